@@ -16,7 +16,7 @@ func InitDB() {
 	var err error
 
 	// 连接SQLite数据库
-	DB, err = gorm.Open(sqlite.Open("../static/database.db"), &gorm.Config{})
+	DB, err = gorm.Open(sqlite.Open(DatabasePath), &gorm.Config{})
 	if err != nil {
 		log.Fatal("数据库连接失败:", err)
 	}
@@ -30,12 +30,41 @@ func InitDB() {
 		&models.FileTag{},
 		&models.FormSchema{},
 		&models.FormRecord{},
+		&models.FormImportJob{},
+		&models.Asset{},
+		&models.FormRecordAsset{},
+		&models.FormRecordRelation{},
+		&models.FormRecordRevision{},
+		&models.FormPublication{},
+		&models.FormSubmission{},
+		&models.ChallengeAttempt{},
+		&models.FormReport{},
+		&models.FormTemplate{},
+		&models.UserGroup{},
+		&models.UserGroupMember{},
+		&models.FormShare{},
+		&models.FormRecordTransition{},
+		&models.FormRecordAssignee{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.UserSession{},
+		&models.PasswordReset{},
+		&models.LoginFailure{},
+		&models.LoginLockout{},
+		&models.UserTwoFactor{},
+		&models.TwoFactorRecoveryCode{},
+		&models.LoginChallenge{},
+		&models.PersonalAccessToken{},
+		&models.Role{},
+		&models.ACLEntry{},
+		&models.OIDCLoginState{},
 	)
 	if err != nil {
 		log.Fatal("数据表迁移失败:", err)
 	}
 
-	// 创建默认管理员账号
+	// 创建内置角色和默认管理员账号
+	createDefaultRoles()
 	createDefaultAdmin()
 
 	log.Println("数据库初始化成功")
@@ -48,6 +77,7 @@ func createDefaultAdmin() {
 	DB.Model(&models.User{}).Where("role = ?", "admin").Count(&adminCount)
 
 	if adminCount > 0 {
+		flagDefaultAdminPassword()
 		return // 已存在管理员，无需创建
 	}
 
@@ -63,6 +93,9 @@ func createDefaultAdmin() {
 		Email:    "admin@material-platform.com",
 		Password: hashedPassword,
 		Role:     "admin",
+
+		// 默认密码公开，首次登录后必须修改
+		MustChangePassword: true,
 	}
 
 	if err := DB.Create(&admin).Error; err != nil {
@@ -73,5 +106,18 @@ func createDefaultAdmin() {
 	log.Println("默认管理员账号创建成功")
 	log.Println("管理员用户名: admin")
 	log.Println("管理员密码: admin123")
-	log.Println("请及时修改默认密码！")
+	log.Println("首次登录后需要修改默认密码")
+}
+
+// flagDefaultAdminPassword 仍在使用默认密码的管理员账号需要在登录后修改密码
+func flagDefaultAdminPassword() {
+	var admin models.User
+	if err := DB.Where("username = ? AND role = ? AND must_change_password = ?", "admin", "admin", false).
+		First(&admin).Error; err != nil {
+		return
+	}
+	if utils.CheckPasswordHash("admin123", admin.Password) {
+		DB.Model(&admin).Update("must_change_password", true)
+		log.Println("管理员账号仍在使用默认密码，登录后需要修改")
+	}
 }
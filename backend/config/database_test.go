@@ -0,0 +1,81 @@
+package config
+
+import (
+	"material-platform/models"
+	"material-platform/utils"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB 使用内存数据库替换 DB，测试结束后恢复
+func useTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+strings.ReplaceAll(t.Name(), "/", "_")+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}); err != nil {
+		t.Fatal(err)
+	}
+	previous := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func TestCreateDefaultAdmin(t *testing.T) {
+	useTestDB(t)
+	createDefaultRoles()
+	createDefaultAdmin()
+
+	var admin models.User
+	if err := DB.Where("username = ?", "admin").First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if admin.Role != models.RoleAdmin || !admin.MustChangePassword {
+		t.Errorf("admin role = %s, must change = %v", admin.Role, admin.MustChangePassword)
+	}
+
+	// 再次启动时不重复创建
+	createDefaultAdmin()
+	var count int64
+	DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("users = %d, want 1", count)
+	}
+}
+
+func TestFlagDefaultAdminPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"仍在使用默认密码", "admin123", true},
+		{"已修改密码", "N3w-secret-pass", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			hash, _ := utils.HashPassword(tt.password)
+			DB.Create(&models.User{Username: "admin", Email: "admin@example.com", Password: hash, Role: models.RoleAdmin})
+
+			// 旧版本创建的管理员没有 must_change_password 标记，启动时检查
+			createDefaultAdmin()
+
+			var admin models.User
+			DB.Where("username = ?", "admin").First(&admin)
+			if admin.MustChangePassword != tt.want {
+				t.Errorf("must change = %v, want %v", admin.MustChangePassword, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envString 读取环境变量，未设置时返回默认值
+func envString(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envInt 读取整数环境变量，未设置或格式错误时返回默认值
+func envInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("环境变量 %s 不是有效的整数，使用默认值 %d", key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// envBool 读取布尔环境变量，未设置或格式错误时返回默认值
+func envBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("环境变量 %s 不是有效的布尔值，使用默认值 %v", key, fallback)
+		return fallback
+	}
+	return b
+}
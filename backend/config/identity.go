@@ -0,0 +1,175 @@
+package config
+
+import (
+	"log"
+	"material-platform/models"
+	"material-platform/utils"
+	"strings"
+	"time"
+)
+
+// LocalRegistrationEnabled 是否允许用户自行注册本地账号
+var LocalRegistrationEnabled = true
+
+// OIDC OpenID Connect 身份提供方，未启用时为 nil
+var OIDC *utils.OIDCProvider
+
+// OIDCDisplayName 登录页面上单点登录按钮显示的名称
+var OIDCDisplayName = "单点登录"
+
+// OIDCStateTTL 发起OIDC授权后完成登录的有效时间
+var OIDCStateTTL = 10 * time.Minute
+
+// LDAP 目录服务，未启用时为 nil
+var LDAP *utils.LDAPAuthenticator
+
+// ExternalDefaultRole 外部身份首次登录时分配的角色，没有匹配的角色映射时使用
+var ExternalDefaultRole = models.RoleUser
+
+// ExternalLinkByEmail 外部身份首次登录时是否关联邮箱相同的本地账号
+var ExternalLinkByEmail = false
+
+// externalMapping 身份提供方的组到本地角色或用户组的映射
+type externalMapping struct {
+	Group  string
+	Target string
+}
+
+var (
+	externalRoleMappings  []externalMapping
+	externalGroupMappings []externalMapping
+)
+
+// InitIdentity 从环境变量加载外部身份提供方设置
+//
+//	LOCAL_REGISTRATION_ENABLED  是否允许注册本地账号，默认 true
+//	OIDC_ENABLED                启用 OpenID Connect 登录
+//	OIDC_ISSUER / OIDC_CLIENT_ID / OIDC_CLIENT_SECRET
+//	OIDC_REDIRECT_URL           身份提供方回调的前端地址，前端将 code 和 state 提交到 /api/auth/oidc/callback
+//	                            前端需与接口同站，发起登录和回调时携带Cookie以校验是同一浏览器发起的登录
+//	OIDC_SCOPES                 空格分隔，默认 "openid profile email groups"
+//	OIDC_USERNAME_CLAIM / OIDC_EMAIL_CLAIM / OIDC_GROUPS_CLAIM  默认 preferred_username、email、groups
+//	OIDC_DISPLAY_NAME           登录按钮显示的名称
+//	LDAP_ENABLED                启用 LDAP 密码验证
+//	LDAP_URL                    如 ldap://ldap.example.com:389
+//	LDAP_START_TLS / LDAP_INSECURE_SKIP_VERIFY
+//	LDAP_BIND_DN / LDAP_BIND_PASSWORD  查找用户的服务账号，为空时匿名查找
+//	LDAP_BASE_DN / LDAP_USER_FILTER    默认过滤条件 (uid=%s)
+//	LDAP_USERNAME_ATTRIBUTE / LDAP_EMAIL_ATTRIBUTE / LDAP_GROUP_ATTRIBUTE  默认 uid、mail、memberOf
+//	LDAP_GROUP_MATCH_RDN        映射时也按组DN第一个RDN的值(如 editors)匹配，默认 false，只匹配完整DN
+//	EXTERNAL_DEFAULT_ROLE       外部账号的默认角色，默认 user
+//	EXTERNAL_ROLE_MAPPING       组到角色的映射，如 "platform-admins=admin;editors=editor"，按顺序取第一个匹配
+//	EXTERNAL_GROUP_MAPPING      组到本地用户组的映射，如 "cn=design,ou=groups,dc=example,dc=com=设计组"
+//	EXTERNAL_LINK_BY_EMAIL      首次登录时关联邮箱相同的本地账号，默认 false；OIDC要求 email_verified 为 true，拥有管理权限的账号不会关联
+func InitIdentity() {
+	LocalRegistrationEnabled = envBool("LOCAL_REGISTRATION_ENABLED", true)
+
+	OIDC = nil
+	if envBool("OIDC_ENABLED", false) {
+		OIDC = &utils.OIDCProvider{
+			Issuer:        envString("OIDC_ISSUER", ""),
+			ClientID:      envString("OIDC_CLIENT_ID", ""),
+			ClientSecret:  envString("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   envString("OIDC_REDIRECT_URL", ""),
+			Scopes:        strings.Fields(envString("OIDC_SCOPES", "openid profile email groups")),
+			UsernameClaim: envString("OIDC_USERNAME_CLAIM", "preferred_username"),
+			EmailClaim:    envString("OIDC_EMAIL_CLAIM", "email"),
+			GroupsClaim:   envString("OIDC_GROUPS_CLAIM", "groups"),
+		}
+		if OIDC.Issuer == "" || OIDC.ClientID == "" || OIDC.RedirectURL == "" {
+			log.Fatal("启用OIDC需要设置 OIDC_ISSUER、OIDC_CLIENT_ID 和 OIDC_REDIRECT_URL")
+		}
+		OIDCDisplayName = envString("OIDC_DISPLAY_NAME", OIDCDisplayName)
+		log.Printf("已启用OIDC登录，身份提供方 %s", OIDC.Issuer)
+	}
+
+	LDAP = nil
+	if envBool("LDAP_ENABLED", false) {
+		LDAP = &utils.LDAPAuthenticator{
+			URL:                envString("LDAP_URL", ""),
+			StartTLS:           envBool("LDAP_START_TLS", false),
+			InsecureSkipVerify: envBool("LDAP_INSECURE_SKIP_VERIFY", false),
+			BindDN:             envString("LDAP_BIND_DN", ""),
+			BindPassword:       envString("LDAP_BIND_PASSWORD", ""),
+			BaseDN:             envString("LDAP_BASE_DN", ""),
+			UserFilter:         envString("LDAP_USER_FILTER", "(uid=%s)"),
+			UsernameAttribute:  envString("LDAP_USERNAME_ATTRIBUTE", "uid"),
+			EmailAttribute:     envString("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			GroupAttribute:     envString("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			MatchGroupRDN:      envBool("LDAP_GROUP_MATCH_RDN", false),
+		}
+		if LDAP.URL == "" || LDAP.BaseDN == "" {
+			log.Fatal("启用LDAP需要设置 LDAP_URL 和 LDAP_BASE_DN")
+		}
+		log.Printf("已启用LDAP登录，目录服务 %s", LDAP.URL)
+	}
+
+	ExternalDefaultRole = envString("EXTERNAL_DEFAULT_ROLE", models.RoleUser)
+	ExternalLinkByEmail = envBool("EXTERNAL_LINK_BY_EMAIL", false)
+	externalRoleMappings = parseExternalMappings("EXTERNAL_ROLE_MAPPING")
+	externalGroupMappings = parseExternalMappings("EXTERNAL_GROUP_MAPPING")
+}
+
+// parseExternalMappings 解析 "组=目标;组=目标" 格式的映射，组可以是包含等号的DN，以最后一个等号分隔
+func parseExternalMappings(key string) []externalMapping {
+	var mappings []externalMapping
+	for _, item := range strings.Split(envString(key, ""), ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i <= 0 || i == len(item)-1 {
+			log.Printf("环境变量 %s 中的映射 %q 格式错误，已忽略", key, item)
+			continue
+		}
+		mappings = append(mappings, externalMapping{
+			Group:  strings.TrimSpace(item[:i]),
+			Target: strings.TrimSpace(item[i+1:]),
+		})
+	}
+	return mappings
+}
+
+// hasExternalGroup 外部身份的组中是否包含指定的组，不区分大小写
+func hasExternalGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExternalRoleMapped 是否配置了组到角色的映射，配置后每次登录都按映射同步角色
+func ExternalRoleMapped() bool {
+	return len(externalRoleMappings) > 0
+}
+
+// ExternalRole 按映射顺序返回第一个匹配的角色，没有匹配时返回默认角色
+func ExternalRole(groups []string) string {
+	for _, m := range externalRoleMappings {
+		if hasExternalGroup(groups, m.Group) {
+			return m.Target
+		}
+	}
+	return ExternalDefaultRole
+}
+
+// ExternalGroups 按映射计算外部身份应属于和不应属于的本地用户组名称
+// 只有出现在映射中的用户组由身份提供方管理，其他用户组的成员关系不受影响
+func ExternalGroups(groups []string) (member []string, other []string) {
+	seen := map[string]bool{}
+	for _, m := range externalGroupMappings {
+		if hasExternalGroup(groups, m.Group) && !seen[m.Target] {
+			seen[m.Target] = true
+			member = append(member, m.Target)
+		}
+	}
+	for _, m := range externalGroupMappings {
+		if !seen[m.Target] {
+			seen[m.Target] = true
+			other = append(other, m.Target)
+		}
+	}
+	return member, other
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"material-platform/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSecretFile 未配置密钥时自动生成的服务端密钥文件名，保存在数据目录中
+const defaultSecretFile = "jwt_secret"
+
+// InitJWTKeys 从环境变量加载JWT签名密钥
+//
+//	JWT_SECRET / JWT_SECRET_FILE  服务端密钥，HS256时用于签名；都未配置时自动生成并保存到数据目录的 jwt_secret
+//	JWT_PREVIOUS_SECRETS          逗号分隔的旧HS256密钥，仅用于验证，轮换密钥时使用
+//	JWT_ALGORITHM                 签名算法：HS256(默认)、RS256、EdDSA
+//	JWT_KEYS_DIR                  非对称密钥目录，每个 .pem 文件为一个密钥，文件名为密钥ID
+//	JWT_ACTIVE_KEY_ID             JWT_KEYS_DIR 中用于签名的密钥ID，其余密钥仅用于验证
+//	JWT_PRIVATE_KEY_FILE          未配置目录时使用的单个私钥文件，JWT_KEY_ID 可指定密钥ID
+func InitJWTKeys() {
+	if err := loadJWTKeys(); err != nil {
+		log.Fatal("JWT密钥加载失败:", err)
+	}
+}
+
+// loadJWTKeys 加载服务端密钥、签名密钥和验证密钥
+func loadJWTKeys() error {
+	for _, env := range []string{"JWT_SECRET_FILE", "JWT_KEYS_DIR", "JWT_PRIVATE_KEY_FILE"} {
+		if err := checkNotPublic(os.Getenv(env)); err != nil {
+			return fmt.Errorf("%s: %v", env, err)
+		}
+	}
+
+	secret, err := loadServerSecret()
+	if err != nil {
+		return err
+	}
+	utils.SetServerSecret(secret)
+
+	var others []*utils.JWTKey
+	for i, previous := range strings.Split(os.Getenv("JWT_PREVIOUS_SECRETS"), ",") {
+		previous = strings.TrimSpace(previous)
+		if previous == "" {
+			continue
+		}
+		key, err := utils.NewHMACKey("", []byte(previous))
+		if err != nil {
+			return fmt.Errorf("JWT_PREVIOUS_SECRETS 第 %d 个密钥无效: %v", i+1, err)
+		}
+		others = append(others, key)
+	}
+
+	algorithm := strings.TrimSpace(os.Getenv("JWT_ALGORITHM"))
+	if algorithm == "" {
+		algorithm = utils.AlgHS256
+	}
+
+	var active *utils.JWTKey
+	switch algorithm {
+	case utils.AlgHS256:
+		if active, err = utils.NewHMACKey(os.Getenv("JWT_KEY_ID"), secret); err != nil {
+			return err
+		}
+	case utils.AlgRS256, utils.AlgEdDSA:
+		var keys []*utils.JWTKey
+		if active, keys, err = loadAsymmetricKeys(); err != nil {
+			return err
+		}
+		if active.Algorithm != algorithm {
+			return fmt.Errorf("签名密钥 %s 的算法为 %s，与 JWT_ALGORITHM 不一致", active.ID, active.Algorithm)
+		}
+		others = append(others, keys...)
+	default:
+		return fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+
+	if err := utils.SetJWTKeys(active, others); err != nil {
+		return err
+	}
+	log.Printf("JWT签名算法 %s，密钥ID %s，验证密钥 %d 个", active.Algorithm, active.ID, len(others)+1)
+	return nil
+}
+
+// loadServerSecret 读取服务端密钥，未配置时读取或生成默认密钥文件
+func loadServerSecret() ([]byte, error) {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret), nil
+	}
+
+	path := os.Getenv("JWT_SECRET_FILE")
+	if path == "" {
+		path = filepath.Join(DataDir, defaultSecretFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			secret, err := utils.RandomToken(32)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+				return nil, err
+			}
+			log.Printf("未配置JWT_SECRET，已生成服务端密钥: %s", path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
+
+// loadAsymmetricKeys 读取非对称密钥，返回签名密钥和其余验证密钥
+func loadAsymmetricKeys() (*utils.JWTKey, []*utils.JWTKey, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, nil, errors.New("RS256/EdDSA 需要配置 JWT_KEYS_DIR 或 JWT_PRIVATE_KEY_FILE")
+		}
+		key, err := loadPEMKeyFile(os.Getenv("JWT_KEY_ID"), path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, nil, nil
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KEY_ID")
+	if activeID == "" {
+		return nil, nil, errors.New("配置 JWT_KEYS_DIR 时需要指定 JWT_ACTIVE_KEY_ID")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var active *utils.JWTKey
+	var others []*utils.JWTKey
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := loadPEMKeyFile(id, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id == activeID {
+			active = key
+		} else {
+			others = append(others, key)
+		}
+	}
+	if active == nil {
+		return nil, nil, fmt.Errorf("JWT_KEYS_DIR 中不存在密钥 %s", activeID)
+	}
+	return active, others, nil
+}
+
+// loadPEMKeyFile 读取PEM格式的密钥文件
+func loadPEMKeyFile(id, path string) (*utils.JWTKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := utils.ParsePEMKey(id, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return key, nil
+}
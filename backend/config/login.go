@@ -0,0 +1,46 @@
+package config
+
+import (
+	"time"
+)
+
+// LoginProtection 登录防暴力破解设置
+type LoginProtection struct {
+	MaxUserFailures int           // 同一账号连续失败次数达到后锁定
+	MaxIPFailures   int           // 同一IP连续失败次数达到后锁定
+	FailureWindow   time.Duration // 超过该时间没有失败则重新计数
+	LockoutDuration time.Duration // 锁定时长
+	DelayAfter      int           // 连续失败超过该次数后，每次尝试需要等待
+	DelayBase       time.Duration // 首次等待时间，之后每次翻倍
+	DelayMax        time.Duration // 等待时间上限
+}
+
+// Login 当前登录防暴力破解设置
+var Login = LoginProtection{
+	MaxUserFailures: 5,
+	MaxIPFailures:   20,
+	FailureWindow:   15 * time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	DelayAfter:      2,
+	DelayBase:       time.Second,
+	DelayMax:        30 * time.Second,
+}
+
+// InitLoginProtection 从环境变量加载登录防暴力破解设置
+//
+//	LOGIN_MAX_USER_FAILURES   同一账号允许的连续失败次数，默认5，0表示不锁定
+//	LOGIN_MAX_IP_FAILURES     同一IP允许的连续失败次数，默认20，0表示不锁定
+//	LOGIN_FAILURE_WINDOW_MINUTES 失败计数的有效时间(分钟)，默认15
+//	LOGIN_LOCKOUT_MINUTES     锁定时长(分钟)，默认15
+//	LOGIN_DELAY_AFTER         连续失败超过该次数后开始要求等待，默认2
+//	LOGIN_DELAY_BASE_SECONDS  首次等待秒数，默认1
+//	LOGIN_DELAY_MAX_SECONDS   最长等待秒数，默认30
+func InitLoginProtection() {
+	Login.MaxUserFailures = envInt("LOGIN_MAX_USER_FAILURES", Login.MaxUserFailures)
+	Login.MaxIPFailures = envInt("LOGIN_MAX_IP_FAILURES", Login.MaxIPFailures)
+	Login.FailureWindow = time.Duration(envInt("LOGIN_FAILURE_WINDOW_MINUTES", int(Login.FailureWindow/time.Minute))) * time.Minute
+	Login.LockoutDuration = time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", int(Login.LockoutDuration/time.Minute))) * time.Minute
+	Login.DelayAfter = envInt("LOGIN_DELAY_AFTER", Login.DelayAfter)
+	Login.DelayBase = time.Duration(envInt("LOGIN_DELAY_BASE_SECONDS", int(Login.DelayBase/time.Second))) * time.Second
+	Login.DelayMax = time.Duration(envInt("LOGIN_DELAY_MAX_SECONDS", int(Login.DelayMax/time.Second))) * time.Second
+}
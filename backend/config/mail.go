@@ -0,0 +1,37 @@
+package config
+
+import (
+	"log"
+	"material-platform/utils"
+)
+
+// InitMailer 从环境变量加载邮件发送驱动
+//
+//	MAIL_DRIVER    log(默认，只写入日志) 或 smtp
+//	MAIL_FROM      发件人地址
+//	SMTP_HOST / SMTP_PORT / SMTP_USERNAME / SMTP_PASSWORD
+//	SMTP_SECURITY  starttls(默认，服务器不支持时不发送)、tls 或 none(明文)
+func InitMailer() {
+	switch driver := envString("MAIL_DRIVER", "log"); driver {
+	case "log":
+		utils.SetMailer(utils.LogMailer{})
+	case "smtp":
+		mailer := &utils.SMTPMailer{
+			Host:     envString("SMTP_HOST", "localhost"),
+			Port:     envInt("SMTP_PORT", 25),
+			Username: envString("SMTP_USERNAME", ""),
+			Password: envString("SMTP_PASSWORD", ""),
+			From:     envString("MAIL_FROM", "noreply@material-platform.com"),
+			Security: envString("SMTP_SECURITY", utils.SMTPSecurityStartTLS),
+		}
+		switch mailer.Security {
+		case utils.SMTPSecurityNone, utils.SMTPSecurityStartTLS, utils.SMTPSecurityTLS:
+		default:
+			log.Fatal("不支持的SMTP_SECURITY: ", mailer.Security)
+		}
+		utils.SetMailer(mailer)
+		log.Printf("邮件发送使用SMTP服务器 %s:%d", mailer.Host, mailer.Port)
+	default:
+		log.Fatal("不支持的MAIL_DRIVER: ", driver)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"log"
+	"material-platform/utils"
+	"time"
+)
+
+// PasswordResetTTL 密码重置链接有效期
+var PasswordResetTTL = 30 * time.Minute
+
+// PasswordResetURL 密码重置页面地址，{token} 替换为重置令牌
+var PasswordResetURL = "http://localhost:3000/reset-password?token={token}"
+
+// InitPasswordPolicy 从环境变量加载密码策略和重置设置
+//
+//	PASSWORD_MIN_LENGTH       最小长度，默认8
+//	PASSWORD_REQUIRE_UPPER    是否必须包含大写字母，默认否
+//	PASSWORD_REQUIRE_LOWER    是否必须包含小写字母，默认否
+//	PASSWORD_REQUIRE_DIGIT    是否必须包含数字，默认是
+//	PASSWORD_REQUIRE_SYMBOL   是否必须包含特殊字符，默认否
+//	PASSWORD_RESET_TTL_MINUTES 重置链接有效期(分钟)，默认30
+//	PASSWORD_RESET_URL        重置页面地址，{token} 替换为重置令牌
+func InitPasswordPolicy() {
+	policy := utils.PasswordPolicy{
+		MinLength:     envInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:  envBool("PASSWORD_REQUIRE_UPPER", false),
+		RequireLower:  envBool("PASSWORD_REQUIRE_LOWER", false),
+		RequireDigit:  envBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol: envBool("PASSWORD_REQUIRE_SYMBOL", false),
+	}
+	if policy.MinLength < 6 {
+		log.Printf("PASSWORD_MIN_LENGTH 不能小于6，已使用6")
+		policy.MinLength = 6
+	}
+	utils.SetPasswordPolicy(policy)
+
+	if minutes := envInt("PASSWORD_RESET_TTL_MINUTES", 30); minutes > 0 {
+		PasswordResetTTL = time.Duration(minutes) * time.Minute
+	}
+	PasswordResetURL = envString("PASSWORD_RESET_URL", PasswordResetURL)
+}
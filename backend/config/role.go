@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"material-platform/models"
+)
+
+// createDefaultRoles 创建内置的管理员和普通用户角色
+func createDefaultRoles() {
+	defaults := []struct {
+		name        string
+		displayName string
+		permissions []string
+	}{
+		{models.RoleAdmin, "管理员", []string{models.PermissionAll}},
+		{models.RoleUser, "普通用户", models.DefaultUserPermissions},
+	}
+
+	for _, d := range defaults {
+		var count int64
+		DB.Model(&models.Role{}).Where("name = ?", d.name).Count(&count)
+		if count > 0 {
+			continue
+		}
+
+		permissions, _ := json.Marshal(d.permissions)
+		role := models.Role{
+			Name:        d.name,
+			DisplayName: d.displayName,
+			Permissions: models.JSON(permissions),
+			IsSystem:    true,
+		}
+		if err := DB.Create(&role).Error; err != nil {
+			log.Printf("创建内置角色 %s 失败: %v", d.name, err)
+		}
+	}
+}
+
+// RolePermissions 读取角色的权限，角色不存在时没有任何权限
+func RolePermissions(name string) models.PermissionSet {
+	var role models.Role
+	if err := DB.Where("name = ?", name).First(&role).Error; err != nil {
+		return models.PermissionSet{}
+	}
+	return role.PermissionSet()
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StaticRoots 对外公开提供的静态文件目录，URL前缀 => 本地目录
+var StaticRoots = map[string]string{
+	"/static": "../static",
+}
+
+// DataDir 数据库和自动生成的密钥等私有数据所在的目录，不能位于公开的静态文件目录中
+var DataDir = "../data"
+
+// DatabasePath SQLite数据库文件
+var DatabasePath = "../data/database.db"
+
+// legacyDatabaseFile 旧版本的数据库位置，位于 /static 下会被公开访问，启动时移动到数据目录
+const legacyDatabaseFile = "../static/database.db"
+
+// InitStorage 从环境变量加载数据目录设置，需要在加载JWT密钥和连接数据库之前调用
+//
+//	DATA_DIR       数据库和自动生成的密钥所在的目录，默认 ../data
+//	DATABASE_PATH  SQLite数据库文件，默认 DATA_DIR/database.db
+func InitStorage() {
+	if err := loadStorage(); err != nil {
+		log.Fatal("数据目录初始化失败:", err)
+	}
+}
+
+// loadStorage 检查数据目录和数据库文件不在公开目录中，并迁移旧位置的数据库
+func loadStorage() error {
+	DataDir = envString("DATA_DIR", "../data")
+	DatabasePath = envString("DATABASE_PATH", filepath.Join(DataDir, "database.db"))
+	for env, path := range map[string]string{"DATA_DIR": DataDir, "DATABASE_PATH": DatabasePath} {
+		if err := checkNotPublic(path); err != nil {
+			return fmt.Errorf("%s: %v", env, err)
+		}
+	}
+
+	for _, dir := range []string{DataDir, filepath.Dir(DatabasePath)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+	return moveLegacyDatabase(legacyDatabaseFile, DatabasePath)
+}
+
+// moveLegacyDatabase 将旧位置的数据库及其日志文件移动到新位置
+// 新位置已有数据库时不覆盖，公开目录中的旧数据库需要管理员确认后删除
+func moveLegacyDatabase(legacy, path string) error {
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("公开目录中仍有旧数据库 %s，数据库已位于 %s，请确认后删除旧文件", legacy, path)
+	}
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		if err := os.Rename(legacy+suffix, path+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("移动旧数据库失败: %w", err)
+		}
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return err
+	}
+	log.Printf("已将数据库从公开目录 %s 移动到 %s", legacy, path)
+	return nil
+}
+
+// checkNotPublic 检查密钥、数据库等文件或目录不在公开的静态文件目录中
+func checkNotPublic(path string) error {
+	if path == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for prefix, dir := range StaticRoots {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s 位于公开的静态文件目录 %s 中", path, prefix)
+		}
+	}
+	return nil
+}
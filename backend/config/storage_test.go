@@ -0,0 +1,73 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckNotPublic(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"", false},
+		{"../data/database.db", false},
+		{"../static-data/database.db", false},
+		{"../static", true},
+		{"../static/database.db", true},
+		{"../static/keys/jwt.pem", true},
+		{"../data/../static/database.db", true},
+	}
+	for _, tt := range tests {
+		if err := checkNotPublic(tt.path); (err != nil) != tt.wantErr {
+			t.Errorf("checkNotPublic(%q) error = %v, want error %v", tt.path, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadStorageRejectsPublicDatabase(t *testing.T) {
+	t.Cleanup(func() { DataDir, DatabasePath = "../data", "../data/database.db" })
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("DATABASE_PATH", "../static/database.db")
+	if err := loadStorage(); err == nil || !strings.Contains(err.Error(), "DATABASE_PATH") {
+		t.Errorf("loadStorage() error = %v, want DATABASE_PATH rejected", err)
+	}
+}
+
+func TestMoveLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "static", "database.db")
+	path := filepath.Join(dir, "data", "database.db")
+	os.MkdirAll(filepath.Dir(legacy), 0755)
+	os.MkdirAll(filepath.Dir(path), 0700)
+	os.WriteFile(legacy, []byte("db"), 0644)
+	os.WriteFile(legacy+"-wal", []byte("wal"), 0644)
+
+	if err := moveLegacyDatabase(legacy, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{legacy, legacy + "-wal"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", name)
+		}
+	}
+	if data, _ := os.ReadFile(path + "-wal"); string(data) != "wal" {
+		t.Errorf("wal = %q, want moved", data)
+	}
+
+	// 新位置已有数据库时拒绝启动，不覆盖也不删除
+	os.WriteFile(legacy, []byte("old"), 0644)
+	if err := moveLegacyDatabase(legacy, path); err == nil {
+		t.Error("want error when both databases exist")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "db" {
+		t.Errorf("database = %q, want unchanged", data)
+	}
+
+	// 没有旧数据库时不做任何操作
+	if err := moveLegacyDatabase(filepath.Join(dir, "missing.db"), path); err != nil {
+		t.Error(err)
+	}
+}
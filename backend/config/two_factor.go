@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// TwoFactorIssuer 身份验证器应用中显示的服务名称
+var TwoFactorIssuer = "Material Platform"
+
+// TwoFactorChallengeTTL 输入密码后完成两步验证的有效时间
+var TwoFactorChallengeTTL = 5 * time.Minute
+
+// TwoFactorReauthWindow 外部身份账号没有本地密码，登录后在此时间内才能设置两步验证
+var TwoFactorReauthWindow = 10 * time.Minute
+
+// twoFactorRequiredRoles 必须启用两步验证的角色
+var twoFactorRequiredRoles = map[string]bool{}
+
+// InitTwoFactor 从环境变量加载两步验证设置
+//
+//	TWO_FACTOR_ISSUER                 身份验证器中显示的服务名称
+//	TWO_FACTOR_REQUIRED_ROLES         逗号分隔的必须启用两步验证的角色，如 admin
+//	TWO_FACTOR_CHALLENGE_TTL_MINUTES  登录时输入验证码的有效时间(分钟)，默认5
+//	TWO_FACTOR_REAUTH_MINUTES         外部身份账号登录后可以设置两步验证的时间(分钟)，默认10
+func InitTwoFactor() {
+	TwoFactorIssuer = envString("TWO_FACTOR_ISSUER", TwoFactorIssuer)
+	if minutes := envInt("TWO_FACTOR_CHALLENGE_TTL_MINUTES", 5); minutes > 0 {
+		TwoFactorChallengeTTL = time.Duration(minutes) * time.Minute
+	}
+	if minutes := envInt("TWO_FACTOR_REAUTH_MINUTES", 10); minutes > 0 {
+		TwoFactorReauthWindow = time.Duration(minutes) * time.Minute
+	}
+
+	twoFactorRequiredRoles = map[string]bool{}
+	for _, role := range strings.Split(envString("TWO_FACTOR_REQUIRED_ROLES", ""), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			twoFactorRequiredRoles[role] = true
+		}
+	}
+}
+
+// TwoFactorRequired 角色是否必须启用两步验证
+func TwoFactorRequired(role string) bool {
+	return twoFactorRequiredRoles[role]
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"log"
+	"material-platform/utils"
+	"strings"
+)
+
+// WebhookAllowedHosts 允许Webhook访问的内网主机，默认为空，即只能访问公网地址
+var WebhookAllowedHosts *utils.HostAllowlist
+
+// InitWebhook 从环境变量加载Webhook设置
+//
+//	WEBHOOK_ALLOWED_HOSTS  逗号分隔的允许访问的内网主机名、IP或CIDR，如 hooks.internal,10.0.5.0/24
+func InitWebhook() {
+	allowlist, invalid := utils.ParseHostAllowlist(envString("WEBHOOK_ALLOWED_HOSTS", ""))
+	if len(invalid) > 0 {
+		log.Printf("环境变量 WEBHOOK_ALLOWED_HOSTS 中的 %s 格式错误，已忽略", strings.Join(invalid, ", "))
+	}
+	WebhookAllowedHosts = allowlist
+}
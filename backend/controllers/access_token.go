@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokenResources 个人访问令牌可授权的资源，与路由分组的权限检查对应
+// admin 只有可以访问管理接口的用户可以授权
+var accessTokenResources = []string{"profile", "files", "forms", "webhooks", "admin"}
+
+// adminPermissions 管理接口对应的权限，拥有其中任一权限即可访问部分管理接口
+var adminPermissions = []string{models.PermUserManage, models.PermGroupManage, models.PermRoleManage, models.PermSystemManage}
+
+const (
+	accessTokenDefaultDays = 30  // 默认有效期(天)
+	accessTokenMaxDays     = 365 // 最长有效期(天)
+	accessTokenMaxActive   = 50  // 每个用户有效令牌的数量上限
+)
+
+// accessTokenRequest 创建个人访问令牌的请求
+type accessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"` // 为空时默认30天
+}
+
+// accessTokenScopes 全部可授权的权限范围
+func accessTokenScopes() []string {
+	scopes := make([]string, 0, len(accessTokenResources)*2)
+	for _, resource := range accessTokenResources {
+		scopes = append(scopes, resource+":read", resource+":write")
+	}
+	return scopes
+}
+
+// GetAccessTokenScopes 获取可授权的权限范围
+func GetAccessTokenScopes(c *gin.Context) {
+	utils.SuccessResponse(c, accessTokenScopes())
+}
+
+// GetAccessTokens 获取当前用户未撤销的个人访问令牌
+func GetAccessTokens(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var tokens []models.PersonalAccessToken
+	if err := config.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("id DESC").
+		Find(&tokens).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, tokens)
+}
+
+// CreateAccessToken 创建个人访问令牌，令牌原文只在创建时返回一次
+func CreateAccessToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req accessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	scopes := uniqueStrings(req.Scopes)
+	if len(scopes) == 0 {
+		utils.ErrorResponse(c, 400, "至少需要授予一个权限")
+		return
+	}
+	canAdmin := false
+	for _, permission := range adminPermissions {
+		canAdmin = canAdmin || hasPermission(c, permission)
+	}
+	allowed := accessTokenScopes()
+	for _, scope := range scopes {
+		if !containsString(allowed, scope) {
+			utils.ErrorResponse(c, 400, "不支持的权限: "+scope)
+			return
+		}
+		if strings.HasPrefix(scope, "admin:") && !canAdmin {
+			utils.ForbiddenResponse(c, "没有管理权限，不能授予管理接口的访问权限")
+			return
+		}
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = accessTokenDefaultDays
+	}
+	if days < 1 || days > accessTokenMaxDays {
+		utils.ErrorResponse(c, 400, "有效期必须在 1 到 "+strconv.Itoa(accessTokenMaxDays)+" 天之间")
+		return
+	}
+
+	var active int64
+	config.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Count(&active)
+	if active >= accessTokenMaxActive {
+		utils.ErrorResponse(c, 400, "有效的访问令牌数量已达上限，请先撤销不用的令牌")
+		return
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成令牌失败")
+		return
+	}
+	token := models.AccessTokenPrefix + secret
+
+	scopesJSON, _ := json.Marshal(scopes)
+	record := models.PersonalAccessToken{
+		UserID:    userID.(uint),
+		Name:      strings.TrimSpace(req.Name),
+		TokenHash: utils.HashToken(token),
+		Prefix:    token[:len(models.AccessTokenPrefix)+8],
+		Scopes:    models.JSON(scopesJSON),
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	if err := config.DB.Create(&record).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建令牌失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"token":        token,
+		"access_token": record,
+		"message":      "令牌只显示一次，请妥善保存",
+	})
+}
+
+// RevokeAccessToken 撤销当前用户的个人访问令牌
+func RevokeAccessToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result := config.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.ServerErrorResponse(c, "撤销失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "访问令牌不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "访问令牌已撤销"})
+}
+
+// GetAllAccessTokens 获取全部个人访问令牌（管理员功能），可按用户筛选
+func GetAllAccessTokens(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := config.DB.Model(&models.PersonalAccessToken{})
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if c.Query("active") == "1" {
+		query = query.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var tokens []models.PersonalAccessToken
+	if err := query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&tokens).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"list":       tokens,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// RevokeAccessTokenByAdmin 撤销任意个人访问令牌（管理员功能）
+func RevokeAccessTokenByAdmin(c *gin.Context) {
+	result := config.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND revoked_at IS NULL", c.Param("id")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.ServerErrorResponse(c, "撤销失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "访问令牌不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "访问令牌已撤销"})
+}
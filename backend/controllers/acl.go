@@ -0,0 +1,361 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// aclEntryRequest 访问控制条目的请求参数，授权对象创建后不能修改
+type aclEntryRequest struct {
+	UserID     *uint  `json:"user_id"`
+	Username   string `json:"username"` // 也可按用户名或邮箱指定用户
+	GroupID    *uint  `json:"group_id"`
+	Permission string `json:"permission" binding:"required"` // read、write、manage
+}
+
+// deleteACLEntries 删除对象的访问控制条目
+func deleteACLEntries(tx *gorm.DB, objectType string, objectIDs ...uint) error {
+	if len(objectIDs) == 0 {
+		return nil
+	}
+	return tx.Where("object_type = ? AND object_id IN ?", objectType, objectIDs).Delete(&models.ACLEntry{}).Error
+}
+
+// canManageCategoryACL 当前用户是否可以管理分类的访问控制条目：
+// 有管理全部文件的权限、是所属用户组的组管理员，或通过分类及其上级分类的访问控制条目拥有管理权限
+func canManageCategoryACL(c *gin.Context, category *models.Category) (bool, error) {
+	userID, _ := c.Get("user_id")
+	if hasPermission(c, models.PermFileManageAny) || category.GroupID != nil && isGroupAdmin(c, *category.GroupID) {
+		return true, nil
+	}
+	_, categoryIDs, err := aclObjectIDs(userID.(uint), fileAccessManage)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range categoryIDs {
+		if id == category.ID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findACLObject 查找访问控制的对象，要求当前用户可以管理其访问控制条目，查找失败时直接写入错误响应
+// 文件需要管理权限，分类的要求见 canManageCategoryACL
+func findACLObject(c *gin.Context, objectType string, objectID interface{}) (uint, bool) {
+	if objectType == models.ACLObjectFile {
+		var file models.File
+		query := config.DB.Where("id = ? AND is_deleted = ?", objectID, false)
+		if err := scopeFiles(c, query, fileAccessManage).First(&file).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				utils.NotFoundResponse(c, "文件不存在")
+				return 0, false
+			}
+			utils.ServerErrorResponse(c, "数据库查询失败")
+			return 0, false
+		}
+		return file.ID, true
+	}
+
+	var category models.Category
+	if err := scopeCategories(c, config.DB).First(&category, objectID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "分类不存在")
+			return 0, false
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return 0, false
+	}
+	allowed, err := canManageCategoryACL(c, &category)
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return 0, false
+	}
+	if !allowed {
+		utils.ForbiddenResponse(c, "没有管理该分类访问控制的权限")
+		return 0, false
+	}
+	return category.ID, true
+}
+
+// findACLEntry 查找访问控制条目，要求当前用户可以管理所属对象的访问控制，查找失败时直接写入错误响应
+func findACLEntry(c *gin.Context) (*models.ACLEntry, bool) {
+	var entry models.ACLEntry
+	if err := config.DB.First(&entry, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "访问控制条目不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+
+	if _, ok := findACLObject(c, entry.ObjectType, entry.ObjectID); !ok {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// getACLEntries 获取对象的访问控制条目
+func getACLEntries(c *gin.Context, objectType string) {
+	objectID, ok := findACLObject(c, objectType, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var entries []models.ACLEntry
+	if err := config.DB.Where("object_type = ? AND object_id = ?", objectType, objectID).
+		Preload("User").Preload("Group").
+		Order("created_at ASC").
+		Find(&entries).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, entries)
+}
+
+// createACLEntry 为对象添加访问控制条目，授权给用户或用户组
+func createACLEntry(c *gin.Context, objectType string) {
+	userID, _ := c.Get("user_id")
+
+	var req aclEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if _, ok := aclLevels[req.Permission]; !ok {
+		utils.ErrorResponse(c, 400, "无效的权限")
+		return
+	}
+
+	objectID, ok := findACLObject(c, objectType, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	entry := models.ACLEntry{ObjectType: objectType, ObjectID: objectID, Permission: req.Permission, CreatedBy: userID.(uint)}
+	query := config.DB.Model(&models.ACLEntry{}).Where("object_type = ? AND object_id = ?", objectType, objectID)
+
+	switch {
+	case req.GroupID != nil && (req.UserID != nil || req.Username != ""):
+		utils.ErrorResponse(c, 400, "只能指定用户或用户组中的一个")
+		return
+	case req.GroupID != nil:
+		var group models.UserGroup
+		if err := config.DB.First(&group, *req.GroupID).Error; err != nil {
+			utils.ErrorResponse(c, 400, "用户组不存在")
+			return
+		}
+		entry.GroupID = &group.ID
+		query = query.Where("group_id = ?", group.ID)
+	case req.UserID != nil || req.Username != "":
+		var user models.User
+		userQuery := config.DB.Model(&models.User{})
+		if req.UserID != nil {
+			userQuery = userQuery.Where("id = ?", *req.UserID)
+		} else {
+			userQuery = userQuery.Where("username = ? OR email = ?", req.Username, req.Username)
+		}
+		if err := userQuery.First(&user).Error; err != nil {
+			utils.ErrorResponse(c, 400, "用户不存在")
+			return
+		}
+		entry.UserID = &user.ID
+		query = query.Where("user_id = ?", user.ID)
+	default:
+		utils.ErrorResponse(c, 400, "请指定授权的用户或用户组")
+		return
+	}
+
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "已授权给该对象，请修改现有的访问控制条目")
+		return
+	}
+
+	if err := config.DB.Create(&entry).Error; err != nil {
+		utils.ServerErrorResponse(c, "授权失败")
+		return
+	}
+
+	config.DB.Preload("User").Preload("Group").First(&entry, entry.ID)
+
+	utils.SuccessResponse(c, entry)
+}
+
+// GetFileACL 获取文件的访问控制条目
+func GetFileACL(c *gin.Context) {
+	getACLEntries(c, models.ACLObjectFile)
+}
+
+// CreateFileACL 为文件添加访问控制条目
+func CreateFileACL(c *gin.Context) {
+	createACLEntry(c, models.ACLObjectFile)
+}
+
+// GetCategoryACL 获取分类的访问控制条目
+func GetCategoryACL(c *gin.Context) {
+	getACLEntries(c, models.ACLObjectCategory)
+}
+
+// CreateCategoryACL 为分类添加访问控制条目，对分类及其子分类中的文件生效
+func CreateCategoryACL(c *gin.Context) {
+	createACLEntry(c, models.ACLObjectCategory)
+}
+
+// UpdateACLEntry 修改访问控制条目的权限
+func UpdateACLEntry(c *gin.Context) {
+	var req struct {
+		Permission string `json:"permission" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if _, ok := aclLevels[req.Permission]; !ok {
+		utils.ErrorResponse(c, 400, "无效的权限")
+		return
+	}
+
+	entry, ok := findACLEntry(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(entry).Update("permission", req.Permission).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	config.DB.Preload("User").Preload("Group").First(entry, entry.ID)
+
+	utils.SuccessResponse(c, entry)
+}
+
+// DeleteACLEntry 删除访问控制条目
+func DeleteACLEntry(c *gin.Context) {
+	entry, ok := findACLEntry(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(entry).Error; err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已取消授权"})
+}
+
+// findPermissionSubject 查找查看有效权限的目标用户，默认为当前用户
+// 查看其他用户需要可以管理对象的访问控制或拥有管理用户的权限，查找失败时直接写入错误响应
+func findPermissionSubject(c *gin.Context, objectType string) (*models.User, bool) {
+	userID, _ := c.Get("user_id")
+
+	subjectID := c.Query("user_id")
+	if subjectID == "" || subjectID == strconv.FormatUint(uint64(userID.(uint)), 10) {
+		var user models.User
+		if err := config.DB.First(&user, userID).Error; err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return nil, false
+		}
+		return &user, true
+	}
+
+	if !hasPermission(c, models.PermUserManage) {
+		if _, ok := findACLObject(c, objectType, c.Param("id")); !ok {
+			return nil, false
+		}
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, subjectID).Error; err != nil {
+		utils.ErrorResponse(c, 400, "用户不存在")
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetFilePermissions 获取用户对文件的有效权限及其来源，user_id 为空时为当前用户
+func GetFilePermissions(c *gin.Context) {
+	user, ok := findPermissionSubject(c, models.ACLObjectFile)
+	if !ok {
+		return
+	}
+
+	var file models.File
+	if err := config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false).First(&file).Error; err != nil {
+		utils.NotFoundResponse(c, "文件不存在")
+		return
+	}
+	// 查看自己的权限时，无权查看的文件视为不存在
+	level, sources, err := effectiveFileAccess(&file, user)
+	if err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+	currentUserID, _ := c.Get("user_id")
+	if user.ID == currentUserID.(uint) && level < fileAccessView {
+		utils.NotFoundResponse(c, "文件不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"user_id":      user.ID,
+		"object_type":  models.ACLObjectFile,
+		"object_id":    file.ID,
+		"permission":   fileAccessName(level),
+		"can_read":     level >= fileAccessView,
+		"can_write":    level >= fileAccessEdit,
+		"can_manage":   level >= fileAccessManage,
+		"can_transfer": level >= fileAccessOwner,
+		"sources":      sources,
+	})
+}
+
+// GetCategoryPermissions 获取用户对分类中文件的有效权限及其来源，user_id 为空时为当前用户
+// 文件自身的所有者、用户组和访问控制条目可能授予更高的权限
+func GetCategoryPermissions(c *gin.Context) {
+	user, ok := findPermissionSubject(c, models.ACLObjectCategory)
+	if !ok {
+		return
+	}
+
+	var category models.Category
+	if err := config.DB.First(&category, c.Param("id")).Error; err != nil {
+		utils.NotFoundResponse(c, "分类不存在")
+		return
+	}
+	level, sources, err := effectiveCategoryAccess(&category, user)
+	if err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	// 公共分类和所在用户组的分类可见，但不授予其中文件的权限
+	visible := level >= fileAccessView || category.GroupID == nil || groupMemberRole(*category.GroupID, user.ID) != ""
+	currentUserID, _ := c.Get("user_id")
+	if user.ID == currentUserID.(uint) && !visible {
+		utils.NotFoundResponse(c, "分类不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"user_id":     user.ID,
+		"object_type": models.ACLObjectCategory,
+		"object_id":   category.ID,
+		"visible":     visible,
+		"permission":  fileAccessName(level),
+		"can_read":    level >= fileAccessView,
+		"can_write":   level >= fileAccessEdit,
+		"can_manage":  level >= fileAccessManage,
+		"sources":     sources,
+	})
+}
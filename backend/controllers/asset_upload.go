@@ -1,25 +1,43 @@
 package controllers
 
 import (
+	"fmt"
 	"io"
+	"material-platform/config"
+	"material-platform/models"
 	"material-platform/utils"
+	"mime"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// assetLinkTTL 响应中资源链接的最短有效期，过期时间按小时对齐，使同一资源的链接在一段时间内不变、可被浏览器缓存
+	assetLinkTTL = time.Hour
+	// assetExportLinkTTL 导出文件中资源链接的有效期
+	assetExportLinkTTL = 7 * 24 * time.Hour
 )
 
 // AssetUploadResponse 资源上传响应结构
 type AssetUploadResponse struct {
-	URL      string `json:"url"`      // 相对路径URL
-	FileName string `json:"filename"` // 文件名
-	FileSize int64  `json:"filesize"` // 文件大小
+	ID       uint   `json:"id"`        // 资源ID，文件字段中保存该ID
+	URL      string `json:"url"`       // 带签名的访问链接
+	FileName string `json:"filename"`  // 文件名
+	FileSize int64  `json:"filesize"`  // 文件大小
+	MimeType string `json:"mime_type"` // MIME类型
 }
 
 // UploadAsset 通用资源上传接口
 // 用于表单字段的文件上传，与文件管理模块完全独立
 func UploadAsset(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
 	// 获取上传的文件
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
@@ -34,11 +52,33 @@ func UploadAsset(c *gin.Context) {
 		return
 	}
 
+	// 计算文件哈希
+	_, sha256Hash, err := utils.GetFileHash(file)
+	if err != nil {
+		utils.ServerErrorResponse(c, "文件哈希计算失败")
+		return
+	}
+
+	// 同一用户重复上传相同内容时直接复用已有资源
+	var existing models.Asset
+	if err := config.DB.Where("sha256_hash = ? AND user_id = ?", sha256Hash, userID).First(&existing).Error; err == nil {
+		if _, statErr := os.Stat(existing.FilePath); statErr == nil {
+			utils.SuccessResponse(c, newAssetUploadResponse(existing))
+			return
+		}
+	}
+
 	// 生成文件名和路径
 	fileName := utils.GenerateFileName(header.Filename)
+	mimeType := utils.GetMimeType(header.Filename)
+	fileType := utils.GetFileType(mimeType)
+	if modelFileType := utils.GetFileTypeByExtension(header.Filename); modelFileType != "" {
+		fileType = modelFileType
+	}
 
 	// 创建资源上传目录（与文件管理模块的uploads目录分开）
-	uploadDir := filepath.Join("../assets", time.Now().Format("2006/01/02"))
+	dateDir := time.Now().Format("2006/01/02")
+	uploadDir := filepath.Join("../assets", dateDir)
 	if err := utils.EnsureDir(uploadDir); err != nil {
 		utils.ServerErrorResponse(c, "创建上传目录失败")
 		return
@@ -60,13 +100,186 @@ func UploadAsset(c *gin.Context) {
 		return
 	}
 
-	// 生成相对路径URL（用于前端访问）
-	relativeURL := "/assets/" + time.Now().Format("2006/01/02") + "/" + fileName
+	// 创建资源记录，访问路径包含资源ID，保存后再写入
+	asset := models.Asset{
+		OriginalName: header.Filename,
+		FileName:     fileName,
+		FilePath:     filePath,
+		FileSize:     header.Size,
+		FileType:     fileType,
+		MimeType:     mimeType,
+		SHA256Hash:   sha256Hash,
+		UserID:       userID.(uint),
+	}
+
+	if err := config.DB.Create(&asset).Error; err != nil {
+		os.Remove(filePath)
+		utils.ServerErrorResponse(c, "资源记录保存失败")
+		return
+	}
+	config.DB.Model(&asset).Update("url", assetPath(asset.ID))
 
 	// 返回文件信息
-	utils.SuccessResponse(c, AssetUploadResponse{
-		URL:      relativeURL,
-		FileName: fileName,
-		FileSize: header.Size,
+	utils.SuccessResponse(c, newAssetUploadResponse(asset))
+}
+
+// assetPath 资源文件的访问路径，需要登录或带签名访问
+func assetPath(assetID uint) string {
+	return fmt.Sprintf("/api/assets/%d/content", assetID)
+}
+
+// assetLink 生成资源文件的带签名链接，至少在ttl内有效
+func assetLink(assetID uint, ttl time.Duration) string {
+	expires := time.Now().Truncate(time.Hour).Add(ttl + time.Hour).Unix()
+	return fmt.Sprintf("%s?expires=%d&signature=%s", assetPath(assetID), expires, utils.SignAssetLink(assetID, expires))
+}
+
+// canViewAsset 上传者、有查看全部资源权限的用户，以及可以查看引用该资源的记录字段的用户可以查看资源
+func canViewAsset(c *gin.Context, asset *models.Asset) bool {
+	userID, _ := c.Get("user_id")
+	if asset.UserID == userID.(uint) || hasPermission(c, models.PermFileReadAny) {
+		return true
+	}
+
+	var links []models.FormRecordAsset
+	config.DB.Where("asset_id = ?", asset.ID).Find(&links)
+	manageAny := hasPermission(c, models.PermFormManageAny)
+	for _, link := range links {
+		var record models.FormRecord
+		if err := config.DB.Preload("Schema").Where("id = ? AND is_deleted = ?", link.RecordID, false).First(&record).Error; err != nil {
+			continue
+		}
+		perm, err := loadFormPermission(&record.Schema, userID.(uint), manageAny)
+		if err != nil || !hasFormRole(perm, models.FormRoleViewer) || fieldAccess(perm, link.FieldKey) == models.FieldAccessHidden {
+			continue
+		}
+		var count int64
+		scopeRecordQuery(config.DB.Model(&models.FormRecord{}).Where("form_records.id = ?", record.ID), perm).Count(&count)
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// findViewableAsset 查找当前用户可以查看的资源，查找失败时直接写入错误响应
+func findViewableAsset(c *gin.Context) (*models.Asset, bool) {
+	var asset models.Asset
+	if err := config.DB.First(&asset, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "资源不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	if !canViewAsset(c, &asset) {
+		utils.NotFoundResponse(c, "资源不存在")
+		return nil, false
+	}
+	return &asset, true
+}
+
+// GetAsset 获取资源信息，返回的链接带签名，可直接用于预览
+func GetAsset(c *gin.Context) {
+	asset, ok := findViewableAsset(c)
+	if !ok {
+		return
+	}
+
+	asset.URL = assetLink(asset.ID, assetLinkTTL)
+	utils.SuccessResponse(c, asset)
+}
+
+// inlineAssetTypes 可以在页面中直接显示的资源类型，其他类型(包括可以执行脚本的SVG、HTML)一律作为附件下载
+var inlineAssetTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// GetAssetContent 获取资源文件内容，需要登录且可以查看该资源，或使用响应中带签名的链接
+func GetAssetContent(c *gin.Context) {
+	var asset *models.Asset
+	if signature := c.Query("signature"); signature != "" {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil || !utils.VerifyAssetLink(uint(id), expires, signature) {
+			utils.ForbiddenResponse(c, "链接无效或已过期")
+			return
+		}
+		asset = &models.Asset{}
+		if err := config.DB.First(asset, id).Error; err != nil {
+			utils.NotFoundResponse(c, "资源不存在")
+			return
+		}
+	} else {
+		if _, exists := c.Get("user_id"); !exists {
+			utils.UnauthorizedResponse(c, "请先登录")
+			return
+		}
+		var ok bool
+		if asset, ok = findViewableAsset(c); !ok {
+			return
+		}
+	}
+
+	if _, err := os.Stat(asset.FilePath); err != nil {
+		utils.NotFoundResponse(c, "资源不存在")
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if inlineAssetTypes[strings.ToLower(asset.MimeType)] {
+		c.Header("Content-Type", asset.MimeType)
+	} else {
+		contentType := asset.MimeType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": asset.OriginalName}))
+	}
+	c.File(asset.FilePath)
+}
+
+// CleanupOrphanAssets 清理未被任何记录引用的资源（管理员功能）
+func CleanupOrphanAssets(c *gin.Context) {
+	// 只清理上传超过一定时间的资源，避免删除刚上传、尚未保存到记录中的文件
+	olderThan, err := time.ParseDuration(c.DefaultQuery("older_than", "24h"))
+	if err != nil || olderThan <= 0 {
+		olderThan = 24 * time.Hour
+	}
+
+	var assets []models.Asset
+	cutoff := time.Now().Add(-olderThan)
+	if err := config.DB.Where("ref_count <= 0 AND created_at < ?", cutoff).Find(&assets).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	var paths []string
+	for _, asset := range assets {
+		if err := config.DB.Delete(&asset).Error; err == nil {
+			paths = append(paths, asset.FilePath)
+		}
+	}
+	removeAssetFiles(paths)
+
+	utils.SuccessResponse(c, gin.H{
+		"message":       "清理完成",
+		"deleted_count": len(paths),
 	})
 }
+
+// newAssetUploadResponse 构建资源上传响应
+func newAssetUploadResponse(asset models.Asset) AssetUploadResponse {
+	return AssetUploadResponse{
+		ID:       asset.ID,
+		URL:      assetLink(asset.ID, assetLinkTTL),
+		FileName: asset.FileName,
+		FileSize: asset.FileSize,
+		MimeType: asset.MimeType,
+	}
+}
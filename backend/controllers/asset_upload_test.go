@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"fmt"
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"material-platform/utils"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createTestAsset 创建资源记录，内容写入临时目录
+func createTestAsset(t *testing.T, name, mimeType, content string, userID uint) *models.Asset {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "asset")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	asset := &models.Asset{OriginalName: name, FileName: "asset", FilePath: path, FileSize: int64(len(content)),
+		MimeType: mimeType, UserID: userID}
+	if err := config.DB.Create(asset).Error; err != nil {
+		t.Fatal(err)
+	}
+	return asset
+}
+
+func TestGetAssetContentHeaders(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newTestRouter()
+	r.GET("/api/assets/:id/content", middlewares.OptionalAuthMiddleware(), GetAssetContent)
+	owner := createTestUser(t, "owner", models.RoleUser, "owner-pass-1")
+
+	tests := []struct {
+		name     string
+		mimeType string
+		content  string
+		inline   bool
+	}{
+		{"photo.png", "image/png", "\x89PNG\r\n\x1a\n", true},
+		{"photo.jpg", "image/jpeg", "\xff\xd8\xff", true},
+		{"anim.gif", "image/gif", "GIF89a", true},
+		{"photo.webp", "image/webp", "RIFF", true},
+		{"icon.svg", "image/svg+xml", `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`, false},
+		{"page.html", "text/html", "<script>alert(1)</script>", false},
+		{"data.txt", "text/plain", "<script>alert(1)</script>", false},
+		{"报告.pdf", "application/pdf", "%PDF-1.4", false},
+		{"unknown", "", "<html></html>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := createTestAsset(t, tt.name, tt.mimeType, tt.content, owner.ID)
+			resp := doRequest(t, r, http.MethodGet, assetLink(asset.ID, assetLinkTTL), "", nil)
+			if resp.Status != http.StatusOK {
+				t.Fatalf("status = %d %s", resp.Status, resp.Message)
+			}
+			if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", got)
+			}
+			disposition, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+			if tt.inline {
+				if disposition != "" || resp.Header.Get("Content-Type") != tt.mimeType {
+					t.Errorf("Content-Type = %q, Content-Disposition = %q", resp.Header.Get("Content-Type"), resp.Header.Get("Content-Disposition"))
+				}
+				return
+			}
+			if disposition != "attachment" || params["filename"] != tt.name {
+				t.Errorf("Content-Disposition = %q", resp.Header.Get("Content-Disposition"))
+			}
+			if resp.Header.Get("Content-Type") == "" {
+				t.Error("missing Content-Type")
+			}
+		})
+	}
+}
+
+func TestGetAssetContentSignedLink(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newTestRouter()
+	r.GET("/api/assets/:id/content", middlewares.OptionalAuthMiddleware(), GetAssetContent)
+	owner := createTestUser(t, "owner", models.RoleUser, "owner-pass-1")
+	other := createTestUser(t, "other", models.RoleUser, "other-pass-1")
+	asset := createTestAsset(t, "photo.png", "image/png", "\x89PNG\r\n\x1a\n", owner.ID)
+	another := createTestAsset(t, "other.png", "image/png", "\x89PNG\r\n\x1a\n", owner.ID)
+
+	past := time.Now().Add(-time.Minute).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+	path := assetPath(asset.ID)
+	ownerToken, _ := loginAs(t, owner)
+	otherToken, _ := loginAs(t, other)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"带签名的链接", assetLink(asset.ID, assetLinkTTL), "", http.StatusOK},
+		{"已过期", fmt.Sprintf("%s?expires=%d&signature=%s", path, past, utils.SignAssetLink(asset.ID, past)), "", http.StatusForbidden},
+		{"延长有效期", fmt.Sprintf("%s?expires=%d&signature=%s", path, future+1, utils.SignAssetLink(asset.ID, future)), "", http.StatusForbidden},
+		{"用于其他资源", fmt.Sprintf("%s?expires=%d&signature=%s", assetPath(another.ID), future, utils.SignAssetLink(asset.ID, future)), "", http.StatusForbidden},
+		{"未登录且没有签名", path, "", http.StatusUnauthorized},
+		{"上传者", path, ownerToken, http.StatusOK},
+		{"无权查看的用户", path, otherToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp := doRequest(t, r, http.MethodGet, tt.path, tt.token, nil); resp.Status != tt.wantStatus {
+			t.Errorf("%s: status = %d %s, want %d", tt.name, resp.Status, resp.Message, tt.wantStatus)
+		}
+	}
+}
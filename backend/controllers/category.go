@@ -16,15 +16,23 @@ func GetCategories(c *gin.Context) {
 	// 支持树形结构和平铺结构
 	treeMode := c.Query("tree") == "true"
 
+	// 只能看到公共分类和所在用户组的分类
+	query := scopeCategories(c, config.DB)
+	if groupID := c.Query("group_id"); groupID != "" {
+		query = query.Where("group_id = ?", groupID)
+	}
+
 	if treeMode {
 		// 获取根分类及其子分类
-		if err := config.DB.Where("parent_id IS NULL").Preload("Children").Find(&categories).Error; err != nil {
+		if err := query.Where("parent_id IS NULL").Preload("Children", func(db *gorm.DB) *gorm.DB {
+			return scopeCategories(c, db)
+		}).Find(&categories).Error; err != nil {
 			utils.ServerErrorResponse(c, "数据库查询失败")
 			return
 		}
 	} else {
 		// 获取所有分类（平铺）
-		if err := config.DB.Preload("Parent").Find(&categories).Error; err != nil {
+		if err := query.Preload("Parent").Find(&categories).Error; err != nil {
 			utils.ServerErrorResponse(c, "数据库查询失败")
 			return
 		}
@@ -42,6 +50,12 @@ func CreateCategory(c *gin.Context) {
 		return
 	}
 
+	// 用户组的分类只有组管理员可以创建
+	if category.GroupID != nil && !isGroupAdmin(c, *category.GroupID) {
+		utils.ForbiddenResponse(c, "只有组管理员可以创建用户组的分类")
+		return
+	}
+
 	// 检查分类名称是否已存在（同一父级下）
 	var existingCategory models.Category
 	query := config.DB.Where("name = ?", category.Name)
@@ -60,7 +74,7 @@ func CreateCategory(c *gin.Context) {
 	// 如果指定了父分类，验证父分类是否存在
 	if category.ParentID != nil {
 		var parentCategory models.Category
-		if err := config.DB.First(&parentCategory, *category.ParentID).Error; err != nil {
+		if err := scopeCategories(c, config.DB).First(&parentCategory, *category.ParentID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				utils.ErrorResponse(c, 400, "父分类不存在")
 				return
@@ -86,7 +100,7 @@ func UpdateCategory(c *gin.Context) {
 	categoryID := c.Param("id")
 
 	var category models.Category
-	if err := config.DB.First(&category, categoryID).Error; err != nil {
+	if err := scopeCategories(c, config.DB).First(&category, categoryID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.NotFoundResponse(c, "分类不存在")
 			return
@@ -94,6 +108,9 @@ func UpdateCategory(c *gin.Context) {
 		utils.ServerErrorResponse(c, "数据库查询失败")
 		return
 	}
+	if !checkCategoryGroupAdmin(c, &category) {
+		return
+	}
 
 	var updateData models.Category
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -129,7 +146,7 @@ func UpdateCategory(c *gin.Context) {
 
 		// 验证父分类是否存在
 		var parentCategory models.Category
-		if err := config.DB.First(&parentCategory, *updateData.ParentID).Error; err != nil {
+		if err := scopeCategories(c, config.DB).First(&parentCategory, *updateData.ParentID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				utils.ErrorResponse(c, 400, "父分类不存在")
 				return
@@ -176,7 +193,7 @@ func DeleteCategory(c *gin.Context) {
 	categoryID := c.Param("id")
 
 	var category models.Category
-	if err := config.DB.First(&category, categoryID).Error; err != nil {
+	if err := scopeCategories(c, config.DB).First(&category, categoryID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.NotFoundResponse(c, "分类不存在")
 			return
@@ -184,6 +201,9 @@ func DeleteCategory(c *gin.Context) {
 		utils.ServerErrorResponse(c, "数据库查询失败")
 		return
 	}
+	if !checkCategoryGroupAdmin(c, &category) {
+		return
+	}
 
 	// 检查是否有子分类
 	var childCount int64
@@ -201,7 +221,21 @@ func DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&category).Error; err != nil {
+	// 检查是否有Webhook使用此分类
+	var webhookCount int64
+	config.DB.Model(&models.Webhook{}).Where("category_id = ?", category.ID).Count(&webhookCount)
+	if webhookCount > 0 {
+		utils.ErrorResponse(c, 400, "存在Webhook使用此分类，无法删除")
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteACLEntries(tx, models.ACLObjectCategory, category.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "分类删除失败")
 		return
 	}
@@ -209,6 +243,15 @@ func DeleteCategory(c *gin.Context) {
 	utils.SuccessResponse(c, gin.H{"message": "分类删除成功"})
 }
 
+// checkCategoryGroupAdmin 用户组的分类只有组管理员可以修改、删除，检查失败时直接写入错误响应
+func checkCategoryGroupAdmin(c *gin.Context, category *models.Category) bool {
+	if category.GroupID != nil && !isGroupAdmin(c, *category.GroupID) {
+		utils.ForbiddenResponse(c, "只有组管理员可以管理用户组的分类")
+		return false
+	}
+	return true
+}
+
 // isDescendant 检查targetID是否是parentID的后代
 func isDescendant(db *gorm.DB, targetID, parentID uint) bool {
 	var parent models.Category
@@ -30,6 +30,7 @@ func UploadFile(c *gin.Context) {
 
 	// 获取可选参数
 	categoryID := c.PostForm("category_id")
+	groupID := c.PostForm("group_id") // 上传到用户组
 	description := c.PostForm("description")
 	tagIDs := c.PostForm("tag_ids") // 逗号分隔的标签ID
 
@@ -39,6 +40,21 @@ func UploadFile(c *gin.Context) {
 		return
 	}
 
+	// 上传到用户组时必须是组成员
+	var groupIDPtr *uint
+	if groupID != "" {
+		id, err := strconv.ParseUint(groupID, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(c, 400, "用户组ID格式错误")
+			return
+		}
+		if !checkGroupMember(c, uint(id)) {
+			return
+		}
+		groupIDUint := uint(id)
+		groupIDPtr = &groupIDUint
+	}
+
 	// 计算文件哈希
 	md5Hash, sha256Hash, err := utils.GetFileHash(file)
 	if err != nil {
@@ -93,7 +109,7 @@ func UploadFile(c *gin.Context) {
 		catID, err := strconv.ParseUint(categoryID, 10, 32)
 		if err == nil {
 			var category models.Category
-			if err := config.DB.First(&category, catID).Error; err == nil {
+			if err := scopeCategories(c, config.DB).First(&category, catID).Error; err == nil {
 				categoryIDUint := uint(catID)
 				categoryIDPtr = &categoryIDUint
 			}
@@ -113,6 +129,7 @@ func UploadFile(c *gin.Context) {
 		Description:  description,
 		UserID:       userID.(uint),
 		CategoryID:   categoryIDPtr,
+		GroupID:      groupIDPtr,
 	}
 
 	if err := config.DB.Create(&fileRecord).Error; err != nil {
@@ -152,6 +169,8 @@ func UploadFile(c *gin.Context) {
 	// 预加载关联数据
 	config.DB.Preload("User").Preload("Category").Preload("Tags").First(&fileRecord, fileRecord.ID)
 
+	emitFileEvent(models.WebhookEventFileUploaded, userID.(uint), fileRecord.ID)
+
 	utils.SuccessResponse(c, models.FileUploadResponse{
 		FileID:   fileRecord.ID,
 		FileName: fileRecord.FileName,
@@ -163,7 +182,6 @@ func UploadFile(c *gin.Context) {
 // GetFiles 获取文件列表
 func GetFiles(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -171,6 +189,7 @@ func GetFiles(c *gin.Context) {
 	categoryID := c.Query("category_id")
 	tagID := c.Query("tag_id")
 	fileType := c.Query("file_type")
+	groupID := c.Query("group_id") // 0 为自己的个人文件
 	sortBy := c.DefaultQuery("sort_by", "created_at")
 	sortOrder := c.DefaultQuery("sort_order", "desc")
 
@@ -186,10 +205,8 @@ func GetFiles(c *gin.Context) {
 
 	query := config.DB.Model(&models.File{}).Where("is_deleted = ?", false)
 
-	// 非管理员只能看到自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能查看自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessView)
 
 	// 关键词搜索
 	if keyword != "" {
@@ -201,6 +218,15 @@ func GetFiles(c *gin.Context) {
 		query = query.Where("category_id = ?", categoryID)
 	}
 
+	// 用户组筛选
+	switch groupID {
+	case "":
+	case "0":
+		query = query.Where("files.user_id = ? AND files.group_id IS NULL", userID)
+	default:
+		query = query.Where("files.group_id = ?", groupID)
+	}
+
 	// 文件类型筛选
 	if fileType != "" {
 		query = query.Where("file_type = ?", fileType)
@@ -221,11 +247,12 @@ func GetFiles(c *gin.Context) {
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := query.Preload("User").Preload("Category").Preload("Tags").
+	if err := query.Preload("User").Preload("Category").Preload("Group").Preload("Tags").
 		Offset(offset).Limit(pageSize).Find(&files).Error; err != nil {
 		utils.ServerErrorResponse(c, "数据库查询失败")
 		return
 	}
+	attachFileLinks(c, files)
 
 	utils.PageResponse(c, files, total, page, pageSize)
 }
@@ -233,18 +260,14 @@ func GetFiles(c *gin.Context) {
 // GetFile 获取单个文件信息
 func GetFile(c *gin.Context) {
 	fileID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, false)
 
-	// 非管理员只能看到自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能查看自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessView)
 
-	if err := query.Preload("User").Preload("Category").Preload("Tags").First(&file).Error; err != nil {
+	if err := query.Preload("User").Preload("Category").Preload("Group").Preload("Tags").First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.NotFoundResponse(c, "文件不存在")
 			return
@@ -256,22 +279,21 @@ func GetFile(c *gin.Context) {
 	// 增加查看次数
 	config.DB.Model(&file).UpdateColumn("view_count", gorm.Expr("view_count + ?", 1))
 
+	userID, _ := c.Get("user_id")
+	file.Links = fileLinks(file.ID, userID.(uint))
+
 	utils.SuccessResponse(c, file)
 }
 
 // UpdateFile 更新文件信息
 func UpdateFile(c *gin.Context) {
 	fileID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, false)
 
-	// 非管理员只能修改自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能修改自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessEdit)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -303,9 +325,9 @@ func UpdateFile(c *gin.Context) {
 		file.Description = updateData.Description
 	}
 	if updateData.CategoryID != nil {
-		// 验证分类存在
+		// 验证分类存在且可见
 		var category models.Category
-		if err := config.DB.First(&category, *updateData.CategoryID).Error; err == nil {
+		if err := scopeCategories(c, config.DB).First(&category, *updateData.CategoryID).Error; err == nil {
 			file.CategoryID = updateData.CategoryID
 		}
 	}
@@ -349,15 +371,12 @@ func UpdateFile(c *gin.Context) {
 func DeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, false)
 
-	// 非管理员只能删除自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -378,6 +397,8 @@ func DeleteFile(c *gin.Context) {
 		return
 	}
 
+	emitFileEvent(models.WebhookEventFileDeleted, userID.(uint), file.ID)
+
 	utils.SuccessResponse(c, gin.H{"message": "文件已移到回收站"})
 }
 
@@ -385,15 +406,12 @@ func DeleteFile(c *gin.Context) {
 func RestoreFile(c *gin.Context) {
 	fileID := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, true)
 
-	// 非管理员只能恢复自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -413,6 +431,8 @@ func RestoreFile(c *gin.Context) {
 		return
 	}
 
+	emitFileEvent(models.WebhookEventFileRestored, userID.(uint), file.ID)
+
 	utils.SuccessResponse(c, gin.H{"message": "文件恢复成功"})
 }
 
@@ -428,13 +448,20 @@ func BatchDeleteFiles(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	query := config.DB.Model(&models.File{}).Where("id IN ? AND is_deleted = ?", req.FileIDs, false)
 
-	// 非管理员只能删除自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
+
+	var fileIDs []uint
+	if err := query.Pluck("id", &fileIDs).Error; err != nil {
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if len(fileIDs) == 0 {
+		utils.SuccessResponse(c, gin.H{"message": "批量删除成功"})
+		return
 	}
 
 	now := time.Now()
@@ -443,11 +470,13 @@ func BatchDeleteFiles(c *gin.Context) {
 		"deleted_at": now,
 	}
 
-	if err := query.Updates(updates).Error; err != nil {
+	if err := config.DB.Model(&models.File{}).Where("id IN ?", fileIDs).Updates(updates).Error; err != nil {
 		utils.ServerErrorResponse(c, "批量删除失败")
 		return
 	}
 
+	emitFileEvent(models.WebhookEventFileDeleted, userID.(uint), fileIDs...)
+
 	utils.SuccessResponse(c, gin.H{"message": "批量删除成功"})
 }
 
@@ -463,13 +492,20 @@ func BatchRestoreFiles(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	query := config.DB.Model(&models.File{}).Where("id IN ? AND is_deleted = ?", req.FileIDs, true)
 
-	// 非管理员只能恢复自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
+
+	var fileIDs []uint
+	if err := query.Pluck("id", &fileIDs).Error; err != nil {
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if len(fileIDs) == 0 {
+		utils.SuccessResponse(c, gin.H{"message": "批量恢复成功"})
+		return
 	}
 
 	updates := map[string]interface{}{
@@ -477,18 +513,18 @@ func BatchRestoreFiles(c *gin.Context) {
 		"deleted_at": nil,
 	}
 
-	if err := query.Updates(updates).Error; err != nil {
+	if err := config.DB.Model(&models.File{}).Where("id IN ?", fileIDs).Updates(updates).Error; err != nil {
 		utils.ServerErrorResponse(c, "批量恢复失败")
 		return
 	}
 
+	emitFileEvent(models.WebhookEventFileRestored, userID.(uint), fileIDs...)
+
 	utils.SuccessResponse(c, gin.H{"message": "批量恢复成功"})
 }
 
 // GetDeletedFiles 获取回收站文件列表
 func GetDeletedFiles(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -505,10 +541,8 @@ func GetDeletedFiles(c *gin.Context) {
 
 	query := config.DB.Model(&models.File{}).Where("is_deleted = ?", true)
 
-	// 非管理员只能看到自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能查看自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessView)
 
 	// 计算总数
 	query.Count(&total)
@@ -526,16 +560,12 @@ func GetDeletedFiles(c *gin.Context) {
 
 // EmptyRecycleBin 清空回收站
 func EmptyRecycleBin(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var files []models.File
 	query := config.DB.Where("is_deleted = ?", true)
 
-	// 非管理员只能清空自己的回收站
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
 
 	if err := query.Find(&files).Error; err != nil {
 		utils.ServerErrorResponse(c, "数据库查询失败")
@@ -550,8 +580,9 @@ func EmptyRecycleBin(c *gin.Context) {
 			fmt.Printf("删除物理文件失败: %s, 错误: %v\n", file.FilePath, err)
 		}
 
-		// 删除文件标签关联
+		// 删除文件标签关联和访问控制条目
 		config.DB.Where("file_id = ?", file.ID).Delete(&models.FileTag{})
+		deleteACLEntries(config.DB, models.ACLObjectFile, file.ID)
 
 		// 删除数据库记录
 		config.DB.Unscoped().Delete(&file)
@@ -563,16 +594,12 @@ func EmptyRecycleBin(c *gin.Context) {
 // PermanentDeleteFile 彻底删除单个文件
 func PermanentDeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, true)
 
-	// 非管理员只能删除自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -589,8 +616,9 @@ func PermanentDeleteFile(c *gin.Context) {
 		fmt.Printf("删除物理文件失败: %s, 错误: %v\n", file.FilePath, err)
 	}
 
-	// 删除文件标签关联
+	// 删除文件标签关联和访问控制条目
 	config.DB.Where("file_id = ?", file.ID).Delete(&models.FileTag{})
+	deleteACLEntries(config.DB, models.ACLObjectFile, file.ID)
 
 	// 彻底删除数据库记录
 	if err := config.DB.Unscoped().Delete(&file).Error; err != nil {
@@ -612,16 +640,11 @@ func BatchPermanentDeleteFiles(c *gin.Context) {
 		return
 	}
 
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
 	var files []models.File
 	query := config.DB.Where("id IN ? AND is_deleted = ?", req.FileIDs, true)
 
-	// 非管理员只能删除自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能操作自己的个人文件和担任组管理员的用户组的文件
+	query = scopeFiles(c, query, fileAccessManage)
 
 	if err := query.Find(&files).Error; err != nil {
 		utils.ServerErrorResponse(c, "数据库查询失败")
@@ -642,8 +665,9 @@ func BatchPermanentDeleteFiles(c *gin.Context) {
 			fmt.Printf("删除物理文件失败: %s, 错误: %v\n", file.FilePath, err)
 		}
 
-		// 删除文件标签关联
+		// 删除文件标签关联和访问控制条目
 		config.DB.Where("file_id = ?", file.ID).Delete(&models.FileTag{})
+		deleteACLEntries(config.DB, models.ACLObjectFile, file.ID)
 
 		// 彻底删除数据库记录
 		if err := config.DB.Unscoped().Delete(&file).Error; err == nil {
@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 文件的访问级别，依次递增
+const (
+	fileAccessNone   = iota - 1 // 无权访问
+	fileAccessView              // 查看、预览、下载
+	fileAccessEdit              // 修改文件信息和内容
+	fileAccessManage            // 删除、恢复、彻底删除，管理访问控制条目
+	fileAccessOwner             // 转移归属
+)
+
+// aclLevels 访问控制权限对应的访问级别
+var aclLevels = map[string]int{
+	models.ACLRead:   fileAccessView,
+	models.ACLWrite:  fileAccessEdit,
+	models.ACLManage: fileAccessManage,
+}
+
+// fileAccessName 访问级别的名称
+func fileAccessName(level int) string {
+	switch level {
+	case fileAccessView:
+		return models.ACLRead
+	case fileAccessEdit:
+		return models.ACLWrite
+	case fileAccessManage:
+		return models.ACLManage
+	case fileAccessOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+// accessSource 有效权限的来源
+type accessSource struct {
+	Source     string `json:"source"` // role(角色权限)、owner(所有者)、uploader(上传者)、group(用户组)、acl(访问控制条目)
+	Permission string `json:"permission"`
+	GroupID    *uint  `json:"group_id,omitempty"`
+	EntryID    uint   `json:"entry_id,omitempty"`
+	ObjectType string `json:"object_type,omitempty"`
+	ObjectID   uint   `json:"object_id,omitempty"`
+}
+
+// categoryTreeIDs 分类及其全部子分类的ID
+func categoryTreeIDs(ids []uint) ([]uint, error) {
+	all := append([]uint{}, ids...)
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for parents := ids; len(parents) > 0; {
+		var children []uint
+		if err := config.DB.Model(&models.Category{}).Where("parent_id IN ?", parents).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		parents = parents[:0:0]
+		for _, id := range children {
+			if !seen[id] {
+				seen[id] = true
+				all = append(all, id)
+				parents = append(parents, id)
+			}
+		}
+	}
+	return all, nil
+}
+
+// categoryAncestorIDs 分类及其全部上级分类的ID
+func categoryAncestorIDs(categoryID uint) []uint {
+	ids := []uint{categoryID}
+	seen := map[uint]bool{categoryID: true}
+	for id := categoryID; ; {
+		var category models.Category
+		if err := config.DB.Select("id", "parent_id").First(&category, id).Error; err != nil || category.ParentID == nil || seen[*category.ParentID] {
+			return ids
+		}
+		id = *category.ParentID
+		seen[id] = true
+		ids = append(ids, id)
+	}
+}
+
+// userACLEntries 适用于用户(直接或通过用户组)的访问控制条目查询
+func userACLEntries(userID uint) *gorm.DB {
+	return config.DB.Model(&models.ACLEntry{}).Where("user_id = ? OR group_id IN (?)", userID, groupIDsQuery(userID))
+}
+
+// aclObjectIDs 用户通过访问控制条目至少达到指定访问级别的文件ID和分类ID，分类包含其全部子分类
+func aclObjectIDs(userID uint, level int) ([]uint, []uint, error) {
+	var permissions []string
+	for permission, l := range aclLevels {
+		if l >= level {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	var entries []models.ACLEntry
+	if err := userACLEntries(userID).Where("permission IN ?", permissions).Find(&entries).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var fileIDs, categoryIDs []uint
+	for _, entry := range entries {
+		if entry.ObjectType == models.ACLObjectFile {
+			fileIDs = append(fileIDs, entry.ObjectID)
+		} else {
+			categoryIDs = append(categoryIDs, entry.ObjectID)
+		}
+	}
+	if len(categoryIDs) > 0 {
+		var err error
+		if categoryIDs, err = categoryTreeIDs(categoryIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+	return fileIDs, categoryIDs, nil
+}
+
+// scopeFiles 按访问级别限制当前用户可访问的文件
+// 个人文件上传者拥有全部权限；用户组的文件组成员可以查看和修改，组管理员可以删除、恢复和转移；
+// 文件或其所在分类(含上级分类)的访问控制条目授予相应的权限，但不能转移归属
+func scopeFiles(c *gin.Context, query *gorm.DB, level int) *gorm.DB {
+	userID, _ := c.Get("user_id")
+
+	if level == fileAccessView && hasPermission(c, models.PermFileReadAny) || hasPermission(c, models.PermFileManageAny) {
+		return query
+	}
+
+	condition := "files.user_id = ? OR files.group_id IN (?)"
+	groups := groupIDsQuery(userID.(uint))
+	if level >= fileAccessManage {
+		condition = "files.user_id = ? AND files.group_id IS NULL OR files.group_id IN (?)"
+		groups = adminGroupIDsQuery(userID.(uint))
+	}
+	if level == fileAccessOwner {
+		return query.Where(condition, userID, groups)
+	}
+
+	fileIDs, categoryIDs, err := aclObjectIDs(userID.(uint), level)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+	return query.Where(condition+" OR files.id IN ? OR files.category_id IN ?", userID, groups, fileIDs, categoryIDs)
+}
+
+// scopeCategories 限制当前用户可见的分类：公共分类、所在用户组的分类和通过访问控制条目授权的分类
+func scopeCategories(c *gin.Context, query *gorm.DB) *gorm.DB {
+	userID, _ := c.Get("user_id")
+	if hasPermission(c, models.PermFileReadAny) {
+		return query
+	}
+
+	_, categoryIDs, err := aclObjectIDs(userID.(uint), fileAccessView)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+	return query.Where("group_id IS NULL OR group_id IN (?) OR id IN ?", groupIDsQuery(userID.(uint)), categoryIDs)
+}
+
+// canAccessFile 当前用户对文件是否至少具有指定的访问级别
+func canAccessFile(c *gin.Context, fileID uint, level int) bool {
+	var count int64
+	scopeFiles(c, config.DB.Model(&models.File{}).Where("files.id = ?", fileID), level).Count(&count)
+	return count > 0
+}
+
+// effectiveFileAccess 计算用户对文件的有效访问级别及其来源，规则与 scopeFiles 一致
+func effectiveFileAccess(file *models.File, user *models.User) (int, []accessSource, error) {
+	level := fileAccessNone
+	var sources []accessSource
+	grant := func(l int, source accessSource) {
+		source.Permission = fileAccessName(l)
+		sources = append(sources, source)
+		if l > level {
+			level = l
+		}
+	}
+
+	permissions := config.RolePermissions(user.Role)
+	if permissions.Has(models.PermFileManageAny) {
+		grant(fileAccessOwner, accessSource{Source: "role"})
+	} else if permissions.Has(models.PermFileReadAny) {
+		grant(fileAccessView, accessSource{Source: "role"})
+	}
+
+	switch {
+	case file.GroupID == nil && file.UserID == user.ID:
+		grant(fileAccessOwner, accessSource{Source: "owner"})
+	case file.GroupID != nil:
+		if file.UserID == user.ID {
+			grant(fileAccessEdit, accessSource{Source: "uploader"})
+		}
+		switch groupMemberRole(*file.GroupID, user.ID) {
+		case models.GroupRoleAdmin:
+			grant(fileAccessOwner, accessSource{Source: "group", GroupID: file.GroupID})
+		case models.GroupRoleMember:
+			grant(fileAccessEdit, accessSource{Source: "group", GroupID: file.GroupID})
+		}
+	}
+
+	objects := config.DB.Where("object_type = ? AND object_id = ?", models.ACLObjectFile, file.ID)
+	if file.CategoryID != nil {
+		objects = objects.Or("object_type = ? AND object_id IN ?", models.ACLObjectCategory, categoryAncestorIDs(*file.CategoryID))
+	}
+	if err := grantACLEntries(userACLEntries(user.ID).Where(objects), grant); err != nil {
+		return fileAccessNone, nil, err
+	}
+
+	return level, sources, nil
+}
+
+// effectiveCategoryAccess 计算用户对分类中文件通过角色权限和访问控制条目至少具有的访问级别及其来源
+// 规则与 scopeFiles 一致，文件自身的所有者、用户组和访问控制条目另行计算
+func effectiveCategoryAccess(category *models.Category, user *models.User) (int, []accessSource, error) {
+	level := fileAccessNone
+	var sources []accessSource
+	grant := func(l int, source accessSource) {
+		source.Permission = fileAccessName(l)
+		sources = append(sources, source)
+		if l > level {
+			level = l
+		}
+	}
+
+	permissions := config.RolePermissions(user.Role)
+	if permissions.Has(models.PermFileManageAny) {
+		grant(fileAccessOwner, accessSource{Source: "role"})
+	} else if permissions.Has(models.PermFileReadAny) {
+		grant(fileAccessView, accessSource{Source: "role"})
+	}
+
+	query := userACLEntries(user.ID).Where("object_type = ? AND object_id IN ?", models.ACLObjectCategory, categoryAncestorIDs(category.ID))
+	if err := grantACLEntries(query, grant); err != nil {
+		return fileAccessNone, nil, err
+	}
+
+	return level, sources, nil
+}
+
+// grantACLEntries 按查询到的访问控制条目授予权限
+func grantACLEntries(query *gorm.DB, grant func(int, accessSource)) error {
+	var entries []models.ACLEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		grant(aclLevels[entry.Permission], accessSource{
+			Source:     "acl",
+			EntryID:    entry.ID,
+			ObjectType: entry.ObjectType,
+			ObjectID:   entry.ObjectID,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"fmt"
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createTestFile 创建文件记录，内容写入临时目录
+func createTestFile(t *testing.T, name string, userID uint, configure func(f *models.File)) *models.File {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("content of "+name), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := &models.File{OriginalName: name, FileName: name, FilePath: path, FileSize: int64(len("content of " + name)),
+		FileType: "document", MimeType: "text/plain", UserID: userID}
+	if configure != nil {
+		configure(file)
+	}
+	if err := config.DB.Create(file).Error; err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// grantACL 为用户添加访问控制条目
+func grantACL(t *testing.T, objectType string, objectID, userID uint, permission string) *models.ACLEntry {
+	t.Helper()
+	entry := &models.ACLEntry{ObjectType: objectType, ObjectID: objectID, UserID: &userID, Permission: permission, CreatedBy: 1}
+	if err := config.DB.Create(entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// userContext 以用户及其角色权限构造请求上下文
+func userContext(user *models.User) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("user_id", user.ID)
+	c.Set("permissions", config.RolePermissions(user.Role))
+	return c
+}
+
+func TestScopeFiles(t *testing.T) {
+	useAccountDB(t, fileTables...)
+	permissions := `["` + models.PermFileReadAny + `"]`
+	config.DB.Create(&models.Role{Name: "auditor", Permissions: models.JSON(permissions)})
+
+	alice := createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+	bob := createTestUser(t, "bob", models.RoleUser, "bob-pass-1")
+	carol := createTestUser(t, "carol", models.RoleUser, "carol-pass-1")
+	dave := createTestUser(t, "dave", models.RoleUser, "dave-pass-1")
+	erin := createTestUser(t, "erin", models.RoleUser, "erin-pass-1")
+	auditor := createTestUser(t, "auditor", "auditor", "auditor-pass-1")
+	admin := createTestUser(t, "admin", models.RoleAdmin, "admin-pass-1")
+
+	group := models.UserGroup{Name: "设计组"}
+	config.DB.Create(&group)
+	config.DB.Create(&models.UserGroupMember{GroupID: group.ID, UserID: bob.ID, Role: models.GroupRoleMember})
+	config.DB.Create(&models.UserGroupMember{GroupID: group.ID, UserID: carol.ID, Role: models.GroupRoleAdmin})
+
+	parent := models.Category{Name: "素材"}
+	config.DB.Create(&parent)
+	child := models.Category{Name: "图片", ParentID: &parent.ID}
+	config.DB.Create(&child)
+
+	personal := createTestFile(t, "personal.txt", alice.ID, nil)
+	groupFile := createTestFile(t, "group.txt", bob.ID, func(f *models.File) { f.GroupID = &group.ID })
+	categorized := createTestFile(t, "categorized.txt", alice.ID, func(f *models.File) { f.CategoryID = &child.ID })
+	shared := createTestFile(t, "shared.txt", alice.ID, nil)
+	files := []*models.File{personal, groupFile, categorized, shared}
+
+	// 上级分类的授权适用于子分类中的文件
+	grantACL(t, models.ACLObjectCategory, parent.ID, dave.ID, models.ACLRead)
+	grantACL(t, models.ACLObjectFile, shared.ID, dave.ID, models.ACLWrite)
+
+	names := func(ids []uint) []string {
+		var result []string
+		for _, f := range files {
+			for _, id := range ids {
+				if f.ID == id {
+					result = append(result, f.OriginalName)
+				}
+			}
+		}
+		sort.Strings(result)
+		return result
+	}
+	all := []string{"categorized.txt", "group.txt", "personal.txt", "shared.txt"}
+	own := []string{"categorized.txt", "personal.txt", "shared.txt"}
+	tests := []struct {
+		user  *models.User
+		level int
+		want  []string
+	}{
+		{alice, fileAccessView, own},
+		{alice, fileAccessOwner, own},
+		{bob, fileAccessView, []string{"group.txt"}},
+		{bob, fileAccessEdit, []string{"group.txt"}},
+		{bob, fileAccessManage, nil},
+		{carol, fileAccessManage, []string{"group.txt"}},
+		{carol, fileAccessOwner, []string{"group.txt"}},
+		{dave, fileAccessView, []string{"categorized.txt", "shared.txt"}},
+		{dave, fileAccessEdit, []string{"shared.txt"}},
+		{dave, fileAccessManage, nil},
+		{dave, fileAccessOwner, nil},
+		{erin, fileAccessView, nil},
+		{auditor, fileAccessView, all},
+		{auditor, fileAccessEdit, nil},
+		{admin, fileAccessOwner, all},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s_%s", tt.user.Username, fileAccessName(tt.level)), func(t *testing.T) {
+			var ids []uint
+			query := scopeFiles(userContext(tt.user), config.DB.Model(&models.File{}), tt.level)
+			if err := query.Pluck("files.id", &ids).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := names(ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 有效权限的计算与 scopeFiles 一致
+	for _, user := range []*models.User{alice, bob, carol, dave, erin, auditor, admin} {
+		for _, file := range files {
+			level, _, err := effectiveFileAccess(file, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for l := fileAccessView; l <= fileAccessOwner; l++ {
+				if canAccessFile(userContext(user), file.ID, l) != (level >= l) {
+					t.Errorf("%s %s: effective access %s, scopeFiles disagrees at %s",
+						user.Username, file.OriginalName, fileAccessName(level), fileAccessName(l))
+				}
+			}
+		}
+	}
+}
+
+func TestSignedFileLinks(t *testing.T) {
+	useAccountDB(t, fileTables...)
+	r := newTestRouter()
+	r.GET("/api/files/:id/download", middlewares.OptionalAuthMiddleware(), DownloadFile)
+	r.GET("/api/files/:id/links", middlewares.AuthMiddleware(), GetFileLinks)
+
+	alice := createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+	bob := createTestUser(t, "bob", models.RoleUser, "bob-pass-1")
+	file := createTestFile(t, "report.txt", alice.ID, nil)
+	other := createTestFile(t, "other.txt", alice.ID, nil)
+	public := createTestFile(t, "public.txt", alice.ID, func(f *models.File) { f.IsPublic = true })
+	entry := grantACL(t, models.ACLObjectFile, file.ID, bob.ID, models.ACLRead)
+
+	bobToken, _ := loginAs(t, bob)
+	if resp := doRequest(t, r, http.MethodGet, fmt.Sprintf("/api/files/%d/links", other.ID), bobToken, nil); resp.Status != http.StatusNotFound {
+		t.Errorf("links for inaccessible file: status = %d, want 404", resp.Status)
+	}
+	resp := doRequest(t, r, http.MethodGet, fmt.Sprintf("/api/files/%d/links", file.ID), bobToken, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("links: %d %s", resp.Status, resp.Message)
+	}
+	var links models.FileLinks
+	resp.decode(t, &links)
+	if time.Until(links.ExpiresAt) > fileLinkTTL {
+		t.Errorf("expires at %v", links.ExpiresAt)
+	}
+	link, err := url.Parse(links.Download)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// withQuery 修改链接中的参数后生成请求路径
+	withQuery := func(fileID uint, change func(q url.Values)) string {
+		q := link.Query()
+		if change != nil {
+			change(q)
+		}
+		return fmt.Sprintf("/api/files/%d/download?%s", fileID, q.Encode())
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"带签名的链接", withQuery(file.ID, nil), http.StatusOK},
+		{"签名被篡改", withQuery(file.ID, func(q url.Values) { q.Set("signature", "x"+q.Get("signature")[1:]) }), http.StatusForbidden},
+		{"用于其他文件", withQuery(other.ID, nil), http.StatusForbidden},
+		{"修改用户", withQuery(file.ID, func(q url.Values) { q.Set("uid", strconv.FormatUint(uint64(alice.ID), 10)) }), http.StatusForbidden},
+		{"延长有效期", withQuery(file.ID, func(q url.Values) { q.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)) }), http.StatusForbidden},
+		{"已过期", withQuery(file.ID, func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(past, 10))
+			q.Set("signature", utils.SignFileLink(file.ID, bob.ID, past))
+		}), http.StatusForbidden},
+		{"未登录且没有签名", fmt.Sprintf("/api/files/%d/download", file.ID), http.StatusUnauthorized},
+		{"公开文件", fmt.Sprintf("/api/files/%d/download", public.ID), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp := doRequest(t, r, http.MethodGet, tt.path, "", nil); resp.Status != tt.wantStatus {
+			t.Errorf("%s: status = %d %s, want %d", tt.name, resp.Status, resp.Message, tt.wantStatus)
+		}
+	}
+
+	// 签发后撤销授权，未过期的链接随即失效
+	config.DB.Delete(entry)
+	if resp := doRequest(t, r, http.MethodGet, withQuery(file.ID, nil), "", nil); resp.Status != http.StatusForbidden {
+		t.Errorf("after revoke: status = %d, want 403", resp.Status)
+	}
+}
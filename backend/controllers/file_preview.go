@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"io"
 	"material-platform/config"
 	"material-platform/models"
@@ -9,17 +10,44 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-// DownloadFile 文件下载
-func DownloadFile(c *gin.Context) {
-	fileID := c.Param("id")
+// fileLinkTTL 带签名的文件链接的有效时间
+const fileLinkTTL = 10 * time.Minute
+
+// fileLinks 生成当前用户访问文件的带签名链接
+func fileLinks(fileID, userID uint) *models.FileLinks {
+	expiresAt := time.Now().Add(fileLinkTTL)
+	expires := expiresAt.Unix()
+	query := fmt.Sprintf("?uid=%d&expires=%d&signature=%s", userID, expires, utils.SignFileLink(fileID, userID, expires))
+	base := fmt.Sprintf("/api/files/%d/", fileID)
+	return &models.FileLinks{
+		Preview:   base + "preview" + query,
+		Download:  base + "download" + query,
+		Thumbnail: base + "thumbnail" + query,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// attachFileLinks 为文件列表附加当前用户的带签名链接
+func attachFileLinks(c *gin.Context, files []models.File) {
+	userID, _ := c.Get("user_id")
+	for i := range files {
+		files[i].Links = fileLinks(files[i].ID, userID.(uint))
+	}
+}
+
+// GetFileLinks 获取文件的带签名预览、下载链接，链接过期后重新获取
+func GetFileLinks(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
 	var file models.File
-	if err := config.DB.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
+	query := scopeFiles(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false), fileAccessView)
+	if err := query.Select("id").First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.NotFoundResponse(c, "文件不存在")
 			return
@@ -28,6 +56,79 @@ func DownloadFile(c *gin.Context) {
 		return
 	}
 
+	utils.SuccessResponse(c, fileLinks(file.ID, userID.(uint)))
+}
+
+// signedLinkAllowed 校验请求中的文件链接签名，并按签名用户当前的权限检查是否仍可查看文件
+func signedLinkAllowed(c *gin.Context, file *models.File) bool {
+	userID, err := strconv.ParseUint(c.Query("uid"), 10, 64)
+	if err != nil {
+		return false
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || !utils.VerifyFileLink(file.ID, uint(userID), expires, c.Query("signature")) {
+		return false
+	}
+
+	var user models.User
+	if err := config.DB.Select("id", "role").First(&user, userID).Error; err != nil {
+		return false
+	}
+	level, _, err := effectiveFileAccess(file, &user)
+	return err == nil && level >= fileAccessView
+}
+
+// findDownloadableFile 查找可以预览、下载的文件，查找失败时直接写入错误响应
+// 公开文件无需登录；其他文件需要登录且有查看权限，或使用 GetFileLinks 生成的带签名链接
+func findDownloadableFile(c *gin.Context, fileID string) (*models.File, bool) {
+	var file models.File
+	if err := config.DB.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "文件不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return nil, false
+	}
+	if file.IsPublic {
+		return &file, true
+	}
+
+	if _, exists := c.Get("user_id"); !exists {
+		if c.Query("signature") != "" {
+			if signedLinkAllowed(c, &file) {
+				return &file, true
+			}
+			utils.ForbiddenResponse(c, "链接无效或已过期")
+			return nil, false
+		}
+		utils.UnauthorizedResponse(c, "请先登录")
+		return nil, false
+	}
+	if !canAccessFile(c, file.ID, fileAccessView) {
+		utils.NotFoundResponse(c, "文件不存在")
+		return nil, false
+	}
+	return &file, true
+}
+
+// fileCacheControl 文件的缓存策略，非公开文件不允许共享缓存
+func fileCacheControl(file *models.File) string {
+	if file.IsPublic {
+		return "public, max-age=3600"
+	}
+	return "private, max-age=3600"
+}
+
+// DownloadFile 文件下载
+func DownloadFile(c *gin.Context) {
+	fileID := c.Param("id")
+
+	file, ok := findDownloadableFile(c, fileID)
+	if !ok {
+		return
+	}
+
 	// 检查文件是否存在
 	if _, err := os.Stat(file.FilePath); os.IsNotExist(err) {
 		utils.NotFoundResponse(c, "文件不存在")
@@ -35,7 +136,7 @@ func DownloadFile(c *gin.Context) {
 	}
 
 	// 增加下载次数
-	config.DB.Model(&file).UpdateColumn("download_count", gorm.Expr("download_count + ?", 1))
+	config.DB.Model(file).UpdateColumn("download_count", gorm.Expr("download_count + ?", 1))
 
 	// 设置响应头
 	c.Header("Content-Disposition", "attachment; filename=\""+file.OriginalName+"\"")
@@ -50,13 +151,8 @@ func DownloadFile(c *gin.Context) {
 func PreviewFile(c *gin.Context) {
 	fileID := c.Param("id")
 
-	var file models.File
-	if err := config.DB.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "文件不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "数据库查询失败")
+	file, ok := findDownloadableFile(c, fileID)
+	if !ok {
 		return
 	}
 
@@ -73,7 +169,7 @@ func PreviewFile(c *gin.Context) {
 	}
 
 	// 增加查看次数
-	config.DB.Model(&file).UpdateColumn("view_count", gorm.Expr("view_count + ?", 1))
+	config.DB.Model(file).UpdateColumn("view_count", gorm.Expr("view_count + ?", 1))
 
 	// 对于文本文件，可以直接返回内容
 	if file.FileType == "text" {
@@ -102,7 +198,7 @@ func PreviewFile(c *gin.Context) {
 
 	// 对于图片，添加缓存控制
 	if file.FileType == "image" {
-		c.Header("Cache-Control", "public, max-age=3600")
+		c.Header("Cache-Control", fileCacheControl(file))
 	}
 
 	// 发送文件
@@ -112,16 +208,12 @@ func PreviewFile(c *gin.Context) {
 // GetFileContent 获取文件内容（用于在线编辑）
 func GetFileContent(c *gin.Context) {
 	fileID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, false)
 
-	// 非管理员只能访问自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能查看自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessView)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -166,16 +258,12 @@ func GetFileContent(c *gin.Context) {
 // UpdateFileContent 更新文件内容（用于在线编辑）
 func UpdateFileContent(c *gin.Context) {
 	fileID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var file models.File
 	query := config.DB.Where("id = ? AND is_deleted = ?", fileID, false)
 
-	// 非管理员只能修改自己的文件
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
+	// 只能修改自己的文件和所在用户组的文件
+	query = scopeFiles(c, query, fileAccessEdit)
 
 	if err := query.First(&file).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -235,13 +323,8 @@ func UpdateFileContent(c *gin.Context) {
 func GetFileThumbnail(c *gin.Context) {
 	fileID := c.Param("id")
 
-	var file models.File
-	if err := config.DB.Where("id = ? AND is_deleted = ?", fileID, false).First(&file).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "文件不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "数据库查询失败")
+	file, ok := findDownloadableFile(c, fileID)
+	if !ok {
 		return
 	}
 
@@ -259,7 +342,7 @@ func GetFileThumbnail(c *gin.Context) {
 
 	// 简单实现：直接返回原图片（在实际应用中，这里应该生成缩略图）
 	c.Header("Content-Type", file.MimeType)
-	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("Cache-Control", fileCacheControl(file))
 	c.File(file.FilePath)
 }
 
@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// formRoleLevels 表单协作角色的权限等级
+var formRoleLevels = map[string]int{
+	models.FormRoleViewer:    1,
+	models.FormRoleSubmitter: 2,
+	models.FormRoleEditor:    3,
+	models.FormRoleManager:   4,
+	models.FormRoleOwner:     5,
+}
+
+// fieldAccessLevels 字段权限等级
+var fieldAccessLevels = map[string]int{
+	models.FieldAccessHidden: 0,
+	models.FieldAccessRead:   1,
+	models.FieldAccessWrite:  2,
+}
+
+// hasFormRole 判断权限是否达到指定角色
+func hasFormRole(perm *models.FormPermission, role string) bool {
+	return perm != nil && formRoleLevels[perm.Role] >= formRoleLevels[role]
+}
+
+// defaultFieldAccess 角色对未单独设置的字段的默认权限
+func defaultFieldAccess(role string) string {
+	if role == models.FormRoleViewer {
+		return models.FieldAccessRead
+	}
+	return models.FieldAccessWrite
+}
+
+// fieldAccess 获取字段的有效权限
+func fieldAccess(perm *models.FormPermission, key string) string {
+	if access, ok := perm.Fields[key]; ok {
+		return access
+	}
+	return defaultFieldAccess(perm.Role)
+}
+
+// groupIDsQuery 用户所属用户组的子查询
+func groupIDsQuery(userID uint) *gorm.DB {
+	return config.DB.Model(&models.UserGroupMember{}).Select("group_id").Where("user_id = ?", userID)
+}
+
+// sharedSchemaIDsQuery 共享给用户(直接或通过用户组)以及用户所在用户组拥有的表单ID子查询
+func sharedSchemaIDsQuery(userID uint) *gorm.DB {
+	return config.DB.Model(&models.FormSchema{}).Select("id").
+		Where("group_id IN (?) OR id IN (?)", groupIDsQuery(userID),
+			config.DB.Model(&models.FormShare{}).Select("schema_id").
+				Where("user_id = ? OR group_id IN (?)", userID, groupIDsQuery(userID)))
+}
+
+// editableSchemaIDsQuery 用户可编辑全部记录的表单ID子查询(自己的表单、所在用户组的表单，或以编辑者及以上角色共享且可见全部记录)
+func editableSchemaIDsQuery(userID uint) *gorm.DB {
+	return config.DB.Model(&models.FormSchema{}).Select("id").
+		Where("user_id = ? OR group_id IN (?) OR id IN (?)", userID, groupIDsQuery(userID),
+			config.DB.Model(&models.FormShare{}).Select("schema_id").
+				Where("role IN ? AND row_scope = ?", []string{models.FormRoleEditor, models.FormRoleManager}, models.RowScopeAll).
+				Where("user_id = ? OR group_id IN (?)", userID, groupIDsQuery(userID)))
+}
+
+// loadFormPermission 计算用户对表单的有效权限，无权访问时返回nil；manageAny 为用户是否有管理全部表单的权限
+// 多条共享设置取最高角色、最宽的记录范围，字段权限取各设置中最高的权限
+// 表单归属于用户组时，组管理员视为所有者，组成员至少为可见全部记录的编辑者
+func loadFormPermission(schema *models.FormSchema, userID uint, manageAny bool) (*models.FormPermission, error) {
+	if manageAny || schema.UserID == userID {
+		return &models.FormPermission{Role: models.FormRoleOwner, RowScope: models.RowScopeAll, UserID: userID}, nil
+	}
+
+	var groupRole string
+	if schema.GroupID != nil {
+		groupRole = groupMemberRole(*schema.GroupID, userID)
+	}
+	if groupRole == models.GroupRoleAdmin {
+		return &models.FormPermission{Role: models.FormRoleOwner, RowScope: models.RowScopeAll, UserID: userID}, nil
+	}
+
+	var shares []models.FormShare
+	if err := config.DB.Where("schema_id = ?", schema.ID).
+		Where("user_id = ? OR group_id IN (?)", userID, groupIDsQuery(userID)).
+		Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 && groupRole == "" {
+		return nil, nil
+	}
+
+	perm := &models.FormPermission{RowScope: models.RowScopeOwn, UserID: userID}
+	if groupRole != "" {
+		perm.Role = models.FormRoleEditor
+		perm.RowScope = models.RowScopeAll
+	}
+	shareFields := make([]map[string]string, len(shares))
+	keys := make(map[string]bool)
+	for i, share := range shares {
+		if formRoleLevels[share.Role] > formRoleLevels[perm.Role] {
+			perm.Role = share.Role
+		}
+		if share.RowScope == models.RowScopeAll {
+			perm.RowScope = models.RowScopeAll
+		}
+		if len(share.FieldPermissions) > 0 {
+			json.Unmarshal(share.FieldPermissions, &shareFields[i])
+		}
+		for key := range shareFields[i] {
+			keys[key] = true
+		}
+	}
+
+	// 管理者可以修改表单定义，不受字段权限限制
+	if hasFormRole(perm, models.FormRoleManager) {
+		return perm, nil
+	}
+
+	for key := range keys {
+		best := models.FieldAccessHidden
+		if groupRole != "" {
+			best = defaultFieldAccess(models.FormRoleEditor)
+		}
+		for i, share := range shares {
+			access, ok := shareFields[i][key]
+			if !ok {
+				access = defaultFieldAccess(share.Role)
+			}
+			if fieldAccessLevels[access] > fieldAccessLevels[best] {
+				best = access
+			}
+		}
+		// 合并后的角色可能高于设置该字段的共享，仅保留与默认权限不同的字段
+		if best != defaultFieldAccess(perm.Role) {
+			if perm.Fields == nil {
+				perm.Fields = make(map[string]string)
+			}
+			perm.Fields[key] = best
+		}
+	}
+
+	return perm, nil
+}
+
+// findAccessibleSchema 查找当前用户至少具有指定角色的表单结构，查找失败时直接写入错误响应
+// 返回的表单结构中带有当前用户的有效权限
+func findAccessibleSchema(c *gin.Context, schemaID interface{}, minRole string) (*models.FormSchema, bool) {
+	var schema models.FormSchema
+	if err := config.DB.Where("id = ?", schemaID).First(&schema).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "表单结构不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+
+	if !authorizeSchema(c, &schema, minRole) {
+		return nil, false
+	}
+	return &schema, true
+}
+
+// authorizeSchema 计算当前用户对已加载表单的权限并检查角色，失败时直接写入错误响应
+func authorizeSchema(c *gin.Context, schema *models.FormSchema, minRole string) bool {
+	userID, _ := c.Get("user_id")
+
+	perm, err := loadFormPermission(schema, userID.(uint), hasPermission(c, models.PermFormManageAny))
+	if err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return false
+	}
+	if perm == nil {
+		utils.NotFoundResponse(c, "表单结构不存在")
+		return false
+	}
+	if !hasFormRole(perm, minRole) {
+		utils.ForbiddenResponse(c, "没有权限执行此操作")
+		return false
+	}
+
+	schema.Permission = perm
+	return true
+}
+
+// findAccessibleRecord 查找当前用户可查看的记录(受记录可见范围限制，指派给用户审核的记录也可查看)，查找失败时直接写入错误响应
+// 返回的记录中的表单结构带有当前用户的有效权限
+func findAccessibleRecord(c *gin.Context, query *gorm.DB) (*models.FormRecord, bool) {
+	var record models.FormRecord
+	if err := query.Preload("Schema").Preload("User").First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "记录不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+
+	userID, _ := c.Get("user_id")
+	perm, err := loadFormPermission(&record.Schema, userID.(uint), hasPermission(c, models.PermFormManageAny))
+	if err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	if !canViewRecord(perm, &record) {
+		utils.NotFoundResponse(c, "记录不存在")
+		return nil, false
+	}
+
+	record.Schema.Permission = perm
+	return &record, true
+}
+
+// canViewRecord 判断记录是否在权限的可见范围内，规则与 scopeRecordQuery 一致
+func canViewRecord(perm *models.FormPermission, record *models.FormRecord) bool {
+	if perm == nil {
+		return false
+	}
+	return perm.RowScope != models.RowScopeOwn || record.UserID == perm.UserID || isRecordAssignee(record.ID, perm.UserID)
+}
+
+// canModifyRecord 判断是否可以修改、删除记录：编辑者及以上可修改全部可见记录，提交者只能修改自己提交的记录
+func canModifyRecord(perm *models.FormPermission, record *models.FormRecord) bool {
+	if hasFormRole(perm, models.FormRoleEditor) {
+		return true
+	}
+	return hasFormRole(perm, models.FormRoleSubmitter) && record.UserID == perm.UserID
+}
+
+// hasFieldRestrictions 判断是否存在不可写的字段
+func hasFieldRestrictions(perm *models.FormPermission) bool {
+	if perm.Role == models.FormRoleViewer {
+		return true
+	}
+	for _, access := range perm.Fields {
+		if access != models.FieldAccessWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHiddenFields 判断是否存在不可见的字段
+func hasHiddenFields(perm *models.FormPermission) bool {
+	if perm == nil {
+		return false
+	}
+	for _, access := range perm.Fields {
+		if access == models.FieldAccessHidden {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleFields 过滤掉当前用户不可见的顶层字段
+func visibleFields(perm *models.FormPermission, fields []models.FormField) []models.FormField {
+	if !hasHiddenFields(perm) {
+		return fields
+	}
+	result := make([]models.FormField, 0, len(fields))
+	for _, field := range fields {
+		if fieldAccess(perm, getFieldKey(field)) != models.FieldAccessHidden {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// visibleSchema 返回隐藏了不可见字段的表单结构副本
+func visibleSchema(schema models.FormSchema) models.FormSchema {
+	if !hasHiddenFields(schema.Permission) {
+		return schema
+	}
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(schema.Schema, &schemaData); err != nil {
+		return schema
+	}
+	schemaData.Fields = visibleFields(schema.Permission, schemaData.Fields)
+	if data, err := json.Marshal(schemaData); err == nil {
+		schema.Schema = models.JSON(data)
+	}
+	return schema
+}
+
+// filterRecordData 移除记录数据中不可见的字段
+func filterRecordData(perm *models.FormPermission, data map[string]interface{}) {
+	if !hasHiddenFields(perm) {
+		return
+	}
+	for key := range data {
+		if fieldAccess(perm, key) == models.FieldAccessHidden {
+			delete(data, key)
+		}
+	}
+}
+
+// filterRecordResponses 移除记录响应中不可见的字段及其资源、关联记录
+func filterRecordResponses(perm *models.FormPermission, responses []models.FormRecordResponse) {
+	if !hasHiddenFields(perm) {
+		return
+	}
+	for i := range responses {
+		filterRecordData(perm, responses[i].Data)
+		for key := range responses[i].Assets {
+			if fieldAccess(perm, key) == models.FieldAccessHidden {
+				delete(responses[i].Assets, key)
+			}
+		}
+		for key := range responses[i].Relations {
+			if fieldAccess(perm, key) == models.FieldAccessHidden {
+				delete(responses[i].Relations, key)
+			}
+		}
+		if responses[i].Schema != nil {
+			schema := *responses[i].Schema
+			schema.Permission = perm
+			schema = visibleSchema(schema)
+			responses[i].Schema = &schema
+		}
+	}
+}
+
+// applyFieldPermissions 校验提交数据中不可写的字段：新建时不能填写，修改时不能改变原值
+// 不可写字段的值统一沿用原记录中的值，因此隐藏字段在修改时保持不变
+func applyFieldPermissions(perm *models.FormPermission, fields []models.FormField, data, oldData map[string]interface{}) error {
+	if !hasFieldRestrictions(perm) {
+		return nil
+	}
+
+	for _, field := range protectedFields(perm, fields) {
+		key := getFieldKey(field)
+		value, submitted := data[key]
+		oldValue, exists := oldData[key]
+		if submitted && !isEmptyValue(value) && (!exists || !reflect.DeepEqual(normalizeDiffValue(value), normalizeDiffValue(oldValue))) {
+			return fmt.Errorf("无权修改字段 '%s'", field.Label)
+		}
+	}
+	keepProtectedFields(perm, fields, data, oldData)
+	return nil
+}
+
+// keepProtectedFields 将数据中不可写字段的值替换为原记录中的值
+func keepProtectedFields(perm *models.FormPermission, fields []models.FormField, data, oldData map[string]interface{}) {
+	for _, field := range protectedFields(perm, fields) {
+		key := getFieldKey(field)
+		if oldValue, exists := oldData[key]; exists {
+			data[key] = oldValue
+		} else {
+			delete(data, key)
+		}
+	}
+}
+
+// protectedFields 当前用户不可写的字段(不含由系统计算的公式、唯一ID字段)
+func protectedFields(perm *models.FormPermission, fields []models.FormField) []models.FormField {
+	if !hasFieldRestrictions(perm) {
+		return nil
+	}
+	var result []models.FormField
+	for _, field := range fields {
+		if field.Type == "formula" || field.Type == "unique_id" {
+			continue
+		}
+		if fieldAccess(perm, getFieldKey(field)) != models.FieldAccessWrite {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// scopeRecordQuery 按记录可见范围限制记录查询，仅可见自己的记录时也可见指派给自己审核的记录
+func scopeRecordQuery(query *gorm.DB, perm *models.FormPermission) *gorm.DB {
+	if perm != nil && perm.RowScope == models.RowScopeOwn {
+		return query.Where("form_records.user_id = ? OR form_records.id IN (?)", perm.UserID, assignedRecordIDsQuery(perm.UserID))
+	}
+	return query
+}
@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newFormRecordRouter 注册表单记录接口
+func newFormRecordRouter() *gin.Engine {
+	r := newTestRouter()
+	forms := r.Group("/api/forms", middlewares.AuthMiddleware())
+	forms.GET("/:id/records", GetFormRecords)
+	forms.POST("/records", CreateFormRecord)
+	forms.GET("/records/:id", GetFormRecord)
+	forms.PUT("/records/:id", UpdateFormRecord)
+	return r
+}
+
+// shareTestSchema 将表单共享给用户或用户组，fields 为字段权限
+func shareTestSchema(t *testing.T, schemaID uint, userID, groupID *uint, role, rowScope string, fields map[string]string) {
+	t.Helper()
+	share := models.FormShare{SchemaID: schemaID, UserID: userID, GroupID: groupID, Role: role, RowScope: rowScope, CreatedBy: 1}
+	if fields != nil {
+		data, _ := json.Marshal(fields)
+		share.FieldPermissions = models.JSON(data)
+	}
+	if err := config.DB.Create(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadFormPermission(t *testing.T) {
+	type share struct {
+		toGroup  bool
+		role     string
+		rowScope string
+		fields   map[string]string
+	}
+	tests := []struct {
+		name      string
+		groupRole string // 用户在表单所属用户组中的角色
+		shares    []share
+		manageAny bool
+		want      *models.FormPermission
+	}{
+		{"没有共享", "", nil, false, nil},
+		{"管理全部表单", "", nil, true, &models.FormPermission{Role: models.FormRoleOwner, RowScope: models.RowScopeAll}},
+		{"用户组管理员", models.GroupRoleAdmin, nil, false, &models.FormPermission{Role: models.FormRoleOwner, RowScope: models.RowScopeAll}},
+		{"用户组成员", models.GroupRoleMember, nil, false, &models.FormPermission{Role: models.FormRoleEditor, RowScope: models.RowScopeAll}},
+		{"仅自己的记录", "", []share{{false, models.FormRoleViewer, models.RowScopeOwn, map[string]string{"salary": "hidden"}}}, false,
+			&models.FormPermission{Role: models.FormRoleViewer, RowScope: models.RowScopeOwn, Fields: map[string]string{"salary": "hidden"}}},
+		{"多条共享取最高角色和最宽范围", "", []share{
+			{false, models.FormRoleViewer, models.RowScopeOwn, map[string]string{"salary": "hidden"}},
+			{true, models.FormRoleEditor, models.RowScopeAll, nil},
+		}, false, &models.FormPermission{Role: models.FormRoleEditor, RowScope: models.RowScopeAll}},
+		{"字段取各共享中最高的权限", "", []share{
+			{false, models.FormRoleEditor, models.RowScopeOwn, map[string]string{"salary": "read", "note": "hidden"}},
+			{true, models.FormRoleViewer, models.RowScopeOwn, nil},
+		}, false, &models.FormPermission{Role: models.FormRoleEditor, RowScope: models.RowScopeOwn, Fields: map[string]string{"salary": "read", "note": "read"}}},
+		{"用户组成员的字段权限不低于编辑者默认权限", models.GroupRoleMember, []share{
+			{false, models.FormRoleViewer, models.RowScopeOwn, map[string]string{"salary": "hidden"}},
+		}, false, &models.FormPermission{Role: models.FormRoleEditor, RowScope: models.RowScopeAll}},
+		{"管理者不受字段权限限制", "", []share{
+			{false, models.FormRoleManager, models.RowScopeOwn, map[string]string{"salary": "hidden"}},
+		}, false, &models.FormPermission{Role: models.FormRoleManager, RowScope: models.RowScopeOwn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccountDB(t, formTables...)
+			owner := createTestUser(t, "owner", models.RoleUser, "owner-pass-1")
+			user := createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+			group := models.UserGroup{Name: "设计组"}
+			config.DB.Create(&group)
+			config.DB.Create(&models.UserGroupMember{GroupID: group.ID, UserID: user.ID, Role: models.GroupRoleMember})
+
+			schema := createTestSchema(t, "人员", nil)
+			config.DB.Model(schema).Update("user_id", owner.ID)
+			if tt.groupRole != "" {
+				config.DB.Model(schema).Update("group_id", group.ID)
+				config.DB.Model(&models.UserGroupMember{}).Where("user_id = ?", user.ID).Update("role", tt.groupRole)
+			}
+			for _, s := range tt.shares {
+				if s.toGroup {
+					shareTestSchema(t, schema.ID, nil, &group.ID, s.role, s.rowScope, s.fields)
+				} else {
+					shareTestSchema(t, schema.ID, &user.ID, nil, s.role, s.rowScope, s.fields)
+				}
+			}
+
+			perm, err := loadFormPermission(schema, user.ID, tt.manageAny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != nil {
+				tt.want.UserID = user.ID
+			}
+			if !reflect.DeepEqual(perm, tt.want) {
+				t.Errorf("permission = %+v, want %+v", perm, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormRecordRowScopeAndFieldPermissions(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newFormRecordRouter()
+
+	owner := createTestUser(t, "owner", models.RoleUser, "owner-pass-1")
+	viewer := createTestUser(t, "viewer", models.RoleUser, "viewer-pass-1")
+	editor := createTestUser(t, "editor", models.RoleUser, "editor-pass-1")
+	submitter := createTestUser(t, "submitter", models.RoleUser, "submitter-pass-1")
+	stranger := createTestUser(t, "stranger", models.RoleUser, "stranger-pass-1")
+
+	schema := createTestSchema(t, "人员", []models.FormField{
+		{Name: "name", Label: "姓名", Type: "string"},
+		{Name: "note", Label: "备注", Type: "string"},
+		{Name: "salary", Label: "薪资", Type: "number"},
+	})
+	config.DB.Model(schema).Update("user_id", owner.ID)
+	shareTestSchema(t, schema.ID, &viewer.ID, nil, models.FormRoleViewer, models.RowScopeOwn, map[string]string{"note": "hidden", "salary": "hidden"})
+	shareTestSchema(t, schema.ID, &editor.ID, nil, models.FormRoleEditor, models.RowScopeAll, map[string]string{"salary": "read"})
+	shareTestSchema(t, schema.ID, &submitter.ID, nil, models.FormRoleSubmitter, models.RowScopeOwn, map[string]string{"note": "hidden"})
+
+	ownerRecord := createTestRecord(t, schema.ID, map[string]interface{}{"name": "甲", "note": "secret-note", "salary": 100})
+	config.DB.Model(ownerRecord).Update("user_id", owner.ID)
+	viewerRecord := createTestRecord(t, schema.ID, map[string]interface{}{"name": "乙", "note": "own-note", "salary": 200})
+	config.DB.Model(viewerRecord).Update("user_id", viewer.ID)
+	assigned := createTestRecord(t, schema.ID, map[string]interface{}{"name": "丙", "note": "review-note", "salary": 300})
+	config.DB.Model(assigned).Update("user_id", owner.ID)
+	config.DB.Create(&models.FormRecordAssignee{RecordID: assigned.ID, UserID: viewer.ID, AssignedBy: owner.ID})
+
+	listPath := "/api/forms/" + strconv.FormatUint(uint64(schema.ID), 10) + "/records"
+	recordPath := func(id uint) string { return "/api/forms/records/" + strconv.FormatUint(uint64(id), 10) }
+
+	// list 返回记录名称和记录中出现的字段
+	list := func(t *testing.T, token, query string) ([]string, map[string]bool) {
+		t.Helper()
+		resp := doRequest(t, r, http.MethodGet, listPath+query, token, nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("list: %d %s", resp.Status, resp.Message)
+		}
+		var page struct {
+			List []models.FormRecordResponse `json:"list"`
+		}
+		resp.decode(t, &page)
+		var names []string
+		keys := make(map[string]bool)
+		for _, record := range page.List {
+			names = append(names, record.Data["name"].(string))
+			for key := range record.Data {
+				keys[key] = true
+			}
+		}
+		sort.Strings(names)
+		return names, keys
+	}
+
+	t.Run("仅自己的记录和指派给自己的记录", func(t *testing.T) {
+		token, _ := loginAs(t, viewer)
+		names, keys := list(t, token, "")
+		if !reflect.DeepEqual(names, []string{"丙", "乙"}) {
+			t.Errorf("records = %v", names)
+		}
+		if keys["note"] || keys["salary"] || !keys["name"] {
+			t.Errorf("fields = %v", keys)
+		}
+
+		// 隐藏字段不能用于搜索
+		if names, _ := list(t, token, "?keyword=own-note"); len(names) != 0 {
+			t.Errorf("search by hidden field = %v", names)
+		}
+
+		if resp := doRequest(t, r, http.MethodGet, recordPath(ownerRecord.ID), token, nil); resp.Status != http.StatusNotFound {
+			t.Errorf("other's record: status = %d, want 404", resp.Status)
+		}
+		resp := doRequest(t, r, http.MethodGet, recordPath(assigned.ID), token, nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("assigned record: %d %s", resp.Status, resp.Message)
+		}
+		var record models.FormRecordResponse
+		resp.decode(t, &record)
+		if _, ok := record.Data["salary"]; ok || record.Data["name"] != "丙" {
+			t.Errorf("assigned record data = %v", record.Data)
+		}
+
+		if resp := doRequest(t, r, http.MethodPut, recordPath(viewerRecord.ID), token, gin.H{"data": gin.H{"name": "改"}}); resp.Status != http.StatusForbidden {
+			t.Errorf("viewer update: status = %d, want 403", resp.Status)
+		}
+	})
+
+	t.Run("全部记录和只读字段", func(t *testing.T) {
+		token, _ := loginAs(t, editor)
+		names, keys := list(t, token, "")
+		if !reflect.DeepEqual(names, []string{"丙", "乙", "甲"}) {
+			t.Errorf("records = %v", names)
+		}
+		if !keys["note"] || !keys["salary"] {
+			t.Errorf("fields = %v", keys)
+		}
+		if names, _ := list(t, token, "?keyword=secret-note"); !reflect.DeepEqual(names, []string{"甲"}) {
+			t.Errorf("search = %v", names)
+		}
+
+		// 只读字段不能修改，未提交时保持原值
+		if resp := doRequest(t, r, http.MethodPut, recordPath(ownerRecord.ID), token, gin.H{"data": gin.H{"name": "甲", "salary": 999}}); resp.Status != http.StatusForbidden {
+			t.Errorf("update read-only field: status = %d, want 403", resp.Status)
+		}
+		if resp := doRequest(t, r, http.MethodPut, recordPath(ownerRecord.ID), token, gin.H{"data": gin.H{"name": "甲2", "note": "n"}}); resp.Status != http.StatusOK {
+			t.Fatalf("update: %d %s", resp.Status, resp.Message)
+		}
+		var saved models.FormRecord
+		config.DB.First(&saved, ownerRecord.ID)
+		var data map[string]interface{}
+		json.Unmarshal(saved.Data, &data)
+		if data["name"] != "甲2" || data["salary"] != 100.0 {
+			t.Errorf("saved data = %v", data)
+		}
+	})
+
+	t.Run("提交者不能填写隐藏字段", func(t *testing.T) {
+		token, _ := loginAs(t, submitter)
+		if resp := doRequest(t, r, http.MethodPost, "/api/forms/records", token, gin.H{"schema_id": schema.ID, "data": gin.H{"name": "丁", "note": "x"}}); resp.Status == http.StatusOK {
+			t.Error("submitter wrote hidden field")
+		}
+		resp := doRequest(t, r, http.MethodPost, "/api/forms/records", token, gin.H{"schema_id": schema.ID, "data": gin.H{"name": "丁", "salary": 50}})
+		if resp.Status != http.StatusOK {
+			t.Fatalf("create: %d %s", resp.Status, resp.Message)
+		}
+		var created models.FormRecordResponse
+		resp.decode(t, &created)
+		if _, ok := created.Data["note"]; ok {
+			t.Errorf("created data = %v", created.Data)
+		}
+
+		names, _ := list(t, token, "")
+		if !reflect.DeepEqual(names, []string{"丁"}) {
+			t.Errorf("records = %v", names)
+		}
+		if resp := doRequest(t, r, http.MethodPut, recordPath(created.ID), token, gin.H{"data": gin.H{"name": "丁2"}}); resp.Status != http.StatusOK {
+			t.Errorf("update own record: %d %s", resp.Status, resp.Message)
+		}
+	})
+
+	t.Run("未共享的用户", func(t *testing.T) {
+		token, _ := loginAs(t, stranger)
+		if resp := doRequest(t, r, http.MethodGet, listPath, token, nil); resp.Status != http.StatusNotFound {
+			t.Errorf("list: status = %d, want 404", resp.Status)
+		}
+		if resp := doRequest(t, r, http.MethodGet, recordPath(viewerRecord.ID), token, nil); resp.Status != http.StatusNotFound {
+			t.Errorf("get: status = %d, want 404", resp.Status)
+		}
+	})
+}
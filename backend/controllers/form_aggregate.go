@@ -0,0 +1,583 @@
+package controllers
+
+import (
+	"fmt"
+	"material-platform/models"
+	"material-platform/utils"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// aggregateDefaultLimit 聚合结果默认返回的分组数
+	aggregateDefaultLimit = 1000
+	// aggregateMaxLimit 聚合结果最多返回的分组数
+	aggregateMaxLimit = 10000
+)
+
+// AggregateGroup 分组条件
+type AggregateGroup struct {
+	Field  string `json:"field"`            // 字段名，或 user_id、created_at、updated_at
+	Bucket string `json:"bucket,omitempty"` // 时间字段的分组粒度: day, week, month, quarter, year
+}
+
+// AggregateMetric 统计指标
+type AggregateMetric struct {
+	Op    string `json:"op"`              // count, sum, avg, min, max, distinct
+	Field string `json:"field,omitempty"` // count 可省略
+	Alias string `json:"alias,omitempty"` // 结果中的键名，默认为 op 或 op_field
+}
+
+// AggregateQuery 聚合查询条件
+type AggregateQuery struct {
+	GroupBy   []AggregateGroup  `json:"group_by"`
+	Metrics   []AggregateMetric `json:"metrics"`
+	Filters   []RecordFilter    `json:"filters,omitempty"`
+	Keyword   string            `json:"keyword,omitempty"`
+	Columns   []string          `json:"columns,omitempty"`    // 作为透视表列的分组字段，其余分组字段作为行
+	SortBy    string            `json:"sort_by,omitempty"`    // 分组字段或指标键名，默认按分组字段升序
+	SortOrder string            `json:"sort_order,omitempty"` // asc, desc
+	Limit     int               `json:"limit,omitempty"`
+}
+
+// AggregateDimension 结果中的分组维度
+type AggregateDimension struct {
+	Key     string                   `json:"key"`
+	Label   string                   `json:"label"`
+	Type    string                   `json:"type"`
+	Bucket  string                   `json:"bucket,omitempty"`
+	Options []models.FormFieldOption `json:"options,omitempty"` // 枚举字段的选项，用于展示标签
+}
+
+// AggregateMeasure 结果中的统计指标
+type AggregateMeasure struct {
+	Key   string `json:"key"`
+	Field string `json:"field,omitempty"`
+	Label string `json:"label"`
+	Op    string `json:"op"`
+}
+
+// AggregateRow 一个分组的统计结果
+type AggregateRow struct {
+	Keys   map[string]interface{} `json:"keys"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// AggregatePivotRow 透视表的一行，Cells与Columns一一对应，没有数据的单元格为null
+type AggregatePivotRow struct {
+	Keys  map[string]interface{}   `json:"keys"`
+	Cells []map[string]interface{} `json:"cells"`
+}
+
+// AggregatePivot 透视表结构
+type AggregatePivot struct {
+	RowFields    []string                 `json:"row_fields"`
+	ColumnFields []string                 `json:"column_fields"`
+	Columns      []map[string]interface{} `json:"columns"`
+	Rows         []AggregatePivotRow      `json:"rows"`
+}
+
+// AggregateResult 聚合查询结果
+type AggregateResult struct {
+	Dimensions []AggregateDimension   `json:"dimensions"`
+	Measures   []AggregateMeasure     `json:"measures"`
+	Rows       []AggregateRow         `json:"rows"`
+	Totals     map[string]interface{} `json:"totals"`
+	Truncated  bool                   `json:"truncated"` // 分组数超过limit，结果被截断
+	Pivot      *AggregatePivot        `json:"pivot,omitempty"`
+}
+
+// aggregateMetaLabels 可分组的记录元数据列
+var aggregateMetaLabels = map[string]string{
+	"user_id":    "创建人",
+	"created_at": "创建时间",
+	"updated_at": "更新时间",
+}
+
+// aggregateOpLabels 统计方式的名称
+var aggregateOpLabels = map[string]string{
+	"count":    "数量",
+	"sum":      "合计",
+	"avg":      "平均值",
+	"min":      "最小值",
+	"max":      "最大值",
+	"distinct": "去重数量",
+}
+
+// aggregatePlan 编译后的聚合查询
+type aggregatePlan struct {
+	query      AggregateQuery
+	dimensions []AggregateDimension
+	measures   []AggregateMeasure
+	groupExprs []string
+	joins      []string
+	metricSQL  []string
+	order      string
+	limit      int
+}
+
+// compileAggregate 校验聚合查询条件并生成SQL片段，字段表达式均来自表单结构定义
+func compileAggregate(schema *models.FormSchema, fields []models.FormField, q AggregateQuery) (*aggregatePlan, error) {
+	storage := newRecordStorage(schema, fields)
+	plan := &aggregatePlan{query: q, limit: q.Limit}
+	if plan.limit <= 0 {
+		plan.limit = aggregateDefaultLimit
+	}
+	if plan.limit > aggregateMaxLimit {
+		plan.limit = aggregateMaxLimit
+	}
+
+	if len(q.Metrics) == 0 {
+		q.Metrics = []AggregateMetric{{Op: "count"}}
+		plan.query.Metrics = q.Metrics
+	}
+
+	seen := make(map[string]bool)
+	for i, group := range q.GroupBy {
+		if seen[group.Field] {
+			return nil, fmt.Errorf("分组字段 '%s' 重复", group.Field)
+		}
+		seen[group.Field] = true
+
+		expr, field, err := resolveRecordColumn(storage, fields, group.Field)
+		if err != nil || group.Field == "id" {
+			return nil, fmt.Errorf("分组字段 '%s' 不存在", group.Field)
+		}
+
+		dimension := AggregateDimension{Key: group.Field, Bucket: group.Bucket}
+		isTime := false
+		if field != nil {
+			dimension.Label = field.Label
+			dimension.Type = field.Type
+			if field.Type == "single_enum" || field.Type == "multi_enum" {
+				dimension.Options = getEnumOptions(*field)
+			}
+			isTime = field.Type == "datetime" && field.TimeFormat != "time"
+
+			// 多值字段按数组中的每个值分组
+			if isMultiValueField(*field) {
+				alias := fmt.Sprintf("je%d", i)
+				plan.joins = append(plan.joins, "LEFT JOIN "+storage.jsonEachExpr(group.Field)+" AS "+alias+" ON 1 = 1")
+				expr = alias + ".value"
+			}
+		} else {
+			dimension.Label = aggregateMetaLabels[group.Field]
+			dimension.Type = "integer"
+			if group.Field != "user_id" {
+				dimension.Type = "datetime"
+				isTime = true
+			}
+		}
+
+		if group.Bucket != "" {
+			if !isTime {
+				return nil, fmt.Errorf("字段 '%s' 不是日期时间字段，不能按时间分组", group.Field)
+			}
+			if expr, err = timeBucketExpr(expr, group.Bucket); err != nil {
+				return nil, err
+			}
+		}
+
+		plan.dimensions = append(plan.dimensions, dimension)
+		plan.groupExprs = append(plan.groupExprs, expr)
+	}
+
+	keys := make(map[string]bool)
+	for _, metric := range q.Metrics {
+		measure := AggregateMeasure{Key: metric.Alias, Field: metric.Field, Op: metric.Op}
+		label, exists := aggregateOpLabels[metric.Op]
+		if !exists {
+			return nil, fmt.Errorf("不支持的统计方式 '%s'", metric.Op)
+		}
+
+		var sql string
+		if metric.Op == "count" && metric.Field == "" {
+			sql = "COUNT(DISTINCT form_records.id)"
+			measure.Label = label
+			if measure.Key == "" {
+				measure.Key = "count"
+			}
+		} else {
+			expr, field, err := resolveRecordColumn(storage, fields, metric.Field)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkMetricField(metric, field); err != nil {
+				return nil, err
+			}
+
+			fieldLabel := aggregateMetaLabels[metric.Field]
+			if field != nil {
+				fieldLabel = field.Label
+			}
+			measure.Label = fieldLabel + label
+			if measure.Key == "" {
+				measure.Key = metric.Op + "_" + metric.Field
+			}
+
+			switch metric.Op {
+			case "count":
+				sql = "COUNT(" + expr + ")"
+			case "distinct":
+				sql = "COUNT(DISTINCT " + expr + ")"
+			default:
+				sql = strings.ToUpper(metric.Op) + "(" + expr + ")"
+			}
+		}
+
+		if keys[measure.Key] || seen[measure.Key] {
+			return nil, fmt.Errorf("指标名称 '%s' 重复", measure.Key)
+		}
+		keys[measure.Key] = true
+		plan.measures = append(plan.measures, measure)
+		plan.metricSQL = append(plan.metricSQL, sql)
+	}
+
+	// 透视表的列必须是分组字段
+	for _, column := range q.Columns {
+		if !seen[column] {
+			return nil, fmt.Errorf("透视列 '%s' 不在分组字段中", column)
+		}
+	}
+
+	// 排序：按指标或分组字段，默认按分组字段升序
+	direction := "ASC"
+	if strings.EqualFold(q.SortOrder, "desc") {
+		direction = "DESC"
+	}
+	var orders []string
+	for i, measure := range plan.measures {
+		if measure.Key == q.SortBy {
+			orders = append(orders, fmt.Sprintf("m%d %s", i, direction))
+		}
+	}
+	for i, dimension := range plan.dimensions {
+		if dimension.Key == q.SortBy {
+			orders = append(orders, fmt.Sprintf("g%d %s", i, direction))
+		}
+	}
+	if q.SortBy != "" && len(orders) == 0 {
+		return nil, fmt.Errorf("排序字段 '%s' 不在分组字段或指标中", q.SortBy)
+	}
+	for i := range plan.dimensions {
+		orders = append(orders, fmt.Sprintf("g%d ASC", i))
+	}
+	plan.order = strings.Join(orders, ", ")
+
+	// 校验筛选条件
+	if _, err := buildRecordQuery(schema, fields, q.Keyword, q.Filters); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// checkMetricField 检查字段是否支持指定的统计方式
+func checkMetricField(metric AggregateMetric, field *models.FormField) error {
+	if metric.Op == "count" || metric.Op == "distinct" {
+		return nil
+	}
+
+	fieldType := "datetime"
+	label := aggregateMetaLabels[metric.Field]
+	if metric.Field == "id" || metric.Field == "user_id" {
+		fieldType = "integer"
+	}
+	if field != nil {
+		fieldType = field.Type
+		label = field.Label
+	}
+
+	switch fieldType {
+	case "integer", "float", "formula":
+		return nil
+	case "datetime":
+		// 时间字段只能取最早、最晚
+		if metric.Op == "min" || metric.Op == "max" {
+			return nil
+		}
+	}
+	return fmt.Errorf("字段 '%s' 不是数值字段，不支持 %s 统计", label, metric.Op)
+}
+
+// timeBucketExpr 生成按时间粒度分组的SQL表达式
+func timeBucketExpr(expr, bucket string) (string, error) {
+	switch bucket {
+	case "day":
+		return "strftime('%Y-%m-%d', " + expr + ")", nil
+	case "week":
+		// 以周一作为一周的开始
+		return "date(" + expr + ", '-6 days', 'weekday 1')", nil
+	case "month":
+		return "strftime('%Y-%m', " + expr + ")", nil
+	case "quarter":
+		return "strftime('%Y', " + expr + ") || '-Q' || ((CAST(strftime('%m', " + expr + ") AS INTEGER) + 2) / 3)", nil
+	case "year":
+		return "strftime('%Y', " + expr + ")", nil
+	}
+	return "", fmt.Errorf("不支持的时间分组粒度 '%s'", bucket)
+}
+
+// runAggregate 执行聚合查询
+func runAggregate(schema *models.FormSchema, fields []models.FormField, plan *aggregatePlan) (*AggregateResult, error) {
+	baseQuery := func() (*gorm.DB, error) {
+		return buildRecordQuery(schema, fields, plan.query.Keyword, plan.query.Filters)
+	}
+
+	selects := make([]string, 0, len(plan.groupExprs)+len(plan.metricSQL))
+	for i, expr := range plan.groupExprs {
+		selects = append(selects, fmt.Sprintf("%s AS g%d", expr, i))
+	}
+	for i, sql := range plan.metricSQL {
+		selects = append(selects, fmt.Sprintf("%s AS m%d", sql, i))
+	}
+
+	query, err := baseQuery()
+	if err != nil {
+		return nil, err
+	}
+	for _, join := range plan.joins {
+		query = query.Joins(join)
+	}
+	query = query.Select(strings.Join(selects, ", "))
+	if len(plan.groupExprs) > 0 {
+		groups := make([]string, len(plan.groupExprs))
+		for i := range groups {
+			groups[i] = fmt.Sprintf("g%d", i)
+		}
+		query = query.Group(strings.Join(groups, ", "))
+	}
+	if plan.order != "" {
+		query = query.Order(plan.order)
+	}
+
+	// 多取一条用于判断是否被截断
+	var rows []map[string]interface{}
+	if err := query.Limit(plan.limit + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := &AggregateResult{
+		Dimensions: plan.dimensions,
+		Measures:   plan.measures,
+		Rows:       make([]AggregateRow, 0, len(rows)),
+	}
+	if len(rows) > plan.limit {
+		rows = rows[:plan.limit]
+		result.Truncated = true
+	}
+	for _, row := range rows {
+		result.Rows = append(result.Rows, AggregateRow{
+			Keys:   pickAggregateValues(row, "g", dimensionKeys(plan.dimensions)),
+			Values: pickAggregateValues(row, "m", measureKeys(plan.measures)),
+		})
+	}
+
+	// 总计不按分组，也不展开多值字段
+	totalQuery, err := baseQuery()
+	if err != nil {
+		return nil, err
+	}
+	metricSelects := make([]string, len(plan.metricSQL))
+	for i, sql := range plan.metricSQL {
+		metricSelects[i] = fmt.Sprintf("%s AS m%d", sql, i)
+	}
+	totals := make(map[string]interface{})
+	if err := totalQuery.Select(strings.Join(metricSelects, ", ")).Take(&totals).Error; err != nil {
+		return nil, err
+	}
+	result.Totals = pickAggregateValues(totals, "m", measureKeys(plan.measures))
+
+	if len(plan.query.Columns) > 0 {
+		result.Pivot = buildAggregatePivot(plan, result.Rows)
+	}
+
+	return result, nil
+}
+
+// dimensionKeys 返回分组维度的键名
+func dimensionKeys(dimensions []AggregateDimension) []string {
+	keys := make([]string, len(dimensions))
+	for i, dimension := range dimensions {
+		keys[i] = dimension.Key
+	}
+	return keys
+}
+
+// measureKeys 返回统计指标的键名
+func measureKeys(measures []AggregateMeasure) []string {
+	keys := make([]string, len(measures))
+	for i, measure := range measures {
+		keys[i] = measure.Key
+	}
+	return keys
+}
+
+// pickAggregateValues 将查询结果中按序号命名的列(如g0、m1)转换为按键名索引
+func pickAggregateValues(row map[string]interface{}, prefix string, keys []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(keys))
+	for i, key := range keys {
+		value := row[fmt.Sprintf("%s%d", prefix, i)]
+		if raw, ok := value.([]byte); ok {
+			value = string(raw)
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// buildAggregatePivot 将分组结果转换为透视表，列按分组值排序
+func buildAggregatePivot(plan *aggregatePlan, rows []AggregateRow) *AggregatePivot {
+	columnSet := make(map[string]bool, len(plan.query.Columns))
+	for _, column := range plan.query.Columns {
+		columnSet[column] = true
+	}
+	pivot := &AggregatePivot{ColumnFields: plan.query.Columns, RowFields: []string{}}
+	for _, dimension := range plan.dimensions {
+		if !columnSet[dimension.Key] {
+			pivot.RowFields = append(pivot.RowFields, dimension.Key)
+		}
+	}
+
+	columnIndex := make(map[string]int)
+	rowIndex := make(map[string]int)
+	type cell struct {
+		row, column string
+		values      map[string]interface{}
+	}
+	var cells []cell
+	var rowKeys []map[string]interface{}
+
+	for _, row := range rows {
+		columnKeys, columnID := subsetKeys(row.Keys, pivot.ColumnFields)
+		keys, rowID := subsetKeys(row.Keys, pivot.RowFields)
+		if _, exists := columnIndex[columnID]; !exists {
+			columnIndex[columnID] = len(pivot.Columns)
+			pivot.Columns = append(pivot.Columns, columnKeys)
+		}
+		if _, exists := rowIndex[rowID]; !exists {
+			rowIndex[rowID] = len(rowKeys)
+			rowKeys = append(rowKeys, keys)
+		}
+		cells = append(cells, cell{row: rowID, column: columnID, values: row.Values})
+	}
+
+	// 列按分组值升序排列
+	order := make([]int, len(pivot.Columns))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		for _, key := range pivot.ColumnFields {
+			if c := compareAggregateValues(pivot.Columns[order[a]][key], pivot.Columns[order[b]][key]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	sorted := make([]map[string]interface{}, len(order))
+	position := make([]int, len(order))
+	for i, index := range order {
+		sorted[i] = pivot.Columns[index]
+		position[index] = i
+	}
+	pivot.Columns = sorted
+
+	pivot.Rows = make([]AggregatePivotRow, len(rowKeys))
+	for i, keys := range rowKeys {
+		pivot.Rows[i] = AggregatePivotRow{Keys: keys, Cells: make([]map[string]interface{}, len(pivot.Columns))}
+	}
+	for _, c := range cells {
+		pivot.Rows[rowIndex[c.row]].Cells[position[columnIndex[c.column]]] = c.values
+	}
+
+	return pivot
+}
+
+// subsetKeys 取出指定的分组值，并生成用于去重的标识
+func subsetKeys(keys map[string]interface{}, fields []string) (map[string]interface{}, string) {
+	subset := make(map[string]interface{}, len(fields))
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		subset[field] = keys[field]
+		parts[i] = fmt.Sprintf("%T:%v", keys[field], keys[field])
+	}
+	return subset, strings.Join(parts, "\x00")
+}
+
+// compareAggregateValues 比较两个分组值，空值排在最前
+func compareAggregateValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	x, xok := toFloat(a)
+	y, yok := toFloat(b)
+	if xok && yok {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// toFloat 将数值类型转换为float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// AggregateFormRecords 按分组统计表单记录
+func AggregateFormRecords(c *gin.Context) {
+	var req AggregateQuery
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	// 不可见的字段不能用于分组、统计和筛选
+	fields = visibleFields(schema.Permission, fields)
+
+	plan, err := compileAggregate(schema, fields, req)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "统计条件错误: "+err.Error())
+		return
+	}
+
+	result, err := runAggregate(schema, fields, plan)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "统计失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, result)
+}
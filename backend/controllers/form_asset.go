@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// isAssetField 判断字段是否为引用资源ID的文件字段
+func isAssetField(field models.FormField) bool {
+	return field.Type == "file" || field.Type == "image"
+}
+
+// matchAssetAccept 判断资源是否符合字段允许的类型(扩展名或MIME类型，逗号分隔)
+func matchAssetAccept(accept string, asset models.Asset) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	ext := strings.ToLower(filepath.Ext(asset.OriginalName))
+	for _, rule := range strings.Split(accept, ",") {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		switch {
+		case rule == "":
+			continue
+		case strings.HasPrefix(rule, "."):
+			if ext == rule {
+				return true
+			}
+		case strings.HasSuffix(rule, "/*"):
+			if strings.HasPrefix(asset.MimeType, strings.TrimSuffix(rule, "*")) {
+				return true
+			}
+		case rule == asset.MimeType:
+			return true
+		}
+	}
+	return false
+}
+
+// prepareAssetFields 校验记录中的文件字段，并将字段值规范化为资源ID(多文件字段为ID数组)
+// 资源必须存在，且由当前用户上传、已被该记录引用，或当前用户有查看全部资源的权限
+func prepareAssetFields(fields []models.FormField, data map[string]interface{}, userID uint, readAnyAsset bool, recordID uint) error {
+	for _, field := range fields {
+		if !isAssetField(field) {
+			continue
+		}
+
+		key := getFieldKey(field)
+		ids, err := parseIDList(data[key])
+		if err != nil {
+			return fmt.Errorf("字段 '%s': %v", field.Label, err)
+		}
+
+		if len(ids) == 0 {
+			delete(data, key)
+			continue
+		}
+		if !field.Multiple && len(ids) > 1 {
+			return fmt.Errorf("字段 '%s' 只能上传一个文件", field.Label)
+		}
+		if field.MaxFiles != nil && len(ids) > *field.MaxFiles {
+			return fmt.Errorf("字段 '%s' 最多上传 %d 个文件", field.Label, *field.MaxFiles)
+		}
+
+		var assets []models.Asset
+		if err := config.DB.Where("id IN ?", ids).Find(&assets).Error; err != nil {
+			return fmt.Errorf("查询资源失败")
+		}
+		assetMap := make(map[uint]models.Asset, len(assets))
+		for _, asset := range assets {
+			assetMap[asset.ID] = asset
+		}
+
+		// 记录已引用的资源允许继续保留(例如管理员上传的文件)
+		linked := make(map[uint]bool)
+		if recordID != 0 {
+			var linkedIDs []uint
+			config.DB.Model(&models.FormRecordAsset{}).Where("record_id = ?", recordID).Pluck("asset_id", &linkedIDs)
+			for _, id := range linkedIDs {
+				linked[id] = true
+			}
+		}
+
+		for _, id := range ids {
+			asset, exists := assetMap[id]
+			if !exists {
+				return fmt.Errorf("字段 '%s' 引用的文件 %d 不存在", field.Label, id)
+			}
+			if !readAnyAsset && asset.UserID != userID && !linked[id] {
+				return fmt.Errorf("字段 '%s' 无权引用文件 %d", field.Label, id)
+			}
+			if field.Type == "image" && asset.FileType != "image" {
+				return fmt.Errorf("字段 '%s' 只能上传图片", field.Label)
+			}
+			if !matchAssetAccept(field.Accept, asset) {
+				return fmt.Errorf("字段 '%s' 不支持文件 '%s' 的类型", field.Label, asset.OriginalName)
+			}
+		}
+
+		if field.Multiple {
+			data[key] = ids
+		} else {
+			data[key] = ids[0]
+		}
+	}
+
+	return nil
+}
+
+// syncRecordAssets 同步记录对资源的引用并维护引用计数，返回引用计数归零后需要删除的物理文件
+func syncRecordAssets(tx *gorm.DB, recordID uint, fields []models.FormField, data map[string]interface{}) ([]string, error) {
+	type linkKey struct {
+		FieldKey string
+		AssetID  uint
+	}
+
+	// 期望的引用关系
+	desired := make(map[linkKey]bool)
+	for _, field := range fields {
+		if !isAssetField(field) {
+			continue
+		}
+		key := getFieldKey(field)
+		ids, err := parseIDList(data[key])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			desired[linkKey{key, id}] = true
+		}
+	}
+
+	// 现有的引用关系
+	var existing []models.FormRecordAsset
+	if err := tx.Where("record_id = ?", recordID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	var released []uint
+	for _, link := range existing {
+		k := linkKey{link.FieldKey, link.AssetID}
+		if desired[k] {
+			delete(desired, k)
+			continue
+		}
+		if err := tx.Where("record_id = ? AND field_key = ? AND asset_id = ?", recordID, link.FieldKey, link.AssetID).
+			Delete(&models.FormRecordAsset{}).Error; err != nil {
+			return nil, err
+		}
+		released = append(released, link.AssetID)
+	}
+
+	for k := range desired {
+		link := models.FormRecordAsset{RecordID: recordID, FieldKey: k.FieldKey, AssetID: k.AssetID}
+		if err := tx.Create(&link).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Asset{}).Where("id = ?", k.AssetID).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + ?", 1)).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return releaseAssets(tx, released)
+}
+
+// releaseRecordAssets 释放记录引用的全部资源，返回需要删除的物理文件
+func releaseRecordAssets(tx *gorm.DB, recordID uint) ([]string, error) {
+	var assetIDs []uint
+	if err := tx.Model(&models.FormRecordAsset{}).Where("record_id = ?", recordID).Pluck("asset_id", &assetIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("record_id = ?", recordID).Delete(&models.FormRecordAsset{}).Error; err != nil {
+		return nil, err
+	}
+	return releaseAssets(tx, assetIDs)
+}
+
+// releaseAssets 减少资源引用计数，删除计数归零的资源记录并返回其物理文件路径
+func releaseAssets(tx *gorm.DB, assetIDs []uint) ([]string, error) {
+	var paths []string
+	for _, id := range assetIDs {
+		if err := tx.Model(&models.Asset{}).Where("id = ? AND ref_count > 0", id).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - ?", 1)).Error; err != nil {
+			return nil, err
+		}
+
+		var asset models.Asset
+		if err := tx.First(&asset, id).Error; err != nil {
+			continue
+		}
+		if asset.RefCount <= 0 {
+			if err := tx.Delete(&asset).Error; err != nil {
+				return nil, err
+			}
+			paths = append(paths, asset.FilePath)
+		}
+	}
+	return paths, nil
+}
+
+// removeAssetFiles 删除资源的物理文件，应在数据库事务提交后调用
+func removeAssetFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除资源文件失败: %s, 错误: %v", path, err)
+		}
+	}
+}
+
+// loadRecordAssets 加载记录引用的资源，返回 记录ID -> 字段名 -> 资源列表
+func loadRecordAssets(recordIDs []uint) map[uint]map[string][]models.Asset {
+	result := make(map[uint]map[string][]models.Asset)
+	if len(recordIDs) == 0 {
+		return result
+	}
+
+	var links []models.FormRecordAsset
+	if err := config.DB.Where("record_id IN ?", recordIDs).Find(&links).Error; err != nil || len(links) == 0 {
+		return result
+	}
+
+	assetIDs := make([]uint, 0, len(links))
+	for _, link := range links {
+		assetIDs = append(assetIDs, link.AssetID)
+	}
+
+	var assets []models.Asset
+	config.DB.Where("id IN ?", assetIDs).Find(&assets)
+	assetMap := make(map[uint]models.Asset, len(assets))
+	for _, asset := range assets {
+		asset.URL = assetLink(asset.ID, assetLinkTTL)
+		assetMap[asset.ID] = asset
+	}
+
+	for _, link := range links {
+		asset, exists := assetMap[link.AssetID]
+		if !exists {
+			continue
+		}
+		if result[link.RecordID] == nil {
+			result[link.RecordID] = make(map[string][]models.Asset)
+		}
+		result[link.RecordID][link.FieldKey] = append(result[link.RecordID][link.FieldKey], asset)
+	}
+
+	return result
+}
+
+// buildRecordResponses 构建表单记录响应，加载物理表存储的数据并展开文件字段引用的资源
+func buildRecordResponses(records []models.FormRecord) []models.FormRecordResponse {
+	if err := hydrateRecordData(config.DB, records); err != nil {
+		log.Printf("加载记录数据失败: %v", err)
+	}
+	assets := loadRecordAssets(recordIDs(records))
+
+	responses := make([]models.FormRecordResponse, 0, len(records))
+	for i := range records {
+		record := &records[i]
+
+		var data map[string]interface{}
+		json.Unmarshal(record.Data, &data)
+
+		response := models.FormRecordResponse{
+			ID:        record.ID,
+			SchemaID:  record.SchemaID,
+			Data:      data,
+			UserID:    record.UserID,
+			State:     record.State,
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: record.UpdatedAt,
+			DeletedAt: record.DeletedAt,
+			Assets:    assets[record.ID],
+		}
+		if record.Schema.ID != 0 {
+			response.Schema = &record.Schema
+		}
+		if record.User.ID != 0 {
+			response.User = &record.User
+		}
+		responses = append(responses, response)
+	}
+
+	return responses
+}
+
+// buildRecordResponse 构建单条表单记录响应
+func buildRecordResponse(record models.FormRecord) models.FormRecordResponse {
+	return buildRecordResponses([]models.FormRecord{record})[0]
+}
@@ -0,0 +1,429 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/models"
+	"strconv"
+	"strings"
+)
+
+// conditionOps 字段条件支持的比较方式
+var conditionOps = map[string]bool{
+	"eq": true, "ne": true, "in": true, "not_in": true,
+	"gt": true, "gte": true, "lt": true, "lte": true,
+	"contains": true, "empty": true, "not_empty": true,
+}
+
+// groupItemFieldTypes 重复分组中允许使用的字段类型
+// 文件、关联等需要维护引用关系的字段只能放在顶层
+var groupItemFieldTypes = map[string]bool{
+	"string": true, "integer": true, "float": true, "boolean": true,
+	"datetime": true, "single_enum": true, "multi_enum": true,
+}
+
+// isGroupField 判断字段是否为重复分组
+func isGroupField(field models.FormField) bool {
+	return field.Type == "group"
+}
+
+// conditionScope 条件求值的作用域，分组条目内先查找同组字段，再查找顶层字段
+type conditionScope struct {
+	fields map[string]bool
+	data   map[string]interface{}
+	parent *conditionScope
+}
+
+// newConditionScope 创建条件求值的作用域
+func newConditionScope(fields []models.FormField, data map[string]interface{}, parent *conditionScope) *conditionScope {
+	scope := &conditionScope{fields: make(map[string]bool, len(fields)), data: data, parent: parent}
+	for _, field := range fields {
+		scope.fields[getFieldKey(field)] = true
+	}
+	return scope
+}
+
+// has 判断字段名在作用域内是否存在
+func (s *conditionScope) has(key string) bool {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.fields[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// value 获取字段在作用域内的值
+func (s *conditionScope) value(key string) interface{} {
+	for scope := s; scope != nil; scope = scope.parent {
+		if scope.fields[key] {
+			return scope.data[key]
+		}
+	}
+	return nil
+}
+
+// evaluateCondition 计算条件是否满足，条件为空时视为满足
+func evaluateCondition(condition *models.FieldCondition, scope *conditionScope) bool {
+	if condition == nil {
+		return true
+	}
+
+	for i := range condition.All {
+		if !evaluateCondition(&condition.All[i], scope) {
+			return false
+		}
+	}
+	if len(condition.Any) > 0 {
+		matched := false
+		for i := range condition.Any {
+			if evaluateCondition(&condition.Any[i], scope) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if condition.Field == "" {
+		return true
+	}
+
+	value := scope.value(condition.Field)
+	switch condition.Op {
+	case "", "eq":
+		return conditionMatches(value, condition.Value)
+	case "ne":
+		return !conditionMatches(value, condition.Value)
+	case "in", "not_in":
+		matched := false
+		if options, ok := condition.Value.([]interface{}); ok {
+			for _, option := range options {
+				if conditionMatches(value, option) {
+					matched = true
+					break
+				}
+			}
+		}
+		return matched == (condition.Op == "in")
+	case "gt", "gte", "lt", "lte":
+		if isEmptyValue(value) {
+			return false
+		}
+		c := compareConditionValues(value, condition.Value)
+		switch condition.Op {
+		case "gt":
+			return c > 0
+		case "gte":
+			return c >= 0
+		case "lt":
+			return c < 0
+		}
+		return c <= 0
+	case "contains":
+		if items, ok := value.([]interface{}); ok {
+			for _, item := range items {
+				if conditionEquals(item, condition.Value) {
+					return true
+				}
+			}
+			return false
+		}
+		return value != nil && strings.Contains(fmt.Sprint(value), fmt.Sprint(condition.Value))
+	case "empty":
+		return isEmptyValue(value)
+	case "not_empty":
+		return !isEmptyValue(value)
+	}
+	return false
+}
+
+// conditionMatches 字段值与条件值是否相等，多值字段包含条件值即视为相等
+func conditionMatches(value, target interface{}) bool {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if conditionEquals(item, target) {
+				return true
+			}
+		}
+		return false
+	}
+	return conditionEquals(value, target)
+}
+
+// conditionEquals 比较两个值是否相等，数值按数字比较，其余按文本比较
+func conditionEquals(a, b interface{}) bool {
+	if isEmptyValue(a) || isEmptyValue(b) {
+		return isEmptyValue(a) && isEmptyValue(b)
+	}
+	return compareConditionValues(a, b) == 0
+}
+
+// compareConditionValues 比较两个值的大小，都能转换为数字时按数字比较
+func compareConditionValues(a, b interface{}) int {
+	x, xok := conditionNumber(a)
+	y, yok := conditionNumber(b)
+	if xok && yok {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// conditionNumber 将值转换为数字，布尔值按0、1处理
+func conditionNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// isEmptyValue 判断值是否为空(nil、空字符串、空数组)
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// normalizeSchemaLayout 校验表单结构中的分节、条件逻辑和重复分组定义
+func normalizeSchemaLayout(fields []models.FormField, sections []models.FormSection) error {
+	scope := newConditionScope(fields, nil, nil)
+
+	sectionIDs := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		if strings.TrimSpace(section.ID) == "" {
+			return fmt.Errorf("分节 '%s' 缺少ID", section.Title)
+		}
+		if sectionIDs[section.ID] {
+			return fmt.Errorf("分节ID '%s' 重复", section.ID)
+		}
+		sectionIDs[section.ID] = true
+		if err := checkCondition(section.VisibleWhen, scope, ""); err != nil {
+			return fmt.Errorf("分节 '%s' 的显示条件: %v", section.Title, err)
+		}
+	}
+
+	for _, field := range fields {
+		if field.Section != "" && !sectionIDs[field.Section] {
+			return fmt.Errorf("字段 '%s' 所属的分节 '%s' 不存在", field.Label, field.Section)
+		}
+		if err := checkFieldConditions(field, scope); err != nil {
+			return err
+		}
+		if !isGroupField(field) {
+			continue
+		}
+
+		if len(field.Fields) == 0 {
+			return fmt.Errorf("重复分组 '%s' 至少需要一个子字段", field.Label)
+		}
+		if field.MinItems != nil && *field.MinItems < 0 || field.MaxItems != nil && *field.MaxItems < 1 {
+			return fmt.Errorf("重复分组 '%s' 的条目数限制无效", field.Label)
+		}
+		if field.MinItems != nil && field.MaxItems != nil && *field.MinItems > *field.MaxItems {
+			return fmt.Errorf("重复分组 '%s' 的最少条目数不能大于最多条目数", field.Label)
+		}
+
+		itemScope := newConditionScope(field.Fields, nil, scope)
+		seen := make(map[string]bool, len(field.Fields))
+		for _, item := range field.Fields {
+			key := getFieldKey(item)
+			if key == "" {
+				return fmt.Errorf("重复分组 '%s' 的子字段 '%s' 缺少字段名", field.Label, item.Label)
+			}
+			if seen[key] {
+				return fmt.Errorf("重复分组 '%s' 的子字段名 '%s' 重复", field.Label, key)
+			}
+			seen[key] = true
+			if !groupItemFieldTypes[item.Type] {
+				return fmt.Errorf("重复分组 '%s' 的子字段 '%s' 不支持 %s 类型", field.Label, item.Label, item.Type)
+			}
+			if err := checkFieldConditions(item, itemScope); err != nil {
+				return fmt.Errorf("重复分组 '%s': %v", field.Label, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkFieldConditions 校验字段的显示、必填条件
+func checkFieldConditions(field models.FormField, scope *conditionScope) error {
+	key := getFieldKey(field)
+	if err := checkCondition(field.VisibleWhen, scope, key); err != nil {
+		return fmt.Errorf("字段 '%s' 的显示条件: %v", field.Label, err)
+	}
+	if err := checkCondition(field.RequiredWhen, scope, key); err != nil {
+		return fmt.Errorf("字段 '%s' 的必填条件: %v", field.Label, err)
+	}
+	return nil
+}
+
+// checkCondition 校验条件引用的字段存在且比较方式有效，self为条件所属字段，条件不能引用自身
+func checkCondition(condition *models.FieldCondition, scope *conditionScope, self string) error {
+	if condition == nil {
+		return nil
+	}
+	for i := range condition.All {
+		if err := checkCondition(&condition.All[i], scope, self); err != nil {
+			return err
+		}
+	}
+	for i := range condition.Any {
+		if err := checkCondition(&condition.Any[i], scope, self); err != nil {
+			return err
+		}
+	}
+	if condition.Field == "" {
+		if len(condition.All) == 0 && len(condition.Any) == 0 {
+			return fmt.Errorf("条件缺少字段")
+		}
+		return nil
+	}
+
+	if condition.Field == self {
+		return fmt.Errorf("不能引用字段自身")
+	}
+	if !scope.has(condition.Field) {
+		return fmt.Errorf("引用的字段 '%s' 不存在", condition.Field)
+	}
+	if condition.Op != "" && !conditionOps[condition.Op] {
+		return fmt.Errorf("不支持的比较方式 '%s'", condition.Op)
+	}
+	if condition.Op == "in" || condition.Op == "not_in" {
+		if _, ok := condition.Value.([]interface{}); !ok {
+			return fmt.Errorf("比较方式 '%s' 的值必须是数组", condition.Op)
+		}
+	}
+	return nil
+}
+
+// hiddenFieldKeys 按条件计算隐藏的字段，并从数据中移除隐藏字段的值
+// 隐藏字段可能影响其他字段的条件，因此重复计算直到结果不再变化
+func hiddenFieldKeys(fields []models.FormField, sections []models.FormSection, data map[string]interface{}, parent *conditionScope) map[string]bool {
+	scope := newConditionScope(fields, data, parent)
+	sectionConditions := make(map[string]*models.FieldCondition, len(sections))
+	for i := range sections {
+		sectionConditions[sections[i].ID] = sections[i].VisibleWhen
+	}
+
+	hidden := make(map[string]bool)
+	for pass := 0; pass <= len(fields); pass++ {
+		changed := false
+		for _, field := range fields {
+			key := getFieldKey(field)
+			if hidden[key] {
+				continue
+			}
+			visible := evaluateCondition(field.VisibleWhen, scope)
+			if condition, exists := sectionConditions[field.Section]; exists && visible {
+				visible = evaluateCondition(condition, scope)
+			}
+			if !visible {
+				hidden[key] = true
+				delete(data, key)
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return hidden
+}
+
+// validateFieldValues 按条件逻辑校验数据：隐藏字段不校验且其值被移除，必填字段须有值，重复分组逐条校验
+func validateFieldValues(fields []models.FormField, sections []models.FormSection, data map[string]interface{}, parent *conditionScope) error {
+	hidden := hiddenFieldKeys(fields, sections, data, parent)
+	scope := newConditionScope(fields, data, parent)
+
+	for _, field := range fields {
+		fieldKey := getFieldKey(field)
+		if hidden[fieldKey] {
+			continue
+		}
+
+		value, exists := data[fieldKey]
+		if field.Required || field.RequiredWhen != nil && evaluateCondition(field.RequiredWhen, scope) {
+			if !exists || value == nil || value == "" {
+				return fmt.Errorf("字段 '%s' 是必填的", field.Label)
+			}
+		}
+
+		if isGroupField(field) && exists && value != nil {
+			items, err := validateGroupItems(field, value, scope)
+			if err != nil {
+				return err
+			}
+			data[fieldKey] = items
+		}
+	}
+
+	return nil
+}
+
+// validateGroupItems 校验重复分组的条目，只保留子字段的值
+func validateGroupItems(field models.FormField, value interface{}, parent *conditionScope) ([]interface{}, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("字段 '%s' 必须是数组", field.Label)
+	}
+	if field.Required && len(items) == 0 {
+		return nil, fmt.Errorf("字段 '%s' 是必填的", field.Label)
+	}
+	if field.MinItems != nil && len(items) < *field.MinItems {
+		return nil, fmt.Errorf("字段 '%s' 至少需要 %d 条", field.Label, *field.MinItems)
+	}
+	if field.MaxItems != nil && len(items) > *field.MaxItems {
+		return nil, fmt.Errorf("字段 '%s' 最多 %d 条", field.Label, *field.MaxItems)
+	}
+
+	result := make([]interface{}, 0, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("字段 '%s' 第 %d 条必须是对象", field.Label, i+1)
+		}
+
+		entry := make(map[string]interface{}, len(field.Fields))
+		for _, sub := range field.Fields {
+			key := getFieldKey(sub)
+			if v, exists := object[key]; exists {
+				entry[key] = v
+			}
+		}
+		if err := validateFieldValues(field.Fields, nil, entry, parent); err != nil {
+			return nil, fmt.Errorf("字段 '%s' 第 %d 条: %v", field.Label, i+1, err)
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
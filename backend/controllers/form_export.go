@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize 导出时每批读取的记录数
+const exportBatchSize = 500
+
+// exportTimeLayout 导出记录创建/更新时间使用的格式
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// ExportFormRecords 导出表单数据记录，支持 csv、xlsx、jsonl 格式
+func ExportFormRecords(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "xlsx" && format != "jsonl" {
+		utils.ErrorResponse(c, 400, "不支持的导出格式")
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	fields = sortFieldsByOrder(visibleFields(schema.Permission, fields))
+
+	filters, err := parseRecordFilters(c.Query("filters"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件格式错误: "+err.Error())
+		return
+	}
+
+	query, err := buildRecordQuery(schema, fields, c.Query("keyword"), filters)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件错误: "+err.Error())
+		return
+	}
+
+	baseURL := utils.GetBaseURL(c)
+	fileName := fmt.Sprintf("%s_%s.%s", schema.Name, time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"export.%s\"; filename*=UTF-8''%s",
+		format, url.PathEscape(fileName)))
+
+	switch format {
+	case "csv":
+		err = exportRecordsCSV(c, query, fields, baseURL)
+	case "xlsx":
+		err = exportRecordsXLSX(c, query, fields, baseURL)
+	case "jsonl":
+		err = exportRecordsJSONL(c, query, fields, baseURL)
+	}
+
+	// 响应头已发送，出错时只能记录日志
+	if err != nil {
+		log.Printf("表单 %d 导出失败: %v", schema.ID, err)
+	}
+}
+
+// exportRecordsCSV 以CSV格式流式导出记录
+func exportRecordsCSV(c *gin.Context, query *gorm.DB, fields []models.FormField, baseURL string) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(200)
+
+	// 写入BOM，便于Excel正确识别UTF-8编码
+	c.Writer.WriteString("\ufeff")
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(exportHeaders(fields))
+
+	err := eachRecordBatch(query, func(records []models.FormRecord) error {
+		assets := loadRecordAssets(recordIDs(records))
+		for _, record := range records {
+			row := exportRow(record, fields, baseURL, assets[record.ID])
+			cells := make([]string, len(row))
+			for i, value := range row {
+				cells[i] = exportCellText(value)
+			}
+			writer.Write(cells)
+		}
+		writer.Flush()
+		c.Writer.Flush()
+		return writer.Error()
+	})
+
+	writer.Flush()
+	return err
+}
+
+// exportRecordsXLSX 以XLSX格式导出记录，使用流式写入降低内存占用
+func exportRecordsXLSX(c *gin.Context, query *gorm.DB, fields []models.FormField, baseURL string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := f.GetSheetName(0)
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+
+	headers := exportHeaders(fields)
+	headerRow := make([]interface{}, len(headers))
+	for i, header := range headers {
+		headerRow[i] = header
+	}
+	if err := sw.SetRow("A1", headerRow); err != nil {
+		return err
+	}
+
+	rowIndex := 2
+	err = eachRecordBatch(query, func(records []models.FormRecord) error {
+		assets := loadRecordAssets(recordIDs(records))
+		for _, record := range records {
+			row := exportRow(record, fields, baseURL, assets[record.ID])
+			cells := make([]interface{}, len(row))
+			for i, value := range row {
+				switch v := value.(type) {
+				case float64, int64, int:
+					cells[i] = v
+				default:
+					cells[i] = exportCellText(v)
+				}
+			}
+
+			cell, _ := excelize.CoordinatesToCellName(1, rowIndex)
+			if err := sw.SetRow(cell, cells); err != nil {
+				return err
+			}
+			rowIndex++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Status(200)
+	return f.Write(c.Writer)
+}
+
+// exportRecordsJSONL 以JSON Lines格式流式导出记录，每行一条记录
+func exportRecordsJSONL(c *gin.Context, query *gorm.DB, fields []models.FormField, baseURL string) error {
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Status(200)
+
+	encoder := json.NewEncoder(c.Writer)
+	encoder.SetEscapeHTML(false)
+
+	return eachRecordBatch(query, func(records []models.FormRecord) error {
+		assets := loadRecordAssets(recordIDs(records))
+		for _, record := range records {
+			var data map[string]interface{}
+			json.Unmarshal(record.Data, &data)
+
+			values := make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				key := getFieldKey(field)
+				values[key] = exportFieldValue(field, data[key], baseURL, assets[record.ID][key])
+			}
+
+			line := gin.H{
+				"id":         record.ID,
+				"user_id":    record.UserID,
+				"created_at": record.CreatedAt,
+				"updated_at": record.UpdatedAt,
+				"data":       values,
+			}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+}
+
+// eachRecordBatch 按主键分批读取记录，物理表存储的记录会加载其数据
+func eachRecordBatch(query *gorm.DB, fn func(records []models.FormRecord) error) error {
+	var batch []models.FormRecord
+	return query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		if err := hydrateRecordData(config.DB, batch); err != nil {
+			return err
+		}
+		return fn(batch)
+	}).Error
+}
+
+// recordIDs 提取记录ID列表
+func recordIDs(records []models.FormRecord) []uint {
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	return ids
+}
+
+// sortFieldsByOrder 按SortOrder对字段排序，顺序相同时保持定义顺序
+func sortFieldsByOrder(fields []models.FormField) []models.FormField {
+	sorted := make([]models.FormField, len(fields))
+	copy(sorted, fields)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].SortOrder < sorted[j].SortOrder
+	})
+	return sorted
+}
+
+// exportHeaders 生成导出表头，字段列使用字段标签
+func exportHeaders(fields []models.FormField) []string {
+	headers := []string{"记录ID"}
+	for _, field := range fields {
+		label := field.Label
+		if label == "" {
+			label = getFieldKey(field)
+		}
+		headers = append(headers, label)
+	}
+	return append(headers, "创建时间", "更新时间")
+}
+
+// exportRow 生成一条记录的导出行，与exportHeaders的列一一对应
+func exportRow(record models.FormRecord, fields []models.FormField, baseURL string, assets map[string][]models.Asset) []interface{} {
+	var data map[string]interface{}
+	json.Unmarshal(record.Data, &data)
+
+	row := []interface{}{int64(record.ID)}
+	for _, field := range fields {
+		key := getFieldKey(field)
+		row = append(row, exportFieldValue(field, data[key], baseURL, assets[key]))
+	}
+	return append(row, record.CreatedAt.Format(exportTimeLayout), record.UpdatedAt.Format(exportTimeLayout))
+}
+
+// exportFieldValue 转换字段值用于导出：枚举输出标签，时间按字段格式输出，文件输出绝对URL
+// assets为该字段引用的资源，仅用于资源文件字段
+func exportFieldValue(field models.FormField, value interface{}, baseURL string, assets []models.Asset) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch {
+	case isAssetField(field):
+		urls := make([]string, 0, len(assets))
+		for _, asset := range assets {
+			urls = append(urls, utils.ToAbsoluteURL(baseURL, assetLink(asset.ID, assetExportLinkTTL)))
+		}
+		if !field.Multiple && len(urls) == 1 {
+			return urls[0]
+		}
+		return urls
+
+	case field.Type == "single_enum":
+		return enumOptionLabel(field, fmt.Sprint(value))
+
+	case field.Type == "multi_enum":
+		items, ok := value.([]interface{})
+		if !ok {
+			return enumOptionLabel(field, fmt.Sprint(value))
+		}
+		labels := make([]string, 0, len(items))
+		for _, item := range items {
+			labels = append(labels, enumOptionLabel(field, fmt.Sprint(item)))
+		}
+		return labels
+
+	case field.Type == "datetime":
+		if text, ok := value.(string); ok {
+			if t, ok := parseTimeValue(text); ok {
+				return formatTimeValue(field, t)
+			}
+		}
+		return value
+
+	case isFileField(field):
+		switch v := value.(type) {
+		case string:
+			return utils.ToAbsoluteURL(baseURL, v)
+		case []interface{}:
+			urls := make([]string, 0, len(v))
+			for _, item := range v {
+				urls = append(urls, utils.ToAbsoluteURL(baseURL, fmt.Sprint(item)))
+			}
+			return urls
+		}
+		return value
+	}
+
+	return value
+}
+
+// exportCellText 将导出值转换为单元格文本
+func exportCellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "是"
+		}
+		return "否"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, exportCellText(item))
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/models"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormatLayouts 时间字段格式与Go时间布局的对应关系
+var timeFormatLayouts = map[string]string{
+	"date_object": time.RFC3339,
+	"datetime":    "2006-01-02 15:04:05",
+	"date":        "2006-01-02",
+	"time":        "15:04:05",
+}
+
+// timeParseLayouts 解析时间文本时依次尝试的布局
+var timeParseLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"2006.01.02",
+	"15:04:05",
+	"15:04",
+}
+
+// parseTimeValue 按常见格式解析时间文本
+func parseTimeValue(text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	for _, layout := range timeParseLayouts {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// formatTimeValue 按字段的TimeFormat格式化时间
+func formatTimeValue(field models.FormField, t time.Time) string {
+	layout, ok := timeFormatLayouts[field.TimeFormat]
+	if !ok {
+		layout = timeFormatLayouts["datetime"]
+	}
+	return t.Format(layout)
+}
+
+// isFileField 判断字段是否为文件字段(包括旧的保存URL的字符串文件字段)
+func isFileField(field models.FormField) bool {
+	return isAssetField(field) || (field.Type == "string" && field.InputType == "file")
+}
+
+// getEnumOptions 获取枚举字段的选项(兼容旧的options字段)
+func getEnumOptions(field models.FormField) []models.FormFieldOption {
+	if len(field.EnumOptions) > 0 {
+		return field.EnumOptions
+	}
+	return field.Options
+}
+
+// enumOptionLabel 获取枚举值对应的选项标签，找不到时返回原值
+func enumOptionLabel(field models.FormField, value string) string {
+	for _, option := range getEnumOptions(field) {
+		if option.Value == value {
+			return option.Label
+		}
+	}
+	return value
+}
+
+// matchEnumOption 按选项值或标签匹配枚举选项，返回选项值
+func matchEnumOption(field models.FormField, text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	options := getEnumOptions(field)
+	for _, option := range options {
+		if option.Value == text {
+			return option.Value, true
+		}
+	}
+	for _, option := range options {
+		if strings.EqualFold(option.Label, text) {
+			return option.Value, true
+		}
+	}
+	return "", false
+}
+
+// splitMultiValue 拆分以逗号、分号或顿号分隔的多值文本
+func splitMultiValue(text string) []string {
+	parts := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ';' || r == '，' || r == '；' || r == '、' || r == '|'
+	})
+	values := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// convertFieldText 将文本(如导入的表格单元格)按字段类型转换为记录中存储的值
+// 空文本返回nil，表示该字段未填写
+func convertFieldText(field models.FormField, text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch field.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil || f != math.Trunc(f) {
+			return nil, fmt.Errorf("'%s' 不是有效的整数", text)
+		}
+		return int64(f), nil
+
+	case "float":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' 不是有效的数字", text)
+		}
+		return f, nil
+
+	case "boolean":
+		switch strings.ToLower(text) {
+		case "true", "1", "yes", "y", "是", "对", "真":
+			return true, nil
+		case "false", "0", "no", "n", "否", "错", "假":
+			return false, nil
+		}
+		return nil, fmt.Errorf("'%s' 不是有效的布尔值", text)
+
+	case "datetime":
+		t, ok := parseTimeValue(text)
+		if !ok {
+			return nil, fmt.Errorf("'%s' 不是有效的时间", text)
+		}
+		return formatTimeValue(field, t), nil
+
+	case "single_enum":
+		value, ok := matchEnumOption(field, text)
+		if !ok {
+			return nil, fmt.Errorf("'%s' 不是有效的选项", text)
+		}
+		return value, nil
+
+	case "multi_enum":
+		var values []string
+		for _, part := range splitMultiValue(text) {
+			value, ok := matchEnumOption(field, part)
+			if !ok {
+				return nil, fmt.Errorf("'%s' 不是有效的选项", part)
+			}
+			values = append(values, value)
+		}
+		return values, nil
+
+	case "group":
+		var items []interface{}
+		if err := json.Unmarshal([]byte(text), &items); err != nil {
+			return nil, fmt.Errorf("'%s' 不是有效的JSON数组", text)
+		}
+		return items, nil
+
+	case "file", "image", "relation":
+		ids, err := parseIDList(text)
+		if err != nil {
+			return nil, err
+		}
+		return ids, nil
+
+	default:
+		return text, nil
+	}
+}
+
+// parseIDList 解析文件、关联等字段值中的ID，支持单个ID、ID数组、逗号分隔文本以及包含id属性的对象
+func parseIDList(value interface{}) ([]uint, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case float64:
+		if v <= 0 || v != float64(uint(v)) {
+			return nil, fmt.Errorf("无效的ID")
+		}
+		return []uint{uint(v)}, nil
+	case int64:
+		if v <= 0 {
+			return nil, fmt.Errorf("无效的ID")
+		}
+		return []uint{uint(v)}, nil
+	case uint:
+		return []uint{v}, nil
+	case string:
+		var ids []uint
+		for _, part := range splitMultiValue(v) {
+			id, err := strconv.ParseUint(part, 10, 32)
+			if err != nil || id == 0 {
+				return nil, fmt.Errorf("无效的ID '%s'", part)
+			}
+			ids = append(ids, uint(id))
+		}
+		return ids, nil
+	case map[string]interface{}:
+		return parseIDList(v["id"])
+	case []uint:
+		return v, nil
+	case []interface{}:
+		var ids []uint
+		for _, item := range v {
+			itemIDs, err := parseIDList(item)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, itemIDs...)
+		}
+		return ids, nil
+	default:
+		return nil, fmt.Errorf("无效的ID")
+	}
+}
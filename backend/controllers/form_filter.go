@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// RecordFilter 表单记录筛选条件
+type RecordFilter struct {
+	Field string      `json:"field"` // 字段名，或 id、user_id、state、created_at、updated_at
+	Op    string      `json:"op"`    // eq, ne, gt, gte, lt, lte, contains, in, between, empty, not_empty
+	Value interface{} `json:"value"`
+}
+
+// recordMetaColumns 可直接筛选和排序的记录元数据列
+var recordMetaColumns = map[string]string{
+	"id":         "form_records.id",
+	"user_id":    "form_records.user_id",
+	"created_at": "form_records.created_at",
+	"updated_at": "form_records.updated_at",
+	"state":      "form_records.state",
+}
+
+// recordFieldExpr 生成读取记录数据中某个字段的SQL表达式
+// key必须来自表单结构定义，不能直接使用用户输入
+func recordFieldExpr(key string) string {
+	path := strings.ReplaceAll(jsonFieldPath(key), "'", "''")
+	return "json_extract(form_records.data, '" + path + "')"
+}
+
+// resolveRecordColumn 将字段名解析为SQL表达式，返回对应的字段定义(元数据列没有字段定义)
+func resolveRecordColumn(storage recordStorage, fields []models.FormField, key string) (string, *models.FormField, error) {
+	if field, exists := findFieldByKey(fields, key); exists {
+		return storage.fieldExpr(key), &field, nil
+	}
+	if column, exists := recordMetaColumns[key]; exists {
+		return column, nil, nil
+	}
+	return "", nil, fmt.Errorf("字段 '%s' 不存在", key)
+}
+
+// buildRecordQuery 构建表单记录查询，支持关键词搜索和字段筛选
+func buildRecordQuery(schema *models.FormSchema, fields []models.FormField, keyword string, filters []RecordFilter) (*gorm.DB, error) {
+	storage := newRecordStorage(schema, fields)
+	query := config.DB.Model(&models.FormRecord{}).Where("form_records.schema_id = ? AND form_records.is_deleted = ?", schema.ID, false)
+
+	// 按当前用户的记录可见范围限制
+	query = scopeRecordQuery(query, schema.Permission)
+
+	// 关键词搜索，存在不可见字段时只搜索可见字段
+	if keyword != "" {
+		var condition string
+		var count int
+		if hasHiddenFields(schema.Permission) {
+			condition, count = storage.fieldsKeywordCondition(fields)
+		} else {
+			condition, count = storage.keywordCondition()
+		}
+		args := make([]interface{}, count)
+		for i := range args {
+			args[i] = "%" + keyword + "%"
+		}
+		query = query.Where(condition, args...)
+	}
+
+	// 字段筛选
+	return applyRecordFilters(query, storage, fields, filters)
+}
+
+// parseRecordFilters 解析查询参数中的筛选条件(JSON数组)
+func parseRecordFilters(raw string) ([]RecordFilter, error) {
+	var filters []RecordFilter
+	if strings.TrimSpace(raw) == "" {
+		return filters, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &filters); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+// applyRecordFilters 将筛选条件应用到记录查询上
+func applyRecordFilters(query *gorm.DB, storage recordStorage, fields []models.FormField, filters []RecordFilter) (*gorm.DB, error) {
+	for _, filter := range filters {
+		expr, field, err := resolveRecordColumn(storage, fields, filter.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		switch filter.Op {
+		case "", "eq":
+			query = query.Where(expr+" = ?", filter.Value)
+		case "ne":
+			query = query.Where("("+expr+" IS NULL OR "+expr+" <> ?)", filter.Value)
+		case "gt":
+			query = query.Where(expr+" > ?", filter.Value)
+		case "gte":
+			query = query.Where(expr+" >= ?", filter.Value)
+		case "lt":
+			query = query.Where(expr+" < ?", filter.Value)
+		case "lte":
+			query = query.Where(expr+" <= ?", filter.Value)
+		case "contains":
+			if field != nil && field.Type == "multi_enum" {
+				// 多选字段：数组中包含指定值
+				query = query.Where("EXISTS (SELECT 1 FROM "+storage.jsonEachExpr(filter.Field)+" WHERE json_each.value = ?)",
+					filter.Value)
+			} else {
+				query = query.Where(expr+" LIKE ?", "%"+fmt.Sprint(filter.Value)+"%")
+			}
+		case "in":
+			values, ok := filter.Value.([]interface{})
+			if !ok || len(values) == 0 {
+				return nil, fmt.Errorf("筛选条件 '%s' 的值必须是非空数组", filter.Field)
+			}
+			query = query.Where(expr+" IN ?", values)
+		case "between":
+			values, ok := filter.Value.([]interface{})
+			if !ok || len(values) != 2 {
+				return nil, fmt.Errorf("筛选条件 '%s' 的值必须是包含两个元素的数组", filter.Field)
+			}
+			query = query.Where(expr+" BETWEEN ? AND ?", values[0], values[1])
+		case "empty":
+			query = query.Where("(" + expr + " IS NULL OR " + expr + " = '')")
+		case "not_empty":
+			query = query.Where("(" + expr + " IS NOT NULL AND " + expr + " <> '')")
+		default:
+			return nil, fmt.Errorf("不支持的筛选操作 '%s'", filter.Op)
+		}
+	}
+
+	return query, nil
+}
+
+// recordOrderClause 生成记录排序子句，默认按创建时间倒序
+func recordOrderClause(storage recordStorage, fields []models.FormField, sortBy, sortOrder string) (string, error) {
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+
+	expr, _, err := resolveRecordColumn(storage, fields, sortBy)
+	if err != nil {
+		return "", err
+	}
+
+	direction := "DESC"
+	if strings.EqualFold(sortOrder, "asc") {
+		direction = "ASC"
+	}
+
+	return expr + " " + direction, nil
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// compiledFormula 解析后的公式字段
+type compiledFormula struct {
+	field   models.FormField
+	key     string
+	formula *utils.Formula
+}
+
+// recordFormulaEnv 记录公式的求值环境
+type recordFormulaEnv struct {
+	db     *gorm.DB
+	fields map[string]models.FormField
+	data   map[string]interface{}
+}
+
+// FieldValue 返回当前记录的字段值，时间字段转换为时间类型
+func (e *recordFormulaEnv) FieldValue(name string) interface{} {
+	value := e.data[name]
+	if field, ok := e.fields[name]; ok && field.Type == "datetime" {
+		if text, ok := value.(string); ok {
+			if t, ok := parseTimeValue(text); ok {
+				return t
+			}
+		}
+	}
+	return value
+}
+
+// RelatedValues 返回关联字段所关联记录中目标字段的值
+func (e *recordFormulaEnv) RelatedValues(field, target string) ([]interface{}, error) {
+	ids, err := parseIDList(e.data[field])
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var records []models.FormRecord
+	if err := e.db.Select("id", "schema_id", "data").Where("id IN ?", ids).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if err := hydrateRecordData(e.db, records); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		var data map[string]interface{}
+		json.Unmarshal(record.Data, &data)
+		values = append(values, data[target])
+	}
+	return values, nil
+}
+
+// isFormulaField 判断字段是否为公式字段
+func isFormulaField(field models.FormField) bool {
+	return field.Type == "formula"
+}
+
+// normalizeFormulaFields 校验表单结构中的公式字段：公式可解析、引用的字段存在且不存在循环引用
+// 关联字段需先经normalizeRelationFields规范化，关联自身(selfID)时按本次提交的字段校验
+func normalizeFormulaFields(fields []models.FormField, selfID uint) error {
+	byKey := make(map[string]models.FormField, len(fields))
+	for _, field := range fields {
+		byKey[getFieldKey(field)] = field
+	}
+
+	for _, field := range fields {
+		if !isFormulaField(field) {
+			continue
+		}
+
+		formula, err := utils.ParseFormula(field.Formula)
+		if err != nil {
+			return fmt.Errorf("公式字段 '%s': %v", field.Label, err)
+		}
+
+		for _, ref := range formula.Refs() {
+			refField, exists := byKey[ref.Field]
+			if !exists {
+				return fmt.Errorf("公式字段 '%s' 引用的字段 '%s' 不存在", field.Label, ref.Field)
+			}
+			if ref.Target == "" {
+				continue
+			}
+
+			if !isRelationField(refField) || refField.RelationSchemaID == nil {
+				return fmt.Errorf("公式字段 '%s' 中的 '%s' 不是关联字段", field.Label, ref.Field)
+			}
+			targetFields := fields
+			if *refField.RelationSchemaID != selfID {
+				var target models.FormSchema
+				if err := config.DB.First(&target, *refField.RelationSchemaID).Error; err != nil {
+					return fmt.Errorf("公式字段 '%s' 中的关联字段 '%s' 关联的表单不存在", field.Label, ref.Field)
+				}
+				if targetFields, err = parseSchemaFields(target.Schema); err != nil {
+					return err
+				}
+			}
+			if _, ok := findFieldByKey(targetFields, ref.Target); !ok {
+				return fmt.Errorf("公式字段 '%s' 引用的字段 '%s.%s' 不存在", field.Label, ref.Field, ref.Target)
+			}
+		}
+	}
+
+	_, err := sortFormulaFields(fields)
+	return err
+}
+
+// sortFormulaFields 解析公式字段并按依赖关系排序，被引用的公式字段先计算
+func sortFormulaFields(fields []models.FormField) ([]compiledFormula, error) {
+	compiled := make(map[string]compiledFormula)
+	var keys []string
+	for _, field := range fields {
+		if !isFormulaField(field) {
+			continue
+		}
+		formula, err := utils.ParseFormula(field.Formula)
+		if err != nil {
+			return nil, fmt.Errorf("公式字段 '%s': %v", field.Label, err)
+		}
+		key := getFieldKey(field)
+		compiled[key] = compiledFormula{field: field, key: key, formula: formula}
+		keys = append(keys, key)
+	}
+
+	// 深度优先遍历，state: 1=访问中 2=已完成
+	state := make(map[string]int, len(keys))
+	sorted := make([]compiledFormula, 0, len(keys))
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case 1:
+			return fmt.Errorf("公式字段 '%s' 存在循环引用", compiled[key].field.Label)
+		case 2:
+			return nil
+		}
+		state[key] = 1
+		for _, ref := range compiled[key].formula.Refs() {
+			if _, ok := compiled[ref.Field]; ok && ref.Target == "" {
+				if err := visit(ref.Field); err != nil {
+					return err
+				}
+			}
+		}
+		state[key] = 2
+		sorted = append(sorted, compiled[key])
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := visit(key); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// computeFormulaFields 按依赖顺序计算记录中的公式字段，提交的公式字段值会被覆盖
+// 计算出错(如除数为0)时该字段为空
+func computeFormulaFields(db *gorm.DB, fields []models.FormField, data map[string]interface{}) error {
+	formulas, err := sortFormulaFields(fields)
+	if err != nil || len(formulas) == 0 {
+		return err
+	}
+
+	env := &recordFormulaEnv{db: db, fields: make(map[string]models.FormField, len(fields)), data: data}
+	for _, field := range fields {
+		env.fields[getFieldKey(field)] = field
+	}
+
+	for _, f := range formulas {
+		value, err := f.formula.Eval(env)
+		if err == nil {
+			value = formulaResultValue(f.field, value)
+		}
+		if err != nil || value == nil {
+			delete(data, f.key)
+			continue
+		}
+		data[f.key] = value
+	}
+	return nil
+}
+
+// formulaResultValue 将公式结果转换为记录中存储的值
+func formulaResultValue(field models.FormField, value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if field.Precision != nil {
+			return utils.RoundFloat(v, *field.Precision)
+		}
+	case time.Time:
+		return formatTimeValue(field, v)
+	}
+	return value
+}
+
+// formulaSignature 生成公式字段定义的摘要，用于判断公式是否发生变化
+func formulaSignature(fields []models.FormField) string {
+	var parts []string
+	for _, field := range fields {
+		if !isFormulaField(field) {
+			continue
+		}
+		precision := ""
+		if field.Precision != nil {
+			precision = fmt.Sprint(*field.Precision)
+		}
+		parts = append(parts, strings.Join([]string{getFieldKey(field), field.Formula, precision, field.TimeFormat}, "\x00"))
+	}
+	return strings.Join(parts, "\x01")
+}
+
+// hasFormulaFields 判断字段中是否包含公式字段
+func hasFormulaFields(fields []models.FormField) bool {
+	for _, field := range fields {
+		if isFormulaField(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// recomputeRecordFormulas 重新计算单条记录的公式字段，值有变化时保存
+// record需已加载数据(物理表存储的记录需先调用hydrateRecordData)
+func recomputeRecordFormulas(db *gorm.DB, schema *models.FormSchema, fields []models.FormField, record *models.FormRecord) (bool, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(record.Data, &data); err != nil {
+		return false, err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	before, _ := json.Marshal(data)
+	if err := computeFormulaFields(db, fields, data); err != nil {
+		return false, err
+	}
+	after, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	if string(before) == string(after) {
+		return false, nil
+	}
+
+	return true, saveRecordData(db, schema, fields, record, data)
+}
+
+// recomputeSchemaFormulas 重新计算表单下全部记录的公式字段，返回更新的记录数
+func recomputeSchemaFormulas(schema *models.FormSchema) (int, error) {
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil || !hasFormulaFields(fields) {
+		return 0, err
+	}
+
+	updated := 0
+	var batch []models.FormRecord
+	err = config.DB.Where("schema_id = ? AND is_deleted = ?", schema.ID, false).FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		if err := hydrateRecordData(config.DB, batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			changed, err := recomputeRecordFormulas(config.DB, schema, fields, &batch[i])
+			if err != nil {
+				return err
+			}
+			if changed {
+				updated++
+			}
+		}
+		return nil
+	}).Error
+	return updated, err
+}
+
+// refreshRelatedFormulas 记录变更后，重新计算通过关联字段引用该记录的记录中的公式
+func refreshRelatedFormulas(tx *gorm.DB, recordID uint) error {
+	var links []models.FormRecordRelation
+	if err := tx.Where("target_record_id = ?", recordID).Find(&links).Error; err != nil {
+		return err
+	}
+
+	schemas := make(map[uint]*models.FormSchema)
+	schemaFields := make(map[uint][]models.FormField)
+	refreshed := make(map[uint]bool)
+	for _, link := range links {
+		if refreshed[link.RecordID] || link.RecordID == recordID {
+			continue
+		}
+
+		schema, exists := schemas[link.SchemaID]
+		if !exists {
+			schema = &models.FormSchema{}
+			if err := tx.First(schema, link.SchemaID).Error; err != nil {
+				return err
+			}
+			schemas[link.SchemaID] = schema
+			schemaFields[link.SchemaID], _ = parseSchemaFields(schema.Schema)
+		}
+		fields := schemaFields[link.SchemaID]
+		if !hasFormulaFields(fields) {
+			continue
+		}
+
+		var record models.FormRecord
+		if err := tx.First(&record, link.RecordID).Error; err != nil {
+			continue
+		}
+		if err := hydrateRecord(tx, &record); err != nil {
+			return err
+		}
+		if _, err := recomputeRecordFormulas(tx, schema, fields, &record); err != nil {
+			return err
+		}
+		refreshed[link.RecordID] = true
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// formulaField 创建公式字段
+func formulaField(name, formula string) models.FormField {
+	return models.FormField{Name: name, Label: name, Type: "formula", Formula: formula}
+}
+
+func TestSortFormulaFields(t *testing.T) {
+	number := models.FormField{Name: "price", Label: "price", Type: "number"}
+	items := models.FormField{Name: "items", Label: "items", Type: "relation"}
+	tests := []struct {
+		name      string
+		fields    []models.FormField
+		wantOrder []string
+		wantErr   string
+	}{
+		{"无依赖", []models.FormField{number, formulaField("a", "price * 2"), formulaField("b", "price + 1")}, []string{"a", "b"}, ""},
+		{"被引用的公式先计算", []models.FormField{formulaField("total", "subtotal + tax"), formulaField("tax", "subtotal * 0.1"),
+			formulaField("subtotal", "price * 2"), number}, []string{"subtotal", "tax", "total"}, ""},
+		{"引用自身", []models.FormField{formulaField("a", "a + 1")}, nil, "循环引用"},
+		{"两个公式互相引用", []models.FormField{formulaField("a", "b + 1"), formulaField("b", "a + 1")}, nil, "循环引用"},
+		{"三个公式形成环", []models.FormField{number, formulaField("a", "price + c"), formulaField("b", "a * 2"),
+			formulaField("c", "IF(price > 0, b, 0)")}, nil, "循环引用"},
+		{"关联记录中同名字段不构成循环", []models.FormField{items, formulaField("total", "SUM(items.total)")}, []string{"total"}, ""},
+		{"公式无法解析", []models.FormField{formulaField("a", "UNKNOWN(1)")}, nil, "不支持的函数"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted, err := sortFormulaFields(tt.fields)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var order []string
+			for _, f := range sorted {
+				order = append(order, f.key)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestNormalizeFormulaFields(t *testing.T) {
+	useTestDB(t, &models.FormSchema{})
+	items := createTestSchema(t, "明细", []models.FormField{{Name: "amount", Label: "amount", Type: "number"}})
+	missing := uint(999)
+
+	relation := func(schemaID *uint) models.FormField {
+		return models.FormField{Name: "items", Label: "items", Type: "relation", RelationSchemaID: schemaID, RelationType: models.RelationOneToMany}
+	}
+	tests := []struct {
+		name    string
+		fields  []models.FormField
+		selfID  uint
+		wantErr string
+	}{
+		{"关联记录聚合", []models.FormField{relation(&items.ID), formulaField("total", "SUM(items.amount)")}, 0, ""},
+		{"引用不存在的字段", []models.FormField{formulaField("total", "price * 2")}, 0, "引用的字段 'price' 不存在"},
+		{"引用关联表单中不存在的字段", []models.FormField{relation(&items.ID), formulaField("total", "SUM(items.price)")}, 0, "'items.price' 不存在"},
+		{"非关联字段不能引用目标字段", []models.FormField{{Name: "items", Label: "items", Type: "number"}, formulaField("total", "SUM(items.amount)")}, 0, "不是关联字段"},
+		{"关联的表单不存在", []models.FormField{relation(&missing), formulaField("total", "SUM(items.amount)")}, 0, "关联的表单不存在"},
+		{"关联自身时按提交的字段校验", []models.FormField{relation(&missing), {Name: "amount", Label: "amount", Type: "number"},
+			formulaField("total", "SUM(items.amount) + amount")}, missing, ""},
+		{"循环引用", []models.FormField{formulaField("a", "b"), formulaField("b", "a")}, 0, "循环引用"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeFormulaFields(tt.fields, tt.selfID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComputeFormulaFieldsRelatedAggregates(t *testing.T) {
+	useTestDB(t, &models.FormSchema{}, &models.FormRecord{})
+	itemSchema := createTestSchema(t, "明细", []models.FormField{{Name: "amount", Label: "amount", Type: "number"}})
+	first := createTestRecord(t, itemSchema.ID, map[string]interface{}{"amount": 10})
+	second := createTestRecord(t, itemSchema.ID, map[string]interface{}{"amount": 2.5})
+	blank := createTestRecord(t, itemSchema.ID, map[string]interface{}{})
+
+	precision := 1
+	fields := []models.FormField{
+		{Name: "items", Label: "items", Type: "relation", RelationSchemaID: &itemSchema.ID, RelationType: models.RelationOneToMany},
+		{Name: "discount", Label: "discount", Type: "number"},
+		formulaField("count", "COUNT(items.amount)"),
+		formulaField("avg", "AVG(items.amount)"),
+		{Name: "total", Label: "total", Type: "formula", Formula: "SUM(items.amount) - discount", Precision: &precision},
+		formulaField("ratio", "discount / SUM(items.amount)"),
+	}
+
+	tests := []struct {
+		name  string
+		items interface{}
+		want  map[string]interface{}
+	}{
+		{"多条关联记录", []interface{}{float64(first.ID), float64(second.ID), float64(blank.ID)},
+			map[string]interface{}{"count": 2.0, "avg": 6.25, "total": 11.5, "ratio": 0.08}},
+		{"逗号分隔的ID", fmt.Sprintf("%d,%d", first.ID, second.ID),
+			map[string]interface{}{"count": 2.0, "avg": 6.25, "total": 11.5, "ratio": 0.08}},
+		{"没有关联记录", nil, map[string]interface{}{"count": 0.0, "total": -1.0}},
+		{"关联记录没有值时除数为0", []interface{}{float64(blank.ID)}, map[string]interface{}{"count": 0.0, "total": -1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 提交的公式字段值会被覆盖或清除
+			data := map[string]interface{}{"items": tt.items, "discount": 1.0, "avg": "stale", "ratio": 99}
+			if err := computeFormulaFields(config.DB, fields, data); err != nil {
+				t.Fatal(err)
+			}
+			delete(data, "items")
+			delete(data, "discount")
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("data = %v, want %v", data, tt.want)
+			}
+		})
+	}
+}
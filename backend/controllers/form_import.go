@@ -0,0 +1,665 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// importBaseDir 导入文件与错误报告的存放目录（不通过静态路由对外暴露）
+const importBaseDir = "../imports"
+
+// importProgressInterval 每处理多少行更新一次任务进度
+const importProgressInterval = 20
+
+// ImportColumnMapping 导入列与字段的映射关系
+type ImportColumnMapping struct {
+	Column     string `json:"column"`      // 表头列名
+	FieldKey   string `json:"field_key"`   // 字段名，为空表示忽略该列
+	FieldLabel string `json:"field_label"` // 字段标签
+}
+
+// importRowError 导入失败的行
+type importRowError struct {
+	Line    int
+	Message string
+	Cells   []string
+}
+
+// PreviewFormImport 预览导入文件，返回表头、自动匹配的字段映射和样例数据
+func PreviewFormImport(c *gin.Context) {
+	schema, ok := findImportableSchema(c)
+	if !ok {
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+
+	path, format, _, ok := saveImportUpload(c)
+	if !ok {
+		return
+	}
+	defer os.Remove(path)
+
+	headers, rows, err := readImportFile(path, format)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "文件解析失败: "+err.Error())
+		return
+	}
+
+	overrides, err := parseImportMapping(c.PostForm("mapping"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "字段映射格式错误: "+err.Error())
+		return
+	}
+
+	columns := resolveImportColumns(headers, fields, overrides)
+	mappings := make([]ImportColumnMapping, 0, len(headers))
+	for i, header := range headers {
+		mapping := ImportColumnMapping{Column: header}
+		if field, exists := columns[i]; exists {
+			mapping.FieldKey = getFieldKey(field)
+			mapping.FieldLabel = field.Label
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	samples := rows
+	if len(samples) > 5 {
+		samples = samples[:5]
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"headers":    headers,
+		"mappings":   mappings,
+		"samples":    samples,
+		"total_rows": len(rows),
+	})
+}
+
+// CreateFormImport 创建导入任务，在后台逐行导入数据
+func CreateFormImport(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	schema, ok := findImportableSchema(c)
+	if !ok {
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+
+	mode := c.DefaultPostForm("mode", models.ImportModeInsert)
+	keyField := strings.TrimSpace(c.PostForm("key_field"))
+
+	if mode != models.ImportModeInsert && mode != models.ImportModeUpsert {
+		utils.ErrorResponse(c, 400, "不支持的导入模式")
+		return
+	}
+
+	if mode == models.ImportModeUpsert {
+		if keyField == "" {
+			utils.ErrorResponse(c, 400, "更新模式必须指定关键字段")
+			return
+		}
+		if _, exists := findFieldByKey(fields, keyField); !exists {
+			utils.ErrorResponse(c, 400, "关键字段不存在")
+			return
+		}
+	}
+
+	overrides, err := parseImportMapping(c.PostForm("mapping"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "字段映射格式错误: "+err.Error())
+		return
+	}
+	for _, key := range overrides {
+		if _, exists := findFieldByKey(fields, key); key != "" && !exists {
+			utils.ErrorResponse(c, 400, fmt.Sprintf("映射的字段 '%s' 不存在", key))
+			return
+		}
+	}
+
+	path, format, originalName, ok := saveImportUpload(c)
+	if !ok {
+		return
+	}
+
+	mappingJSON, _ := json.Marshal(overrides)
+
+	job := models.FormImportJob{
+		SchemaID:   schema.ID,
+		UserID:     userID.(uint),
+		FileName:   originalName,
+		Format:     format,
+		Mode:       mode,
+		KeyField:   keyField,
+		Mapping:    models.JSON(mappingJSON),
+		Status:     models.ImportStatusPending,
+		SourcePath: path,
+	}
+
+	if err := config.DB.Create(&job).Error; err != nil {
+		os.Remove(path)
+		utils.ServerErrorResponse(c, "创建导入任务失败")
+		return
+	}
+
+	go runFormImportJob(job.ID)
+
+	utils.SuccessResponse(c, job)
+}
+
+// GetFormImportJobs 获取表单的导入任务列表
+func GetFormImportJobs(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleEditor)
+	if !ok {
+		return
+	}
+
+	var jobs []models.FormImportJob
+	query := config.DB.Where("schema_id = ?", schema.ID)
+
+	// 没有管理全部表单的权限时只能看到自己创建的任务
+	if !hasPermission(c, models.PermFormManageAny) {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.Order("created_at DESC").Limit(50).Find(&jobs).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, jobs)
+}
+
+// GetFormImportJob 获取导入任务进度
+func GetFormImportJob(c *gin.Context) {
+	job, ok := findAccessibleImportJob(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, job)
+}
+
+// DownloadFormImportErrors 下载导入任务的错误报告
+func DownloadFormImportErrors(c *gin.Context) {
+	job, ok := findAccessibleImportJob(c)
+	if !ok {
+		return
+	}
+
+	if !job.HasReport || job.ReportPath == "" {
+		utils.NotFoundResponse(c, "该任务没有错误报告")
+		return
+	}
+
+	if _, err := os.Stat(job.ReportPath); os.IsNotExist(err) {
+		utils.NotFoundResponse(c, "错误报告文件不存在")
+		return
+	}
+
+	fileName := fmt.Sprintf("import_%d_errors.csv", job.ID)
+	c.Header("Content-Disposition", "attachment; filename=\""+fileName+"\"")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.File(job.ReportPath)
+}
+
+// findImportableSchema 查找当前用户可导入数据的表单结构，失败时直接写入错误响应
+// 导入会新增或覆盖任意记录的全部字段，要求编辑者及以上角色、可见全部记录且没有字段限制
+func findImportableSchema(c *gin.Context) (*models.FormSchema, bool) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleEditor)
+	if !ok {
+		return nil, false
+	}
+	if schema.Permission.RowScope != models.RowScopeAll || hasFieldRestrictions(schema.Permission) {
+		utils.ForbiddenResponse(c, "当前权限受记录范围或字段限制，不能导入数据")
+		return nil, false
+	}
+	return schema, true
+}
+
+// findAccessibleImportJob 查找当前用户可访问的导入任务
+func findAccessibleImportJob(c *gin.Context) (*models.FormImportJob, bool) {
+	userID, _ := c.Get("user_id")
+
+	var job models.FormImportJob
+	query := config.DB.Where("id = ?", c.Param("id"))
+
+	if !hasPermission(c, models.PermFormManageAny) {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if err := query.First(&job).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "导入任务不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+
+	return &job, true
+}
+
+// saveImportUpload 保存上传的导入文件，返回保存路径、文件格式和原始文件名
+func saveImportUpload(c *gin.Context) (string, string, string, bool) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, 400, "文件上传失败: "+err.Error())
+		return "", "", "", false
+	}
+	defer file.Close()
+
+	// 验证文件大小（限制20MB）
+	if header.Size > 20*1024*1024 {
+		utils.ErrorResponse(c, 400, "导入文件大小不能超过20MB")
+		return "", "", "", false
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	if format != "csv" && format != "xlsx" {
+		utils.ErrorResponse(c, 400, "仅支持CSV和XLSX格式的文件")
+		return "", "", "", false
+	}
+
+	uploadDir := filepath.Join(importBaseDir, time.Now().Format("2006/01/02"))
+	if err := utils.EnsureDir(uploadDir); err != nil {
+		utils.ServerErrorResponse(c, "创建上传目录失败")
+		return "", "", "", false
+	}
+
+	path := filepath.Join(uploadDir, utils.GenerateFileName(header.Filename))
+	dst, err := os.Create(path)
+	if err != nil {
+		utils.ServerErrorResponse(c, "文件保存失败")
+		return "", "", "", false
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, file); err != nil {
+		os.Remove(path)
+		utils.ServerErrorResponse(c, "文件保存失败")
+		return "", "", "", false
+	}
+
+	return path, format, header.Filename, true
+}
+
+// parseImportMapping 解析手动指定的列映射（JSON对象：列名 -> 字段名）
+func parseImportMapping(raw string) (map[string]string, error) {
+	mapping := map[string]string{}
+	if strings.TrimSpace(raw) == "" {
+		return mapping, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// readImportFile 读取CSV或XLSX文件，返回表头和数据行
+func readImportFile(path, format string) ([]string, [][]string, error) {
+	var rows [][]string
+
+	switch format {
+	case "csv":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		rows, err = reader.ReadAll()
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case "xlsx":
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, nil, fmt.Errorf("工作簿中没有工作表")
+		}
+		rows, err = f.GetRows(sheets[0])
+		if err != nil {
+			return nil, nil, err
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("不支持的文件格式: %s", format)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("文件中没有数据")
+	}
+
+	headers := rows[0]
+	for i := range headers {
+		headers[i] = strings.TrimSpace(strings.TrimPrefix(headers[i], "\ufeff"))
+	}
+
+	// 跳过空行
+	data := make([][]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		data = append(data, row)
+	}
+
+	return headers, data, nil
+}
+
+// resolveImportColumns 按标签、字段名自动匹配表头，再应用手动映射，返回列序号 -> 字段
+func resolveImportColumns(headers []string, fields []models.FormField, overrides map[string]string) map[int]models.FormField {
+	columns := make(map[int]models.FormField)
+
+	for i, header := range headers {
+		if key, exists := overrides[header]; exists {
+			if field, found := findFieldByKey(fields, key); found {
+				columns[i] = field
+			}
+			continue
+		}
+
+		normalized := strings.ToLower(strings.TrimSpace(header))
+		if normalized == "" {
+			continue
+		}
+		for _, field := range fields {
+			if strings.ToLower(strings.TrimSpace(field.Label)) == normalized ||
+				strings.ToLower(getFieldKey(field)) == normalized {
+				columns[i] = field
+				break
+			}
+		}
+	}
+
+	return columns
+}
+
+// findFieldByKey 按键名查找字段
+func findFieldByKey(fields []models.FormField, key string) (models.FormField, bool) {
+	for _, field := range fields {
+		if getFieldKey(field) == key {
+			return field, true
+		}
+	}
+	return models.FormField{}, false
+}
+
+// runFormImportJob 执行导入任务
+func runFormImportJob(jobID uint) {
+	var job models.FormImportJob
+	if err := config.DB.First(&job, jobID).Error; err != nil {
+		log.Printf("导入任务 %d 加载失败: %v", jobID, err)
+		return
+	}
+
+	defer os.Remove(job.SourcePath)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("导入任务 %d 异常: %v", jobID, r)
+			finishImportJob(&job, models.ImportStatusFailed, fmt.Sprintf("导入异常: %v", r))
+		}
+	}()
+
+	now := time.Now()
+	job.Status = models.ImportStatusRunning
+	job.StartedAt = &now
+	config.DB.Save(&job)
+
+	var schema models.FormSchema
+	if err := config.DB.First(&schema, job.SchemaID).Error; err != nil {
+		finishImportJob(&job, models.ImportStatusFailed, "表单结构不存在")
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		finishImportJob(&job, models.ImportStatusFailed, "表单结构解析失败")
+		return
+	}
+
+	// 按任务创建者的身份校验数据（如文件字段的访问权限）
+	var user models.User
+	if err := config.DB.First(&user, job.UserID).Error; err != nil {
+		finishImportJob(&job, models.ImportStatusFailed, "任务创建者不存在")
+		return
+	}
+	readAnyAsset := config.RolePermissions(user.Role).Has(models.PermFileReadAny)
+
+	var overrides map[string]string
+	json.Unmarshal(job.Mapping, &overrides)
+
+	headers, rows, err := readImportFile(job.SourcePath, job.Format)
+	if err != nil {
+		finishImportJob(&job, models.ImportStatusFailed, "文件解析失败: "+err.Error())
+		return
+	}
+
+	columns := resolveImportColumns(headers, fields, overrides)
+	if len(columns) == 0 {
+		finishImportJob(&job, models.ImportStatusFailed, "没有任何列与表单字段匹配")
+		return
+	}
+
+	job.Total = len(rows)
+	config.DB.Save(&job)
+
+	var rowErrors []importRowError
+	for i, row := range rows {
+		updated, err := importFormRow(&job, &schema, readAnyAsset, columns, row)
+		if err != nil {
+			job.Failed++
+			rowErrors = append(rowErrors, importRowError{Line: i + 2, Message: err.Error(), Cells: row})
+		} else if updated {
+			job.Updated++
+		} else {
+			job.Inserted++
+		}
+		job.Processed++
+
+		if job.Processed%importProgressInterval == 0 {
+			config.DB.Model(&models.FormImportJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+				"processed": job.Processed,
+				"inserted":  job.Inserted,
+				"updated":   job.Updated,
+				"failed":    job.Failed,
+			})
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		reportPath, err := writeImportErrorReport(&job, headers, rowErrors)
+		if err != nil {
+			log.Printf("导入任务 %d 错误报告生成失败: %v", job.ID, err)
+		} else {
+			job.ReportPath = reportPath
+			job.HasReport = true
+		}
+	}
+
+	finishImportJob(&job, models.ImportStatusCompleted,
+		fmt.Sprintf("新增 %d 条，更新 %d 条，失败 %d 条", job.Inserted, job.Updated, job.Failed))
+}
+
+// importFormRow 导入单行数据，返回是否为更新已有记录
+func importFormRow(job *models.FormImportJob, schema *models.FormSchema, readAnyAsset bool, columns map[int]models.FormField, row []string) (bool, error) {
+	data := make(map[string]interface{})
+	for i, field := range columns {
+		if i >= len(row) {
+			continue
+		}
+		value, err := convertFieldText(field, row[i])
+		if err != nil {
+			return false, fmt.Errorf("字段 '%s': %v", field.Label, err)
+		}
+		if value != nil {
+			data[getFieldKey(field)] = value
+		}
+	}
+
+	// 按关键字段查找已有记录
+	var existing models.FormRecord
+	found := false
+	if job.Mode == models.ImportModeUpsert {
+		keyValue, exists := data[job.KeyField]
+		if !exists {
+			return false, fmt.Errorf("关键字段 '%s' 为空", job.KeyField)
+		}
+
+		fields, _ := parseSchemaFields(schema.Schema)
+		storage := newRecordStorage(schema, fields)
+		err := config.DB.Where("form_records.schema_id = ? AND form_records.is_deleted = ? AND "+storage.fieldExpr(job.KeyField)+" = ?", schema.ID, false, keyValue).
+			First(&existing).Error
+		if err == nil {
+			found = true
+		} else if err != gorm.ErrRecordNotFound {
+			return false, fmt.Errorf("查询已有记录失败")
+		}
+		if found {
+			if err := hydrateRecord(config.DB, &existing); err != nil {
+				return false, fmt.Errorf("读取已有记录失败")
+			}
+		}
+	}
+
+	var oldData map[string]interface{}
+	if found {
+		// 合并已有数据，仅覆盖导入文件中提供的字段
+		json.Unmarshal(existing.Data, &oldData)
+		merged := make(map[string]interface{})
+		json.Unmarshal(existing.Data, &merged)
+		for key, value := range data {
+			merged[key] = value
+		}
+		data = merged
+	}
+
+	recordID := uint(0)
+	if found {
+		recordID = existing.ID
+	}
+	if err := prepareRecordData(schema, data, job.UserID, readAnyAsset, recordID); err != nil {
+		return false, err
+	}
+
+	dataJSON, err := encodeRecordData(schema, data)
+	if err != nil {
+		return false, fmt.Errorf("数据序列化失败")
+	}
+
+	record := existing
+	if !found {
+		record = models.FormRecord{
+			SchemaID: schema.ID,
+			UserID:   job.UserID,
+			State:    initialRecordState(schema),
+		}
+	}
+	record.Data = dataJSON
+
+	var removedFiles []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&record).Error; err != nil {
+			return err
+		}
+		var err error
+		if removedFiles, err = syncRecordReferences(tx, schema, record.ID, data); err != nil {
+			return err
+		}
+		action := models.RevisionActionCreate
+		if found {
+			action = models.RevisionActionUpdate
+		}
+		_, err = saveRecordRevision(tx, schema, record.ID, action, oldData, data, job.UserID)
+		return err
+	})
+	if err != nil {
+		if found {
+			return false, fmt.Errorf("更新记录失败")
+		}
+		return false, fmt.Errorf("创建记录失败")
+	}
+	removeAssetFiles(removedFiles)
+
+	event := models.WebhookEventRecordCreated
+	if found {
+		event = models.WebhookEventRecordUpdated
+	}
+	emitRecordEvent(event, job.UserID, gin.H{"source": "import", "import_job_id": job.ID}, record.ID)
+
+	return found, nil
+}
+
+// writeImportErrorReport 生成CSV格式的错误报告（行号、错误信息和原始数据）
+func writeImportErrorReport(job *models.FormImportJob, headers []string, rowErrors []importRowError) (string, error) {
+	reportDir := filepath.Join(importBaseDir, "reports")
+	if err := utils.EnsureDir(reportDir); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(reportDir, "job_"+strconv.FormatUint(uint64(job.ID), 10)+"_errors.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// 写入BOM，便于Excel正确识别UTF-8编码
+	f.WriteString("\ufeff")
+
+	writer := csv.NewWriter(f)
+	writer.Write(append([]string{"行号", "错误信息"}, headers...))
+	for _, rowError := range rowErrors {
+		writer.Write(append([]string{strconv.Itoa(rowError.Line), rowError.Message}, rowError.Cells...))
+	}
+	writer.Flush()
+
+	return path, writer.Error()
+}
+
+// finishImportJob 结束导入任务并保存最终状态
+func finishImportJob(job *models.FormImportJob, status, message string) {
+	now := time.Now()
+	job.Status = status
+	job.Message = message
+	job.FinishedAt = &now
+	if err := config.DB.Save(job).Error; err != nil {
+		log.Printf("导入任务 %d 状态保存失败: %v", job.ID, err)
+	}
+}
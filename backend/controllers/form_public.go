@@ -0,0 +1,683 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// publicChallengeTTL 公开表单验证题目的有效期
+	publicChallengeTTL = 10 * time.Minute
+	// publicRateWindow 按IP限制提交次数和验证失败次数的统计周期
+	publicRateWindow = time.Hour
+	// publicChallengeMaxFailures 统计周期内同一IP答错验证题目的次数上限
+	publicChallengeMaxFailures = 5
+)
+
+// 公开表单的状态
+const (
+	publicFormOpen       = "open"
+	publicFormNotStarted = "not_started"
+	publicFormClosed     = "closed"
+	publicFormFull       = "full"
+)
+
+// 公开表单提交失败的原因
+var (
+	errPublicationFull = fmt.Errorf("表单提交数量已达上限")
+	errChallengeReused = fmt.Errorf("验证已使用")
+)
+
+// isPublicField 判断字段是否可以在公开表单中填写
+// 文件、关联字段需要访问系统内部数据，公式、唯一ID由系统生成，均不对匿名用户开放
+func isPublicField(field models.FormField) bool {
+	switch field.Type {
+	case "file", "image", "relation", "formula", "unique_id":
+		return false
+	}
+	return true
+}
+
+// publicFields 返回公开表单中展示的字段定义，去除内部配置
+func publicFields(fields []models.FormField) []models.FormField {
+	result := make([]models.FormField, 0, len(fields))
+	for _, field := range fields {
+		if !isPublicField(field) {
+			continue
+		}
+		result = append(result, models.FormField{
+			Fields:       publicFields(field.Fields),
+			MinItems:     field.MinItems,
+			MaxItems:     field.MaxItems,
+			VisibleWhen:  field.VisibleWhen,
+			RequiredWhen: field.RequiredWhen,
+			Section:      field.Section,
+			ID:           field.ID,
+			Name:         field.Name,
+			Label:        field.Label,
+			Type:         field.Type,
+			Required:     field.Required,
+			Placeholder:  field.Placeholder,
+			DefaultValue: field.DefaultValue,
+			Format:       field.Format,
+			MinLength:    field.MinLength,
+			MaxLength:    field.MaxLength,
+			MinValue:     field.MinValue,
+			MaxValue:     field.MaxValue,
+			Precision:    field.Precision,
+			TimeFormat:   field.TimeFormat,
+			EnumOptions:  field.EnumOptions,
+			Options:      field.Options,
+			InputType:    field.InputType,
+			TextareaRows: field.TextareaRows,
+			SortOrder:    field.SortOrder,
+		})
+	}
+	return result
+}
+
+// publicFormData 只保留提交数据中公开字段的值
+func publicFormData(fields []models.FormField, data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, field := range fields {
+		key := getFieldKey(field)
+		if value, exists := data[key]; exists && isPublicField(field) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// publicationStatus 计算公开表单当前的状态
+func publicationStatus(publication *models.FormPublication) string {
+	now := time.Now()
+	switch {
+	case publication.OpensAt != nil && now.Before(*publication.OpensAt):
+		return publicFormNotStarted
+	case publication.ClosesAt != nil && now.After(*publication.ClosesAt):
+		return publicFormClosed
+	case publication.MaxSubmissions > 0 && publication.SubmissionCount >= publication.MaxSubmissions:
+		return publicFormFull
+	}
+	return publicFormOpen
+}
+
+// publicationStatusMessage 返回表单不可提交时的提示
+func publicationStatusMessage(status string) string {
+	switch status {
+	case publicFormNotStarted:
+		return "表单尚未开放"
+	case publicFormClosed:
+		return "表单已截止"
+	case publicFormFull:
+		return "表单提交数量已达上限"
+	}
+	return ""
+}
+
+// publicationResponse 构建公开链接配置的响应，附带可访问的链接地址
+func publicationResponse(c *gin.Context, publication *models.FormPublication) gin.H {
+	return gin.H{
+		"publication": publication,
+		"status":      publicationStatus(publication),
+		"url":         utils.ToAbsoluteURL(utils.GetBaseURL(c), "/api/public/forms/"+publication.Token),
+	}
+}
+
+// GetFormPublication 获取表单的公开链接配置
+func GetFormPublication(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	var publication models.FormPublication
+	if err := config.DB.Where("schema_id = ?", schema.ID).First(&publication).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "表单未发布")
+			return
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, publicationResponse(c, &publication))
+}
+
+// SaveFormPublication 发布表单或修改公开链接配置
+func SaveFormPublication(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Enabled         *bool      `json:"enabled"`
+		OpensAt         *time.Time `json:"opens_at"`
+		ClosesAt        *time.Time `json:"closes_at"`
+		MaxSubmissions  int        `json:"max_submissions"`
+		RateLimit       *int       `json:"rate_limit"`
+		Challenge       string     `json:"challenge"`
+		PoWDifficulty   *int       `json:"pow_difficulty"`
+		AllowEdit       *bool      `json:"allow_edit"`
+		RegenerateToken bool       `json:"regenerate_token"` // 重新生成链接令牌，旧链接失效
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	// 校验配置
+	if req.Challenge == "" {
+		req.Challenge = utils.ChallengeNone
+	}
+	if req.Challenge != utils.ChallengeNone && req.Challenge != utils.ChallengeMath && req.Challenge != utils.ChallengePoW {
+		utils.ErrorResponse(c, 400, "不支持的验证方式")
+		return
+	}
+	difficulty := 18
+	if req.PoWDifficulty != nil {
+		difficulty = *req.PoWDifficulty
+	}
+	if req.Challenge == utils.ChallengePoW && (difficulty < 1 || difficulty > utils.MaxPoWDifficulty) {
+		utils.ErrorResponse(c, 400, fmt.Sprintf("工作量证明难度必须在1到%d之间", utils.MaxPoWDifficulty))
+		return
+	}
+	if req.OpensAt != nil && req.ClosesAt != nil && !req.ClosesAt.After(*req.OpensAt) {
+		utils.ErrorResponse(c, 400, "截止时间必须晚于开放时间")
+		return
+	}
+	if req.MaxSubmissions < 0 || (req.RateLimit != nil && *req.RateLimit < 0) {
+		utils.ErrorResponse(c, 400, "提交次数限制不能为负数")
+		return
+	}
+
+	// 必填字段必须能在公开表单中填写
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	for _, field := range fields {
+		if field.Required && !isPublicField(field) {
+			utils.ErrorResponse(c, 400, "必填字段 '"+field.Label+"' 不支持匿名填写，无法发布")
+			return
+		}
+	}
+
+	var publication models.FormPublication
+	err = config.DB.Where("schema_id = ?", schema.ID).First(&publication).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+	if err == gorm.ErrRecordNotFound || req.RegenerateToken {
+		token, err := utils.RandomToken(24)
+		if err != nil {
+			utils.ServerErrorResponse(c, "生成链接失败")
+			return
+		}
+		publication.Token = token
+	}
+	if publication.ID == 0 {
+		publication.SchemaID = schema.ID
+		publication.UserID = userID.(uint)
+	}
+
+	publication.Enabled = req.Enabled == nil || *req.Enabled
+	publication.OpensAt = req.OpensAt
+	publication.ClosesAt = req.ClosesAt
+	publication.MaxSubmissions = req.MaxSubmissions
+	publication.RateLimit = 10
+	if req.RateLimit != nil {
+		publication.RateLimit = *req.RateLimit
+	}
+	publication.Challenge = req.Challenge
+	publication.PoWDifficulty = difficulty
+	publication.AllowEdit = req.AllowEdit == nil || *req.AllowEdit
+
+	if err := config.DB.Save(&publication).Error; err != nil {
+		utils.ServerErrorResponse(c, "保存失败")
+		return
+	}
+
+	utils.SuccessResponse(c, publicationResponse(c, &publication))
+}
+
+// DeleteFormPublication 取消发布表单，公开链接和提交者的确认令牌随之失效
+func DeleteFormPublication(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteFormPublication(tx, schema.ID)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "取消发布失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已取消发布"})
+}
+
+// deleteFormPublication 删除表单的公开链接及其提交记录
+func deleteFormPublication(tx *gorm.DB, schemaID uint) error {
+	var publication models.FormPublication
+	if err := tx.Where("schema_id = ?", schemaID).First(&publication).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if err := tx.Where("publication_id = ?", publication.ID).Delete(&models.FormSubmission{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&publication).Error
+}
+
+// findPublication 按链接令牌查找已启用的公开表单，查找失败时直接写入错误响应
+func findPublication(c *gin.Context) (*models.FormPublication, bool) {
+	var publication models.FormPublication
+	if err := config.DB.Where("token = ? AND enabled = ?", c.Param("token"), true).
+		Preload("Schema").First(&publication).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "表单不存在或未开放")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	return &publication, true
+}
+
+// findSubmission 按确认令牌查找公开表单的提交，查找失败时直接写入错误响应
+func findSubmission(c *gin.Context, publication *models.FormPublication) (*models.FormSubmission, *models.FormRecord, bool) {
+	var submission models.FormSubmission
+	if err := config.DB.Where("publication_id = ? AND token_hash = ?", publication.ID, utils.HashToken(c.Param("submission"))).
+		First(&submission).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "提交不存在")
+			return nil, nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	var record models.FormRecord
+	if err := config.DB.Where("id = ? AND is_deleted = ?", submission.RecordID, false).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "提交不存在")
+			return nil, nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+	if err := hydrateRecord(config.DB, &record); err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	return &submission, &record, true
+}
+
+// GetPublicForm 获取公开表单的字段定义(无需认证)
+func GetPublicForm(c *gin.Context) {
+	publication, ok := findPublication(c)
+	if !ok {
+		return
+	}
+
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(publication.Schema.Schema, &schemaData); err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"name":        publication.Schema.Name,
+		"description": publication.Schema.Description,
+		"fields":      publicFields(schemaData.Fields),
+		"sections":    schemaData.Sections,
+		"status":      publicationStatus(publication),
+		"opens_at":    publication.OpensAt,
+		"closes_at":   publication.ClosesAt,
+		"challenge":   publication.Challenge,
+		"allow_edit":  publication.AllowEdit,
+	})
+}
+
+// GetPublicFormChallenge 获取提交公开表单所需的验证题目(无需认证)
+func GetPublicFormChallenge(c *gin.Context) {
+	publication, ok := findPublication(c)
+	if !ok {
+		return
+	}
+	if publication.Challenge == "" || publication.Challenge == utils.ChallengeNone {
+		utils.ErrorResponse(c, 400, "该表单无需验证")
+		return
+	}
+
+	challenge, err := utils.NewChallenge(publication.Challenge, publicationScope(publication), publication.PoWDifficulty, publicChallengeTTL)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成验证失败")
+		return
+	}
+
+	utils.SuccessResponse(c, challenge)
+}
+
+// publicationScope 验证题目的作用范围，重新生成链接后旧题目失效
+func publicationScope(publication *models.FormPublication) string {
+	return "form:" + strconv.FormatUint(uint64(publication.ID), 10) + ":" + publication.Token
+}
+
+// verifyPublicChallenge 校验公开表单的验证题目，失败时直接写入错误响应
+// 每道题只能作答一次，同一IP答错次数过多时暂时拒绝作答
+func verifyPublicChallenge(c *gin.Context, publication *models.FormPublication, token, answer, ip string) (string, bool) {
+	now := time.Now()
+	config.DB.Where("created_at < ?", now.Add(-publicRateWindow-publicChallengeTTL)).Delete(&models.ChallengeAttempt{})
+
+	var failures int64
+	config.DB.Model(&models.ChallengeAttempt{}).
+		Where("publication_id = ? AND ip = ? AND failed = ? AND created_at > ?", publication.ID, ip, true, now.Add(-publicRateWindow)).
+		Count(&failures)
+	if failures >= publicChallengeMaxFailures {
+		utils.TooManyRequestsResponse(c, "验证失败次数过多，请稍后再试")
+		return "", false
+	}
+
+	// 作答前先按答错登记，答对后再更正，并发提交同一道题时只有一次能登记成功
+	var attempt *models.ChallengeAttempt
+	nonce, err := utils.VerifyChallenge(token, answer, publicationScope(publication), func(nonce string) error {
+		attempt = &models.ChallengeAttempt{PublicationID: publication.ID, Nonce: nonce, IP: ip, Failed: true}
+		if err := config.DB.Create(attempt).Error; err != nil {
+			return errChallengeReused
+		}
+		return nil
+	})
+	if err != nil {
+		if err == errChallengeReused {
+			utils.ErrorResponse(c, 400, "验证已使用，请重新获取")
+		} else {
+			utils.ErrorResponse(c, 400, err.Error())
+		}
+		return "", false
+	}
+	config.DB.Model(attempt).Update("failed", false)
+	return nonce, true
+}
+
+// SubmitPublicForm 匿名提交公开表单(无需认证)，返回用于查看、修改提交的确认令牌
+func SubmitPublicForm(c *gin.Context) {
+	var req struct {
+		Data            map[string]interface{} `json:"data" binding:"required"`
+		ChallengeToken  string                 `json:"challenge_token"`
+		ChallengeAnswer string                 `json:"challenge_answer"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	publication, ok := findPublication(c)
+	if !ok {
+		return
+	}
+	if status := publicationStatus(publication); status != publicFormOpen {
+		utils.ForbiddenResponse(c, publicationStatusMessage(status))
+		return
+	}
+
+	// 按IP限制提交频率
+	ip := c.ClientIP()
+	if publication.RateLimit > 0 {
+		var recent int64
+		config.DB.Model(&models.FormSubmission{}).
+			Where("publication_id = ? AND ip = ? AND created_at > ?", publication.ID, ip, time.Now().Add(-publicRateWindow)).
+			Count(&recent)
+		if recent >= int64(publication.RateLimit) {
+			utils.TooManyRequestsResponse(c, "提交过于频繁，请稍后再试")
+			return
+		}
+	}
+
+	// 只接受公开字段的值，并按表单结构校验
+	fields, err := parseSchemaFields(publication.Schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	data := publicFormData(fields, req.Data)
+	if err := prepareRecordData(&publication.Schema, data, publication.UserID, false, 0); err != nil {
+		utils.ErrorResponse(c, 400, "数据验证失败: "+err.Error())
+		return
+	}
+
+	// 人机验证在数据校验通过后进行，填写错误时不会消耗验证题目
+	var challengeNonce *string
+	if publication.Challenge != "" && publication.Challenge != utils.ChallengeNone {
+		if req.ChallengeToken == "" {
+			utils.ErrorResponse(c, 400, "请先完成验证")
+			return
+		}
+		nonce, ok := verifyPublicChallenge(c, publication, req.ChallengeToken, req.ChallengeAnswer, ip)
+		if !ok {
+			return
+		}
+		challengeNonce = &nonce
+	}
+
+	dataJSON, err := encodeRecordData(&publication.Schema, data)
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据序列化失败")
+		return
+	}
+
+	token, err := utils.RandomToken(24)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成确认令牌失败")
+		return
+	}
+
+	// 记录归属于发布者
+	record := models.FormRecord{
+		SchemaID: publication.SchemaID,
+		Data:     dataJSON,
+		UserID:   publication.UserID,
+		State:    initialRecordState(&publication.Schema),
+	}
+	submission := models.FormSubmission{
+		PublicationID:  publication.ID,
+		TokenHash:      utils.HashToken(token),
+		ChallengeNonce: challengeNonce,
+		IP:             ip,
+	}
+
+	var removedFiles []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 提交数量上限在更新计数时校验，避免并发提交超出上限
+		counter := tx.Model(&models.FormPublication{}).Where("id = ?", publication.ID)
+		if publication.MaxSubmissions > 0 {
+			counter = counter.Where("submission_count < max_submissions")
+		}
+		result := counter.UpdateColumn("submission_count", gorm.Expr("submission_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPublicationFull
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		var err error
+		if removedFiles, err = syncRecordReferences(tx, &publication.Schema, record.ID, data); err != nil {
+			return err
+		}
+		if _, err = saveRecordRevision(tx, &publication.Schema, record.ID, models.RevisionActionCreate, nil, data, publication.UserID); err != nil {
+			return err
+		}
+
+		submission.RecordID = record.ID
+		if err := tx.Create(&submission).Error; err != nil {
+			if challengeNonce != nil {
+				var used int64
+				tx.Model(&models.FormSubmission{}).Where("challenge_nonce = ?", *challengeNonce).Count(&used)
+				if used > 0 {
+					return errChallengeReused
+				}
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		switch err {
+		case errPublicationFull:
+			utils.ForbiddenResponse(c, publicationStatusMessage(publicFormFull))
+		case errChallengeReused:
+			utils.ErrorResponse(c, 400, "验证已使用，请重新获取")
+		default:
+			utils.ServerErrorResponse(c, "提交失败")
+		}
+		return
+	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordCreated, publication.UserID, gin.H{"source": "public"}, record.ID)
+
+	utils.SuccessResponse(c, gin.H{
+		"message":          "提交成功",
+		"submission_token": token,
+		"submitted_at":     submission.CreatedAt,
+		"data":             publicFormData(fields, data),
+	})
+}
+
+// GetPublicSubmission 提交者凭确认令牌查看自己的提交(无需认证)
+func GetPublicSubmission(c *gin.Context) {
+	publication, ok := findPublication(c)
+	if !ok {
+		return
+	}
+	submission, record, ok := findSubmission(c, publication)
+	if !ok {
+		return
+	}
+
+	fields, _ := parseSchemaFields(publication.Schema.Schema)
+	var data map[string]interface{}
+	json.Unmarshal(record.Data, &data)
+
+	utils.SuccessResponse(c, gin.H{
+		"submitted_at": submission.CreatedAt,
+		"updated_at":   record.UpdatedAt,
+		"data":         publicFormData(fields, data),
+		"editable":     publication.AllowEdit && publicationStatus(publication) != publicFormClosed,
+	})
+}
+
+// UpdatePublicSubmission 提交者凭确认令牌修改自己的提交(无需认证)
+func UpdatePublicSubmission(c *gin.Context) {
+	var req struct {
+		Data map[string]interface{} `json:"data" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	publication, ok := findPublication(c)
+	if !ok {
+		return
+	}
+	if !publication.AllowEdit {
+		utils.ForbiddenResponse(c, "该表单不允许修改提交")
+		return
+	}
+	if publicationStatus(publication) == publicFormClosed {
+		utils.ForbiddenResponse(c, publicationStatusMessage(publicFormClosed))
+		return
+	}
+
+	submission, record, ok := findSubmission(c, publication)
+	if !ok {
+		return
+	}
+
+	// 保留非公开字段的值(如所有者补充的信息)，公开字段以提交的数据为准
+	fields, err := parseSchemaFields(publication.Schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	var oldData, data map[string]interface{}
+	json.Unmarshal(record.Data, &oldData)
+	json.Unmarshal(record.Data, &data)
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	for _, field := range fields {
+		if isPublicField(field) {
+			delete(data, getFieldKey(field))
+		}
+	}
+	for key, value := range publicFormData(fields, req.Data) {
+		data[key] = value
+	}
+
+	if err := prepareRecordData(&publication.Schema, data, publication.UserID, false, record.ID); err != nil {
+		utils.ErrorResponse(c, 400, "数据验证失败: "+err.Error())
+		return
+	}
+
+	dataJSON, err := encodeRecordData(&publication.Schema, data)
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据序列化失败")
+		return
+	}
+	record.Data = dataJSON
+
+	var removedFiles []string
+	var revision *models.FormRecordRevision
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Schema", "User").Save(record).Error; err != nil {
+			return err
+		}
+		var err error
+		if removedFiles, err = syncRecordReferences(tx, &publication.Schema, record.ID, data); err != nil {
+			return err
+		}
+		if revision, err = saveRecordRevision(tx, &publication.Schema, record.ID, models.RevisionActionUpdate, oldData, data, publication.UserID); err != nil {
+			return err
+		}
+		return tx.Model(submission).UpdateColumn("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "修改失败")
+		return
+	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordUpdated, publication.UserID, gin.H{"source": "public", "changes": revision.Changes}, record.ID)
+
+	utils.SuccessResponse(c, gin.H{
+		"message":    "修改成功",
+		"updated_at": record.UpdatedAt,
+		"data":       publicFormData(fields, data),
+	})
+}
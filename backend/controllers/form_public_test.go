@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPublicFormRouter 注册公开表单接口
+func newPublicFormRouter() *gin.Engine {
+	r := newTestRouter()
+	r.GET("/api/public/forms/:token/challenge", GetPublicFormChallenge)
+	r.POST("/api/public/forms/:token/submissions", SubmitPublicForm)
+	return r
+}
+
+// createTestPublication 创建包含必填字段 name 的表单并公开
+func createTestPublication(t *testing.T, token string, configure func(p *models.FormPublication)) *models.FormPublication {
+	t.Helper()
+	owner := createTestUser(t, "owner-"+token, models.RoleUser, "owner-pass-1")
+	schema := createTestSchema(t, "报名表", []models.FormField{{Name: "name", Label: "姓名", Type: "string", Required: true}})
+	publication := &models.FormPublication{SchemaID: schema.ID, Token: token, Enabled: true, UserID: owner.ID}
+	if configure != nil {
+		configure(publication)
+	}
+	if err := config.DB.Create(publication).Error; err != nil {
+		t.Fatal(err)
+	}
+	return publication
+}
+
+// submitPublic 从指定IP提交公开表单
+func submitPublic(t *testing.T, r http.Handler, ip, token string, body gin.H) *testResponse {
+	t.Helper()
+	if body == nil {
+		body = gin.H{}
+	}
+	if _, ok := body["data"]; !ok {
+		body["data"] = gin.H{"name": "张三"}
+	}
+	return doRequestFrom(t, r, ip, http.MethodPost, "/api/public/forms/"+token+"/submissions", "", body)
+}
+
+// getChallenge 获取公开表单的验证题目
+func getChallenge(t *testing.T, r http.Handler, token string) utils.Challenge {
+	t.Helper()
+	resp := doRequest(t, r, http.MethodGet, "/api/public/forms/"+token+"/challenge", "", nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("challenge: %d %s", resp.Status, resp.Message)
+	}
+	var challenge utils.Challenge
+	resp.decode(t, &challenge)
+	return challenge
+}
+
+// mathAnswer 计算算术题 "x + y = ?" 的答案
+func mathAnswer(t *testing.T, question string) string {
+	t.Helper()
+	var x, y int
+	if _, err := fmt.Sscanf(question, "%d + %d = ?", &x, &y); err != nil {
+		t.Fatalf("无法解析题目 %q: %v", question, err)
+	}
+	return strconv.Itoa(x + y)
+}
+
+// solvePoW 找出满足难度的工作量证明答案
+func solvePoW(token string, difficulty int) string {
+	for i := 0; ; i++ {
+		answer := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(token + ":" + answer))
+		zeros := 0
+		for _, b := range sum {
+			zeros += bits.LeadingZeros8(b)
+			if b != 0 {
+				break
+			}
+		}
+		if zeros >= difficulty {
+			return answer
+		}
+	}
+}
+
+func TestPublicFormRateLimit(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newPublicFormRouter()
+	createTestPublication(t, "limited", func(p *models.FormPublication) { p.RateLimit = 2 })
+	createTestPublication(t, "unlimited", nil)
+
+	for i := 0; i < 2; i++ {
+		if resp := submitPublic(t, r, "192.0.2.1", "limited", nil); resp.Status != http.StatusOK {
+			t.Fatalf("submission %d: %d %s", i+1, resp.Status, resp.Message)
+		}
+	}
+	if resp := submitPublic(t, r, "192.0.2.1", "limited", nil); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("over limit: status = %d, want 429", resp.Status)
+	}
+
+	// 其他IP和其他表单不受影响
+	if resp := submitPublic(t, r, "192.0.2.2", "limited", nil); resp.Status != http.StatusOK {
+		t.Errorf("other ip: %d %s", resp.Status, resp.Message)
+	}
+	for i := 0; i < 3; i++ {
+		if resp := submitPublic(t, r, "192.0.2.1", "unlimited", nil); resp.Status != http.StatusOK {
+			t.Fatalf("unlimited submission %d: %d %s", i+1, resp.Status, resp.Message)
+		}
+	}
+
+	// 超出统计周期的提交不再计数
+	config.DB.Model(&models.FormSubmission{}).Where("ip = ?", "192.0.2.1").
+		Update("created_at", time.Now().Add(-publicRateWindow-time.Minute))
+	if resp := submitPublic(t, r, "192.0.2.1", "limited", nil); resp.Status != http.StatusOK {
+		t.Errorf("after window: %d %s", resp.Status, resp.Message)
+	}
+}
+
+func TestPublicFormMathChallenge(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newPublicFormRouter()
+	publication := createTestPublication(t, "math", func(p *models.FormPublication) { p.Challenge = utils.ChallengeMath })
+	createTestPublication(t, "other", func(p *models.FormPublication) { p.Challenge = utils.ChallengeMath })
+	createTestPublication(t, "open", nil)
+
+	if resp := doRequest(t, r, http.MethodGet, "/api/public/forms/open/challenge", "", nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("challenge for form without challenge: status = %d, want 400", resp.Status)
+	}
+
+	challenge := getChallenge(t, r, "math")
+	if challenge.Type != utils.ChallengeMath || challenge.Question == "" {
+		t.Fatalf("challenge = %+v", challenge)
+	}
+	answer := mathAnswer(t, challenge.Question)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       gin.H
+		wantStatus int
+	}{
+		{"未完成验证", "math", gin.H{}, http.StatusBadRequest},
+		{"数据校验失败不消耗题目", "math", gin.H{"data": gin.H{}, "challenge_token": challenge.Token, "challenge_answer": answer}, http.StatusBadRequest},
+		{"其他表单的题目", "other", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}, http.StatusBadRequest},
+		{"伪造的题目", "math", gin.H{"challenge_token": "e30.forged", "challenge_answer": answer}, http.StatusBadRequest},
+		{"回答正确", "math", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}, http.StatusOK},
+		{"题目不能重复使用", "math", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp := submitPublic(t, r, "192.0.2.1", tt.token, tt.body); resp.Status != tt.wantStatus {
+			t.Fatalf("%s: status = %d %s, want %d", tt.name, resp.Status, resp.Message, tt.wantStatus)
+		}
+	}
+
+	// 答错后题目失效，不能再尝试其他答案
+	challenge = getChallenge(t, r, "math")
+	answer = mathAnswer(t, challenge.Question)
+	if resp := submitPublic(t, r, "192.0.2.1", "math", gin.H{"challenge_token": challenge.Token, "challenge_answer": "-1"}); resp.Status != http.StatusBadRequest {
+		t.Fatalf("wrong answer: status = %d, want 400", resp.Status)
+	}
+	if resp := submitPublic(t, r, "192.0.2.1", "math", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}); resp.Status != http.StatusBadRequest {
+		t.Errorf("retry after wrong answer: status = %d, want 400", resp.Status)
+	}
+
+	// 过期的题目
+	expired, err := utils.NewChallenge(utils.ChallengeMath, publicationScope(publication), 0, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := submitPublic(t, r, "192.0.2.1", "math", gin.H{"challenge_token": expired.Token, "challenge_answer": mathAnswer(t, expired.Question)}); resp.Status != http.StatusBadRequest {
+		t.Errorf("expired challenge: status = %d, want 400", resp.Status)
+	}
+}
+
+func TestPublicFormChallengeFailureLimit(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newPublicFormRouter()
+	createTestPublication(t, "math", func(p *models.FormPublication) { p.Challenge = utils.ChallengeMath })
+
+	for i := 0; i < publicChallengeMaxFailures; i++ {
+		challenge := getChallenge(t, r, "math")
+		if resp := submitPublic(t, r, "192.0.2.1", "math", gin.H{"challenge_token": challenge.Token, "challenge_answer": "-1"}); resp.Status != http.StatusBadRequest {
+			t.Fatalf("wrong answer %d: status = %d, want 400", i+1, resp.Status)
+		}
+	}
+
+	// 答错次数达到上限后，同一IP回答正确也被拒绝，其他IP不受影响
+	challenge := getChallenge(t, r, "math")
+	body := gin.H{"challenge_token": challenge.Token, "challenge_answer": mathAnswer(t, challenge.Question)}
+	if resp := submitPublic(t, r, "192.0.2.1", "math", body); resp.Status != http.StatusTooManyRequests {
+		t.Fatalf("after failures: status = %d %s, want 429", resp.Status, resp.Message)
+	}
+	if resp := submitPublic(t, r, "192.0.2.2", "math", body); resp.Status != http.StatusOK {
+		t.Errorf("other ip: status = %d %s", resp.Status, resp.Message)
+	}
+
+	// 超出统计周期后可以再次作答
+	config.DB.Model(&models.ChallengeAttempt{}).Where("ip = ?", "192.0.2.1").
+		Update("created_at", time.Now().Add(-publicRateWindow-time.Minute))
+	challenge = getChallenge(t, r, "math")
+	body = gin.H{"challenge_token": challenge.Token, "challenge_answer": mathAnswer(t, challenge.Question)}
+	if resp := submitPublic(t, r, "192.0.2.1", "math", body); resp.Status != http.StatusOK {
+		t.Errorf("after window: status = %d %s", resp.Status, resp.Message)
+	}
+}
+
+func TestPublicFormPoWChallenge(t *testing.T) {
+	useAccountDB(t, formTables...)
+	r := newPublicFormRouter()
+	createTestPublication(t, "pow", func(p *models.FormPublication) {
+		p.Challenge = utils.ChallengePoW
+		p.PoWDifficulty = 12
+	})
+
+	challenge := getChallenge(t, r, "pow")
+	if challenge.Type != utils.ChallengePoW || challenge.Difficulty != 12 {
+		t.Fatalf("challenge = %+v", challenge)
+	}
+
+	// 找一个不满足难度的答案
+	weak := "0"
+	for i := 0; ; i++ {
+		weak = strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge.Token + ":" + weak))
+		if sum[0] != 0 {
+			break
+		}
+	}
+	if resp := submitPublic(t, r, "192.0.2.1", "pow", gin.H{"challenge_token": challenge.Token, "challenge_answer": weak}); resp.Status != http.StatusBadRequest {
+		t.Fatalf("insufficient work: status = %d, want 400", resp.Status)
+	}
+
+	challenge = getChallenge(t, r, "pow")
+	answer := solvePoW(challenge.Token, challenge.Difficulty)
+	if resp := submitPublic(t, r, "192.0.2.1", "pow", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}); resp.Status != http.StatusOK {
+		t.Fatalf("solved: status = %d %s", resp.Status, resp.Message)
+	}
+	if resp := submitPublic(t, r, "192.0.2.1", "pow", gin.H{"challenge_token": challenge.Token, "challenge_answer": answer}); resp.Status != http.StatusBadRequest {
+		t.Errorf("reused: status = %d, want 400", resp.Status)
+	}
+}
@@ -2,11 +2,11 @@ package controllers
 
 import (
 	"encoding/json"
-	"fmt"
 	"material-platform/config"
 	"material-platform/models"
 	"material-platform/utils"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,7 +15,6 @@ import (
 // CreateFormRecord 创建表单数据记录
 func CreateFormRecord(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var req struct {
 		SchemaID uint                   `json:"schema_id" binding:"required"`
@@ -27,32 +26,31 @@ func CreateFormRecord(c *gin.Context) {
 		return
 	}
 
-	// 验证表单结构是否存在
-	var schema models.FormSchema
-	query := config.DB.Where("id = ?", req.SchemaID)
-
-	// 非管理员只能在自己的表单中创建记录
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 提交者及以上角色可以创建记录
+	schema, ok := findAccessibleSchema(c, req.SchemaID, models.FormRoleSubmitter)
+	if !ok {
+		return
 	}
 
-	if err := query.First(&schema).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "表单结构不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "查询失败")
+	// 不可写的字段不能填写
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	if err := applyFieldPermissions(schema.Permission, fields, req.Data, nil); err != nil {
+		utils.ForbiddenResponse(c, err.Error())
 		return
 	}
 
 	// 验证数据格式
-	if err := validateFormData(schema.Schema, req.Data); err != nil {
+	if err := prepareRecordData(schema, req.Data, userID.(uint), hasPermission(c, models.PermFileReadAny), 0); err != nil {
 		utils.ErrorResponse(c, 400, "数据验证失败: "+err.Error())
 		return
 	}
 
 	// 序列化数据
-	dataJSON, err := json.Marshal(req.Data)
+	dataJSON, err := encodeRecordData(schema, req.Data)
 	if err != nil {
 		utils.ServerErrorResponse(c, "数据序列化失败")
 		return
@@ -61,27 +59,41 @@ func CreateFormRecord(c *gin.Context) {
 	// 创建记录
 	record := models.FormRecord{
 		SchemaID: req.SchemaID,
-		Data:     models.JSON(dataJSON),
+		Data:     dataJSON,
 		UserID:   userID.(uint),
+		State:    initialRecordState(schema),
 	}
 
-	if err := config.DB.Create(&record).Error; err != nil {
+	var removedFiles []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if removedFiles, err = syncRecordReferences(tx, schema, record.ID, req.Data); err != nil {
+			return err
+		}
+		_, err = saveRecordRevision(tx, schema, record.ID, models.RevisionActionCreate, nil, req.Data, userID.(uint))
+		return err
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "创建记录失败")
 		return
 	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordCreated, userID.(uint), nil, record.ID)
 
 	// 预加载关联数据
 	config.DB.Preload("Schema").Preload("User").First(&record, record.ID)
+	record.Schema.Permission = schema.Permission
 
-	utils.SuccessResponse(c, record)
+	responses := []models.FormRecordResponse{buildRecordResponse(record)}
+	filterRecordResponses(schema.Permission, responses)
+
+	utils.SuccessResponse(c, responses[0])
 }
 
 // GetFormRecords 获取表单数据记录列表
 func GetFormRecords(c *gin.Context) {
-	schemaID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 
@@ -93,26 +105,39 @@ func GetFormRecords(c *gin.Context) {
 	}
 
 	// 验证表单结构权限
-	var schema models.FormSchema
-	query := config.DB.Where("id = ?", schemaID)
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
+		return
+	}
 
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 不可见的字段不能用于筛选、排序和搜索
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
 	}
+	fields = visibleFields(schema.Permission, fields)
 
-	if err := query.First(&schema).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "表单结构不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "查询失败")
+	filters, err := parseRecordFilters(c.Query("filters"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件格式错误: "+err.Error())
+		return
+	}
+
+	orderClause, err := recordOrderClause(newRecordStorage(schema, fields), fields, c.Query("sort_by"), c.DefaultQuery("sort_order", "desc"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "排序字段错误: "+err.Error())
 		return
 	}
 
 	var records []models.FormRecord
 	var total int64
 
-	recordQuery := config.DB.Model(&models.FormRecord{}).Where("schema_id = ?", schemaID)
+	recordQuery, err := buildRecordQuery(schema, fields, c.Query("keyword"), filters)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件错误: "+err.Error())
+		return
+	}
 
 	// 获取总数
 	recordQuery.Count(&total)
@@ -120,7 +145,7 @@ func GetFormRecords(c *gin.Context) {
 	// 分页查询
 	offset := (page - 1) * pageSize
 	if err := recordQuery.Preload("User").
-		Order("created_at DESC").
+		Order(orderClause).
 		Offset(offset).
 		Limit(pageSize).
 		Find(&records).Error; err != nil {
@@ -128,49 +153,42 @@ func GetFormRecords(c *gin.Context) {
 		return
 	}
 
+	responses := buildRecordResponses(records)
+	expandRecordRelations(c, responses, fields, c.Query("expand"))
+	filterRecordResponses(schema.Permission, responses)
+
 	utils.SuccessResponse(c, gin.H{
-		"list":       records,
+		"list":       responses,
 		"total":      total,
 		"page":       page,
 		"page_size":  pageSize,
 		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
-		"schema":     schema,
+		"schema":     visibleSchema(*schema),
 	})
 }
 
 // GetFormRecord 获取单个表单数据记录
 func GetFormRecord(c *gin.Context) {
-	recordID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var record models.FormRecord
-	query := config.DB.Where("id = ?", recordID)
-
-	// 非管理员只能访问自己创建的记录或自己表单下的记录
-	if role != "admin" {
-		query = query.Where("user_id = ? OR schema_id IN (?)",
-			userID,
-			config.DB.Model(&models.FormSchema{}).Select("id").Where("user_id = ?", userID))
+	// 可查看所属表单且在记录可见范围内
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false))
+	if !ok {
+		return
 	}
 
-	if err := query.Preload("Schema").Preload("User").First(&record).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "记录不存在")
-			return
+	responses := []models.FormRecordResponse{buildRecordResponse(*record)}
+	if expand := c.Query("expand"); expand != "" {
+		if fields, err := parseSchemaFields(record.Schema.Schema); err == nil {
+			expandRecordRelations(c, responses, fields, expand)
 		}
-		utils.ServerErrorResponse(c, "查询失败")
-		return
 	}
+	filterRecordResponses(record.Schema.Permission, responses)
 
-	utils.SuccessResponse(c, record)
+	utils.SuccessResponse(c, responses[0])
 }
 
 // UpdateFormRecord 更新表单数据记录
 func UpdateFormRecord(c *gin.Context) {
-	recordID := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	var req struct {
 		Data map[string]interface{} `json:"data" binding:"required"`
@@ -181,85 +199,161 @@ func UpdateFormRecord(c *gin.Context) {
 		return
 	}
 
-	// 查找记录
-	var record models.FormRecord
-	query := config.DB.Where("id = ?", recordID)
-
-	// 非管理员只能修改自己创建的记录
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 查找记录，编辑者可修改全部可见记录，提交者只能修改自己的记录
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false))
+	if !ok {
+		return
+	}
+	perm := record.Schema.Permission
+	if !canModifyRecord(perm, record) {
+		utils.ForbiddenResponse(c, "没有权限修改该记录")
+		return
 	}
 
-	if err := query.Preload("Schema").First(&record).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "记录不存在")
-			return
-		}
+	// 保留修改前的数据，用于生成修订
+	if err := hydrateRecord(config.DB, record); err != nil {
 		utils.ServerErrorResponse(c, "查询失败")
 		return
 	}
+	var oldData map[string]interface{}
+	json.Unmarshal(record.Data, &oldData)
+
+	// 不可写的字段保持原值
+	fields, err := parseSchemaFields(record.Schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	if err := applyFieldPermissions(perm, fields, req.Data, oldData); err != nil {
+		utils.ForbiddenResponse(c, err.Error())
+		return
+	}
 
 	// 验证数据格式
-	if err := validateFormData(record.Schema.Schema, req.Data); err != nil {
+	if err := prepareRecordData(&record.Schema, req.Data, userID.(uint), hasPermission(c, models.PermFileReadAny), record.ID); err != nil {
 		utils.ErrorResponse(c, 400, "数据验证失败: "+err.Error())
 		return
 	}
 
 	// 序列化数据
-	dataJSON, err := json.Marshal(req.Data)
+	dataJSON, err := encodeRecordData(&record.Schema, req.Data)
 	if err != nil {
 		utils.ServerErrorResponse(c, "数据序列化失败")
 		return
 	}
 
 	// 更新记录
-	record.Data = models.JSON(dataJSON)
+	record.Data = dataJSON
 
-	if err := config.DB.Save(&record).Error; err != nil {
+	var removedFiles []string
+	var revision *models.FormRecordRevision
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Schema", "User").Save(record).Error; err != nil {
+			return err
+		}
+		if removedFiles, err = syncRecordReferences(tx, &record.Schema, record.ID, req.Data); err != nil {
+			return err
+		}
+		revision, err = saveRecordRevision(tx, &record.Schema, record.ID, models.RevisionActionUpdate, oldData, req.Data, userID.(uint))
+		return err
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "更新失败")
 		return
 	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordUpdated, userID.(uint), gin.H{"changes": revision.Changes}, record.ID)
 
 	// 重新加载记录
-	config.DB.Preload("Schema").Preload("User").First(&record, record.ID)
+	config.DB.Preload("Schema").Preload("User").First(record, record.ID)
+	record.Schema.Permission = perm
+
+	responses := []models.FormRecordResponse{buildRecordResponse(*record)}
+	filterRecordResponses(perm, responses)
 
-	utils.SuccessResponse(c, record)
+	utils.SuccessResponse(c, responses[0])
 }
 
 // DeleteFormRecord 删除表单数据记录
 func DeleteFormRecord(c *gin.Context) {
-	recordID := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// 查找记录
-	var record models.FormRecord
-	query := config.DB.Where("id = ?", recordID)
 
-	// 非管理员只能删除自己创建的记录
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 查找记录，编辑者可删除全部可见记录，提交者只能删除自己的记录
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false))
+	if !ok {
+		return
+	}
+	if !canModifyRecord(record.Schema.Permission, record) {
+		utils.ForbiddenResponse(c, "没有权限删除该记录")
+		return
 	}
 
-	if err := query.First(&record).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "记录不存在")
+	// 移到回收站，按关联字段的删除策略处理引用该记录的数据
+	deleted := make(map[uint]bool)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteRecordCascade(tx, record, userID.(uint), deleted)
+	})
+	if err != nil {
+		if restrictErr, ok := err.(*relationRestrictError); ok {
+			utils.ErrorResponse(c, 400, restrictErr.Error())
 			return
 		}
-		utils.ServerErrorResponse(c, "查询失败")
+		utils.ServerErrorResponse(c, "删除失败")
 		return
 	}
 
-	// 删除记录
-	if err := config.DB.Delete(&record).Error; err != nil {
-		utils.ServerErrorResponse(c, "删除失败")
-		return
+	emitRecordEvent(models.WebhookEventRecordDeleted, userID.(uint), nil, visitedRecordIDs(deleted)...)
+
+	utils.SuccessResponse(c, gin.H{"message": "记录已移到回收站"})
+}
+
+// prepareRecordData 校验并规范化提交的记录数据
+// recordID为0表示新建记录
+func prepareRecordData(schema *models.FormSchema, data map[string]interface{}, userID uint, readAnyAsset bool, recordID uint) error {
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		return err
 	}
 
-	utils.SuccessResponse(c, gin.H{"message": "删除成功"})
+	// 文件字段：校验资源并规范化为资源ID
+	if err := prepareAssetFields(fields, data, userID, readAnyAsset, recordID); err != nil {
+		return err
+	}
+
+	// 关联字段：校验被关联记录并规范化为记录ID
+	if err := prepareRelationFields(fields, data, schema.ID, recordID); err != nil {
+		return err
+	}
+
+	// 公式字段：由服务端计算，忽略提交的值
+	if err := computeFormulaFields(config.DB, fields, data); err != nil {
+		return err
+	}
+
+	return validateFormData(schema.Schema, data)
+}
+
+// syncRecordReferences 在记录保存后写入物理表数据，并同步其对资源、关联记录等外部对象的引用，返回需要删除的物理文件
+func syncRecordReferences(tx *gorm.DB, schema *models.FormSchema, recordID uint, data map[string]interface{}) ([]string, error) {
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := storeRecordData(tx, schema, fields, recordID, data); err != nil {
+		return nil, err
+	}
+	if err := syncRecordRelations(tx, schema.ID, recordID, fields, data); err != nil {
+		return nil, err
+	}
+	removedFiles, err := syncRecordAssets(tx, recordID, fields, data)
+	if err != nil {
+		return nil, err
+	}
+	return removedFiles, refreshRelatedFormulas(tx, recordID)
 }
 
 // validateFormData 验证表单数据
+// 按字段的显示条件移除隐藏字段的值，隐藏字段不做必填校验；重复分组逐条校验子字段
 func validateFormData(schema models.JSON, data map[string]interface{}) error {
 	// 解析Schema
 	var schemaData models.FormSchemaData
@@ -267,20 +361,27 @@ func validateFormData(schema models.JSON, data map[string]interface{}) error {
 		return err
 	}
 
-	// 验证必填字段
-	for _, field := range schemaData.Fields {
-		if field.Required {
-			// 检查字段名称(优先使用Name，如果为空则使用ID)
-			fieldKey := field.Name
-			if fieldKey == "" {
-				fieldKey = field.ID
-			}
+	return validateFieldValues(schemaData.Fields, schemaData.Sections, data, nil)
+}
 
-			if value, exists := data[fieldKey]; !exists || value == nil || value == "" {
-				return fmt.Errorf("字段 '%s' 是必填的", field.Label)
-			}
-		}
+// parseSchemaFields 解析表单结构中的字段定义
+func parseSchemaFields(schema models.JSON) ([]models.FormField, error) {
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(schema, &schemaData); err != nil {
+		return nil, err
+	}
+	return schemaData.Fields, nil
+}
+
+// getFieldKey 获取字段在数据中的键名(优先使用Name，如果为空则使用ID)
+func getFieldKey(field models.FormField) string {
+	if field.Name != "" {
+		return field.Name
 	}
+	return field.ID
+}
 
-	return nil
+// jsonFieldPath 生成字段在记录数据中的JSON路径
+func jsonFieldPath(key string) string {
+	return "$.\"" + strings.ReplaceAll(key, "\"", "") + "\""
 }
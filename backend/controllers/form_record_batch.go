@@ -0,0 +1,502 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBatchRecords 单次批量操作最多处理的记录数
+const maxBatchRecords = 500
+
+// errBatchAborted 存在失败的记录且未允许部分执行时回滚整个批量操作
+var errBatchAborted = errors.New("batch aborted")
+
+// recordSelection 批量操作的记录选择条件，按记录ID或筛选条件选择
+type recordSelection struct {
+	RecordIDs       []uint         `json:"record_ids"`
+	Filters         []RecordFilter `json:"filters"`
+	Keyword         string         `json:"keyword"`
+	All             bool           `json:"all"`               // 未指定记录ID和筛选条件时，需确认选择全部记录
+	ContinueOnError bool           `json:"continue_on_error"` // 部分记录失败时是否继续处理其他记录
+}
+
+// batchRecordResult 单条记录的处理结果
+type batchRecordResult struct {
+	RecordID    uint   `json:"record_id"`
+	NewRecordID uint   `json:"new_record_id,omitempty"` // 复制生成的记录
+	Success     bool   `json:"success"`
+	Unchanged   bool   `json:"unchanged,omitempty"` // 数据没有变化，未生成修订
+	Error       string `json:"error,omitempty"`
+}
+
+// batchRecordItem 通过校验、待写入的记录
+type batchRecordItem struct {
+	record   *models.FormRecord
+	oldData  map[string]interface{}
+	data     map[string]interface{}
+	dataJSON models.JSON
+}
+
+// batchRecordApply 在事务中写入单条记录，返回复制生成的记录ID和需要删除的物理文件
+type batchRecordApply func(tx *gorm.DB, item *batchRecordItem) (uint, []string, error)
+
+// selectBatchRecords 按选择条件查找当前用户可见的记录，查找失败时直接写入错误响应
+// 指定的记录ID不存在或不可见时记为失败结果
+func selectBatchRecords(c *gin.Context, schema *models.FormSchema, sel recordSelection) ([]models.FormRecord, []batchRecordResult, bool) {
+	if len(sel.RecordIDs) == 0 && len(sel.Filters) == 0 && sel.Keyword == "" && !sel.All {
+		utils.ErrorResponse(c, 400, "请指定要操作的记录")
+		return nil, nil, false
+	}
+	if len(sel.RecordIDs) > maxBatchRecords {
+		utils.ErrorResponse(c, 400, fmt.Sprintf("单次最多操作 %d 条记录", maxBatchRecords))
+		return nil, nil, false
+	}
+
+	// 不可见的字段不能用于筛选
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return nil, nil, false
+	}
+	fields = visibleFields(schema.Permission, fields)
+
+	query, err := buildRecordQuery(schema, fields, sel.Keyword, sel.Filters)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件错误: "+err.Error())
+		return nil, nil, false
+	}
+	if len(sel.RecordIDs) > 0 {
+		query = query.Where("form_records.id IN ?", sel.RecordIDs)
+	}
+
+	var total int64
+	query.Count(&total)
+	if total > maxBatchRecords {
+		utils.ErrorResponse(c, 400, fmt.Sprintf("匹配的记录有 %d 条，单次最多操作 %d 条", total, maxBatchRecords))
+		return nil, nil, false
+	}
+
+	var records []models.FormRecord
+	if err := query.Order("form_records.id ASC").Find(&records).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+	if err := hydrateRecordData(config.DB, records); err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	var results []batchRecordResult
+	found := make(map[uint]bool, len(records))
+	for _, record := range records {
+		found[record.ID] = true
+	}
+	for _, id := range uniqueIDs(sel.RecordIDs) {
+		if !found[id] {
+			results = append(results, batchRecordResult{RecordID: id, Error: "记录不存在"})
+		}
+	}
+
+	return records, results, true
+}
+
+// runRecordBatch 在同一事务中逐条写入记录，每条记录使用独立的保存点
+// 未允许部分执行时，任一记录失败都会回滚全部修改；已提交时返回执行成功的记录和批次标识
+func runRecordBatch(c *gin.Context, items []batchRecordItem, results []batchRecordResult, continueOnError bool, apply batchRecordApply) ([]batchRecordResult, string) {
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	batchID, err := utils.RandomToken(16)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成批次标识失败")
+		return nil, ""
+	}
+
+	var removedFiles []string
+	done := make([]batchRecordResult, 0, len(items))
+	if failed == 0 || continueOnError {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			for i := range items {
+				item := &items[i]
+				result := batchRecordResult{RecordID: item.record.ID}
+
+				var files []string
+				err := tx.Transaction(func(tx *gorm.DB) error {
+					newID, f, err := apply(tx, item)
+					if err != nil {
+						return err
+					}
+					result.NewRecordID = newID
+					files = f
+
+					target := item.record.ID
+					if newID != 0 {
+						target = newID
+					}
+					return tagBatchRevision(tx, target, batchID)
+				})
+				if err != nil {
+					message, ok := batchErrorMessage(err)
+					if !ok {
+						return err
+					}
+					result.Error = message
+					failed++
+				} else {
+					result.Success = true
+					removedFiles = append(removedFiles, files...)
+				}
+				done = append(done, result)
+			}
+
+			if failed > 0 && !continueOnError {
+				return errBatchAborted
+			}
+			return nil
+		})
+		if err != nil && err != errBatchAborted {
+			utils.ServerErrorResponse(c, "批量操作失败")
+			return nil, ""
+		}
+	} else {
+		// 校验阶段已有失败的记录，不再执行
+		for _, item := range items {
+			done = append(done, batchRecordResult{RecordID: item.record.ID})
+		}
+		err = errBatchAborted
+	}
+
+	applied := err == nil
+	if applied {
+		removeAssetFiles(removedFiles)
+	} else {
+		for i := range done {
+			if done[i].Error == "" {
+				done[i].Success = false
+				done[i].NewRecordID = 0
+				done[i].Error = "其他记录处理失败，未执行"
+			}
+		}
+	}
+	results = append(results, done...)
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+
+	response := gin.H{
+		"applied":   applied,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}
+	if !applied || len(items) == 0 {
+		utils.SuccessResponse(c, response)
+		return nil, ""
+	}
+	response["batch_id"] = batchID
+	utils.SuccessResponse(c, response)
+
+	var succeededItems []batchRecordResult
+	for _, result := range done {
+		if result.Success {
+			succeededItems = append(succeededItems, result)
+		}
+	}
+	return succeededItems, batchID
+}
+
+// batchErrorMessage 返回单条记录业务错误的提示，非业务错误返回false
+func batchErrorMessage(err error) (string, bool) {
+	if restrictErr, ok := err.(*relationRestrictError); ok {
+		return restrictErr.Error(), true
+	}
+	return "", false
+}
+
+// tagBatchRevision 为记录最新的修订标记批次
+func tagBatchRevision(tx *gorm.DB, recordID uint, batchID string) error {
+	return tx.Model(&models.FormRecordRevision{}).
+		Where("record_id = ? AND version = (?)", recordID,
+			tx.Model(&models.FormRecordRevision{}).Select("MAX(version)").Where("record_id = ?", recordID)).
+		Update("batch_id", batchID).Error
+}
+
+// recordDataMap 解析记录数据
+func recordDataMap(record *models.FormRecord) map[string]interface{} {
+	data := make(map[string]interface{})
+	json.Unmarshal(record.Data, &data)
+	return data
+}
+
+// BatchDeleteFormRecords 批量将记录移到回收站
+func BatchDeleteFormRecords(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req recordSelection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 编辑者可删除全部可见记录，提交者只能删除自己的记录
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleSubmitter)
+	if !ok {
+		return
+	}
+
+	records, results, ok := selectBatchRecords(c, schema, req)
+	if !ok {
+		return
+	}
+
+	var items []batchRecordItem
+	for i := range records {
+		if !canModifyRecord(schema.Permission, &records[i]) {
+			results = append(results, batchRecordResult{RecordID: records[i].ID, Error: "没有权限删除该记录"})
+			continue
+		}
+		items = append(items, batchRecordItem{record: &records[i]})
+	}
+
+	// 已被前面的记录级联删除的记录直接视为成功
+	deleted := make(map[uint]bool)
+	_, batchID := runRecordBatch(c, items, results, req.ContinueOnError, func(tx *gorm.DB, item *batchRecordItem) (uint, []string, error) {
+		if deleted[item.record.ID] {
+			return 0, nil, nil
+		}
+		visited := make(map[uint]bool)
+		if err := deleteRecordCascade(tx, item.record, userID.(uint), visited); err != nil {
+			return 0, nil, err
+		}
+		for id := range visited {
+			deleted[id] = true
+		}
+		return 0, nil, nil
+	})
+	if batchID != "" {
+		emitRecordEvent(models.WebhookEventRecordDeleted, userID.(uint), gin.H{"batch_id": batchID}, visitedRecordIDs(deleted)...)
+	}
+}
+
+// BatchUpdateFormRecords 批量修改记录的字段值，未提交的字段保持不变
+func BatchUpdateFormRecords(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		recordSelection
+		Data map[string]interface{} `json:"data" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if len(req.Data) == 0 {
+		utils.ErrorResponse(c, 400, "请指定要修改的字段")
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleSubmitter)
+	if !ok {
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	for key := range req.Data {
+		field, exists := findFieldByKey(fields, key)
+		if !exists {
+			utils.ErrorResponse(c, 400, fmt.Sprintf("字段 '%s' 不存在", key))
+			return
+		}
+		if field.Type == "formula" || field.Type == "unique_id" {
+			utils.ErrorResponse(c, 400, fmt.Sprintf("字段 '%s' 由系统生成，不能修改", field.Label))
+			return
+		}
+		if fieldAccess(schema.Permission, key) != models.FieldAccessWrite {
+			utils.ForbiddenResponse(c, fmt.Sprintf("无权修改字段 '%s'", field.Label))
+			return
+		}
+	}
+	changes, err := json.Marshal(req.Data)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "字段值格式错误")
+		return
+	}
+
+	records, results, ok := selectBatchRecords(c, schema, req.recordSelection)
+	if !ok {
+		return
+	}
+
+	// 逐条合并并校验，校验失败的记录不写入
+	var items []batchRecordItem
+	for i := range records {
+		record := &records[i]
+		if !canModifyRecord(schema.Permission, record) {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: "没有权限修改该记录"})
+			continue
+		}
+
+		oldData := recordDataMap(record)
+		data := recordDataMap(record)
+		var values map[string]interface{}
+		json.Unmarshal(changes, &values)
+		for key, value := range values {
+			data[key] = value
+		}
+
+		if err := applyFieldPermissions(schema.Permission, fields, data, oldData); err != nil {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: err.Error()})
+			continue
+		}
+		if err := prepareRecordData(schema, data, userID.(uint), hasPermission(c, models.PermFileReadAny), record.ID); err != nil {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: "数据验证失败: " + err.Error()})
+			continue
+		}
+		if len(diffRecordData(fields, oldData, data)) == 0 {
+			results = append(results, batchRecordResult{RecordID: record.ID, Success: true, Unchanged: true})
+			continue
+		}
+
+		dataJSON, err := encodeRecordData(schema, data)
+		if err != nil {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: "数据序列化失败"})
+			continue
+		}
+		items = append(items, batchRecordItem{record: record, oldData: oldData, data: data, dataJSON: dataJSON})
+	}
+
+	succeeded, batchID := runRecordBatch(c, items, results, req.ContinueOnError, func(tx *gorm.DB, item *batchRecordItem) (uint, []string, error) {
+		item.record.Data = item.dataJSON
+		if err := tx.Omit("Schema", "User").Save(item.record).Error; err != nil {
+			return 0, nil, err
+		}
+		files, err := syncRecordReferences(tx, schema, item.record.ID, item.data)
+		if err != nil {
+			return 0, nil, err
+		}
+		_, err = saveRecordRevision(tx, schema, item.record.ID, models.RevisionActionUpdate, item.oldData, item.data, userID.(uint))
+		return 0, files, err
+	})
+
+	recordChanges := make(map[uint][]models.FieldChange)
+	for _, item := range items {
+		recordChanges[item.record.ID] = diffRecordData(fields, item.oldData, item.data)
+	}
+	for _, result := range succeeded {
+		emitRecordEvent(models.WebhookEventRecordUpdated, userID.(uint), gin.H{
+			"batch_id": batchID,
+			"changes":  recordChanges[result.RecordID],
+		}, result.RecordID)
+	}
+}
+
+// BatchDuplicateFormRecords 批量复制记录，复制的记录归当前用户所有
+func BatchDuplicateFormRecords(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req recordSelection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 提交者及以上角色可以创建记录
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleSubmitter)
+	if !ok {
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+
+	records, results, ok := selectBatchRecords(c, schema, req)
+	if !ok {
+		return
+	}
+
+	var items []batchRecordItem
+	for i := range records {
+		record := &records[i]
+		data := recordDataMap(record)
+
+		// 不可写的字段不复制，只能被关联一次的关联字段不复制
+		keepProtectedFields(schema.Permission, fields, data, nil)
+		for _, field := range fields {
+			if isRelationField(field) && isExclusiveRelation(field) {
+				delete(data, getFieldKey(field))
+			}
+		}
+
+		if err := prepareDuplicateData(schema, fields, data); err != nil {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: "数据验证失败: " + err.Error()})
+			continue
+		}
+
+		dataJSON, err := encodeRecordData(schema, data)
+		if err != nil {
+			results = append(results, batchRecordResult{RecordID: record.ID, Error: "数据序列化失败"})
+			continue
+		}
+		items = append(items, batchRecordItem{record: record, data: data, dataJSON: dataJSON})
+	}
+
+	succeeded, batchID := runRecordBatch(c, items, results, req.ContinueOnError, func(tx *gorm.DB, item *batchRecordItem) (uint, []string, error) {
+		duplicate := models.FormRecord{
+			SchemaID: schema.ID,
+			Data:     item.dataJSON,
+			UserID:   userID.(uint),
+			State:    initialRecordState(schema),
+		}
+		if err := tx.Create(&duplicate).Error; err != nil {
+			return 0, nil, err
+		}
+		files, err := syncRecordReferences(tx, schema, duplicate.ID, item.data)
+		if err != nil {
+			return 0, nil, err
+		}
+		_, err = saveRecordRevision(tx, schema, duplicate.ID, models.RevisionActionCreate, nil, item.data, userID.(uint))
+		return duplicate.ID, files, err
+	})
+
+	var created []uint
+	for _, result := range succeeded {
+		created = append(created, result.NewRecordID)
+	}
+	if len(created) > 0 {
+		emitRecordEvent(models.WebhookEventRecordCreated, userID.(uint), gin.H{"batch_id": batchID}, created...)
+	}
+}
+
+// prepareDuplicateData 校验复制的记录数据
+// 文件字段沿用原记录已引用的资源，不再校验资源归属
+func prepareDuplicateData(schema *models.FormSchema, fields []models.FormField, data map[string]interface{}) error {
+	if err := prepareRelationFields(fields, data, schema.ID, 0); err != nil {
+		return err
+	}
+	if err := computeFormulaFields(config.DB, fields, data); err != nil {
+		return err
+	}
+	return validateFormData(schema.Schema, data)
+}
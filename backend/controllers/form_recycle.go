@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// findDeletedRecord 查找回收站中当前用户可恢复、删除的记录，查找失败时直接写入错误响应
+func findDeletedRecord(c *gin.Context) (*models.FormRecord, bool) {
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), true))
+	if !ok {
+		return nil, false
+	}
+	if !canModifyRecord(record.Schema.Permission, record) {
+		utils.ForbiddenResponse(c, "没有权限操作该记录")
+		return nil, false
+	}
+	return record, true
+}
+
+// GetDeletedFormRecords 获取回收站中的表单记录，可按表单结构筛选
+func GetDeletedFormRecords(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var records []models.FormRecord
+	var total int64
+
+	query := config.DB.Model(&models.FormRecord{}).Where("is_deleted = ?", true)
+
+	// 没有管理全部表单的权限时只能看到自己的记录，以及可编辑全部记录的表单中的记录
+	if !hasPermission(c, models.PermFormManageAny) {
+		query = query.Where("user_id = ? OR schema_id IN (?)", userID, editableSchemaIDsQuery(userID.(uint)))
+	}
+
+	if schemaID := c.Query("schema_id"); schemaID != "" {
+		query = query.Where("schema_id = ?", schemaID)
+	}
+
+	// 计算总数
+	query.Count(&total)
+
+	// 分页查询
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Schema").Preload("User").
+		Order("deleted_at DESC").Offset(offset).Limit(pageSize).Find(&records).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	// 按各记录所属表单的字段权限隐藏不可见字段
+	responses := buildRecordResponses(records)
+	perms := make(map[uint]*models.FormPermission)
+	for i := range records {
+		perm, exists := perms[records[i].SchemaID]
+		if !exists {
+			perm, _ = loadFormPermission(&records[i].Schema, userID.(uint), hasPermission(c, models.PermFormManageAny))
+			perms[records[i].SchemaID] = perm
+		}
+		filterRecordResponses(perm, responses[i:i+1])
+	}
+
+	utils.PageResponse(c, responses, total, page, pageSize)
+}
+
+// RestoreFormRecord 从回收站恢复表单记录
+func RestoreFormRecord(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	record, ok := findDeletedRecord(c)
+	if !ok {
+		return
+	}
+
+	if err := hydrateRecord(config.DB, record); err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+	var oldData, data map[string]interface{}
+	json.Unmarshal(record.Data, &oldData)
+	json.Unmarshal(record.Data, &data)
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	// 删除期间表单结构或关联记录可能已变化，按当前结构重新校验
+	if err := prepareRecordData(&record.Schema, data, userID.(uint), hasPermission(c, models.PermFileReadAny), record.ID); err != nil {
+		utils.ErrorResponse(c, 400, "记录无法恢复: "+err.Error())
+		return
+	}
+
+	dataJSON, err := encodeRecordData(&record.Schema, data)
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据序列化失败")
+		return
+	}
+
+	var removedFiles []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(record).UpdateColumns(map[string]interface{}{
+			"data":       dataJSON,
+			"is_deleted": false,
+			"deleted_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		if removedFiles, err = syncRecordReferences(tx, &record.Schema, record.ID, data); err != nil {
+			return err
+		}
+		_, err = saveRecordRevision(tx, &record.Schema, record.ID, models.RevisionActionRecover, oldData, data, userID.(uint))
+		return err
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "记录恢复失败")
+		return
+	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordRestored, userID.(uint), nil, record.ID)
+
+	utils.SuccessResponse(c, gin.H{"message": "记录恢复成功"})
+}
+
+// PermanentDeleteFormRecord 彻底删除回收站中的单条表单记录
+func PermanentDeleteFormRecord(c *gin.Context) {
+	record, ok := findDeletedRecord(c)
+	if !ok {
+		return
+	}
+
+	var removedFiles []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		removedFiles, err = purgeRecord(tx, record)
+		return err
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "记录删除失败")
+		return
+	}
+	removeAssetFiles(removedFiles)
+
+	utils.SuccessResponse(c, gin.H{"message": "记录已彻底删除"})
+}
+
+// EmptyFormRecycleBin 清空表单记录回收站，可按表单结构筛选
+func EmptyFormRecycleBin(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var records []models.FormRecord
+	query := config.DB.Where("is_deleted = ?", true)
+
+	// 没有管理全部表单的权限时只能清空自己的记录，以及可编辑全部记录的表单中的记录
+	if !hasPermission(c, models.PermFormManageAny) {
+		query = query.Where("user_id = ? OR schema_id IN (?)", userID, editableSchemaIDsQuery(userID.(uint)))
+	}
+
+	if schemaID := c.Query("schema_id"); schemaID != "" {
+		query = query.Where("schema_id = ?", schemaID)
+	}
+
+	if err := query.Find(&records).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	var removedFiles []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range records {
+			files, err := purgeRecord(tx, &records[i])
+			if err != nil {
+				return err
+			}
+			removedFiles = append(removedFiles, files...)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "清空回收站失败")
+		return
+	}
+	removeAssetFiles(removedFiles)
+
+	utils.SuccessResponse(c, gin.H{"message": "回收站清空成功", "count": len(records)})
+}
+
+// purgeSchemaRecords 彻底删除表单结构下回收站中的全部记录，返回需要删除的物理文件
+func purgeSchemaRecords(tx *gorm.DB, schemaID uint) ([]string, error) {
+	var records []models.FormRecord
+	if err := tx.Where("schema_id = ? AND is_deleted = ?", schemaID, true).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	var removedFiles []string
+	for i := range records {
+		files, err := purgeRecord(tx, &records[i])
+		if err != nil {
+			return nil, err
+		}
+		removedFiles = append(removedFiles, files...)
+	}
+	return removedFiles, nil
+}
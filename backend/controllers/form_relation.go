@@ -0,0 +1,485 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// relationRestrictError 被关联记录受限制无法删除
+type relationRestrictError struct {
+	message string
+}
+
+func (e *relationRestrictError) Error() string {
+	return e.message
+}
+
+// isRelationField 判断字段是否为关联字段
+func isRelationField(field models.FormField) bool {
+	return field.Type == "relation"
+}
+
+// isMultipleRelation 关联字段是否可以关联多条记录
+func isMultipleRelation(field models.FormField) bool {
+	return field.RelationType == models.RelationOneToMany || field.RelationType == models.RelationManyToMany
+}
+
+// isExclusiveRelation 被关联的记录是否只能被该字段关联一次
+func isExclusiveRelation(field models.FormField) bool {
+	return field.RelationType == models.RelationOneToOne || field.RelationType == models.RelationOneToMany
+}
+
+// normalizeRelationFields 校验表单结构中的关联字段定义并补全默认值
+// 关联的目标表单必须存在，且当前用户至少可以查看(自己的、共享的或所在用户组的表单)；
+// relation_schema_id 为0表示关联表单自身，统一替换为selfID(新建表单时为0，创建后再回填)
+func normalizeRelationFields(fields []models.FormField, selfID, userID uint, manageAny bool) error {
+	for i := range fields {
+		field := &fields[i]
+		if !isRelationField(*field) {
+			continue
+		}
+
+		if field.RelationSchemaID == nil {
+			return fmt.Errorf("关联字段 '%s' 必须指定关联的表单", field.Label)
+		}
+
+		if *field.RelationSchemaID == 0 || *field.RelationSchemaID == selfID {
+			self := selfID
+			field.RelationSchemaID = &self
+		} else {
+			var target models.FormSchema
+			if err := config.DB.First(&target, *field.RelationSchemaID).Error; err != nil {
+				return fmt.Errorf("关联字段 '%s' 关联的表单不存在", field.Label)
+			}
+			perm, err := loadFormPermission(&target, userID, manageAny)
+			if err != nil {
+				return err
+			}
+			if !hasFormRole(perm, models.FormRoleViewer) {
+				return fmt.Errorf("关联字段 '%s' 关联的表单不存在", field.Label)
+			}
+		}
+
+		switch field.RelationType {
+		case "":
+			field.RelationType = models.RelationManyToOne
+		case models.RelationOneToOne, models.RelationManyToOne, models.RelationOneToMany, models.RelationManyToMany:
+		default:
+			return fmt.Errorf("关联字段 '%s' 的关联类型无效", field.Label)
+		}
+
+		switch field.OnDelete {
+		case "":
+			field.OnDelete = models.OnDeleteRestrict
+		case models.OnDeleteRestrict, models.OnDeleteCascade, models.OnDeleteNullify:
+		default:
+			return fmt.Errorf("关联字段 '%s' 的删除策略无效", field.Label)
+		}
+	}
+
+	return nil
+}
+
+// resolveSelfRelations 将关联自身的占位ID(0)替换为新建表单的ID
+func resolveSelfRelations(fields []models.FormField, schemaID uint) bool {
+	resolved := false
+	for i := range fields {
+		if isRelationField(fields[i]) && fields[i].RelationSchemaID != nil && *fields[i].RelationSchemaID == 0 {
+			id := schemaID
+			fields[i].RelationSchemaID = &id
+			resolved = true
+		}
+	}
+	return resolved
+}
+
+// prepareRelationFields 校验记录中的关联字段：被关联记录必须属于目标表单，且满足关联类型的约束
+func prepareRelationFields(fields []models.FormField, data map[string]interface{}, schemaID, recordID uint) error {
+	for _, field := range fields {
+		if !isRelationField(field) || field.RelationSchemaID == nil {
+			continue
+		}
+
+		key := getFieldKey(field)
+		ids, err := parseIDList(data[key])
+		if err != nil {
+			return fmt.Errorf("字段 '%s': %v", field.Label, err)
+		}
+		ids = uniqueIDs(ids)
+
+		if len(ids) == 0 {
+			delete(data, key)
+			continue
+		}
+		if !isMultipleRelation(field) && len(ids) > 1 {
+			return fmt.Errorf("字段 '%s' 只能关联一条记录", field.Label)
+		}
+
+		var count int64
+		config.DB.Model(&models.FormRecord{}).
+			Where("id IN ? AND schema_id = ? AND is_deleted = ?", ids, *field.RelationSchemaID, false).
+			Count(&count)
+		if int(count) != len(ids) {
+			return fmt.Errorf("字段 '%s' 关联的记录不存在", field.Label)
+		}
+
+		if isExclusiveRelation(field) {
+			var taken []uint
+			config.DB.Model(&models.FormRecordRelation{}).
+				Where("schema_id = ? AND field_key = ? AND target_record_id IN ? AND record_id <> ?", schemaID, key, ids, recordID).
+				Pluck("target_record_id", &taken)
+			if len(taken) > 0 {
+				return fmt.Errorf("字段 '%s' 关联的记录 %d 已被其他记录关联", field.Label, taken[0])
+			}
+		}
+
+		if isMultipleRelation(field) {
+			data[key] = ids
+		} else {
+			data[key] = ids[0]
+		}
+	}
+
+	return nil
+}
+
+// syncRecordRelations 根据记录数据重建该记录的关联关系
+func syncRecordRelations(tx *gorm.DB, schemaID, recordID uint, fields []models.FormField, data map[string]interface{}) error {
+	if err := tx.Where("record_id = ?", recordID).Delete(&models.FormRecordRelation{}).Error; err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if !isRelationField(field) || field.RelationSchemaID == nil {
+			continue
+		}
+
+		key := getFieldKey(field)
+		ids, err := parseIDList(data[key])
+		if err != nil {
+			return err
+		}
+
+		for _, id := range uniqueIDs(ids) {
+			relation := models.FormRecordRelation{
+				RecordID:       recordID,
+				FieldKey:       key,
+				TargetRecordID: id,
+				SchemaID:       schemaID,
+				TargetSchemaID: *field.RelationSchemaID,
+			}
+			if err := tx.Create(&relation).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteRecordCascade 将记录移到回收站，按关联字段的删除策略处理引用它的记录
+// 记录引用的资源保留到彻底删除时释放；visited记录本次删除中已处理的记录，避免循环关联导致重复处理
+func deleteRecordCascade(tx *gorm.DB, record *models.FormRecord, userID uint, visited map[uint]bool) error {
+	visited[record.ID] = true
+
+	var incoming []models.FormRecordRelation
+	if err := tx.Where("target_record_id = ?", record.ID).Find(&incoming).Error; err != nil {
+		return err
+	}
+
+	schemas := make(map[uint]*models.FormSchema)
+	for _, link := range incoming {
+		if visited[link.RecordID] {
+			continue
+		}
+
+		source, exists := schemas[link.SchemaID]
+		if !exists {
+			source = &models.FormSchema{}
+			if err := tx.First(source, link.SchemaID).Error; err != nil {
+				return err
+			}
+			schemas[link.SchemaID] = source
+		}
+
+		fields, err := parseSchemaFields(source.Schema)
+		if err != nil {
+			return err
+		}
+		field, _ := findFieldByKey(fields, link.FieldKey)
+
+		switch field.OnDelete {
+		case models.OnDeleteCascade:
+			var sourceRecord models.FormRecord
+			if err := tx.Where("is_deleted = ?", false).First(&sourceRecord, link.RecordID).Error; err != nil {
+				continue
+			}
+			if err := deleteRecordCascade(tx, &sourceRecord, userID, visited); err != nil {
+				return err
+			}
+
+		case models.OnDeleteNullify:
+			if err := removeRelationValue(tx, link, source, fields, userID); err != nil {
+				return err
+			}
+
+		default:
+			return &relationRestrictError{
+				message: fmt.Sprintf("该记录被表单 '%s' 的记录 %d 通过字段 '%s' 引用，无法删除", source.Name, link.RecordID, field.Label),
+			}
+		}
+	}
+
+	// 回收站中的记录不再参与关联，恢复时根据记录数据重建
+	if err := tx.Where("record_id = ? OR target_record_id = ?", record.ID, record.ID).
+		Delete(&models.FormRecordRelation{}).Error; err != nil {
+		return err
+	}
+
+	if err := hydrateRecord(tx, record); err != nil {
+		return err
+	}
+	var data map[string]interface{}
+	json.Unmarshal(record.Data, &data)
+
+	now := time.Now()
+	record.IsDeleted = true
+	record.DeletedAt = &now
+	if err := tx.Model(record).UpdateColumns(map[string]interface{}{
+		"is_deleted": true,
+		"deleted_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	var schema models.FormSchema
+	if err := tx.First(&schema, record.SchemaID).Error; err != nil {
+		return err
+	}
+	_, err := saveRecordRevision(tx, &schema, record.ID, models.RevisionActionDelete, data, nil, userID)
+	return err
+}
+
+// visitedRecordIDs 返回级联删除过程中移到回收站的记录ID
+func visitedRecordIDs(visited map[uint]bool) []uint {
+	ids := make([]uint, 0, len(visited))
+	for id := range visited {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// purgeRecord 彻底删除记录，释放其引用的资源，返回需要删除的物理文件
+func purgeRecord(tx *gorm.DB, record *models.FormRecord) ([]string, error) {
+	if err := tx.Where("record_id = ? OR target_record_id = ?", record.ID, record.ID).
+		Delete(&models.FormRecordRelation{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("record_id = ?", record.ID).Delete(&models.FormRecordRevision{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("record_id = ?", record.ID).Delete(&models.FormSubmission{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("record_id = ?", record.ID).Delete(&models.FormRecordTransition{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("record_id = ?", record.ID).Delete(&models.FormRecordAssignee{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Delete(record).Error; err != nil {
+		return nil, err
+	}
+	if err := deleteStoredRecordData(tx, record.SchemaID, record.ID); err != nil {
+		return nil, err
+	}
+	return releaseRecordAssets(tx, record.ID)
+}
+
+// removeRelationValue 从引用记录的关联字段中移除被删除的记录，并重新计算其公式字段
+func removeRelationValue(tx *gorm.DB, link models.FormRecordRelation, schema *models.FormSchema, fields []models.FormField, userID uint) error {
+	var source models.FormRecord
+	if err := tx.Where("is_deleted = ?", false).First(&source, link.RecordID).Error; err != nil {
+		return nil
+	}
+	if err := hydrateRecord(tx, &source); err != nil {
+		return err
+	}
+
+	var data, oldData map[string]interface{}
+	if err := json.Unmarshal(source.Data, &data); err != nil {
+		return err
+	}
+	json.Unmarshal(source.Data, &oldData)
+
+	ids, _ := parseIDList(data[link.FieldKey])
+	remaining := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id != link.TargetRecordID {
+			remaining = append(remaining, id)
+		}
+	}
+
+	switch {
+	case len(remaining) == 0:
+		delete(data, link.FieldKey)
+	case len(remaining) == 1 && !isSliceValue(data[link.FieldKey]):
+		data[link.FieldKey] = remaining[0]
+	default:
+		data[link.FieldKey] = remaining
+	}
+
+	// 先删除关联关系，公式中对关联记录的聚合不再包含被删除的记录
+	if err := tx.Where("record_id = ? AND field_key = ? AND target_record_id = ?", link.RecordID, link.FieldKey, link.TargetRecordID).
+		Delete(&models.FormRecordRelation{}).Error; err != nil {
+		return err
+	}
+	if err := computeFormulaFields(tx, fields, data); err != nil {
+		return err
+	}
+	if err := saveRecordData(tx, schema, fields, &source, data); err != nil {
+		return err
+	}
+
+	_, err := saveRecordRevision(tx, schema, source.ID, models.RevisionActionUpdate, oldData, data, userID)
+	return err
+}
+
+// expandRecordRelations 展开记录响应中的关联字段
+// expand为逗号分隔的字段名，"all"表示展开全部关联字段
+// 关联记录按当前用户对目标表单的权限、记录可见范围和字段权限过滤，无权查看的记录只返回ID
+func expandRecordRelations(c *gin.Context, responses []models.FormRecordResponse, fields []models.FormField, expand string) {
+	expand = strings.TrimSpace(expand)
+	if expand == "" || len(responses) == 0 {
+		return
+	}
+
+	var keys []string
+	for _, field := range fields {
+		if !isRelationField(field) {
+			continue
+		}
+		key := getFieldKey(field)
+		if expand == "all" || expand == "*" || containsString(strings.Split(expand, ","), key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(responses))
+	for _, response := range responses {
+		ids = append(ids, response.ID)
+	}
+
+	var links []models.FormRecordRelation
+	if err := config.DB.Where("record_id IN ? AND field_key IN ?", ids, keys).Find(&links).Error; err != nil || len(links) == 0 {
+		return
+	}
+
+	targetIDs := make(map[uint][]uint)
+	for _, link := range links {
+		targetIDs[link.TargetSchemaID] = append(targetIDs[link.TargetSchemaID], link.TargetRecordID)
+	}
+
+	userID, _ := c.Get("user_id")
+	manageAny := hasPermission(c, models.PermFormManageAny)
+	targetMap := make(map[uint]models.FormRecordResponse)
+	for schemaID, recordIDs := range targetIDs {
+		var schema models.FormSchema
+		if err := config.DB.First(&schema, schemaID).Error; err != nil {
+			continue
+		}
+		perm, err := loadFormPermission(&schema, userID.(uint), manageAny)
+		if err != nil || !hasFormRole(perm, models.FormRoleViewer) {
+			continue
+		}
+
+		var targets []models.FormRecord
+		query := config.DB.Model(&models.FormRecord{}).Where("form_records.id IN ? AND form_records.schema_id = ? AND form_records.is_deleted = ?", uniqueIDs(recordIDs), schemaID, false)
+		scopeRecordQuery(query, perm).Find(&targets)
+		targetResponses := buildRecordResponses(targets)
+		filterRecordResponses(perm, targetResponses)
+		for _, target := range targetResponses {
+			targetMap[target.ID] = target
+		}
+	}
+
+	index := make(map[uint]int, len(responses))
+	for i, response := range responses {
+		index[response.ID] = i
+	}
+
+	for _, link := range links {
+		target, exists := targetMap[link.TargetRecordID]
+		if !exists {
+			target = models.FormRecordResponse{ID: link.TargetRecordID, SchemaID: link.TargetSchemaID}
+		}
+		response := &responses[index[link.RecordID]]
+		if response.Relations == nil {
+			response.Relations = make(map[string][]models.FormRecordResponse)
+		}
+		response.Relations[link.FieldKey] = append(response.Relations[link.FieldKey], target)
+	}
+}
+
+// findRelationReferences 查找通过关联字段引用指定表单的其他表单名称
+func findRelationReferences(schemaID uint) []string {
+	var schemas []models.FormSchema
+	config.DB.Select("id", "name", "schema").Where("id <> ?", schemaID).Find(&schemas)
+
+	var names []string
+	for _, schema := range schemas {
+		fields, err := parseSchemaFields(schema.Schema)
+		if err != nil {
+			continue
+		}
+		for _, field := range fields {
+			if isRelationField(field) && field.RelationSchemaID != nil && *field.RelationSchemaID == schemaID {
+				names = append(names, schema.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// uniqueIDs 去除重复的ID，保持原有顺序
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// isSliceValue 判断值是否为数组
+func isSliceValue(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, []uint:
+		return true
+	}
+	return false
+}
+
+// containsString 判断字符串切片中是否包含指定值(忽略首尾空白)
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if strings.TrimSpace(value) == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// formReportRequest 创建、修改报表的请求参数
+type formReportRequest struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Definition  AggregateQuery `json:"definition"`
+}
+
+// findAccessibleReport 查找当前用户可访问的报表(可查看其所属表单即可访问报表)，查找失败时直接写入错误响应
+func findAccessibleReport(c *gin.Context) (*models.FormReport, *models.FormSchema, bool) {
+	var report models.FormReport
+	if err := config.DB.Where("id = ?", c.Param("id")).Preload("User").First(&report).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "报表不存在")
+			return nil, nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	schema, ok := findAccessibleSchema(c, report.SchemaID, models.FormRoleViewer)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return &report, schema, true
+}
+
+// canManageReport 报表创建者和表单管理者可以修改、删除报表
+func canManageReport(c *gin.Context, report *models.FormReport, schema *models.FormSchema) bool {
+	if report.UserID == schema.Permission.UserID || hasFormRole(schema.Permission, models.FormRoleManager) {
+		return true
+	}
+	utils.ForbiddenResponse(c, "只能修改自己创建的报表")
+	return false
+}
+
+// compileReportDefinition 校验报表定义，返回序列化后的定义
+func compileReportDefinition(c *gin.Context, schema *models.FormSchema, definition AggregateQuery) (models.JSON, bool) {
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return nil, false
+	}
+	if _, err := compileAggregate(schema, visibleFields(schema.Permission, fields), definition); err != nil {
+		utils.ErrorResponse(c, 400, "报表定义错误: "+err.Error())
+		return nil, false
+	}
+
+	definitionJSON, err := json.Marshal(definition)
+	if err != nil {
+		utils.ServerErrorResponse(c, "报表定义序列化失败")
+		return nil, false
+	}
+	return models.JSON(definitionJSON), true
+}
+
+// GetFormReports 获取表单下保存的报表
+func GetFormReports(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
+		return
+	}
+
+	var reports []models.FormReport
+	if err := config.DB.Where("schema_id = ?", schema.ID).
+		Preload("User").
+		Order("created_at DESC").
+		Find(&reports).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, reports)
+}
+
+// CreateFormReport 保存报表定义
+func CreateFormReport(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req formReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
+		return
+	}
+
+	definition, ok := compileReportDefinition(c, schema, req.Definition)
+	if !ok {
+		return
+	}
+
+	report := models.FormReport{
+		SchemaID:    schema.ID,
+		Name:        req.Name,
+		Description: req.Description,
+		Definition:  definition,
+		UserID:      userID.(uint),
+	}
+	if err := config.DB.Create(&report).Error; err != nil {
+		utils.ServerErrorResponse(c, "保存报表失败")
+		return
+	}
+
+	config.DB.Preload("User").First(&report, report.ID)
+
+	utils.SuccessResponse(c, report)
+}
+
+// GetFormReport 获取报表定义
+func GetFormReport(c *gin.Context) {
+	report, _, ok := findAccessibleReport(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, report)
+}
+
+// UpdateFormReport 修改报表定义
+func UpdateFormReport(c *gin.Context) {
+	var req formReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	report, schema, ok := findAccessibleReport(c)
+	if !ok || !canManageReport(c, report, schema) {
+		return
+	}
+
+	definition, ok := compileReportDefinition(c, schema, req.Definition)
+	if !ok {
+		return
+	}
+
+	report.Name = req.Name
+	report.Description = req.Description
+	report.Definition = definition
+	if err := config.DB.Omit("User").Save(report).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	utils.SuccessResponse(c, report)
+}
+
+// DeleteFormReport 删除报表
+func DeleteFormReport(c *gin.Context) {
+	report, schema, ok := findAccessibleReport(c)
+	if !ok || !canManageReport(c, report, schema) {
+		return
+	}
+
+	if err := config.DB.Delete(report).Error; err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "删除成功"})
+}
+
+// RunFormReport 执行保存的报表，可通过filters参数追加筛选条件
+func RunFormReport(c *gin.Context) {
+	report, schema, ok := findAccessibleReport(c)
+	if !ok {
+		return
+	}
+
+	var definition AggregateQuery
+	if err := json.Unmarshal(report.Definition, &definition); err != nil {
+		utils.ServerErrorResponse(c, "报表定义解析失败")
+		return
+	}
+
+	filters, err := parseRecordFilters(c.Query("filters"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "筛选条件格式错误: "+err.Error())
+		return
+	}
+	definition.Filters = append(definition.Filters, filters...)
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+
+	// 表单结构修改后报表可能引用已删除的字段；报表按执行者的权限统计
+	fields = visibleFields(schema.Permission, fields)
+	plan, err := compileAggregate(schema, fields, definition)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "报表定义错误: "+err.Error())
+		return
+	}
+
+	result, err := runAggregate(schema, fields, plan)
+	if err != nil {
+		utils.ErrorResponse(c, 400, "统计失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"report": report,
+		"result": result,
+	})
+}
@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// saveRecordRevision 为记录生成一条修订，版本号在该记录已有修订基础上递增
+// 删除记录时newData为nil，修订中保存删除前的数据
+func saveRecordRevision(tx *gorm.DB, schema *models.FormSchema, recordID uint, action string, oldData, newData map[string]interface{}, userID uint) (*models.FormRecordRevision, error) {
+	fields, _ := parseSchemaFields(schema.Schema)
+
+	var version int
+	if err := tx.Model(&models.FormRecordRevision{}).
+		Where("record_id = ?", recordID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version).Error; err != nil {
+		return nil, err
+	}
+
+	snapshot := newData
+	if action == models.RevisionActionDelete {
+		snapshot = oldData
+	}
+	dataJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.FieldChange
+	if action != models.RevisionActionDelete {
+		changes = diffRecordData(fields, oldData, newData)
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &models.FormRecordRevision{
+		RecordID: recordID,
+		Version:  version + 1,
+		SchemaID: schema.ID,
+		Action:   action,
+		Data:     models.JSON(dataJSON),
+		Changes:  models.JSON(changesJSON),
+		UserID:   userID,
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// diffRecordData 比较两份记录数据，返回有变化的字段
+// 先按表单结构中的字段顺序，再按键名顺序列出结构中已不存在的字段
+func diffRecordData(fields []models.FormField, oldData, newData map[string]interface{}) []models.FieldChange {
+	changes := []models.FieldChange{}
+	seen := make(map[string]bool)
+
+	compare := func(key, label string) {
+		seen[key] = true
+		oldValue, newValue := normalizeDiffValue(oldData[key]), normalizeDiffValue(newData[key])
+		if reflect.DeepEqual(oldValue, newValue) {
+			return
+		}
+		changes = append(changes, models.FieldChange{
+			Field:    key,
+			Label:    label,
+			OldValue: oldValue,
+			NewValue: newValue,
+		})
+	}
+
+	for _, field := range fields {
+		compare(getFieldKey(field), field.Label)
+	}
+
+	var extra []string
+	for _, data := range []map[string]interface{}{oldData, newData} {
+		for key := range data {
+			if !seen[key] {
+				seen[key] = true
+				extra = append(extra, key)
+			}
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		compare(key, "")
+	}
+
+	return changes
+}
+
+// normalizeDiffValue 将值转换为JSON反序列化后的形式，避免数值类型不同导致误判
+func normalizeDiffValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	json.Unmarshal(raw, &normalized)
+	if text, ok := normalized.(string); ok && text == "" {
+		return nil
+	}
+	return normalized
+}
+
+// findRevisionRecord 查找当前用户可查看修订历史的记录(包括回收站中的记录)，查找失败时直接写入错误响应
+func findRevisionRecord(c *gin.Context) (*models.FormRecord, bool) {
+	return findAccessibleRecord(c, config.DB.Where("id = ?", c.Param("id")))
+}
+
+// filterRevisions 移除修订中当前用户不可见字段的数据和差异
+func filterRevisions(perm *models.FormPermission, revisions []models.FormRecordRevision) {
+	if !hasHiddenFields(perm) {
+		return
+	}
+	for i := range revisions {
+		var data map[string]interface{}
+		if json.Unmarshal(revisions[i].Data, &data) == nil && data != nil {
+			filterRecordData(perm, data)
+			if filtered, err := json.Marshal(data); err == nil {
+				revisions[i].Data = models.JSON(filtered)
+			}
+		}
+
+		var changes []models.FieldChange
+		if json.Unmarshal(revisions[i].Changes, &changes) == nil {
+			if filtered, err := json.Marshal(visibleChanges(perm, changes)); err == nil {
+				revisions[i].Changes = models.JSON(filtered)
+			}
+		}
+	}
+}
+
+// visibleChanges 过滤掉不可见字段的差异
+func visibleChanges(perm *models.FormPermission, changes []models.FieldChange) []models.FieldChange {
+	if !hasHiddenFields(perm) {
+		return changes
+	}
+	visible := make([]models.FieldChange, 0, len(changes))
+	for _, change := range changes {
+		if fieldAccess(perm, change.Field) != models.FieldAccessHidden {
+			visible = append(visible, change)
+		}
+	}
+	return visible
+}
+
+// findRecordRevision 查找记录的指定版本
+func findRecordRevision(recordID uint, version int) (*models.FormRecordRevision, error) {
+	var revision models.FormRecordRevision
+	if err := config.DB.Where("record_id = ? AND version = ?", recordID, version).
+		Preload("User").First(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetFormRecordRevisions 获取记录的修订历史
+func GetFormRecordRevisions(c *gin.Context) {
+	record, ok := findRevisionRecord(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var revisions []models.FormRecordRevision
+	var total int64
+
+	query := config.DB.Model(&models.FormRecordRevision{}).Where("record_id = ?", record.ID)
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	if err := query.Preload("User").
+		Order("version DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&revisions).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+	filterRevisions(record.Schema.Permission, revisions)
+
+	utils.SuccessResponse(c, gin.H{
+		"list":       revisions,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetFormRecordRevision 获取记录的指定版本
+func GetFormRecordRevision(c *gin.Context) {
+	record, ok := findRevisionRecord(c)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "版本号格式错误")
+		return
+	}
+
+	revision, err := findRecordRevision(record.ID, version)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "版本不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	revisions := []models.FormRecordRevision{*revision}
+	filterRevisions(record.Schema.Permission, revisions)
+
+	utils.SuccessResponse(c, revisions[0])
+}
+
+// CompareFormRecordRevisions 比较记录的两个版本，to为空时与最新版本比较
+func CompareFormRecordRevisions(c *gin.Context) {
+	record, ok := findRevisionRecord(c)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "起始版本号格式错误")
+		return
+	}
+
+	var to int
+	if c.Query("to") != "" {
+		if to, err = strconv.Atoi(c.Query("to")); err != nil {
+			utils.ErrorResponse(c, 400, "目标版本号格式错误")
+			return
+		}
+	} else {
+		config.DB.Model(&models.FormRecordRevision{}).
+			Where("record_id = ?", record.ID).
+			Select("COALESCE(MAX(version), 0)").
+			Scan(&to)
+	}
+
+	fromRevision, err := findRecordRevision(record.ID, from)
+	if err != nil {
+		utils.NotFoundResponse(c, "起始版本不存在")
+		return
+	}
+	toRevision, err := findRecordRevision(record.ID, to)
+	if err != nil {
+		utils.NotFoundResponse(c, "目标版本不存在")
+		return
+	}
+
+	var fromData, toData map[string]interface{}
+	json.Unmarshal(fromRevision.Data, &fromData)
+	json.Unmarshal(toRevision.Data, &toData)
+
+	fields, _ := parseSchemaFields(record.Schema.Schema)
+	revisions := []models.FormRecordRevision{*fromRevision, *toRevision}
+	filterRevisions(record.Schema.Permission, revisions)
+
+	utils.SuccessResponse(c, gin.H{
+		"from":    revisions[0],
+		"to":      revisions[1],
+		"changes": diffRecordData(visibleFields(record.Schema.Permission, fields), fromData, toData),
+	})
+}
+
+// RestoreFormRecordRevision 将记录恢复到指定版本，恢复操作本身生成新的修订
+func RestoreFormRecordRevision(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		utils.ErrorResponse(c, 400, "版本号格式错误")
+		return
+	}
+
+	// 查找记录，须有修改该记录的权限
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false))
+	if !ok {
+		return
+	}
+	perm := record.Schema.Permission
+	if !canModifyRecord(perm, record) {
+		utils.ForbiddenResponse(c, "没有权限修改该记录")
+		return
+	}
+
+	revision, err := findRecordRevision(record.ID, version)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "版本不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(revision.Data, &data); err != nil || data == nil {
+		utils.ErrorResponse(c, 400, "该版本没有可恢复的数据")
+		return
+	}
+
+	if err := hydrateRecord(config.DB, record); err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+	var oldData map[string]interface{}
+	json.Unmarshal(record.Data, &oldData)
+
+	// 不可写的字段保持当前值，只恢复可写字段
+	fields, err := parseSchemaFields(record.Schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	keepProtectedFields(perm, fields, data, oldData)
+
+	// 历史数据按当前表单结构重新校验，引用的资源、关联记录须仍然存在
+	if err := prepareRecordData(&record.Schema, data, userID.(uint), hasPermission(c, models.PermFileReadAny), record.ID); err != nil {
+		utils.ErrorResponse(c, 400, "数据验证失败: "+err.Error())
+		return
+	}
+
+	dataJSON, err := encodeRecordData(&record.Schema, data)
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据序列化失败")
+		return
+	}
+	record.Data = dataJSON
+
+	var removedFiles []string
+	var restored *models.FormRecordRevision
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Schema", "User").Save(record).Error; err != nil {
+			return err
+		}
+		if removedFiles, err = syncRecordReferences(tx, &record.Schema, record.ID, data); err != nil {
+			return err
+		}
+
+		restored, err = saveRecordRevision(tx, &record.Schema, record.ID, models.RevisionActionRevert, oldData, data, userID.(uint))
+		if err != nil {
+			return err
+		}
+		return tx.Model(restored).Update("source_version", version).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "恢复失败")
+		return
+	}
+	removeAssetFiles(removedFiles)
+	emitRecordEvent(models.WebhookEventRecordUpdated, userID.(uint), gin.H{"changes": restored.Changes, "source_version": version}, record.ID)
+
+	config.DB.Preload("Schema").Preload("User").First(record, record.ID)
+	record.Schema.Permission = perm
+
+	responses := []models.FormRecordResponse{buildRecordResponse(*record)}
+	filterRecordResponses(perm, responses)
+
+	utils.SuccessResponse(c, responses[0])
+}
@@ -6,6 +6,7 @@ import (
 	"material-platform/models"
 	"material-platform/utils"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -13,12 +14,14 @@ import (
 
 // CreateFormSchema 创建表单结构
 func CreateFormSchema(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
 	var req struct {
-		Name        string             `json:"name" binding:"required"`
-		Description string             `json:"description"`
-		Fields      []models.FormField `json:"fields" binding:"required"`
+		Name        string               `json:"name" binding:"required"`
+		Description string               `json:"description"`
+		Fields      []models.FormField   `json:"fields" binding:"required"`
+		Sections    []models.FormSection `json:"sections"`     // 分节(多步骤表单)
+		Workflow    *models.FormWorkflow `json:"workflow"`     // 记录状态机
+		StorageMode string               `json:"storage_mode"` // json(默认) 或 table
+		GroupID     *uint                `json:"group_id"`     // 创建为用户组的表单
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -32,40 +35,108 @@ func CreateFormSchema(c *gin.Context) {
 	// 	return
 	// }
 
-	// 构建Schema数据
-	schemaData := models.FormSchemaData{
-		Fields: req.Fields,
+	formSchema, ok := createFormSchema(c, req.Name, req.Description, models.FormSchemaData{
+		Fields:   req.Fields,
+		Sections: req.Sections,
+		Workflow: req.Workflow,
+	}, req.StorageMode, req.GroupID)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, formSchema)
+}
+
+// createFormSchema 校验表单定义并创建表单结构(物理表存储的同时创建物理表)，失败时直接写入错误响应
+// 模板创建、克隆、JSON Schema导入均通过此函数创建表单；groupID 不为空时表单归属于该用户组，创建者必须是组成员
+func createFormSchema(c *gin.Context, name, description string, schemaData models.FormSchemaData, storageMode string, groupID *uint) (*models.FormSchema, bool) {
+	userID, _ := c.Get("user_id")
+
+	if groupID != nil && !checkGroupMember(c, *groupID) {
+		return nil, false
+	}
+
+	if storageMode == "" {
+		storageMode = models.StorageModeJSON
+	}
+	if storageMode != models.StorageModeJSON && storageMode != models.StorageModeTable {
+		utils.ErrorResponse(c, 400, "不支持的存储方式")
+		return nil, false
+	}
+	if storageMode == models.StorageModeTable {
+		if err := validatePhysicalColumns(schemaData.Fields); err != nil {
+			utils.ErrorResponse(c, 400, err.Error())
+			return nil, false
+		}
+	}
+
+	// 校验关联字段、公式字段、条件逻辑、工作流定义
+	if err := normalizeRelationFields(schemaData.Fields, 0, userID.(uint), hasPermission(c, models.PermFormManageAny)); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
+	}
+	if err := normalizeFormulaFields(schemaData.Fields, 0); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
+	}
+	if err := normalizeSchemaLayout(schemaData.Fields, schemaData.Sections); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
+	}
+	if err := normalizeWorkflow(schemaData.Workflow); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
 	}
 
 	schemaJSON, err := json.Marshal(schemaData)
 	if err != nil {
 		utils.ServerErrorResponse(c, "Schema序列化失败")
-		return
+		return nil, false
 	}
 
-	// 创建表单结构
 	formSchema := models.FormSchema{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:        name,
+		Description: description,
 		Schema:      models.JSON(schemaJSON),
+		StorageMode: storageMode,
 		UserID:      userID.(uint),
+		GroupID:     groupID,
 	}
 
-	if err := config.DB.Create(&formSchema).Error; err != nil {
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&formSchema).Error; err != nil {
+			return err
+		}
+		// 关联自身的字段创建后才能确定表单ID
+		if resolveSelfRelations(schemaData.Fields, formSchema.ID) {
+			schemaJSON, err := json.Marshal(schemaData)
+			if err != nil {
+				return err
+			}
+			formSchema.Schema = models.JSON(schemaJSON)
+			if err := tx.Model(&formSchema).UpdateColumn("schema", formSchema.Schema).Error; err != nil {
+				return err
+			}
+		}
+		if formSchema.StorageMode == models.StorageModeTable {
+			return syncPhysicalTable(tx, formSchema.ID, schemaData.Fields)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "创建表单结构失败")
-		return
+		return nil, false
 	}
 
 	// 预加载用户信息
 	config.DB.Preload("User").First(&formSchema, formSchema.ID)
 
-	utils.SuccessResponse(c, formSchema)
+	return &formSchema, true
 }
 
 // GetFormSchemas 获取表单结构列表
 func GetFormSchemas(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -83,9 +154,22 @@ func GetFormSchemas(c *gin.Context) {
 
 	query := config.DB.Model(&models.FormSchema{})
 
-	// 非管理员只能看到自己的表单
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 没有管理全部表单的权限时只能看到自己的表单、所在用户组的表单和共享给自己的表单
+	// scope可选 owned(自己的个人表单)、shared(共享给自己的及所在用户组的)、group(指定用户组的，需同时传group_id)
+	switch c.Query("scope") {
+	case "owned":
+		query = query.Where("user_id = ? AND group_id IS NULL", userID)
+	case "group":
+		query = query.Where("group_id = ?", c.Query("group_id"))
+		if !hasPermission(c, models.PermFormManageAny) {
+			query = query.Where("group_id IN (?)", groupIDsQuery(userID.(uint)))
+		}
+	case "shared":
+		query = query.Where("user_id <> ? AND id IN (?)", userID, sharedSchemaIDsQuery(userID.(uint)))
+	default:
+		if !hasPermission(c, models.PermFormManageAny) {
+			query = query.Where("user_id = ? OR id IN (?)", userID, sharedSchemaIDsQuery(userID.(uint)))
+		}
 	}
 
 	// 关键词搜索
@@ -98,7 +182,7 @@ func GetFormSchemas(c *gin.Context) {
 
 	// 分页查询
 	offset := (page - 1) * pageSize
-	if err := query.Preload("User").
+	if err := query.Preload("User").Preload("Group").
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(pageSize).
@@ -107,6 +191,16 @@ func GetFormSchemas(c *gin.Context) {
 		return
 	}
 
+	for i := range schemas {
+		perm, err := loadFormPermission(&schemas[i], userID.(uint), hasPermission(c, models.PermFormManageAny))
+		if err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+		schemas[i].Permission = perm
+		schemas[i] = visibleSchema(schemas[i])
+	}
+
 	utils.SuccessResponse(c, gin.H{
 		"list":       schemas,
 		"total":      total,
@@ -116,42 +210,26 @@ func GetFormSchemas(c *gin.Context) {
 	})
 }
 
-// GetFormSchema 获取单个表单结构
+// GetFormSchema 获取单个表单结构，不包含当前用户不可见的字段
 func GetFormSchema(c *gin.Context) {
-	schemaID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var schema models.FormSchema
-	query := config.DB.Where("id = ?", schemaID)
-
-	// 非管理员只能访问自己的表单
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
-
-	if err := query.Preload("User").First(&schema).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "表单结构不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "查询失败")
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleViewer)
+	if !ok {
 		return
 	}
 
-	utils.SuccessResponse(c, schema)
+	config.DB.Model(schema).Association("User").Find(&schema.User)
+
+	utils.SuccessResponse(c, visibleSchema(*schema))
 }
 
 // UpdateFormSchema 更新表单结构
 func UpdateFormSchema(c *gin.Context) {
-	schemaID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
 	var req struct {
-		Name        string             `json:"name" binding:"required"`
-		Description string             `json:"description"`
-		Fields      []models.FormField `json:"fields" binding:"required"`
+		Name        string               `json:"name" binding:"required"`
+		Description string               `json:"description"`
+		Fields      []models.FormField   `json:"fields" binding:"required"`
+		Sections    []models.FormSection `json:"sections"` // 分节(多步骤表单)
+		Workflow    *models.FormWorkflow `json:"workflow"` // 记录状态机
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -159,89 +237,151 @@ func UpdateFormSchema(c *gin.Context) {
 		return
 	}
 
-	// 查找表单结构
-	var schema models.FormSchema
-	query := config.DB.Where("id = ?", schemaID)
-
-	// 非管理员只能修改自己的表单
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
+	// 表单管理者可以修改表单定义
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
 	}
 
-	if err := query.First(&schema).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "表单结构不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "查询失败")
+	if !updateFormSchema(c, schema, req.Name, req.Description, models.FormSchemaData{
+		Fields:   req.Fields,
+		Sections: req.Sections,
+		Workflow: req.Workflow,
+	}) {
 		return
 	}
 
-	// 构建新的Schema数据
-	schemaData := models.FormSchemaData{
-		Fields: req.Fields,
+	utils.SuccessResponse(c, schema)
+}
+
+// updateFormSchema 校验并替换表单定义(同步物理表结构、重新计算公式)，失败时直接写入错误响应
+func updateFormSchema(c *gin.Context, schema *models.FormSchema, name, description string, schemaData models.FormSchemaData) bool {
+	userID, _ := c.Get("user_id")
+
+	// 校验关联字段、公式字段、条件逻辑、工作流定义
+	if err := normalizeRelationFields(schemaData.Fields, schema.ID, userID.(uint), hasPermission(c, models.PermFormManageAny)); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return false
+	}
+	if err := normalizeFormulaFields(schemaData.Fields, schema.ID); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return false
+	}
+	if err := normalizeSchemaLayout(schemaData.Fields, schemaData.Sections); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return false
+	}
+	if err := normalizeWorkflow(schemaData.Workflow); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return false
+	}
+
+	if schema.StorageMode == models.StorageModeTable {
+		if err := validatePhysicalColumns(schemaData.Fields); err != nil {
+			utils.ErrorResponse(c, 400, err.Error())
+			return false
+		}
 	}
 
 	schemaJSON, err := json.Marshal(schemaData)
 	if err != nil {
 		utils.ServerErrorResponse(c, "Schema序列化失败")
-		return
+		return false
 	}
 
 	// 更新
-	schema.Name = req.Name
-	schema.Description = req.Description
+	oldFields, _ := parseSchemaFields(schema.Schema)
+	schema.Name = name
+	schema.Description = description
 	schema.Schema = models.JSON(schemaJSON)
 
-	if err := config.DB.Save(&schema).Error; err != nil {
+	// 物理表存储的表单同步修改物理表结构
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User").Save(schema).Error; err != nil {
+			return err
+		}
+		if err := resetRecordStates(tx, schema.ID, schemaData.Workflow); err != nil {
+			return err
+		}
+		if schema.StorageMode == models.StorageModeTable {
+			return syncPhysicalTable(tx, schema.ID, schemaData.Fields)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "更新失败")
-		return
+		return false
+	}
+
+	// 公式变化时重新计算已有记录
+	if formulaSignature(oldFields) != formulaSignature(schemaData.Fields) {
+		if _, err := recomputeSchemaFormulas(schema); err != nil {
+			utils.ServerErrorResponse(c, "公式重新计算失败")
+			return false
+		}
 	}
 
 	// 预加载用户信息
-	config.DB.Preload("User").First(&schema, schema.ID)
+	config.DB.Preload("User").First(schema, schema.ID)
 
-	utils.SuccessResponse(c, schema)
+	return true
 }
 
 // DeleteFormSchema 删除表单结构
 func DeleteFormSchema(c *gin.Context) {
-	schemaID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// 查找表单结构
-	var schema models.FormSchema
-	query := config.DB.Where("id = ?", schemaID)
-
-	// 非管理员只能删除自己的表单
-	if role != "admin" {
-		query = query.Where("user_id = ?", userID)
-	}
-
-	if err := query.First(&schema).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.NotFoundResponse(c, "表单结构不存在")
-			return
-		}
-		utils.ServerErrorResponse(c, "查询失败")
+	// 只有创建者和有管理全部表单权限的用户可以删除表单
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleOwner)
+	if !ok {
 		return
 	}
 
 	// 检查是否有关联的记录
 	var recordCount int64
-	config.DB.Model(&models.FormRecord{}).Where("schema_id = ?", schemaID).Count(&recordCount)
+	config.DB.Model(&models.FormRecord{}).Where("schema_id = ? AND is_deleted = ?", schema.ID, false).Count(&recordCount)
 
 	if recordCount > 0 {
 		utils.ErrorResponse(c, 400, "无法删除：该表单结构下还有数据记录")
 		return
 	}
 
-	// 删除表单结构
-	if err := config.DB.Delete(&schema).Error; err != nil {
+	// 检查是否被其他表单的关联字段引用
+	if names := findRelationReferences(schema.ID); len(names) > 0 {
+		utils.ErrorResponse(c, 400, "无法删除：该表单结构被表单 '"+strings.Join(names, "', '")+"' 的关联字段引用")
+		return
+	}
+
+	// 删除表单结构及其物理表，回收站中的记录一并彻底删除，公开链接、报表、共享设置随之删除
+	var removedFiles []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if removedFiles, err = purgeSchemaRecords(tx, schema.ID); err != nil {
+			return err
+		}
+		if err := deleteFormPublication(tx, schema.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("schema_id = ?", schema.ID).Delete(&models.FormReport{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("schema_id = ?", schema.ID).Delete(&models.FormShare{}).Error; err != nil {
+			return err
+		}
+		if err := deleteWebhooks(tx, "schema_id", schema.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(schema).Error; err != nil {
+			return err
+		}
+		if schema.StorageMode == models.StorageModeTable {
+			return dropPhysicalTable(tx, schema.ID)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "删除失败")
 		return
 	}
+	removeAssetFiles(removedFiles)
 
 	utils.SuccessResponse(c, gin.H{"message": "删除成功"})
 }
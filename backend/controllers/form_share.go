@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// formShareRequest 共享设置的请求参数，共享对象创建后不能修改
+type formShareRequest struct {
+	UserID           *uint             `json:"user_id"`
+	Username         string            `json:"username"` // 也可按用户名或邮箱指定用户
+	GroupID          *uint             `json:"group_id"`
+	Role             string            `json:"role" binding:"required"`
+	RowScope         string            `json:"row_scope"` // 默认提交者仅可见自己的记录，其他角色可见全部记录
+	FieldPermissions map[string]string `json:"field_permissions"`
+}
+
+// normalizeFormShare 校验共享的角色、记录范围和字段权限，返回序列化后的字段权限
+func normalizeFormShare(schema *models.FormSchema, req *formShareRequest) (models.JSON, error) {
+	switch req.Role {
+	case models.FormRoleViewer, models.FormRoleSubmitter, models.FormRoleEditor, models.FormRoleManager:
+	default:
+		return nil, fmt.Errorf("无效的角色")
+	}
+
+	switch req.RowScope {
+	case "":
+		req.RowScope = models.RowScopeAll
+		if req.Role == models.FormRoleSubmitter {
+			req.RowScope = models.RowScopeOwn
+		}
+	case models.RowScopeAll, models.RowScopeOwn:
+	default:
+		return nil, fmt.Errorf("无效的记录范围")
+	}
+
+	if len(req.FieldPermissions) == 0 {
+		return nil, nil
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	for key, access := range req.FieldPermissions {
+		if _, ok := findFieldByKey(fields, key); !ok {
+			return nil, fmt.Errorf("字段 '%s' 不存在", key)
+		}
+		if _, ok := fieldAccessLevels[access]; !ok {
+			return nil, fmt.Errorf("字段 '%s' 的权限无效", key)
+		}
+	}
+
+	data, err := json.Marshal(req.FieldPermissions)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSON(data), nil
+}
+
+// findFormShare 查找共享设置，要求当前用户是所属表单的管理者，查找失败时直接写入错误响应
+func findFormShare(c *gin.Context) (*models.FormShare, *models.FormSchema, bool) {
+	var share models.FormShare
+	if err := config.DB.Where("id = ?", c.Param("id")).First(&share).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "共享设置不存在")
+			return nil, nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	schema, ok := findAccessibleSchema(c, share.SchemaID, models.FormRoleManager)
+	if !ok {
+		return nil, nil, false
+	}
+	return &share, schema, true
+}
+
+// GetFormShares 获取表单的共享设置
+func GetFormShares(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	var shares []models.FormShare
+	if err := config.DB.Where("schema_id = ?", schema.ID).
+		Preload("User").Preload("Group").
+		Order("created_at ASC").
+		Find(&shares).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, shares)
+}
+
+// CreateFormShare 将表单共享给用户或用户组
+func CreateFormShare(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req formShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	share := models.FormShare{SchemaID: schema.ID, CreatedBy: userID.(uint)}
+	query := config.DB.Model(&models.FormShare{}).Where("schema_id = ?", schema.ID)
+
+	switch {
+	case req.GroupID != nil && (req.UserID != nil || req.Username != ""):
+		utils.ErrorResponse(c, 400, "只能指定用户或用户组中的一个")
+		return
+	case req.GroupID != nil:
+		var group models.UserGroup
+		if err := config.DB.First(&group, *req.GroupID).Error; err != nil {
+			utils.ErrorResponse(c, 400, "用户组不存在")
+			return
+		}
+		share.GroupID = &group.ID
+		query = query.Where("group_id = ?", group.ID)
+	case req.UserID != nil || req.Username != "":
+		var user models.User
+		userQuery := config.DB.Model(&models.User{})
+		if req.UserID != nil {
+			userQuery = userQuery.Where("id = ?", *req.UserID)
+		} else {
+			userQuery = userQuery.Where("username = ? OR email = ?", req.Username, req.Username)
+		}
+		if err := userQuery.First(&user).Error; err != nil {
+			utils.ErrorResponse(c, 400, "用户不存在")
+			return
+		}
+		if user.ID == schema.UserID {
+			utils.ErrorResponse(c, 400, "不能共享给表单创建者")
+			return
+		}
+		share.UserID = &user.ID
+		query = query.Where("user_id = ?", user.ID)
+	default:
+		utils.ErrorResponse(c, 400, "请指定共享的用户或用户组")
+		return
+	}
+
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "已共享给该对象，请修改现有的共享设置")
+		return
+	}
+
+	fieldPermissions, err := normalizeFormShare(schema, &req)
+	if err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+	share.Role = req.Role
+	share.RowScope = req.RowScope
+	share.FieldPermissions = fieldPermissions
+
+	if err := config.DB.Create(&share).Error; err != nil {
+		utils.ServerErrorResponse(c, "共享失败")
+		return
+	}
+
+	config.DB.Preload("User").Preload("Group").First(&share, share.ID)
+
+	utils.SuccessResponse(c, share)
+}
+
+// UpdateFormShare 修改共享的角色、记录范围和字段权限
+func UpdateFormShare(c *gin.Context) {
+	var req formShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	share, schema, ok := findFormShare(c)
+	if !ok {
+		return
+	}
+
+	fieldPermissions, err := normalizeFormShare(schema, &req)
+	if err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := config.DB.Model(share).Updates(map[string]interface{}{
+		"role":              req.Role,
+		"row_scope":         req.RowScope,
+		"field_permissions": fieldPermissions,
+	}).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	config.DB.Preload("User").Preload("Group").First(share, share.ID)
+
+	utils.SuccessResponse(c, share)
+}
+
+// DeleteFormShare 取消共享
+func DeleteFormShare(c *gin.Context) {
+	share, _, ok := findFormShare(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(share).Error; err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已取消共享"})
+}
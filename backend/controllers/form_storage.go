@@ -0,0 +1,589 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 物理表列类型
+const (
+	columnInteger = "INTEGER"
+	columnReal    = "REAL"
+	columnText    = "TEXT"
+	columnBoolean = "BOOLEAN"
+	columnJSON    = "JSON"
+	columnAny     = "BLOB" // 不做类型转换，按写入的值原样保存(公式字段)
+)
+
+// physicalKeyColumn 物理表中关联form_records的主键列
+const physicalKeyColumn = "record_id"
+
+// physicalColumn 物理表中字段对应的列
+type physicalColumn struct {
+	name    string
+	sqlType string
+}
+
+// recordStorage 表单记录数据的存储位置
+type recordStorage struct {
+	table   string // 物理表名，为空表示存储在form_records.data中
+	columns map[string]physicalColumn
+}
+
+// newRecordStorage 根据表单结构的存储方式创建记录存储
+func newRecordStorage(schema *models.FormSchema, fields []models.FormField) recordStorage {
+	if schema.StorageMode != models.StorageModeTable {
+		return recordStorage{}
+	}
+	storage := recordStorage{table: physicalTableName(schema.ID), columns: make(map[string]physicalColumn)}
+	for _, column := range physicalColumns(fields) {
+		storage.columns[column.name] = column
+	}
+	return storage
+}
+
+// fieldExpr 生成读取记录中某个字段的SQL表达式
+// key必须来自表单结构定义，不能直接使用用户输入
+func (s recordStorage) fieldExpr(key string) string {
+	if s.table == "" {
+		return recordFieldExpr(key)
+	}
+	return fmt.Sprintf("(SELECT %s FROM %s WHERE %s = form_records.id)",
+		quoteIdent(key), quoteIdent(s.table), physicalKeyColumn)
+}
+
+// jsonEachExpr 生成展开数组字段的json_each表达式
+func (s recordStorage) jsonEachExpr(key string) string {
+	if s.table == "" {
+		return "json_each(form_records.data, '" + strings.ReplaceAll(jsonFieldPath(key), "'", "''") + "')"
+	}
+	return "json_each(" + s.fieldExpr(key) + ")"
+}
+
+// keywordCondition 生成关键词搜索条件，参数为 LIKE 模式
+func (s recordStorage) keywordCondition() (string, int) {
+	if s.table == "" {
+		return "form_records.data LIKE ?", 1
+	}
+	if len(s.columns) == 0 {
+		return "1 = 0", 0
+	}
+
+	conditions := make([]string, 0, len(s.columns))
+	for name := range s.columns {
+		conditions = append(conditions, "CAST("+quoteIdent(name)+" AS TEXT) LIKE ?")
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s = form_records.id AND (%s))",
+		quoteIdent(s.table), physicalKeyColumn, strings.Join(conditions, " OR ")), len(conditions)
+}
+
+// fieldsKeywordCondition 生成只在指定字段中搜索关键词的条件
+func (s recordStorage) fieldsKeywordCondition(fields []models.FormField) (string, int) {
+	if len(fields) == 0 {
+		return "1 = 0", 0
+	}
+	conditions := make([]string, 0, len(fields))
+	for _, field := range fields {
+		conditions = append(conditions, "CAST("+s.fieldExpr(getFieldKey(field))+" AS TEXT) LIKE ?")
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", len(conditions)
+}
+
+// physicalTableName 物理表名
+func physicalTableName(schemaID uint) string {
+	return fmt.Sprintf("form_data_%d", schemaID)
+}
+
+// quoteIdent 转义SQL标识符
+func quoteIdent(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
+
+// isMultiValueField 判断字段的值是否为数组(多选、多文件、多条关联记录)
+func isMultiValueField(field models.FormField) bool {
+	return field.Type == "multi_enum" ||
+		isAssetField(field) && field.Multiple ||
+		isRelationField(field) && isMultipleRelation(field)
+}
+
+// physicalColumnType 根据字段类型和DbType确定物理表列类型
+func physicalColumnType(field models.FormField) string {
+	// 多值字段、重复分组始终以JSON数组保存
+	if isMultiValueField(field) || isGroupField(field) {
+		return columnJSON
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(field.DbType)) {
+	case "INTEGER", "INT", "BIGINT":
+		return columnInteger
+	case "FLOAT", "REAL", "DOUBLE", "DECIMAL", "NUMERIC":
+		return columnReal
+	case "VARCHAR", "TEXT", "CHAR", "STRING":
+		return columnText
+	case "BOOLEAN", "BOOL":
+		return columnBoolean
+	case "JSON":
+		return columnJSON
+	case "DATETIME", "DATE", "TIMESTAMP":
+		// 时间按字段格式的文本保存，避免驱动自动转换为时间类型
+		return columnText
+	}
+
+	switch field.Type {
+	case "integer", "file", "image", "relation":
+		return columnInteger
+	case "float":
+		return columnReal
+	case "boolean":
+		return columnBoolean
+	case "formula":
+		return columnAny
+	}
+	return columnText
+}
+
+// physicalColumns 生成字段对应的物理表列
+func physicalColumns(fields []models.FormField) []physicalColumn {
+	columns := make([]physicalColumn, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, physicalColumn{name: getFieldKey(field), sqlType: physicalColumnType(field)})
+	}
+	return columns
+}
+
+// validatePhysicalColumns 检查字段名能否作为物理表列名
+func validatePhysicalColumns(fields []models.FormField) error {
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		name := strings.ToLower(getFieldKey(field))
+		if name == "" {
+			return fmt.Errorf("字段 '%s' 缺少字段名", field.Label)
+		}
+		if name == physicalKeyColumn {
+			return fmt.Errorf("字段名 '%s' 为物理表保留列名", physicalKeyColumn)
+		}
+		if seen[name] {
+			return fmt.Errorf("字段名 '%s' 重复(物理表列名不区分大小写)", getFieldKey(field))
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// syncPhysicalTable 创建或修改表单的物理表，使其列与字段定义一致
+// 仅新增列时直接 ALTER TABLE，删除列或修改列类型时重建表并复制保留列的数据
+func syncPhysicalTable(db *gorm.DB, schemaID uint, fields []models.FormField) error {
+	if err := validatePhysicalColumns(fields); err != nil {
+		return err
+	}
+
+	table := physicalTableName(schemaID)
+	desired := physicalColumns(fields)
+
+	var existing []struct {
+		Name string
+		Type string
+	}
+	if err := db.Raw("SELECT name, type FROM pragma_table_info(?)", table).Scan(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return db.Exec(createPhysicalTableSQL(table, desired)).Error
+	}
+
+	existingTypes := make(map[string]string, len(existing))
+	for _, column := range existing {
+		if column.Name != physicalKeyColumn {
+			existingTypes[column.Name] = strings.ToUpper(column.Type)
+		}
+	}
+
+	rebuild := false
+	desiredNames := make(map[string]bool, len(desired))
+	for _, column := range desired {
+		desiredNames[column.name] = true
+		if sqlType, exists := existingTypes[column.name]; exists && sqlType != column.sqlType {
+			rebuild = true
+		}
+	}
+	for name := range existingTypes {
+		if !desiredNames[name] {
+			rebuild = true
+		}
+	}
+
+	if !rebuild {
+		for _, column := range desired {
+			if _, exists := existingTypes[column.name]; exists {
+				continue
+			}
+			sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", quoteIdent(table), quoteIdent(column.name), column.sqlType)
+			if err := db.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// 重建表：复制主键和仍然保留的列
+	tempTable := table + "_new"
+	copied := []string{physicalKeyColumn}
+	for _, column := range desired {
+		if _, exists := existingTypes[column.name]; exists {
+			copied = append(copied, quoteIdent(column.name))
+		}
+	}
+
+	statements := []string{
+		"DROP TABLE IF EXISTS " + quoteIdent(tempTable),
+		createPhysicalTableSQL(tempTable, desired),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+			quoteIdent(tempTable), strings.Join(copied, ", "), strings.Join(copied, ", "), quoteIdent(table)),
+		"DROP TABLE " + quoteIdent(table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(tempTable), quoteIdent(table)),
+	}
+	for _, sql := range statements {
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPhysicalTableSQL 生成创建物理表的DDL
+func createPhysicalTableSQL(table string, columns []physicalColumn) string {
+	definitions := []string{physicalKeyColumn + " INTEGER PRIMARY KEY REFERENCES form_records(id) ON DELETE CASCADE"}
+	for _, column := range columns {
+		definitions = append(definitions, quoteIdent(column.name)+" "+column.sqlType)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(table), strings.Join(definitions, ", "))
+}
+
+// dropPhysicalTable 删除表单的物理表
+func dropPhysicalTable(db *gorm.DB, schemaID uint) error {
+	return db.Exec("DROP TABLE IF EXISTS " + quoteIdent(physicalTableName(schemaID))).Error
+}
+
+// encodeRecordData 生成保存到form_records.data的内容，物理表存储的表单只保存空对象
+func encodeRecordData(schema *models.FormSchema, data map[string]interface{}) (models.JSON, error) {
+	if schema.StorageMode == models.StorageModeTable {
+		return models.JSON("{}"), nil
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return models.JSON(dataJSON), nil
+}
+
+// storeRecordData 将记录数据写入物理表，JSON存储的表单无需处理
+// 物理表只保存字段定义中存在的键
+func storeRecordData(tx *gorm.DB, schema *models.FormSchema, fields []models.FormField, recordID uint, data map[string]interface{}) error {
+	if schema.StorageMode != models.StorageModeTable {
+		return nil
+	}
+
+	columns := []string{physicalKeyColumn}
+	placeholders := []string{"?"}
+	values := []interface{}{recordID}
+	for _, column := range physicalColumns(fields) {
+		value, err := physicalValue(column, data[column.name])
+		if err != nil {
+			return err
+		}
+		columns = append(columns, quoteIdent(column.name))
+		placeholders = append(placeholders, "?")
+		values = append(values, value)
+	}
+
+	sql := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)",
+		quoteIdent(physicalTableName(schema.ID)), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	return tx.Exec(sql, values...).Error
+}
+
+// saveRecordData 保存已有记录的数据(不触发更新时间)
+func saveRecordData(tx *gorm.DB, schema *models.FormSchema, fields []models.FormField, record *models.FormRecord, data map[string]interface{}) error {
+	dataJSON, err := encodeRecordData(schema, data)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(record).UpdateColumn("data", dataJSON).Error; err != nil {
+		return err
+	}
+	return storeRecordData(tx, schema, fields, record.ID, data)
+}
+
+// deleteStoredRecordData 删除记录在物理表中的数据
+func deleteStoredRecordData(tx *gorm.DB, schemaID, recordID uint) error {
+	var schema models.FormSchema
+	if err := tx.Select("id", "storage_mode").First(&schema, schemaID).Error; err != nil {
+		return nil
+	}
+	if schema.StorageMode != models.StorageModeTable {
+		return nil
+	}
+	return tx.Exec("DELETE FROM "+quoteIdent(physicalTableName(schemaID))+" WHERE "+physicalKeyColumn+" = ?", recordID).Error
+}
+
+// physicalValue 将记录中的值转换为写入物理表的值，数组和对象以JSON文本保存
+func physicalValue(column physicalColumn, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string, bool, float64, int, int64, uint:
+		if column.sqlType != columnJSON {
+			return v, nil
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// logicalValue 将物理表中读取的值转换为记录中的值
+func logicalValue(column physicalColumn, value interface{}) interface{} {
+	if data, ok := value.([]byte); ok {
+		value = string(data)
+	}
+	if text, ok := value.(string); ok && column.sqlType == columnJSON {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			return decoded
+		}
+	}
+	if n, ok := value.(int64); ok && column.sqlType == columnBoolean {
+		return n != 0
+	}
+	return value
+}
+
+// hydrateRecordData 为物理表存储的记录加载数据，填充到记录的Data中
+func hydrateRecordData(db *gorm.DB, records []models.FormRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	schemaIDs := make([]uint, 0)
+	seen := make(map[uint]bool)
+	for _, record := range records {
+		if !seen[record.SchemaID] {
+			seen[record.SchemaID] = true
+			schemaIDs = append(schemaIDs, record.SchemaID)
+		}
+	}
+
+	var schemas []models.FormSchema
+	if err := db.Where("id IN ? AND storage_mode = ?", schemaIDs, models.StorageModeTable).Find(&schemas).Error; err != nil {
+		return err
+	}
+
+	for _, schema := range schemas {
+		fields, err := parseSchemaFields(schema.Schema)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]uint, 0, len(records))
+		for _, record := range records {
+			if record.SchemaID == schema.ID {
+				ids = append(ids, record.ID)
+			}
+		}
+
+		rows, err := loadPhysicalRows(db, schema.ID, fields, ids)
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			if records[i].SchemaID != schema.ID {
+				continue
+			}
+			data := rows[records[i].ID]
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			dataJSON, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			records[i].Data = models.JSON(dataJSON)
+		}
+	}
+
+	return nil
+}
+
+// hydrateRecord 为单条记录加载物理表中的数据
+func hydrateRecord(db *gorm.DB, record *models.FormRecord) error {
+	records := []models.FormRecord{*record}
+	if err := hydrateRecordData(db, records); err != nil {
+		return err
+	}
+	record.Data = records[0].Data
+	return nil
+}
+
+// loadPhysicalRows 读取物理表中指定记录的数据，返回 记录ID -> 数据
+func loadPhysicalRows(db *gorm.DB, schemaID uint, fields []models.FormField, recordIDs []uint) (map[uint]map[string]interface{}, error) {
+	result := make(map[uint]map[string]interface{}, len(recordIDs))
+	if len(recordIDs) == 0 {
+		return result, nil
+	}
+
+	columnTypes := make(map[string]physicalColumn)
+	for _, column := range physicalColumns(fields) {
+		columnTypes[column.name] = column
+	}
+
+	rows, err := db.Raw("SELECT * FROM "+quoteIdent(physicalTableName(schemaID))+" WHERE "+physicalKeyColumn+" IN ?", recordIDs).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		pointers := make([]interface{}, len(names))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		var recordID uint
+		data := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			if name == physicalKeyColumn {
+				if id, ok := values[i].(int64); ok {
+					recordID = uint(id)
+				}
+				continue
+			}
+			column, exists := columnTypes[name]
+			if !exists || values[i] == nil {
+				continue
+			}
+			data[name] = logicalValue(column, values[i])
+		}
+		result[recordID] = data
+	}
+
+	return result, rows.Err()
+}
+
+// ChangeFormStorage 切换表单记录的存储方式，并一次性迁移已有记录
+// json -> table：按字段定义生成物理表，将记录数据迁移到物理表
+// table -> json：将物理表中的数据写回form_records.data，并删除物理表
+func ChangeFormStorage(c *gin.Context) {
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		StorageMode string `json:"storage_mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.StorageMode != models.StorageModeJSON && req.StorageMode != models.StorageModeTable {
+		utils.ErrorResponse(c, 400, "不支持的存储方式")
+		return
+	}
+	if currentStorageMode(schema) == req.StorageMode {
+		utils.ErrorResponse(c, 400, "表单已使用该存储方式")
+		return
+	}
+
+	fields, err := parseSchemaFields(schema.Schema)
+	if err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	if req.StorageMode == models.StorageModeTable {
+		if err := validatePhysicalColumns(fields); err != nil {
+			utils.ErrorResponse(c, 400, err.Error())
+			return
+		}
+	}
+
+	migrated := 0
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if req.StorageMode == models.StorageModeTable {
+			if err := syncPhysicalTable(tx, schema.ID, fields); err != nil {
+				return err
+			}
+		}
+
+		var records []models.FormRecord
+		if err := tx.Where("schema_id = ?", schema.ID).Find(&records).Error; err != nil {
+			return err
+		}
+		if err := hydrateRecordData(tx, records); err != nil {
+			return err
+		}
+
+		target := *schema
+		target.StorageMode = req.StorageMode
+		for i := range records {
+			var data map[string]interface{}
+			json.Unmarshal(records[i].Data, &data)
+			if err := saveRecordData(tx, &target, fields, &records[i], data); err != nil {
+				return err
+			}
+			migrated++
+		}
+
+		if req.StorageMode == models.StorageModeJSON {
+			if err := dropPhysicalTable(tx, schema.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(schema).UpdateColumn("storage_mode", req.StorageMode).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "存储方式切换失败: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":        "存储方式切换成功",
+		"storage_mode":   req.StorageMode,
+		"migrated_count": migrated,
+		"table_name":     storageTableName(req.StorageMode, schema.ID),
+	})
+}
+
+// currentStorageMode 获取表单当前的存储方式(旧数据为空时视为json)
+func currentStorageMode(schema *models.FormSchema) string {
+	if schema.StorageMode == "" {
+		return models.StorageModeJSON
+	}
+	return schema.StorageMode
+}
+
+// storageTableName 物理表存储时返回物理表名，否则返回空
+func storageTableName(mode string, schemaID uint) string {
+	if mode == models.StorageModeTable {
+		return physicalTableName(schemaID)
+	}
+	return ""
+}
@@ -0,0 +1,639 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// builtinFormTemplate 内置表单模板，以key标识
+type builtinFormTemplate struct {
+	Key         string                `json:"key"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Category    string                `json:"category"`
+	Schema      models.FormSchemaData `json:"schema"`
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// builtinFormTemplates 内置模板库
+var builtinFormTemplates = []builtinFormTemplate{
+	{
+		Key:         "contact",
+		Name:        "联系表",
+		Description: "收集姓名、联系方式和留言",
+		Category:    "通用",
+		Schema: models.FormSchemaData{Fields: []models.FormField{
+			{ID: "name", Name: "name", Label: "姓名", Type: "string", Required: true, MaxLength: intPtr(50), SortOrder: 1},
+			{ID: "email", Name: "email", Label: "邮箱", Type: "string", Format: "email", Required: true, SortOrder: 2},
+			{ID: "phone", Name: "phone", Label: "电话", Type: "string", Format: "phone", SortOrder: 3},
+			{ID: "message", Name: "message", Label: "留言", Type: "string", Required: true, MaxLength: intPtr(2000), InputType: "textarea", TextareaRows: intPtr(5), SortOrder: 4},
+		}},
+	},
+	{
+		Key:         "feedback",
+		Name:        "满意度反馈",
+		Description: "评分与意见收集，评分较低时要求填写原因",
+		Category:    "调查",
+		Schema: models.FormSchemaData{Fields: []models.FormField{
+			{ID: "rating", Name: "rating", Label: "满意度评分", Type: "integer", Required: true, MinValue: floatPtr(1), MaxValue: floatPtr(5), SortOrder: 1},
+			{ID: "reason", Name: "reason", Label: "不满意的原因", Type: "string", InputType: "textarea",
+				RequiredWhen: &models.FieldCondition{Field: "rating", Op: "lte", Value: 2}, SortOrder: 2},
+			{ID: "topics", Name: "topics", Label: "关注方面", Type: "multi_enum", EnumOptions: []models.FormFieldOption{
+				{Label: "产品质量", Value: "quality"},
+				{Label: "服务态度", Value: "service"},
+				{Label: "价格", Value: "price"},
+				{Label: "交付速度", Value: "delivery"},
+			}, SortOrder: 3},
+			{ID: "suggestion", Name: "suggestion", Label: "建议", Type: "string", InputType: "textarea", SortOrder: 4},
+		}},
+	},
+	{
+		Key:         "event_registration",
+		Name:        "活动报名",
+		Description: "活动报名信息，可登记多名同行人员",
+		Category:    "活动",
+		Schema: models.FormSchemaData{
+			Sections: []models.FormSection{
+				{ID: "attendee", Title: "报名人信息", SortOrder: 1},
+				{ID: "companions", Title: "同行人员", SortOrder: 2},
+			},
+			Fields: []models.FormField{
+				{ID: "name", Name: "name", Label: "姓名", Type: "string", Required: true, Section: "attendee", SortOrder: 1},
+				{ID: "email", Name: "email", Label: "邮箱", Type: "string", Format: "email", Required: true, Section: "attendee", SortOrder: 2},
+				{ID: "session", Name: "session", Label: "场次", Type: "single_enum", Required: true, EnumOptions: []models.FormFieldOption{
+					{Label: "上午场", Value: "morning"},
+					{Label: "下午场", Value: "afternoon"},
+				}, Section: "attendee", SortOrder: 3},
+				{ID: "with_companions", Name: "with_companions", Label: "是否有同行人员", Type: "boolean", Section: "attendee", SortOrder: 4},
+				{ID: "companions", Name: "companions", Label: "同行人员", Type: "group", MaxItems: intPtr(5), Fields: []models.FormField{
+					{ID: "name", Name: "name", Label: "姓名", Type: "string", Required: true, SortOrder: 1},
+					{ID: "phone", Name: "phone", Label: "电话", Type: "string", Format: "phone", SortOrder: 2},
+				}, VisibleWhen: &models.FieldCondition{Field: "with_companions", Op: "eq", Value: true}, Section: "companions", SortOrder: 5},
+			},
+		},
+	},
+	{
+		Key:         "expense",
+		Name:        "费用报销",
+		Description: "报销明细与金额自动汇总，提交后由审核人审批",
+		Category:    "办公",
+		Schema: models.FormSchemaData{Fields: []models.FormField{
+			{ID: "applicant", Name: "applicant", Label: "申请人", Type: "string", Required: true, SortOrder: 1},
+			{ID: "expense_date", Name: "expense_date", Label: "费用日期", Type: "datetime", TimeFormat: "date", Required: true, SortOrder: 2},
+			{ID: "category", Name: "category", Label: "费用类别", Type: "single_enum", Required: true, EnumOptions: []models.FormFieldOption{
+				{Label: "交通", Value: "travel"},
+				{Label: "餐饮", Value: "meal"},
+				{Label: "住宿", Value: "hotel"},
+				{Label: "其他", Value: "other"},
+			}, SortOrder: 3},
+			{ID: "amount", Name: "amount", Label: "金额", Type: "float", Required: true, MinValue: floatPtr(0), Precision: intPtr(2), SortOrder: 4},
+			{ID: "tax", Name: "tax", Label: "税额", Type: "float", MinValue: floatPtr(0), Precision: intPtr(2), SortOrder: 5},
+			{ID: "total", Name: "total", Label: "合计", Type: "formula", Formula: "amount + tax", Precision: intPtr(2), SortOrder: 6},
+			{ID: "receipts", Name: "receipts", Label: "票据", Type: "image", Multiple: true, MaxFiles: intPtr(10), SortOrder: 7},
+			{ID: "remark", Name: "remark", Label: "备注", Type: "string", InputType: "textarea", SortOrder: 8},
+		},
+			Workflow: &models.FormWorkflow{
+				InitialState: "draft",
+				States: []models.WorkflowState{
+					{Key: "draft", Label: "草稿"},
+					{Key: "pending", Label: "待审批"},
+					{Key: "approved", Label: "已通过", Final: true},
+					{Key: "rejected", Label: "已驳回"},
+				},
+				Transitions: []models.WorkflowTransition{
+					{Key: "submit", Label: "提交审批", From: []string{"draft", "rejected"}, To: "pending", Roles: []string{models.WorkflowActorCreator}},
+					{Key: "approve", Label: "通过", From: []string{"pending"}, To: "approved", Roles: []string{models.WorkflowActorAssignee, models.FormRoleManager}},
+					{Key: "reject", Label: "驳回", From: []string{"pending"}, To: "rejected", Roles: []string{models.WorkflowActorAssignee, models.FormRoleManager}, RequireComment: true},
+				},
+			},
+		},
+	},
+}
+
+// findBuiltinTemplate 按key查找内置模板
+func findBuiltinTemplate(key string) (*builtinFormTemplate, bool) {
+	for i := range builtinFormTemplates {
+		if builtinFormTemplates[i].Key == key {
+			return &builtinFormTemplates[i], true
+		}
+	}
+	return nil, false
+}
+
+// findVisibleTemplate 查找当前用户可见的模板(自己的、共享的，有管理全部模板权限时可见全部)，查找失败时直接写入错误响应
+func findVisibleTemplate(c *gin.Context, templateID interface{}) (*models.FormTemplate, bool) {
+	userID, _ := c.Get("user_id")
+
+	var template models.FormTemplate
+	query := config.DB.Where("id = ?", templateID)
+	if !hasPermission(c, models.PermTemplateManageAny) {
+		query = query.Where("user_id = ? OR shared = ?", userID, true)
+	}
+
+	if err := query.Preload("User").First(&template).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "模板不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+
+	return &template, true
+}
+
+// findOwnedTemplate 查找当前用户可修改的模板(仅创建者和有管理全部模板权限的用户)
+func findOwnedTemplate(c *gin.Context) (*models.FormTemplate, bool) {
+	userID, _ := c.Get("user_id")
+
+	if _, builtin := findBuiltinTemplate(c.Param("id")); builtin {
+		utils.ForbiddenResponse(c, "内置模板不能修改")
+		return nil, false
+	}
+
+	template, ok := findVisibleTemplate(c, c.Param("id"))
+	if !ok {
+		return nil, false
+	}
+	if !hasPermission(c, models.PermTemplateManageAny) && template.UserID != userID.(uint) {
+		utils.ForbiddenResponse(c, "只能修改自己创建的模板")
+		return nil, false
+	}
+
+	return template, true
+}
+
+// resolveTemplate 按ID(用户模板)或key(内置模板)获取模板的名称、说明和表单结构数据
+func resolveTemplate(c *gin.Context, id string) (string, string, models.FormSchemaData, bool) {
+	if builtin, ok := findBuiltinTemplate(id); ok {
+		// 深拷贝，避免后续规范化修改内置定义
+		var schemaData models.FormSchemaData
+		raw, _ := json.Marshal(builtin.Schema)
+		json.Unmarshal(raw, &schemaData)
+		return builtin.Name, builtin.Description, schemaData, true
+	}
+
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		utils.NotFoundResponse(c, "模板不存在")
+		return "", "", models.FormSchemaData{}, false
+	}
+
+	template, ok := findVisibleTemplate(c, id)
+	if !ok {
+		return "", "", models.FormSchemaData{}, false
+	}
+
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(template.Schema, &schemaData); err != nil {
+		utils.ServerErrorResponse(c, "模板解析失败")
+		return "", "", models.FormSchemaData{}, false
+	}
+	return template.Name, template.Description, schemaData, true
+}
+
+// templateSchemaJSON 校验模板中的表单结构，返回序列化后的结构数据
+// 关联字段的目标表单在使用模板时再校验权限
+func templateSchemaJSON(c *gin.Context, schemaData models.FormSchemaData) (models.JSON, bool) {
+	if err := normalizeSchemaLayout(schemaData.Fields, schemaData.Sections); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
+	}
+	if err := normalizeWorkflow(schemaData.Workflow); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return nil, false
+	}
+
+	schemaJSON, err := json.Marshal(schemaData)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Schema序列化失败")
+		return nil, false
+	}
+	return models.JSON(schemaJSON), true
+}
+
+// selfRelationPlaceholders 将关联表单自身的字段改为占位ID(0)，使模板、副本中的自关联指向新表单
+func selfRelationPlaceholders(fields []models.FormField, schemaID uint) {
+	for i := range fields {
+		if isRelationField(fields[i]) && fields[i].RelationSchemaID != nil && *fields[i].RelationSchemaID == schemaID {
+			self := uint(0)
+			fields[i].RelationSchemaID = &self
+		}
+	}
+}
+
+// GetFormTemplates 获取模板库：内置模板、自己的模板和共享模板
+func GetFormTemplates(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	category := c.Query("category")
+	keyword := c.Query("keyword")
+
+	builtins := make([]builtinFormTemplate, 0)
+	for _, template := range builtinFormTemplates {
+		if category != "" && template.Category != category {
+			continue
+		}
+		if keyword != "" && !strings.Contains(template.Name+" "+template.Description, keyword) {
+			continue
+		}
+		builtins = append(builtins, template)
+	}
+
+	query := config.DB.Model(&models.FormTemplate{})
+	if !hasPermission(c, models.PermTemplateManageAny) {
+		query = query.Where("user_id = ? OR shared = ?", userID, true)
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if keyword != "" {
+		query = query.Where("name LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+
+	var templates []models.FormTemplate
+	if err := query.Preload("User").Order("created_at DESC").Find(&templates).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"builtin": builtins,
+		"list":    templates,
+	})
+}
+
+// GetFormTemplate 获取模板详情，id为用户模板ID或内置模板key
+func GetFormTemplate(c *gin.Context) {
+	if builtin, ok := findBuiltinTemplate(c.Param("id")); ok {
+		utils.SuccessResponse(c, builtin)
+		return
+	}
+
+	template, ok := findVisibleTemplate(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, template)
+}
+
+// formTemplateRequest 创建、修改模板的请求参数
+type formTemplateRequest struct {
+	Name        string               `json:"name" binding:"required"`
+	Description string               `json:"description"`
+	Category    string               `json:"category"`
+	Fields      []models.FormField   `json:"fields" binding:"required"`
+	Sections    []models.FormSection `json:"sections"`
+	Workflow    *models.FormWorkflow `json:"workflow"`
+	Shared      bool                 `json:"shared"`
+}
+
+// CreateFormTemplate 创建模板
+func CreateFormTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req formTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schemaJSON, ok := templateSchemaJSON(c, models.FormSchemaData{Fields: req.Fields, Sections: req.Sections, Workflow: req.Workflow})
+	if !ok {
+		return
+	}
+
+	template := models.FormTemplate{
+		Name:        req.Name,
+		Description: req.Description,
+		Category:    req.Category,
+		Schema:      schemaJSON,
+		Shared:      req.Shared,
+		UserID:      userID.(uint),
+	}
+	if err := config.DB.Create(&template).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建模板失败")
+		return
+	}
+
+	config.DB.Preload("User").First(&template, template.ID)
+
+	utils.SuccessResponse(c, template)
+}
+
+// SaveFormSchemaAsTemplate 将已有表单结构保存为模板
+func SaveFormSchemaAsTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Category    string `json:"category"`
+		Shared      bool   `json:"shared"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(schema.Schema, &schemaData); err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	selfRelationPlaceholders(schemaData.Fields, schema.ID)
+
+	schemaJSON, ok := templateSchemaJSON(c, schemaData)
+	if !ok {
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = schema.Name
+	}
+	if req.Description == "" {
+		req.Description = schema.Description
+	}
+
+	template := models.FormTemplate{
+		Name:        req.Name,
+		Description: req.Description,
+		Category:    req.Category,
+		Schema:      schemaJSON,
+		Shared:      req.Shared,
+		UserID:      userID.(uint),
+	}
+	if err := config.DB.Create(&template).Error; err != nil {
+		utils.ServerErrorResponse(c, "保存模板失败")
+		return
+	}
+
+	config.DB.Preload("User").First(&template, template.ID)
+
+	utils.SuccessResponse(c, template)
+}
+
+// UpdateFormTemplate 修改模板
+func UpdateFormTemplate(c *gin.Context) {
+	var req formTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	template, ok := findOwnedTemplate(c)
+	if !ok {
+		return
+	}
+
+	schemaJSON, ok := templateSchemaJSON(c, models.FormSchemaData{Fields: req.Fields, Sections: req.Sections, Workflow: req.Workflow})
+	if !ok {
+		return
+	}
+
+	template.Name = req.Name
+	template.Description = req.Description
+	template.Category = req.Category
+	template.Schema = schemaJSON
+	template.Shared = req.Shared
+	if err := config.DB.Omit("User").Save(template).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	utils.SuccessResponse(c, template)
+}
+
+// DeleteFormTemplate 删除模板
+func DeleteFormTemplate(c *gin.Context) {
+	template, ok := findOwnedTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Delete(template).Error; err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "删除成功"})
+}
+
+// UseFormTemplate 使用模板创建表单结构
+func UseFormTemplate(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		StorageMode string `json:"storage_mode"`
+		GroupID     *uint  `json:"group_id"` // 创建为用户组的表单
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	name, description, schemaData, ok := resolveTemplate(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if req.Name != "" {
+		name = req.Name
+	}
+	if req.Description != "" {
+		description = req.Description
+	}
+
+	formSchema, ok := createFormSchema(c, name, description, schemaData, req.StorageMode, req.GroupID)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, formSchema)
+}
+
+// CloneFormSchema 复制表单结构，可选同时复制记录(不含回收站中的记录)
+// 关联自身的字段及其记录值指向副本，关联其他表单的字段保持原目标
+func CloneFormSchema(c *gin.Context) {
+	var req struct {
+		Name           string `json:"name"`
+		Description    string `json:"description"`
+		StorageMode    string `json:"storage_mode"` // 默认与原表单相同
+		GroupID        *uint  `json:"group_id"`     // 副本归属的用户组，默认为个人表单
+		IncludeRecords bool   `json:"include_records"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	source, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleManager)
+	if !ok {
+		return
+	}
+
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(source.Schema, &schemaData); err != nil {
+		utils.ServerErrorResponse(c, "表单结构解析失败")
+		return
+	}
+	selfRelationPlaceholders(schemaData.Fields, source.ID)
+
+	if req.Name == "" {
+		req.Name = source.Name + " (副本)"
+	}
+	if req.Description == "" {
+		req.Description = source.Description
+	}
+	if req.StorageMode == "" {
+		req.StorageMode = currentStorageMode(source)
+	}
+
+	clone, ok := createFormSchema(c, req.Name, req.Description, schemaData, req.StorageMode, req.GroupID)
+	if !ok {
+		return
+	}
+
+	copied := 0
+	if req.IncludeRecords {
+		var err error
+		if copied, err = cloneFormRecords(c, source, clone); err != nil {
+			// 记录复制失败时撤销创建的副本
+			config.DB.Transaction(func(tx *gorm.DB) error {
+				if err := dropPhysicalTable(tx, clone.ID); err != nil {
+					return err
+				}
+				return tx.Delete(&models.FormSchema{}, clone.ID).Error
+			})
+			utils.ServerErrorResponse(c, "复制记录失败")
+			return
+		}
+
+		// 通过自关联引用其他记录的公式在全部记录写入后重新计算
+		if _, err := recomputeSchemaFormulas(clone); err != nil {
+			utils.ServerErrorResponse(c, "公式重新计算失败")
+			return
+		}
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"schema":         clone,
+		"copied_records": copied,
+	})
+}
+
+// cloneFormRecords 将原表单的记录复制到副本，返回复制的记录数
+// 先创建全部记录以确定新ID，再将自关联字段的值映射为新记录ID后写入数据和引用关系
+func cloneFormRecords(c *gin.Context, source, clone *models.FormSchema) (int, error) {
+	userID, _ := c.Get("user_id")
+
+	var records []models.FormRecord
+	if err := config.DB.Where("schema_id = ? AND is_deleted = ?", source.ID, false).
+		Order("id ASC").Find(&records).Error; err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	if err := hydrateRecordData(config.DB, records); err != nil {
+		return 0, err
+	}
+
+	fields, err := parseSchemaFields(clone.Schema)
+	if err != nil {
+		return 0, err
+	}
+
+	var removedFiles []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		idMap := make(map[uint]uint, len(records))
+		copies := make([]models.FormRecord, len(records))
+		for i, record := range records {
+			copies[i] = models.FormRecord{
+				SchemaID: clone.ID,
+				Data:     models.JSON("{}"),
+				UserID:   record.UserID,
+				State:    record.State,
+			}
+			if err := tx.Create(&copies[i]).Error; err != nil {
+				return err
+			}
+			idMap[record.ID] = copies[i].ID
+		}
+
+		for i, record := range records {
+			var data map[string]interface{}
+			if err := json.Unmarshal(record.Data, &data); err != nil {
+				return err
+			}
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+
+			for _, field := range fields {
+				if !isRelationField(field) || field.RelationSchemaID == nil || *field.RelationSchemaID != clone.ID {
+					continue
+				}
+				key := getFieldKey(field)
+				ids, err := parseIDList(data[key])
+				if err != nil {
+					return err
+				}
+				mapped := make([]uint, 0, len(ids))
+				for _, id := range ids {
+					if newID, ok := idMap[id]; ok {
+						mapped = append(mapped, newID)
+					}
+				}
+				switch {
+				case len(mapped) == 0:
+					delete(data, key)
+				case isMultipleRelation(field):
+					data[key] = mapped
+				default:
+					data[key] = mapped[0]
+				}
+			}
+
+			dataJSON, err := encodeRecordData(clone, data)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&copies[i]).UpdateColumn("data", dataJSON).Error; err != nil {
+				return err
+			}
+			files, err := syncRecordReferences(tx, clone, copies[i].ID, data)
+			if err != nil {
+				return err
+			}
+			removedFiles = append(removedFiles, files...)
+			if _, err := saveRecordRevision(tx, clone, copies[i].ID, models.RevisionActionCreate, nil, data, userID.(uint)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	removeAssetFiles(removedFiles)
+
+	return len(records), nil
+}
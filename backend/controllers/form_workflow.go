@@ -0,0 +1,586 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxTransitionComment 转换意见的最大长度(字符)
+const maxTransitionComment = 2000
+
+// workflowRecordResponse 带有工作流信息的记录
+type workflowRecordResponse struct {
+	models.FormRecordResponse
+	StateLabel  string                      `json:"state_label"`
+	Transitions []models.WorkflowTransition `json:"transitions"` // 当前用户可执行的转换
+}
+
+// normalizeWorkflow 校验工作流定义，补全默认的初始状态和显示名称
+func normalizeWorkflow(workflow *models.FormWorkflow) error {
+	if workflow == nil {
+		return nil
+	}
+	if len(workflow.States) == 0 {
+		return fmt.Errorf("工作流至少需要一个状态")
+	}
+
+	states := make(map[string]bool, len(workflow.States))
+	for i := range workflow.States {
+		state := &workflow.States[i]
+		if state.Key == "" || len(state.Key) > 50 {
+			return fmt.Errorf("工作流状态的key不能为空且不能超过50个字符")
+		}
+		if states[state.Key] {
+			return fmt.Errorf("工作流状态 '%s' 重复", state.Key)
+		}
+		states[state.Key] = true
+		if state.Label == "" {
+			state.Label = state.Key
+		}
+	}
+
+	if workflow.InitialState == "" {
+		workflow.InitialState = workflow.States[0].Key
+	}
+	if !states[workflow.InitialState] {
+		return fmt.Errorf("工作流初始状态 '%s' 不存在", workflow.InitialState)
+	}
+
+	transitions := make(map[string]bool, len(workflow.Transitions))
+	for i := range workflow.Transitions {
+		transition := &workflow.Transitions[i]
+		if transition.Key == "" || len(transition.Key) > 50 {
+			return fmt.Errorf("工作流转换的key不能为空且不能超过50个字符")
+		}
+		if transitions[transition.Key] {
+			return fmt.Errorf("工作流转换 '%s' 重复", transition.Key)
+		}
+		transitions[transition.Key] = true
+		if transition.Label == "" {
+			transition.Label = transition.Key
+		}
+
+		if !states[transition.To] {
+			return fmt.Errorf("工作流转换 '%s' 的目标状态 '%s' 不存在", transition.Key, transition.To)
+		}
+		for _, from := range transition.From {
+			if !states[from] {
+				return fmt.Errorf("工作流转换 '%s' 的来源状态 '%s' 不存在", transition.Key, from)
+			}
+		}
+		for _, role := range transition.Roles {
+			if _, ok := formRoleLevels[role]; !ok && role != models.WorkflowActorCreator && role != models.WorkflowActorAssignee {
+				return fmt.Errorf("工作流转换 '%s' 的角色 '%s' 无效", transition.Key, role)
+			}
+		}
+	}
+
+	return nil
+}
+
+// schemaWorkflow 解析表单的工作流定义，未启用时返回nil
+func schemaWorkflow(schema *models.FormSchema) *models.FormWorkflow {
+	var schemaData models.FormSchemaData
+	if err := json.Unmarshal(schema.Schema, &schemaData); err != nil {
+		return nil
+	}
+	return schemaData.Workflow
+}
+
+// initialRecordState 新记录的工作流状态，未启用工作流时为空
+func initialRecordState(schema *models.FormSchema) string {
+	if workflow := schemaWorkflow(schema); workflow != nil {
+		return workflow.InitialState
+	}
+	return ""
+}
+
+// resetRecordStates 工作流变化后，将没有状态或状态已不存在的记录置为初始状态
+func resetRecordStates(tx *gorm.DB, schemaID uint, workflow *models.FormWorkflow) error {
+	if workflow == nil {
+		return nil
+	}
+	keys := make([]string, len(workflow.States))
+	for i, state := range workflow.States {
+		keys[i] = state.Key
+	}
+	return tx.Model(&models.FormRecord{}).
+		Where("schema_id = ? AND (state IS NULL OR state NOT IN ?)", schemaID, keys).
+		UpdateColumn("state", workflow.InitialState).Error
+}
+
+// findWorkflowState 按key查找工作流状态
+func findWorkflowState(workflow *models.FormWorkflow, key string) (models.WorkflowState, bool) {
+	for _, state := range workflow.States {
+		if state.Key == key {
+			return state, true
+		}
+	}
+	return models.WorkflowState{}, false
+}
+
+// recordState 记录当前的工作流状态，状态为空的记录视为初始状态
+func recordState(workflow *models.FormWorkflow, record *models.FormRecord) string {
+	if record.State == "" {
+		return workflow.InitialState
+	}
+	return record.State
+}
+
+// transitionSources 转换的来源状态，未指定时为全部非终止状态
+func transitionSources(workflow *models.FormWorkflow, transition models.WorkflowTransition) []string {
+	if len(transition.From) > 0 {
+		return transition.From
+	}
+	var sources []string
+	for _, state := range workflow.States {
+		if !state.Final {
+			sources = append(sources, state.Key)
+		}
+	}
+	return sources
+}
+
+// transitionActors 可触发转换的角色，未指定时为表单管理者
+func transitionActors(transition models.WorkflowTransition) []string {
+	if len(transition.Roles) == 0 {
+		return []string{models.FormRoleManager}
+	}
+	return transition.Roles
+}
+
+// assignedRecordIDsQuery 指派给用户审核的记录ID子查询
+func assignedRecordIDsQuery(userID uint) *gorm.DB {
+	return config.DB.Model(&models.FormRecordAssignee{}).Select("record_id").Where("user_id = ?", userID)
+}
+
+// isRecordAssignee 判断用户是否为记录的审核人
+func isRecordAssignee(recordID, userID uint) bool {
+	var count int64
+	config.DB.Model(&models.FormRecordAssignee{}).Where("record_id = ? AND user_id = ?", recordID, userID).Count(&count)
+	return count > 0
+}
+
+// canTriggerTransition 判断用户能否在记录上执行转换(不检查来源状态)
+func canTriggerTransition(perm *models.FormPermission, record *models.FormRecord, assigned bool, transition models.WorkflowTransition) bool {
+	for _, actor := range transitionActors(transition) {
+		switch actor {
+		case models.WorkflowActorCreator:
+			if record.UserID == perm.UserID {
+				return true
+			}
+		case models.WorkflowActorAssignee:
+			if assigned {
+				return true
+			}
+		default:
+			if hasFormRole(perm, actor) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// availableTransitions 用户在记录当前状态下可执行的转换
+func availableTransitions(workflow *models.FormWorkflow, perm *models.FormPermission, record *models.FormRecord, assigned bool) []models.WorkflowTransition {
+	state := recordState(workflow, record)
+	result := make([]models.WorkflowTransition, 0)
+	for _, transition := range workflow.Transitions {
+		if !containsString(transitionSources(workflow, transition), state) {
+			continue
+		}
+		if canTriggerTransition(perm, record, assigned, transition) {
+			result = append(result, transition)
+		}
+	}
+	return result
+}
+
+// findWorkflowRecord 查找当前用户可查看且所属表单启用了工作流的记录，查找失败时直接写入错误响应
+func findWorkflowRecord(c *gin.Context) (*models.FormRecord, *models.FormWorkflow, bool) {
+	record, ok := findAccessibleRecord(c, config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false))
+	if !ok {
+		return nil, nil, false
+	}
+	workflow := schemaWorkflow(&record.Schema)
+	if workflow == nil {
+		utils.ErrorResponse(c, 400, "该表单未启用工作流")
+		return nil, nil, false
+	}
+	return record, workflow, true
+}
+
+// loadRecordAssignees 获取记录的审核人
+func loadRecordAssignees(recordID uint) []models.FormRecordAssignee {
+	var assignees []models.FormRecordAssignee
+	config.DB.Where("record_id = ?", recordID).Preload("User").Order("created_at ASC").Find(&assignees)
+	return assignees
+}
+
+// GetFormRecordWorkflow 获取记录的工作流状态、可执行的转换、审核人和转换历史
+func GetFormRecordWorkflow(c *gin.Context) {
+	record, workflow, ok := findWorkflowRecord(c)
+	if !ok {
+		return
+	}
+	perm := record.Schema.Permission
+
+	var history []models.FormRecordTransition
+	if err := config.DB.Where("record_id = ?", record.ID).
+		Preload("User").
+		Order("created_at ASC, id ASC").
+		Find(&history).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	state := recordState(workflow, record)
+	current, _ := findWorkflowState(workflow, state)
+
+	utils.SuccessResponse(c, gin.H{
+		"state":       current,
+		"transitions": availableTransitions(workflow, perm, record, isRecordAssignee(record.ID, perm.UserID)),
+		"assignees":   loadRecordAssignees(record.ID),
+		"history":     history,
+		"workflow":    workflow,
+	})
+}
+
+// TransitionFormRecord 执行记录的状态转换
+func TransitionFormRecord(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Transition string `json:"transition" binding:"required"`
+		Comment    string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	record, workflow, ok := findWorkflowRecord(c)
+	if !ok {
+		return
+	}
+	perm := record.Schema.Permission
+
+	var transition *models.WorkflowTransition
+	for i := range workflow.Transitions {
+		if workflow.Transitions[i].Key == req.Transition {
+			transition = &workflow.Transitions[i]
+			break
+		}
+	}
+	if transition == nil {
+		utils.ErrorResponse(c, 400, "转换不存在")
+		return
+	}
+
+	state := recordState(workflow, record)
+	if !containsString(transitionSources(workflow, *transition), state) {
+		current, _ := findWorkflowState(workflow, state)
+		utils.ErrorResponse(c, 400, fmt.Sprintf("记录当前状态为 '%s'，不能执行 '%s'", current.Label, transition.Label))
+		return
+	}
+	if !canTriggerTransition(perm, record, isRecordAssignee(record.ID, perm.UserID), *transition) {
+		utils.ForbiddenResponse(c, "没有权限执行该操作")
+		return
+	}
+
+	req.Comment = strings.TrimSpace(req.Comment)
+	if transition.RequireComment && req.Comment == "" {
+		utils.ErrorResponse(c, 400, "请填写意见")
+		return
+	}
+	if utf8.RuneCountInString(req.Comment) > maxTransitionComment {
+		utils.ErrorResponse(c, 400, fmt.Sprintf("意见不能超过 %d 个字符", maxTransitionComment))
+		return
+	}
+
+	history := models.FormRecordTransition{
+		RecordID:   record.ID,
+		SchemaID:   record.SchemaID,
+		Transition: transition.Key,
+		FromState:  state,
+		ToState:    transition.To,
+		Comment:    req.Comment,
+		UserID:     userID.(uint),
+	}
+
+	// 按原状态条件更新，避免并发转换
+	errStateChanged := fmt.Errorf("state changed")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.FormRecord{}).Where("id = ? AND is_deleted = ?", record.ID, false)
+		if record.State == "" {
+			query = query.Where("state = '' OR state IS NULL")
+		} else {
+			query = query.Where("state = ?", record.State)
+		}
+		result := query.Update("state", transition.To)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStateChanged
+		}
+		return tx.Create(&history).Error
+	})
+	if err != nil {
+		if err == errStateChanged {
+			utils.ErrorResponse(c, 400, "记录状态已变化，请刷新后重试")
+			return
+		}
+		utils.ServerErrorResponse(c, "操作失败")
+		return
+	}
+
+	emitRecordEvent(models.WebhookEventRecordTransitioned, userID.(uint), gin.H{
+		"transition": transition.Key,
+		"from_state": state,
+		"to_state":   transition.To,
+		"comment":    req.Comment,
+	}, record.ID)
+
+	config.DB.Preload("User").First(&history, history.ID)
+
+	utils.SuccessResponse(c, history)
+}
+
+// SetFormRecordAssignees 设置记录的审核人，按提交的列表整体替换
+// 可修改记录的用户可以指派审核人，审核人需能访问该表单
+func SetFormRecordAssignees(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		UserIDs []uint `json:"user_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	record, _, ok := findWorkflowRecord(c)
+	if !ok {
+		return
+	}
+	if !canModifyRecord(record.Schema.Permission, record) {
+		utils.ForbiddenResponse(c, "没有权限指派该记录的审核人")
+		return
+	}
+
+	ids := uniqueIDs(req.UserIDs)
+	var users []models.User
+	if len(ids) > 0 {
+		if err := config.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+		if len(users) != len(ids) {
+			utils.ErrorResponse(c, 400, "部分用户不存在")
+			return
+		}
+	}
+	roles := rolePermissionCache{}
+	for _, user := range users {
+		perm, err := loadFormPermission(&record.Schema, user.ID, roles.has(user.Role, models.PermFormManageAny))
+		if err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+		if perm == nil {
+			utils.ErrorResponse(c, 400, fmt.Sprintf("用户 '%s' 无权访问该表单", user.Username))
+			return
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("record_id = ?", record.ID).Delete(&models.FormRecordAssignee{}).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			assignee := models.FormRecordAssignee{RecordID: record.ID, UserID: user.ID, AssignedBy: userID.(uint)}
+			if err := tx.Create(&assignee).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "指派失败")
+		return
+	}
+
+	utils.SuccessResponse(c, loadRecordAssignees(record.ID))
+}
+
+// GetPendingFormRecords 获取所有表单中等待当前用户处理的记录(当前状态下用户可执行转换的记录)
+func GetPendingFormRecords(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// 启用了工作流且当前用户可访问的表单
+	schemaQuery := config.DB.Model(&models.FormSchema{}).Where("json_extract(form_schemas.schema, '$.workflow') IS NOT NULL")
+	if !hasPermission(c, models.PermFormManageAny) {
+		schemaQuery = schemaQuery.Where("user_id = ? OR id IN (?)", userID, sharedSchemaIDsQuery(userID.(uint)))
+	}
+	if schemaID := c.Query("schema_id"); schemaID != "" {
+		schemaQuery = schemaQuery.Where("id = ?", schemaID)
+	}
+
+	var schemas []models.FormSchema
+	if err := schemaQuery.Find(&schemas).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	// 每个表单按触发者分别收集可发起转换的状态，组合成查询条件
+	assigned := assignedRecordIDsQuery(userID.(uint))
+	workflows := make(map[uint]*models.FormWorkflow)
+	perms := make(map[uint]*models.FormPermission)
+	var conditions []string
+	var args []interface{}
+	for i := range schemas {
+		schema := &schemas[i]
+		workflow := schemaWorkflow(schema)
+		if workflow == nil {
+			continue
+		}
+		perm, err := loadFormPermission(schema, userID.(uint), hasPermission(c, models.PermFormManageAny))
+		if err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+		if perm == nil {
+			continue
+		}
+		workflows[schema.ID] = workflow
+		perms[schema.ID] = perm
+
+		roleStates := make(map[string]bool)
+		creatorStates := make(map[string]bool)
+		assigneeStates := make(map[string]bool)
+		for _, transition := range workflow.Transitions {
+			for _, actor := range transitionActors(transition) {
+				for _, state := range transitionSources(workflow, transition) {
+					switch actor {
+					case models.WorkflowActorCreator:
+						creatorStates[state] = true
+					case models.WorkflowActorAssignee:
+						assigneeStates[state] = true
+					default:
+						if hasFormRole(perm, actor) {
+							roleStates[state] = true
+						}
+					}
+				}
+			}
+		}
+
+		var parts []string
+		var partArgs []interface{}
+		if len(roleStates) > 0 {
+			if perm.RowScope == models.RowScopeOwn {
+				parts = append(parts, "form_records.state IN ? AND (form_records.user_id = ? OR form_records.id IN (?))")
+				partArgs = append(partArgs, stateKeys(roleStates), userID, assigned)
+			} else {
+				parts = append(parts, "form_records.state IN ?")
+				partArgs = append(partArgs, stateKeys(roleStates))
+			}
+		}
+		if len(creatorStates) > 0 {
+			parts = append(parts, "form_records.state IN ? AND form_records.user_id = ?")
+			partArgs = append(partArgs, stateKeys(creatorStates), userID)
+		}
+		if len(assigneeStates) > 0 {
+			parts = append(parts, "form_records.state IN ? AND form_records.id IN (?)")
+			partArgs = append(partArgs, stateKeys(assigneeStates), assigned)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		conditions = append(conditions, "form_records.schema_id = ? AND (("+strings.Join(parts, ") OR (")+"))")
+		args = append(append(args, schema.ID), partArgs...)
+	}
+
+	list := make([]workflowRecordResponse, 0)
+	var total int64
+	if len(conditions) > 0 {
+		query := config.DB.Model(&models.FormRecord{}).
+			Where("form_records.is_deleted = ?", false).
+			Where("("+strings.Join(conditions, ") OR (")+")", args...)
+		query.Count(&total)
+
+		var records []models.FormRecord
+		offset := (page - 1) * pageSize
+		if err := query.Preload("Schema").Preload("User").
+			Order("form_records.updated_at DESC").
+			Offset(offset).
+			Limit(pageSize).
+			Find(&records).Error; err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+
+		var assignedIDs []uint
+		config.DB.Model(&models.FormRecordAssignee{}).
+			Where("user_id = ? AND record_id IN ?", userID, recordIDs(records)).
+			Pluck("record_id", &assignedIDs)
+		assignedSet := make(map[uint]bool, len(assignedIDs))
+		for _, id := range assignedIDs {
+			assignedSet[id] = true
+		}
+
+		responses := buildRecordResponses(records)
+		for i := range records {
+			record := &records[i]
+			workflow := workflows[record.SchemaID]
+			perm := perms[record.SchemaID]
+			filterRecordResponses(perm, responses[i:i+1])
+
+			state, _ := findWorkflowState(workflow, recordState(workflow, record))
+			list = append(list, workflowRecordResponse{
+				FormRecordResponse: responses[i],
+				StateLabel:         state.Label,
+				Transitions:        availableTransitions(workflow, perm, record, assignedSet[record.ID]),
+			})
+		}
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"list":       list,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// stateKeys 将状态集合转换为列表
+func stateKeys(states map[string]bool) []string {
+	keys := make([]string, 0, len(states))
+	for key := range states {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminGroupIDsQuery 用户担任组管理员的用户组ID子查询
+func adminGroupIDsQuery(userID uint) *gorm.DB {
+	return config.DB.Model(&models.UserGroupMember{}).Select("group_id").
+		Where("user_id = ? AND role = ?", userID, models.GroupRoleAdmin)
+}
+
+// groupMemberRole 用户在用户组中的角色，不是成员时返回空字符串
+func groupMemberRole(groupID, userID uint) string {
+	var member models.UserGroupMember
+	if err := config.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return ""
+	}
+	return member.Role
+}
+
+// isGroupAdmin 当前用户是否可以管理用户组：拥有管理用户组权限或是组管理员
+func isGroupAdmin(c *gin.Context, groupID uint) bool {
+	userID, _ := c.Get("user_id")
+	return hasPermission(c, models.PermGroupManage) || groupMemberRole(groupID, userID.(uint)) == models.GroupRoleAdmin
+}
+
+// checkGroupMember 检查用户组存在且当前用户是组成员(拥有管理用户组权限时不要求)，用于将资源归属到用户组
+// 检查失败时直接写入错误响应
+func checkGroupMember(c *gin.Context, groupID uint) bool {
+	userID, _ := c.Get("user_id")
+
+	var count int64
+	config.DB.Model(&models.UserGroup{}).Where("id = ?", groupID).Count(&count)
+	if count == 0 {
+		utils.ErrorResponse(c, 400, "用户组不存在")
+		return false
+	}
+	if !hasPermission(c, models.PermGroupManage) && groupMemberRole(groupID, userID.(uint)) == "" {
+		utils.ForbiddenResponse(c, "不是该用户组的成员")
+		return false
+	}
+	return true
+}
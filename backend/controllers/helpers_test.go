@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB 使用内存数据库替换 config.DB，测试结束后恢复
+func useTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+strings.ReplaceAll(t.Name(), "/", "_")+"?mode=memory&cache=shared"),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// accountTables 登录、会话和两步验证相关的数据表
+var accountTables = []interface{}{
+	&models.User{}, &models.Role{}, &models.UserSession{}, &models.PasswordReset{},
+	&models.LoginFailure{}, &models.LoginLockout{}, &models.UserTwoFactor{},
+	&models.TwoFactorRecoveryCode{}, &models.LoginChallenge{}, &models.PersonalAccessToken{},
+	&models.UserGroup{}, &models.UserGroupMember{},
+}
+
+// formTables 表单、记录及其关联数据的数据表
+var formTables = []interface{}{
+	&models.FormSchema{}, &models.FormRecord{}, &models.Asset{}, &models.FormRecordAsset{},
+	&models.FormRecordRelation{}, &models.FormRecordRevision{}, &models.FormPublication{},
+	&models.FormSubmission{}, &models.ChallengeAttempt{}, &models.FormShare{},
+	&models.FormRecordTransition{}, &models.FormRecordAssignee{}, &models.ACLEntry{},
+	&models.Webhook{}, &models.WebhookDelivery{},
+}
+
+// fileTables 文件、分类及其访问控制的数据表
+var fileTables = []interface{}{
+	&models.File{}, &models.Category{}, &models.Tag{}, &models.ACLEntry{},
+}
+
+// useAccountDB 使用包含账号相关数据表和内置角色的测试数据库，并设置JWT签名密钥
+func useAccountDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	useTestDB(t, append(append([]interface{}{}, accountTables...), tables...)...)
+	config.DB.Create(&models.Role{Name: models.RoleAdmin, Permissions: models.JSON(`["*"]`)})
+	permissions, _ := json.Marshal(models.DefaultUserPermissions)
+	config.DB.Create(&models.Role{Name: models.RoleUser, Permissions: models.JSON(permissions)})
+
+	key, err := utils.NewHMACKey("test", []byte("controllers-test-secret-0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.SetJWTKeys(key, nil); err != nil {
+		t.Fatal(err)
+	}
+	utils.SetServerSecret([]byte("controllers-test-secret-0123456789"))
+}
+
+// createTestUser 创建本地账号，密码为 password
+func createTestUser(t *testing.T, username, role, password string) *models.User {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: username, Email: username + "@example.com", Password: hash, Role: role, AuthProvider: models.AuthProviderLocal}
+	if err := config.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// loginAs 为用户创建登录会话，返回访问令牌和刷新令牌
+func loginAs(t *testing.T, user *models.User) (string, string) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	resp, err := issueSession(c, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Token, resp.RefreshToken
+}
+
+// newTestRouter 创建测试用的路由
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	return gin.New()
+}
+
+// testResponse 接口返回的状态码和内容
+type testResponse struct {
+	Status  int
+	Header  http.Header
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// decode 解析响应中的 data
+func (r *testResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("解析响应失败: %v (%s)", err, r.Data)
+	}
+}
+
+// doRequest 发送JSON请求，token 不为空时作为访问令牌
+func doRequest(t *testing.T, r http.Handler, method, path, token string, body interface{}) *testResponse {
+	t.Helper()
+	return doRequestFrom(t, r, "", method, path, token, body)
+}
+
+// doRequestFrom 从指定IP发送JSON请求，ip 为空时使用默认地址
+func doRequestFrom(t *testing.T, r http.Handler, ip, method, path, token string, body interface{}) *testResponse {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if ip != "" {
+		req.RemoteAddr = ip + ":40000"
+	}
+	return serveRequest(t, r, req)
+}
+
+// serveRequest 处理请求并解析JSON响应
+func serveRequest(t *testing.T, r http.Handler, req *http.Request) *testResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := &testResponse{Status: w.Code, Header: w.Header()}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+			t.Fatalf("%s %s 响应无法解析: %v", req.Method, req.URL.Path, err)
+		}
+	}
+	return resp
+}
+
+// totpNow 计算当前时间的验证码，与身份验证器应用一致
+func totpNow(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/utils.TOTPPeriod))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// createTestSchema 创建JSON存储的表单结构
+func createTestSchema(t *testing.T, name string, fields []models.FormField) *models.FormSchema {
+	t.Helper()
+	schemaJSON, _ := json.Marshal(models.FormSchemaData{Fields: fields})
+	schema := &models.FormSchema{Name: name, Schema: models.JSON(schemaJSON), StorageMode: models.StorageModeJSON, UserID: 1}
+	if err := config.DB.Create(schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// createTestRecord 创建JSON存储的表单记录
+func createTestRecord(t *testing.T, schemaID uint, data map[string]interface{}) *models.FormRecord {
+	t.Helper()
+	dataJSON, _ := json.Marshal(data)
+	record := &models.FormRecord{SchemaID: schemaID, Data: models.JSON(dataJSON), UserID: 1}
+	if err := config.DB.Create(record).Error; err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
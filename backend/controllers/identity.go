@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errExternalAccountConflict 外部身份的用户名或邮箱已被其他账号使用
+var errExternalAccountConflict = errors.New("external account conflict")
+
+const (
+	oidcStateCookie     = "oidc_state"     // 保存发起登录时state的哈希，回调时校验是同一浏览器发起的登录
+	oidcStateCookiePath = "/api/auth/oidc" // 只随OIDC接口发送
+)
+
+// setOIDCStateCookie 设置或清除(state 为空时)OIDC登录的state Cookie
+// 回调地址为https时只通过https发送
+func setOIDCStateCookie(c *gin.Context, state string) {
+	value, maxAge := "", -1
+	if state != "" {
+		value, maxAge = utils.HashToken(state), int(config.OIDCStateTTL/time.Second)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcStateCookiePath, "", strings.HasPrefix(config.OIDC.RedirectURL, "https://"), true)
+}
+
+// GetIdentityProviders 获取可用的登录方式，供登录页面显示
+func GetIdentityProviders(c *gin.Context) {
+	providers := gin.H{
+		"local_registration": config.LocalRegistrationEnabled,
+		"ldap":               config.LDAP != nil,
+		"oidc":               nil,
+	}
+	if config.OIDC != nil {
+		providers["oidc"] = gin.H{"name": config.OIDCDisplayName}
+	}
+	utils.SuccessResponse(c, providers)
+}
+
+// OIDCAuthorize 发起OIDC登录，返回跳转到身份提供方的授权地址，并在浏览器中保存state的哈希
+func OIDCAuthorize(c *gin.Context) {
+	if config.OIDC == nil {
+		utils.NotFoundResponse(c, "未启用单点登录")
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		token, err := utils.RandomToken(32)
+		if err != nil {
+			utils.ServerErrorResponse(c, "发起登录失败")
+			return
+		}
+		values[i] = token
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := config.OIDC.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		log.Printf("获取OIDC授权地址失败: %v", err)
+		utils.ErrorResponse(c, 502, "无法连接身份提供方")
+		return
+	}
+
+	// 顺便清理过期的state
+	now := time.Now()
+	config.DB.Where("expires_at < ?", now.Add(-time.Hour)).Delete(&models.OIDCLoginState{})
+
+	if err := config.DB.Create(&models.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		IP:           c.ClientIP(),
+		ExpiresAt:    now.Add(config.OIDCStateTTL),
+	}).Error; err != nil {
+		utils.ServerErrorResponse(c, "发起登录失败")
+		return
+	}
+	setOIDCStateCookie(c, state)
+
+	utils.SuccessResponse(c, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+		"expires_in":        int64(config.OIDCStateTTL / time.Second),
+	})
+}
+
+// OIDCCallback 使用身份提供方返回的授权码完成登录，首次登录时自动创建账号
+func OIDCCallback(c *gin.Context) {
+	if config.OIDC == nil {
+		utils.NotFoundResponse(c, "未启用单点登录")
+		return
+	}
+
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// state 必须由同一浏览器发起，防止攻击者将自己账号的授权码提交到他人浏览器中完成登录(登录CSRF)
+	cookie, err := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "")
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(utils.HashToken(req.State))) != 1 {
+		utils.ErrorResponse(c, 400, "登录已过期，请重新登录")
+		return
+	}
+
+	// state 只能使用一次
+	var state models.OIDCLoginState
+	if err := config.DB.Where("state_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.State), time.Now()).
+		First(&state).Error; err != nil {
+		utils.ErrorResponse(c, 400, "登录已过期，请重新登录")
+		return
+	}
+	result := config.DB.Model(&models.OIDCLoginState{}).Where("id = ? AND used_at IS NULL", state.ID).Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		utils.ErrorResponse(c, 400, "登录已过期，请重新登录")
+		return
+	}
+
+	identity, err := config.OIDC.Exchange(req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC登录失败: %v", err)
+		utils.ErrorResponse(c, 400, "单点登录失败，请重新登录")
+		return
+	}
+
+	user, ok := provisionExternalUser(c, identity, nil)
+	if !ok {
+		return
+	}
+	completeLogin(c, user)
+}
+
+// completeLogin 身份验证通过后完成登录：启用两步验证的用户还需要输入验证码，否则直接创建会话
+func completeLogin(c *gin.Context, user *models.User) {
+	// 两步验证通过后才清除失败次数
+	if user.TwoFactorEnabled {
+		startTwoFactorLogin(c, user)
+		return
+	}
+	clearLoginFailures(user.ID)
+
+	// 创建登录会话
+	resp, err := issueSession(c, user)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+
+	utils.SuccessResponse(c, resp)
+}
+
+// provisionExternalUser 根据外部身份查找或创建本地账号，并按映射同步角色和用户组，失败时直接写入错误响应
+// user 不为空时表示已按用户名匹配到该身份对应的账号(LDAP)
+func provisionExternalUser(c *gin.Context, identity *utils.ExternalIdentity, user *models.User) (*models.User, bool) {
+	if identity.Username == "" || len(identity.Username) > 50 || identity.Email == "" || len(identity.Email) > 100 {
+		log.Printf("%s 身份 %s 缺少有效的用户名或邮箱", identity.Provider, identity.Subject)
+		utils.ErrorResponse(c, 400, "身份提供方未返回有效的用户名或邮箱，请联系管理员")
+		return nil, false
+	}
+
+	if user == nil {
+		var existing models.User
+		err := config.DB.Where("auth_provider = ? AND external_id = ?", identity.Provider, identity.Subject).First(&existing).Error
+		if err == nil {
+			user = &existing
+		} else if err != gorm.ErrRecordNotFound {
+			utils.ServerErrorResponse(c, "数据库查询失败")
+			return nil, false
+		}
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if user == nil {
+			user, err = createExternalUser(tx, identity)
+		} else {
+			err = updateExternalUser(tx, user, identity)
+		}
+		if err != nil {
+			return err
+		}
+		return syncExternalGroups(tx, user.ID, identity.Groups)
+	})
+	if err != nil {
+		if err == errExternalAccountConflict {
+			utils.ErrorResponse(c, 400, fmt.Sprintf("用户名 %s 或邮箱 %s 已被其他账号使用，请联系管理员", identity.Username, identity.Email))
+			return nil, false
+		}
+		log.Printf("同步外部账号 %s 失败: %v", identity.Username, err)
+		utils.ServerErrorResponse(c, "账号同步失败")
+		return nil, false
+	}
+
+	config.DB.First(user, user.ID)
+	return user, true
+}
+
+// createExternalUser 首次登录时创建账号，允许时关联邮箱相同的本地账号
+// 只有身份提供方验证过的邮箱才会关联，拥有管理权限的账号不会自动关联，避免通过身份提供方中同邮箱的账号接管
+func createExternalUser(tx *gorm.DB, identity *utils.ExternalIdentity) (*models.User, error) {
+	var existing models.User
+	if err := tx.Where("username = ? OR email = ?", identity.Username, identity.Email).First(&existing).Error; err == nil {
+		if !config.ExternalLinkByEmail || existing.AuthProvider != models.AuthProviderLocal || existing.Email != identity.Email {
+			return nil, errExternalAccountConflict
+		}
+		if !identity.EmailVerified {
+			log.Printf("%s 身份 %s 的邮箱未经验证，未关联本地账号 %s", identity.Provider, identity.Subject, existing.Username)
+			return nil, errExternalAccountConflict
+		}
+		if hasAdminRole(tx, existing.Role) {
+			log.Printf("本地账号 %s 拥有管理权限，未自动关联 %s 身份 %s", existing.Username, identity.Provider, identity.Subject)
+			return nil, errExternalAccountConflict
+		}
+		// 关联后只能通过身份提供方登录
+		if err := tx.Model(&existing).Updates(map[string]interface{}{
+			"auth_provider": identity.Provider,
+			"external_id":   identity.Subject,
+		}).Error; err != nil {
+			return nil, err
+		}
+		log.Printf("本地账号 %s 已关联 %s 身份 %s", existing.Username, identity.Provider, identity.Subject)
+		return &existing, updateExternalUser(tx, &existing, identity)
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	user := &models.User{
+		Username:     identity.Username,
+		Email:        identity.Email,
+		Role:         externalRole(tx, identity.Groups, models.RoleUser),
+		AuthProvider: identity.Provider,
+		ExternalID:   identity.Subject,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("已为 %s 身份 %s 创建账号 %s", identity.Provider, identity.Subject, user.Username)
+	return user, nil
+}
+
+// hasAdminRole 角色是否拥有任一管理权限
+func hasAdminRole(tx *gorm.DB, name string) bool {
+	if name == models.RoleAdmin {
+		return true
+	}
+	var role models.Role
+	if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+		return false
+	}
+	permissions := role.PermissionSet()
+	for _, permission := range adminPermissions {
+		if permissions.Has(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateExternalUser 同步已有账号的标识、邮箱和角色，角色变化时撤销该用户的全部会话
+func updateExternalUser(tx *gorm.DB, user *models.User, identity *utils.ExternalIdentity) error {
+	updates := map[string]interface{}{}
+	if user.ExternalID != identity.Subject {
+		updates["external_id"] = identity.Subject
+	}
+	if user.Email != identity.Email {
+		var count int64
+		tx.Model(&models.User{}).Where("email = ? AND id != ?", identity.Email, user.ID).Count(&count)
+		if count == 0 {
+			updates["email"] = identity.Email
+		}
+	}
+
+	roleChanged := false
+	if config.ExternalRoleMapped() {
+		if role := externalRole(tx, identity.Groups, user.Role); role != user.Role {
+			if isLastAdmin(user) {
+				log.Printf("账号 %s 是唯一的管理员，未按映射修改为角色 %s", user.Username, role)
+			} else {
+				updates["role"] = role
+				roleChanged = true
+			}
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := tx.Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	if roleChanged {
+		return revokeUserSessions(tx, user.ID)
+	}
+	return nil
+}
+
+// externalRole 按映射计算外部身份的角色，角色不存在时保留 fallback
+func externalRole(tx *gorm.DB, groups []string, fallback string) string {
+	role := config.ExternalRole(groups)
+	var count int64
+	tx.Model(&models.Role{}).Where("name = ?", role).Count(&count)
+	if count == 0 {
+		log.Printf("映射的角色 %s 不存在，使用角色 %s", role, fallback)
+		return fallback
+	}
+	return role
+}
+
+// syncExternalGroups 按映射同步用户组成员关系，映射中的用户组不存在时自动创建
+// 已是组成员时保留其组内角色，只有映射中的用户组由身份提供方管理
+func syncExternalGroups(tx *gorm.DB, userID uint, groups []string) error {
+	member, other := config.ExternalGroups(groups)
+
+	for _, name := range member {
+		group := models.UserGroup{Name: name}
+		if err := tx.Where("name = ?", name).Attrs(models.UserGroup{Description: "由身份提供方的组映射创建"}).
+			FirstOrCreate(&group).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ? AND user_id = ?", group.ID, userID).
+			FirstOrCreate(&models.UserGroupMember{GroupID: group.ID, UserID: userID, Role: models.GroupRoleMember}).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(other) == 0 {
+		return nil
+	}
+	return tx.Where("user_id = ? AND group_id IN (?)", userID,
+		tx.Model(&models.UserGroup{}).Select("id").Where("name IN ?", other)).
+		Delete(&models.UserGroupMember{}).Error
+}
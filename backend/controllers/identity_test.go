@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useIdentityMappings 临时设置外部身份的映射环境变量，测试结束后按原环境变量重新加载
+func useIdentityMappings(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Cleanup(config.InitIdentity)
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	config.InitIdentity()
+}
+
+func TestExternalRole(t *testing.T) {
+	useTestDB(t, &models.Role{})
+	for _, name := range []string{models.RoleAdmin, models.RoleUser, "editor", "viewer"} {
+		config.DB.Create(&models.Role{Name: name, Permissions: models.JSON(`[]`)})
+	}
+	useIdentityMappings(t, map[string]string{
+		"EXTERNAL_ROLE_MAPPING": "platform-admins=admin; cn=editors,ou=groups,dc=example,dc=com=editor; readers=viewer; ghosts=missing",
+		"EXTERNAL_DEFAULT_ROLE": "viewer",
+	})
+
+	tests := []struct {
+		name     string
+		groups   []string
+		fallback string
+		want     string
+	}{
+		{"按映射顺序取第一个匹配", []string{"readers", "platform-admins"}, models.RoleUser, models.RoleAdmin},
+		{"组名不区分大小写", []string{"Platform-Admins"}, models.RoleUser, models.RoleAdmin},
+		{"按完整DN匹配", []string{"cn=editors,ou=groups,dc=example,dc=com"}, models.RoleUser, "editor"},
+		{"不匹配DN中的RDN值", []string{"editors"}, models.RoleUser, "viewer"},
+		{"没有匹配时使用默认角色", []string{"others"}, models.RoleUser, "viewer"},
+		{"没有组时使用默认角色", nil, models.RoleUser, "viewer"},
+		{"映射的角色不存在时保留原角色", []string{"ghosts"}, "editor", "editor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := externalRole(config.DB, tt.groups, tt.fallback); got != tt.want {
+				t.Errorf("externalRole(%v) = %s, want %s", tt.groups, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("默认角色不存在时保留原角色", func(t *testing.T) {
+		t.Setenv("EXTERNAL_DEFAULT_ROLE", "missing")
+		config.InitIdentity()
+		if got := externalRole(config.DB, []string{"others"}, models.RoleUser); got != models.RoleUser {
+			t.Errorf("externalRole = %s, want %s", got, models.RoleUser)
+		}
+	})
+}
+
+func TestSyncExternalGroups(t *testing.T) {
+	useIdentityMappings(t, map[string]string{
+		"EXTERNAL_GROUP_MAPPING": "design=设计组; cn=dev,ou=groups,dc=example,dc=com=研发组; developers=研发组; ops=运维组",
+	})
+
+	tests := []struct {
+		name       string
+		groups     []string
+		existing   map[string]string // 同步前所在的用户组及组内角色
+		wantGroups map[string]string
+	}{
+		{
+			name:       "创建并加入映射的用户组",
+			groups:     []string{"design", "cn=dev,ou=groups,dc=example,dc=com"},
+			wantGroups: map[string]string{"设计组": models.GroupRoleMember, "研发组": models.GroupRoleMember},
+		},
+		{
+			name:       "多个组映射到同一用户组",
+			groups:     []string{"DEVELOPERS", "cn=dev,ou=groups,dc=example,dc=com"},
+			wantGroups: map[string]string{"研发组": models.GroupRoleMember},
+		},
+		{
+			name:       "离开身份提供方的组后移出对应用户组",
+			groups:     []string{"design"},
+			existing:   map[string]string{"设计组": models.GroupRoleMember, "运维组": models.GroupRoleMember},
+			wantGroups: map[string]string{"设计组": models.GroupRoleMember},
+		},
+		{
+			name:       "保留已有的组内角色",
+			groups:     []string{"ops"},
+			existing:   map[string]string{"运维组": models.GroupRoleAdmin},
+			wantGroups: map[string]string{"运维组": models.GroupRoleAdmin},
+		},
+		{
+			name:       "不影响映射以外的用户组",
+			groups:     nil,
+			existing:   map[string]string{"市场部": models.GroupRoleAdmin, "研发组": models.GroupRoleMember},
+			wantGroups: map[string]string{"市场部": models.GroupRoleAdmin},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, &models.UserGroup{}, &models.UserGroupMember{})
+			const userID = 1
+			for name, role := range tt.existing {
+				group := models.UserGroup{Name: name}
+				config.DB.Create(&group)
+				config.DB.Create(&models.UserGroupMember{GroupID: group.ID, UserID: userID, Role: role})
+			}
+			// 其他用户的成员关系不受影响
+			config.DB.Create(&models.UserGroup{Name: "运维组"})
+			var ops models.UserGroup
+			config.DB.Where("name = ?", "运维组").First(&ops)
+			config.DB.Create(&models.UserGroupMember{GroupID: ops.ID, UserID: 2, Role: models.GroupRoleMember})
+
+			if err := syncExternalGroups(config.DB, userID, tt.groups); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := userGroupRoles(t, userID); !reflect.DeepEqual(got, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", got, tt.wantGroups)
+			}
+			if got := userGroupRoles(t, 2); !reflect.DeepEqual(got, map[string]string{"运维组": models.GroupRoleMember}) {
+				t.Errorf("other user's groups = %v", got)
+			}
+		})
+	}
+}
+
+// userGroupRoles 查询用户所在的用户组及组内角色
+func userGroupRoles(t *testing.T, userID uint) map[string]string {
+	t.Helper()
+	var rows []struct {
+		Name string
+		Role string
+	}
+	if err := config.DB.Table("user_group_members").
+		Select("user_groups.name, user_group_members.role").
+		Joins("JOIN user_groups ON user_groups.id = user_group_members.group_id").
+		Where("user_group_members.user_id = ?", userID).Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	groups := map[string]string{}
+	for _, row := range rows {
+		groups[row.Name] = row.Role
+	}
+	return groups
+}
+
+func TestHasAdminRole(t *testing.T) {
+	useTestDB(t, &models.Role{})
+	config.DB.Create(&models.Role{Name: "editor", Permissions: models.JSON(`["form.create","file.upload"]`)})
+	config.DB.Create(&models.Role{Name: "helpdesk", Permissions: models.JSON(`["user.manage"]`)})
+	config.DB.Create(&models.Role{Name: "super", Permissions: models.JSON(`["*"]`)})
+
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{models.RoleAdmin, true},
+		{"helpdesk", true},
+		{"super", true},
+		{"editor", false},
+		{"missing", false},
+	}
+	for _, tt := range tests {
+		if got := hasAdminRole(config.DB, tt.role); got != tt.want {
+			t.Errorf("hasAdminRole(%s) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+// useTestOIDC 启用测试用的身份提供方，令牌接口对授权码 good-code 返回以最近一次授权地址中的nonce签发的ID令牌
+func useTestOIDC(t *testing.T) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		var state models.OIDCLoginState
+		config.DB.Order("id DESC").First(&state)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                issuer,
+			"aud":                "material",
+			"sub":                "u-1",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              state.Nonce,
+			"preferred_username": "alice",
+			"email":              "alice@example.com",
+		})
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	server := httptest.NewServer(mux)
+	issuer = server.URL
+	t.Cleanup(server.Close)
+
+	previous := config.OIDC
+	config.OIDC = &utils.OIDCProvider{Issuer: issuer, ClientID: "material", RedirectURL: "https://app.example.com/oidc/callback",
+		Scopes: []string{"openid"}, UsernameClaim: "preferred_username", EmailClaim: "email"}
+	t.Cleanup(func() { config.OIDC = previous })
+}
+
+func TestOIDCLoginStateCookie(t *testing.T) {
+	useAccountDB(t, &models.OIDCLoginState{})
+	useTestOIDC(t)
+	r := newTestRouter()
+	r.GET("/api/auth/oidc/authorize", OIDCAuthorize)
+	r.POST("/api/auth/oidc/callback", OIDCCallback)
+
+	// authorize 发起登录，返回 state 和浏览器中保存的Cookie
+	authorize := func() (string, *http.Cookie) {
+		t.Helper()
+		resp := doRequest(t, r, http.MethodGet, "/api/auth/oidc/authorize", "", nil)
+		if resp.Status != http.StatusOK {
+			t.Fatalf("authorize: %d %s", resp.Status, resp.Message)
+		}
+		var data struct {
+			AuthorizationURL string `json:"authorization_url"`
+			State            string `json:"state"`
+		}
+		resp.decode(t, &data)
+		if u, err := url.Parse(data.AuthorizationURL); err != nil || u.Query().Get("state") != data.State {
+			t.Fatalf("authorization url = %s", data.AuthorizationURL)
+		}
+		cookies := (&http.Response{Header: resp.Header}).Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("cookies = %v", cookies)
+		}
+		return data.State, cookies[0]
+	}
+	// callback 在带有 cookie 的浏览器中提交授权码
+	callback := func(state string, cookie *http.Cookie) *testResponse {
+		t.Helper()
+		body, _ := json.Marshal(gin.H{"code": "good-code", "state": state})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/callback", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		return serveRequest(t, r, req)
+	}
+
+	state, cookie := authorize()
+	if cookie.Name != oidcStateCookie || cookie.Value != utils.HashToken(state) || cookie.Path != oidcStateCookiePath ||
+		!cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Errorf("cookie = %+v", cookie)
+	}
+
+	// 攻击者发起登录后将授权码交给其他浏览器提交
+	attackerState, attackerCookie := authorize()
+	if resp := callback(attackerState, nil); resp.Status != http.StatusBadRequest {
+		t.Errorf("without cookie: status = %d, want 400", resp.Status)
+	}
+	if resp := callback(attackerState, cookie); resp.Status != http.StatusBadRequest {
+		t.Errorf("with other login's cookie: status = %d, want 400", resp.Status)
+	}
+	var used int64
+	config.DB.Model(&models.OIDCLoginState{}).Where("used_at IS NOT NULL").Count(&used)
+	if used != 0 {
+		t.Errorf("used states = %d, want 0", used)
+	}
+
+	resp := callback(attackerState, attackerCookie)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("callback: %d %s", resp.Status, resp.Message)
+	}
+	var login models.LoginResponse
+	resp.decode(t, &login)
+	if login.Token == "" || login.User.Username != "alice" {
+		t.Errorf("login = %+v", login)
+	}
+	if cleared := (&http.Response{Header: resp.Header}).Cookies(); len(cleared) != 1 || cleared[0].Name != oidcStateCookie || cleared[0].MaxAge >= 0 {
+		t.Errorf("cookie after login = %v", cleared)
+	}
+
+	// state 只能使用一次
+	if resp := callback(attackerState, attackerCookie); resp.Status != http.StatusBadRequest {
+		t.Errorf("replay: status = %d, want 400", resp.Status)
+	}
+}
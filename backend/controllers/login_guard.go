@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loginGuardKey 登录请求对应的一个统计对象
+type loginGuardKey struct {
+	key         string
+	kind        string
+	subject     string
+	userID      *uint
+	maxFailures int
+}
+
+var (
+	dummyPasswordHash string
+	dummyPasswordOnce sync.Once
+)
+
+// compareDummyPassword 账号不存在时同样执行一次密码校验，避免通过响应时间判断账号是否存在
+func compareDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword("material-platform-dummy-password")
+	})
+	utils.CheckPasswordHash(password, dummyPasswordHash)
+}
+
+// loginGuardKeys 登录请求的统计对象：账号存在时按用户ID统计，同一账号使用用户名或邮箱登录共用计数
+func loginGuardKeys(username string, user *models.User, ip string) []loginGuardKey {
+	account := loginGuardKey{
+		key:         "name:" + strings.ToLower(strings.TrimSpace(username)),
+		kind:        models.LoginGuardUser,
+		subject:     strings.TrimSpace(username),
+		maxFailures: config.Login.MaxUserFailures,
+	}
+	if user != nil {
+		account.key = userLoginGuardKey(user.ID)
+		account.subject = user.Username
+		account.userID = &user.ID
+	}
+
+	return []loginGuardKey{account, {
+		key:         "ip:" + ip,
+		kind:        models.LoginGuardIP,
+		subject:     ip,
+		maxFailures: config.Login.MaxIPFailures,
+	}}
+}
+
+// userLoginGuardKey 账号的统计对象
+func userLoginGuardKey(userID uint) string {
+	return "user:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// loginRetryDelay 连续失败后下一次尝试前需要等待的时间
+func loginRetryDelay(failures int) time.Duration {
+	n := failures - config.Login.DelayAfter
+	if n <= 0 || config.Login.DelayBase <= 0 {
+		return 0
+	}
+	delay := config.Login.DelayBase
+	for i := 1; i < n && delay < config.Login.DelayMax; i++ {
+		delay *= 2
+	}
+	if delay > config.Login.DelayMax {
+		delay = config.Login.DelayMax
+	}
+	return delay
+}
+
+// checkLoginAllowed 检查是否允许尝试登录，不允许时直接写入错误响应
+// 账号是否存在时的提示相同
+func checkLoginAllowed(c *gin.Context, keys []loginGuardKey) bool {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.key)
+	}
+
+	var failures []models.LoginFailure
+	if err := config.DB.Where("guard_key IN ?", names).Find(&failures).Error; err != nil {
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return false
+	}
+
+	now := time.Now()
+	var lockedUntil, retryAt time.Time
+	for _, f := range failures {
+		if f.LockedUntil != nil && f.LockedUntil.After(now) {
+			if f.LockedUntil.After(lockedUntil) {
+				lockedUntil = *f.LockedUntil
+			}
+			continue
+		}
+		if now.Sub(f.LastFailedAt) > config.Login.FailureWindow {
+			continue
+		}
+		if at := f.LastFailedAt.Add(loginRetryDelay(f.Failures)); at.After(retryAt) {
+			retryAt = at
+		}
+	}
+
+	if !lockedUntil.IsZero() {
+		wait := lockedUntil.Sub(now)
+		c.Header("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+		utils.TooManyRequestsResponse(c, fmt.Sprintf("登录失败次数过多，请 %d 分钟后重试", int(wait/time.Minute)+1))
+		return false
+	}
+	if retryAt.After(now) {
+		wait := int(retryAt.Sub(now)/time.Second) + 1
+		c.Header("Retry-After", strconv.Itoa(wait))
+		utils.TooManyRequestsResponse(c, fmt.Sprintf("登录尝试过于频繁，请 %d 秒后重试", wait))
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure 记录一次登录失败，达到次数上限时锁定并写入审计记录
+func recordLoginFailure(keys []loginGuardKey, ip string) {
+	now := time.Now()
+	for _, k := range keys {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			failure := models.LoginFailure{GuardKey: k.key, Kind: k.kind}
+			if err := tx.Where("guard_key = ?", k.key).FirstOrInit(&failure).Error; err != nil {
+				return err
+			}
+
+			// 超出计数时间或锁定已过期时重新计数
+			if now.Sub(failure.LastFailedAt) > config.Login.FailureWindow ||
+				(failure.LockedUntil != nil && !failure.LockedUntil.After(now)) {
+				failure.Failures = 0
+				failure.LockedUntil = nil
+			}
+			failure.Failures++
+			failure.LastFailedAt = now
+
+			if k.maxFailures > 0 && failure.Failures >= k.maxFailures && failure.LockedUntil == nil {
+				until := now.Add(config.Login.LockoutDuration)
+				failure.LockedUntil = &until
+				if err := tx.Create(&models.LoginLockout{
+					GuardKey:    k.key,
+					Kind:        k.kind,
+					Subject:     truncateString(k.subject, 150),
+					UserID:      k.userID,
+					Failures:    failure.Failures,
+					IP:          ip,
+					LockedUntil: until,
+				}).Error; err != nil {
+					return err
+				}
+				log.Printf("登录失败 %d 次，已锁定 %s 至 %s", failure.Failures, k.key, until.Format(time.RFC3339))
+			}
+			return tx.Save(&failure).Error
+		})
+		if err != nil {
+			log.Printf("记录登录失败出错: %v", err)
+		}
+	}
+}
+
+// clearLoginFailures 登录成功后清除账号的失败计数，IP的计数按时间过期
+func clearLoginFailures(userID uint) {
+	config.DB.Where("guard_key = ?", userLoginGuardKey(userID)).Delete(&models.LoginFailure{})
+}
+
+// unlockLoginKey 解除锁定并在审计记录中标记解锁人
+func unlockLoginKey(key string, adminID uint) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("guard_key = ?", key).Delete(&models.LoginFailure{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Model(&models.LoginLockout{}).
+			Where("guard_key = ? AND unlocked_at IS NULL AND locked_until > ?", key, now).
+			Updates(map[string]interface{}{"unlocked_at": now, "unlocked_by": adminID}).Error
+	})
+}
+
+// GetLoginLockouts 获取登录锁定记录（管理员功能），active=1时只返回仍在锁定中的记录
+func GetLoginLockouts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := config.DB.Model(&models.LoginLockout{})
+	if c.Query("active") == "1" {
+		query = query.Where("unlocked_at IS NULL AND locked_until > ?", time.Now())
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var lockouts []models.LoginLockout
+	if err := query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&lockouts).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"list":       lockouts,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// UnlockLoginLockout 解除锁定记录对应的账号或IP（管理员功能）
+func UnlockLoginLockout(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+
+	var lockout models.LoginLockout
+	if err := config.DB.First(&lockout, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "锁定记录不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+
+	if err := unlockLoginKey(lockout.GuardKey, adminID.(uint)); err != nil {
+		utils.ServerErrorResponse(c, "解锁失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已解除锁定"})
+}
+
+// UnlockUser 解除账号的登录锁定（管理员功能）
+func UnlockUser(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用户不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+
+	if err := unlockLoginKey(userLoginGuardKey(user.ID), adminID.(uint)); err != nil {
+		utils.ServerErrorResponse(c, "解锁失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已解除锁定"})
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"fmt"
+	"material-platform/config"
+	"material-platform/models"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useLoginProtection 临时替换登录防暴力破解设置
+func useLoginProtection(t *testing.T, settings config.LoginProtection) {
+	t.Helper()
+	previous := config.Login
+	config.Login = settings
+	t.Cleanup(func() { config.Login = previous })
+}
+
+// loginFrom 从指定IP登录，返回响应和 Retry-After
+func loginFrom(t *testing.T, r http.Handler, ip, username, password string) (*testResponse, string) {
+	t.Helper()
+	resp := doRequestFrom(t, r, ip, http.MethodPost, "/api/auth/login", "", gin.H{"username": username, "password": password})
+	return resp, resp.Header.Get("Retry-After")
+}
+
+// newLoginRouter 注册登录接口
+func newLoginRouter() *gin.Engine {
+	r := newTestRouter()
+	r.POST("/api/auth/login", Login)
+	return r
+}
+
+func TestLoginRetryDelay(t *testing.T) {
+	useLoginProtection(t, config.LoginProtection{DelayAfter: 2, DelayBase: time.Second, DelayMax: 30 * time.Second})
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{7, 16 * time.Second},
+		{8, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := loginRetryDelay(tt.failures); got != tt.want {
+			t.Errorf("loginRetryDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	config.Login.DelayBase = 0
+	if got := loginRetryDelay(10); got != 0 {
+		t.Errorf("delay disabled: loginRetryDelay(10) = %v, want 0", got)
+	}
+}
+
+func TestLoginLockoutThresholds(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxUser   int
+		maxIP     int
+		attempts  []string // 每次失败尝试使用的用户名
+		sameIP    bool     // 是否来自同一IP
+		wantLock  bool
+		wantLocks []string // 锁定记录的统计对象
+	}{
+		{"账号失败次数未达上限", 3, 0, []string{"alice", "alice"}, false, false, nil},
+		{"账号达到上限后锁定", 3, 0, []string{"alice", "alice", "alice"}, false, true, []string{"user:1"}},
+		{"用户名和邮箱共用计数", 3, 0, []string{"alice", "alice@example.com", "alice"}, false, true, []string{"user:1"}},
+		{"不同账号不共用计数", 3, 0, []string{"bob", "bob", "bob"}, true, false, []string{"user:2"}},
+		{"同一IP达到上限后锁定", 0, 3, []string{"bob", "carol", "nobody"}, true, true, []string{"ip:192.0.2.1"}},
+		{"上限为0时不锁定", 0, 0, []string{"alice", "alice", "alice", "alice"}, true, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccountDB(t)
+			useLoginProtection(t, config.LoginProtection{
+				MaxUserFailures: tt.maxUser, MaxIPFailures: tt.maxIP,
+				FailureWindow: time.Hour, LockoutDuration: time.Hour,
+			})
+			r := newLoginRouter()
+			createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+			createTestUser(t, "bob", models.RoleUser, "bob-pass-1")
+			createTestUser(t, "carol", models.RoleUser, "carol-pass-1")
+
+			for i, username := range tt.attempts {
+				ip := "192.0.2.1"
+				if !tt.sameIP {
+					ip = fmt.Sprintf("198.51.100.%d", i+1)
+				}
+				if resp, _ := loginFrom(t, r, ip, username, "wrong-pass"); resp.Status != http.StatusBadRequest {
+					t.Fatalf("attempt %d: status = %d %s, want 400", i+1, resp.Status, resp.Message)
+				}
+			}
+
+			// 锁定后正确的密码也不能登录
+			resp, retryAfter := loginFrom(t, r, "192.0.2.1", "alice", "alice-pass-1")
+			if locked := resp.Status == http.StatusTooManyRequests; locked != tt.wantLock {
+				t.Fatalf("correct password: status = %d %s, want locked %v", resp.Status, resp.Message, tt.wantLock)
+			}
+			if tt.wantLock && retryAfter == "" {
+				t.Error("missing Retry-After header")
+			}
+
+			var lockouts []models.LoginLockout
+			config.DB.Order("id").Find(&lockouts)
+			var keys []string
+			for _, l := range lockouts {
+				keys = append(keys, l.GuardKey)
+			}
+			if !reflect.DeepEqual(keys, tt.wantLocks) {
+				t.Errorf("lockouts = %v, want %v", keys, tt.wantLocks)
+			}
+		})
+	}
+}
+
+func TestLoginLockoutLifecycle(t *testing.T) {
+	useAccountDB(t)
+	useLoginProtection(t, config.LoginProtection{
+		MaxUserFailures: 3, MaxIPFailures: 0,
+		FailureWindow: 10 * time.Minute, LockoutDuration: time.Hour,
+	})
+	r := newLoginRouter()
+	alice := createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+	admin := createTestUser(t, "admin", models.RoleAdmin, "admin-pass-1")
+	key := userLoginGuardKey(alice.ID)
+
+	fail := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "wrong-pass"); resp.Status != http.StatusBadRequest {
+				t.Fatalf("failure: status = %d %s", resp.Status, resp.Message)
+			}
+		}
+	}
+
+	// 超过计数时间的失败不再累计
+	fail(2)
+	config.DB.Model(&models.LoginFailure{}).Where("guard_key = ?", key).Update("last_failed_at", time.Now().Add(-11*time.Minute))
+	fail(2)
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "alice-pass-1"); resp.Status != http.StatusOK {
+		t.Fatalf("after window: status = %d %s, want 200", resp.Status, resp.Message)
+	}
+
+	// 登录成功后清除账号的计数
+	var count int64
+	config.DB.Model(&models.LoginFailure{}).Where("guard_key = ?", key).Count(&count)
+	if count != 0 {
+		t.Fatalf("failures after success = %d, want 0", count)
+	}
+
+	fail(3)
+	locked, _ := loginFrom(t, r, "192.0.2.1", "alice", "alice-pass-1")
+	if locked.Status != http.StatusTooManyRequests {
+		t.Fatalf("locked: status = %d, want 429", locked.Status)
+	}
+
+	// 不存在的账号锁定后提示相同
+	for i := 0; i < 3; i++ {
+		loginFrom(t, r, "192.0.2.1", "nobody", "wrong-pass")
+	}
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "nobody", "wrong-pass"); resp.Status != locked.Status || resp.Message != locked.Message {
+		t.Errorf("unknown account: %d %q, want %d %q", resp.Status, resp.Message, locked.Status, locked.Message)
+	}
+
+	// 锁定到期后重新计数
+	expired := time.Now().Add(-time.Second)
+	config.DB.Model(&models.LoginFailure{}).Where("guard_key = ?", key).Update("locked_until", expired)
+	config.DB.Model(&models.LoginLockout{}).Where("guard_key = ?", key).Update("locked_until", expired)
+	fail(1)
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "alice-pass-1"); resp.Status != http.StatusOK {
+		t.Fatalf("after lockout expired: status = %d %s, want 200", resp.Status, resp.Message)
+	}
+
+	// 管理员解锁并记录解锁人
+	fail(3)
+	if err := unlockLoginKey(key, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "alice-pass-1"); resp.Status != http.StatusOK {
+		t.Errorf("after unlock: status = %d %s, want 200", resp.Status, resp.Message)
+	}
+	var lockouts []models.LoginLockout
+	config.DB.Where("guard_key = ?", key).Order("id").Find(&lockouts)
+	if len(lockouts) != 2 || lockouts[0].UnlockedBy != nil || lockouts[1].UnlockedBy == nil || *lockouts[1].UnlockedBy != admin.ID {
+		t.Errorf("lockouts = %+v", lockouts)
+	}
+}
+
+func TestLoginRetryDelayEnforced(t *testing.T) {
+	useAccountDB(t)
+	useLoginProtection(t, config.LoginProtection{
+		FailureWindow: time.Hour, DelayAfter: 1, DelayBase: time.Minute, DelayMax: time.Hour,
+	})
+	r := newLoginRouter()
+	createTestUser(t, "alice", models.RoleUser, "alice-pass-1")
+
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "wrong-pass"); resp.Status != http.StatusBadRequest {
+		t.Fatalf("first failure: status = %d", resp.Status)
+	}
+	if resp, _ := loginFrom(t, r, "192.0.2.1", "alice", "wrong-pass"); resp.Status != http.StatusBadRequest {
+		t.Fatalf("second failure: status = %d", resp.Status)
+	}
+
+	// 第二次失败后需等待1分钟，其他IP登录同一账号同样需要等待
+	resp, retryAfter := loginFrom(t, r, "198.51.100.1", "alice", "alice-pass-1")
+	if resp.Status != http.StatusTooManyRequests || retryAfter == "" {
+		t.Fatalf("status = %d %s, Retry-After %q, want 429", resp.Status, resp.Message, retryAfter)
+	}
+	var lockouts int64
+	config.DB.Model(&models.LoginLockout{}).Count(&lockouts)
+	if lockouts != 0 {
+		t.Errorf("lockouts = %d, want 0", lockouts)
+	}
+}
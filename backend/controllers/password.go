@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// passwordResetInterval 同一用户两次申请重置密码的最小间隔
+const passwordResetInterval = time.Minute
+
+// setUserPassword 修改用户密码并撤销其全部会话
+func setUserPassword(tx *gorm.DB, userID uint, password string, mustChange bool) error {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":             hashed,
+		"must_change_password": mustChange,
+		"password_changed_at":  time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	return revokeUserSessions(tx, userID)
+}
+
+// GetPasswordPolicy 获取密码强度策略
+func GetPasswordPolicy(c *gin.Context) {
+	utils.SuccessResponse(c, utils.GetPasswordPolicy())
+}
+
+// ChangePassword 修改当前用户的密码，其他设备的登录会话全部失效，返回当前设备的新令牌
+func ChangePassword(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "用户不存在")
+		return
+	}
+	if user.AuthProvider != models.AuthProviderLocal {
+		utils.ErrorResponse(c, 400, "该账号通过外部身份登录，请在身份提供方修改密码")
+		return
+	}
+
+	if !utils.CheckPasswordHash(req.CurrentPassword, user.Password) {
+		utils.ErrorResponse(c, 400, "当前密码错误")
+		return
+	}
+	if utils.CheckPasswordHash(req.NewPassword, user.Password) {
+		utils.ErrorResponse(c, 400, "新密码不能与当前密码相同")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setUserPassword(tx, user.ID, req.NewPassword, false)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "密码修改失败")
+		return
+	}
+
+	// 重新加载用户以获取新的令牌版本
+	config.DB.First(&user, user.ID)
+	resp, err := issueSession(c, &user)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+
+	utils.SuccessResponse(c, resp)
+}
+
+// ForgotPassword 申请重置密码，向注册邮箱发送重置链接
+// 无论邮箱是否存在都返回相同结果，避免泄露注册信息
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	response := gin.H{"message": "如果该邮箱已注册，重置密码的链接将发送到该邮箱"}
+
+	// 外部身份登录的账号没有本地密码
+	var user models.User
+	if err := config.DB.Where("email = ? AND auth_provider = ?", req.Email, models.AuthProviderLocal).First(&user).Error; err != nil {
+		utils.SuccessResponse(c, response)
+		return
+	}
+
+	var recent int64
+	config.DB.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-passwordResetInterval)).
+		Count(&recent)
+	if recent > 0 {
+		utils.SuccessResponse(c, response)
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成重置链接失败")
+		return
+	}
+
+	// 新的重置令牌生成后，之前未使用的令牌失效
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("expires_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: now.Add(config.PasswordResetTTL),
+			IP:        c.ClientIP(),
+		}).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成重置链接失败")
+		return
+	}
+
+	msg := utils.MailMessage{
+		To:      user.Email,
+		Subject: "重置密码",
+		Body: fmt.Sprintf("%s，您好：\n\n我们收到了重置您账号密码的申请，请在 %d 分钟内打开以下链接设置新密码：\n\n%s\n\n如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。\n",
+			user.Username, int(config.PasswordResetTTL/time.Minute),
+			strings.ReplaceAll(config.PasswordResetURL, "{token}", token)),
+	}
+	go func() {
+		if err := utils.SendMail(msg); err != nil {
+			log.Printf("发送重置密码邮件失败: %v", err)
+		}
+	}()
+
+	utils.SuccessResponse(c, response)
+}
+
+// ResetPassword 使用重置令牌设置新密码，令牌只能使用一次
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var reset models.PasswordReset
+	if err := config.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+		First(&reset).Error; err != nil {
+		utils.ErrorResponse(c, 400, "重置链接无效或已过期")
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, reset.UserID).Error; err != nil || user.AuthProvider != models.AuthProviderLocal {
+		utils.ErrorResponse(c, 400, "重置链接无效或已过期")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	errTokenUsed := fmt.Errorf("token used")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTokenUsed
+		}
+		return setUserPassword(tx, user.ID, req.NewPassword, false)
+	})
+	if err != nil {
+		if err == errTokenUsed {
+			utils.ErrorResponse(c, 400, "重置链接无效或已过期")
+			return
+		}
+		utils.ServerErrorResponse(c, "密码重置失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// SetUserPasswordByAdmin 为用户设置新密码（管理员功能），默认要求用户登录后修改
+func SetUserPasswordByAdmin(c *gin.Context) {
+	var req struct {
+		NewPassword string `json:"new_password" binding:"required"`
+		MustChange  *bool  `json:"must_change"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用户不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		return
+	}
+	if user.AuthProvider != models.AuthProviderLocal {
+		utils.ErrorResponse(c, 400, "该账号通过外部身份登录，不能设置本地密码")
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	mustChange := req.MustChange == nil || *req.MustChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setUserPassword(tx, user.ID, req.NewPassword, mustChange)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "密码修改失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "密码已修改"})
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureMailer 将发送的邮件写入通道，用于测试
+type captureMailer chan utils.MailMessage
+
+// Send 实现Mailer接口
+func (m captureMailer) Send(msg utils.MailMessage) error {
+	m <- msg
+	return nil
+}
+
+// useCaptureMailer 临时替换邮件发送驱动
+func useCaptureMailer(t *testing.T) captureMailer {
+	t.Helper()
+	mailer := make(captureMailer, 10)
+	utils.SetMailer(mailer)
+	t.Cleanup(func() { utils.SetMailer(utils.LogMailer{}) })
+	return mailer
+}
+
+// newPasswordRouter 注册登录、修改密码和重置密码接口，以及一个需要先修改密码的接口
+func newPasswordRouter() *gin.Engine {
+	r := newTestRouter()
+	r.POST("/api/auth/login", Login)
+	r.POST("/api/auth/password/forgot", ForgotPassword)
+	r.POST("/api/auth/password/reset", ResetPassword)
+	protected := r.Group("/api", middlewares.AuthMiddleware(), middlewares.SessionOnly())
+	protected.GET("/auth/sessions", GetUserSessions)
+	protected.GET("/users/profile", GetUserProfile)
+	protected.PUT("/users/password", ChangePassword)
+	return r
+}
+
+var resetTokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestPasswordResetFlow(t *testing.T) {
+	useAccountDB(t)
+	mailer := useCaptureMailer(t)
+	r := newPasswordRouter()
+
+	user := createTestUser(t, "alice", models.RoleUser, "old-pass-1")
+	oldToken, _ := loginAs(t, user)
+
+	// 未注册的邮箱返回相同结果，不生成重置令牌
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/forgot", "", gin.H{"email": "nobody@example.com"}); resp.Status != http.StatusOK {
+		t.Fatalf("forgot unknown: %d %s", resp.Status, resp.Message)
+	}
+	var count int64
+	config.DB.Model(&models.PasswordReset{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("reset rows = %d, want 0", count)
+	}
+
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/forgot", "", gin.H{"email": "alice@example.com"}); resp.Status != http.StatusOK {
+		t.Fatalf("forgot: %d %s", resp.Status, resp.Message)
+	}
+	var msg utils.MailMessage
+	select {
+	case msg = <-mailer:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reset mail not sent")
+	}
+	match := resetTokenPattern.FindStringSubmatch(msg.Body)
+	if msg.To != "alice@example.com" || match == nil {
+		t.Fatalf("mail = %+v", msg)
+	}
+	token := match[1]
+
+	// 短时间内重复申请不再生成新令牌
+	doRequest(t, r, http.MethodPost, "/api/auth/password/forgot", "", gin.H{"email": "alice@example.com"})
+	config.DB.Model(&models.PasswordReset{}).Count(&count)
+	if count != 1 {
+		t.Errorf("reset rows after repeated request = %d, want 1", count)
+	}
+
+	// 不符合密码策略时令牌不会被使用
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/reset", "", gin.H{"token": token, "new_password": "short"}); resp.Status != http.StatusBadRequest {
+		t.Fatalf("weak password: status = %d, want 400", resp.Status)
+	}
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/reset", "", gin.H{"token": token, "new_password": "new-pass-2"}); resp.Status != http.StatusOK {
+		t.Fatalf("reset: %d %s", resp.Status, resp.Message)
+	}
+
+	// 令牌只能使用一次
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/reset", "", gin.H{"token": token, "new_password": "other-pass-3"}); resp.Status != http.StatusBadRequest {
+		t.Errorf("reuse: status = %d, want 400", resp.Status)
+	}
+
+	// 重置后原有会话失效，新密码可以登录，旧密码不能登录
+	if resp := doRequest(t, r, http.MethodGet, "/api/users/profile", oldToken, nil); resp.Status != http.StatusUnauthorized {
+		t.Errorf("old session: status = %d, want 401", resp.Status)
+	}
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/login", "", gin.H{"username": "alice", "password": "old-pass-1"}); resp.Status == http.StatusOK {
+		t.Error("old password still accepted")
+	}
+	if resp := doRequest(t, r, http.MethodPost, "/api/auth/login", "", gin.H{"username": "alice", "password": "new-pass-2"}); resp.Status != http.StatusOK {
+		t.Errorf("login with new password: %d %s", resp.Status, resp.Message)
+	}
+}
+
+func TestResetPasswordToken(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		expiresAt  time.Time
+		usedAt     *time.Time
+		provider   string
+		wantStatus int
+	}{
+		{"有效令牌", now.Add(time.Minute), nil, models.AuthProviderLocal, http.StatusOK},
+		{"已过期", now.Add(-time.Second), nil, models.AuthProviderLocal, http.StatusBadRequest},
+		{"已使用", now.Add(time.Minute), &now, models.AuthProviderLocal, http.StatusBadRequest},
+		{"账号已改为外部身份登录", now.Add(time.Minute), nil, models.AuthProviderOIDC, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccountDB(t)
+			r := newPasswordRouter()
+
+			user := createTestUser(t, "bob", models.RoleUser, "old-pass-1")
+			config.DB.Model(user).Update("auth_provider", tt.provider)
+			config.DB.Create(&models.PasswordReset{UserID: user.ID, TokenHash: utils.HashToken("reset-token"), ExpiresAt: tt.expiresAt, UsedAt: tt.usedAt})
+
+			resp := doRequest(t, r, http.MethodPost, "/api/auth/password/reset", "", gin.H{"token": "reset-token", "new_password": "new-pass-2"})
+			if resp.Status != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", resp.Status, resp.Message, tt.wantStatus)
+			}
+
+			var saved models.User
+			config.DB.First(&saved, user.ID)
+			if changed := utils.CheckPasswordHash("new-pass-2", saved.Password); changed != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("password changed = %v", changed)
+			}
+		})
+	}
+
+	t.Run("新令牌生成后旧令牌失效", func(t *testing.T) {
+		useAccountDB(t)
+		mailer := useCaptureMailer(t)
+		r := newPasswordRouter()
+		user := createTestUser(t, "carol", models.RoleUser, "old-pass-1")
+		config.DB.Create(&models.PasswordReset{UserID: user.ID, TokenHash: utils.HashToken("first-token"),
+			ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-2 * passwordResetInterval)})
+
+		doRequest(t, r, http.MethodPost, "/api/auth/password/forgot", "", gin.H{"email": "carol@example.com"})
+		select {
+		case <-mailer:
+		case <-time.After(2 * time.Second):
+			t.Fatal("reset mail not sent")
+		}
+		if resp := doRequest(t, r, http.MethodPost, "/api/auth/password/reset", "", gin.H{"token": "first-token", "new_password": "new-pass-2"}); resp.Status != http.StatusBadRequest {
+			t.Errorf("superseded token: status = %d, want 400", resp.Status)
+		}
+	})
+}
+
+func TestDefaultAdminMustChangePassword(t *testing.T) {
+	useAccountDB(t)
+	r := newPasswordRouter()
+
+	admin := createTestUser(t, "admin", models.RoleAdmin, "admin123")
+	config.DB.Model(admin).Update("must_change_password", true)
+
+	resp := doRequest(t, r, http.MethodPost, "/api/auth/login", "", gin.H{"username": "admin", "password": "admin123"})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("login: %d %s", resp.Status, resp.Message)
+	}
+	var login models.LoginResponse
+	resp.decode(t, &login)
+	if !login.User.MustChangePassword {
+		t.Error("login response does not ask for a password change")
+	}
+
+	// 修改密码前只能访问允许的接口
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", login.Token, nil); resp.Status != http.StatusForbidden {
+		t.Errorf("sessions before change: status = %d, want 403", resp.Status)
+	}
+	if resp := doRequest(t, r, http.MethodGet, "/api/users/profile", login.Token, nil); resp.Status != http.StatusOK {
+		t.Errorf("profile before change: status = %d, want 200", resp.Status)
+	}
+
+	changes := []struct {
+		name       string
+		current    string
+		next       string
+		wantStatus int
+	}{
+		{"当前密码错误", "wrong", "N3w-secret-pass", http.StatusBadRequest},
+		{"与当前密码相同", "admin123", "admin123", http.StatusBadRequest},
+		{"不符合密码策略", "admin123", "short", http.StatusBadRequest},
+		{"包含用户名", "admin123", "N3w-admin-pass", http.StatusBadRequest},
+		{"修改成功", "admin123", "N3w-secret-pass", http.StatusOK},
+	}
+	for _, tt := range changes {
+		resp = doRequest(t, r, http.MethodPut, "/api/users/password", login.Token, gin.H{"current_password": tt.current, "new_password": tt.next})
+		if resp.Status != tt.wantStatus {
+			t.Fatalf("%s: status = %d %s, want %d", tt.name, resp.Status, resp.Message, tt.wantStatus)
+		}
+	}
+	var changed models.LoginResponse
+	resp.decode(t, &changed)
+
+	// 修改后旧令牌失效，新令牌可以访问全部接口
+	if resp := doRequest(t, r, http.MethodGet, "/api/users/profile", login.Token, nil); resp.Status != http.StatusUnauthorized {
+		t.Errorf("old token: status = %d, want 401", resp.Status)
+	}
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", changed.Token, nil); resp.Status != http.StatusOK {
+		t.Errorf("sessions after change: status = %d %s, want 200", resp.Status, resp.Message)
+	}
+	var saved models.User
+	config.DB.First(&saved, admin.ID)
+	if saved.MustChangePassword {
+		t.Error("must_change_password still set")
+	}
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentPermissions 当前用户的权限，由 AuthMiddleware 写入上下文
+func currentPermissions(c *gin.Context) models.PermissionSet {
+	value, _ := c.Get("permissions")
+	permissions, _ := value.(models.PermissionSet)
+	return permissions
+}
+
+// hasPermission 当前用户是否拥有权限
+func hasPermission(c *gin.Context, permission string) bool {
+	return currentPermissions(c).Has(permission)
+}
+
+// canManageRole 检查当前用户是否拥有角色的全部权限，不能管理或授予权限高于自己的角色
+// 检查失败时直接写入错误响应
+func canManageRole(c *gin.Context, roleName string) bool {
+	if !currentPermissions(c).Covers(config.RolePermissions(roleName)) {
+		utils.ForbiddenResponse(c, "不能管理权限高于自己的用户或角色")
+		return false
+	}
+	return true
+}
+
+// rolePermissionCache 后台任务中按角色名缓存权限，避免重复查询
+type rolePermissionCache map[string]models.PermissionSet
+
+// has 角色是否拥有权限
+func (cache rolePermissionCache) has(role, permission string) bool {
+	permissions, ok := cache[role]
+	if !ok {
+		permissions = config.RolePermissions(role)
+		cache[role] = permissions
+	}
+	return permissions.Has(permission)
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// roleNamePattern 角色名只能包含小写字母、数字、下划线和连字符
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,19}$`)
+
+// roleRequest 创建、修改角色的请求
+type roleRequest struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name" binding:"max=100"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// findRole 按路径参数查找角色，查找失败时直接写入错误响应
+func findRole(c *gin.Context) (*models.Role, bool) {
+	var role models.Role
+	if err := config.DB.First(&role, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "角色不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	return &role, true
+}
+
+// rolePermissionsJSON 校验权限列表，只能授予当前用户自己拥有的权限，校验失败时直接写入错误响应
+func rolePermissionsJSON(c *gin.Context, permissions []string) (models.JSON, bool) {
+	permissions = uniqueStrings(permissions)
+	granted := make(models.PermissionSet, len(permissions))
+	for _, permission := range permissions {
+		valid := false
+		for _, p := range models.Permissions {
+			valid = valid || p.Name == permission
+		}
+		if !valid {
+			utils.ErrorResponse(c, 400, "不支持的权限: "+permission)
+			return nil, false
+		}
+		granted[permission] = true
+	}
+	if !currentPermissions(c).Covers(granted) {
+		utils.ForbiddenResponse(c, "不能授予自己没有的权限")
+		return nil, false
+	}
+
+	data, _ := json.Marshal(permissions)
+	return models.JSON(data), true
+}
+
+// GetPermissions 获取全部可分配的权限
+func GetPermissions(c *gin.Context) {
+	utils.SuccessResponse(c, models.Permissions)
+}
+
+// GetMyPermissions 获取当前用户拥有的权限
+func GetMyPermissions(c *gin.Context) {
+	role, _ := c.Get("role")
+	permissions := currentPermissions(c)
+
+	list := make([]string, 0, len(models.Permissions))
+	for _, p := range models.Permissions {
+		if permissions.Has(p.Name) {
+			list = append(list, p.Name)
+		}
+	}
+
+	utils.SuccessResponse(c, gin.H{"role": role, "permissions": list})
+}
+
+// GetRoles 获取角色列表及各角色的用户数
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := config.DB.Order("id ASC").Find(&roles).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	var counts []struct {
+		Role  string
+		Count int64
+	}
+	config.DB.Model(&models.User{}).Select("role, COUNT(*) AS count").Group("role").Scan(&counts)
+	for i := range roles {
+		for _, count := range counts {
+			if count.Role == roles[i].Name {
+				roles[i].UserCount = count.Count
+			}
+		}
+	}
+
+	utils.SuccessResponse(c, roles)
+}
+
+// CreateRole 创建自定义角色
+func CreateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if !roleNamePattern.MatchString(req.Name) {
+		utils.ErrorResponse(c, 400, "角色名只能包含小写字母、数字、下划线和连字符，以字母开头，长度2-20")
+		return
+	}
+	var count int64
+	config.DB.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "角色名已存在")
+		return
+	}
+
+	permissions, ok := rolePermissionsJSON(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := config.DB.Create(&role).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建角色失败")
+		return
+	}
+
+	utils.SuccessResponse(c, role)
+}
+
+// UpdateRole 修改角色的显示名称、说明和权限，角色名不能修改
+// 权限修改后立即对使用该角色的用户生效
+func UpdateRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.Name != "" && req.Name != role.Name {
+		utils.ErrorResponse(c, 400, "角色名不能修改")
+		return
+	}
+	if !canManageRole(c, role.Name) {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"display_name": req.DisplayName,
+		"description":  req.Description,
+	}
+	if req.Permissions != nil {
+		if role.Name == models.RoleAdmin {
+			utils.ForbiddenResponse(c, "内置管理员角色的权限不能修改")
+			return
+		}
+		permissions, ok := rolePermissionsJSON(c, req.Permissions)
+		if !ok {
+			return
+		}
+		updates["permissions"] = permissions
+	}
+
+	if err := config.DB.Model(role).Updates(updates).Error; err != nil {
+		utils.ServerErrorResponse(c, "修改角色失败")
+		return
+	}
+
+	config.DB.First(role, role.ID)
+	utils.SuccessResponse(c, role)
+}
+
+// DeleteRole 删除自定义角色，内置角色和仍有用户使用的角色不能删除
+func DeleteRole(c *gin.Context) {
+	role, ok := findRole(c)
+	if !ok {
+		return
+	}
+
+	if role.IsSystem {
+		utils.ForbiddenResponse(c, "内置角色不能删除")
+		return
+	}
+	if !canManageRole(c, role.Name) {
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "仍有用户使用该角色，请先为这些用户更换角色")
+		return
+	}
+
+	if err := config.DB.Delete(role).Error; err != nil {
+		utils.ServerErrorResponse(c, "删除角色失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "角色已删除"})
+}
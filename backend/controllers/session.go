@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sessionResponse 会话列表项
+type sessionResponse struct {
+	models.UserSession
+	Current bool `json:"current"`
+}
+
+// issueSession 创建登录会话，返回访问令牌和刷新令牌
+func issueSession(c *gin.Context, user *models.User) (*models.LoginResponse, error) {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.UserSession{
+		UserID:           user.ID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        truncateString(c.Request.UserAgent(), 255),
+		IP:               c.ClientIP(),
+		ExpiresAt:        now.Add(utils.RefreshTokenTTL),
+		LastUsedAt:       now,
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role, session.ID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL / time.Second),
+		User:         *user,
+
+		TwoFactorSetupRequired: config.TwoFactorRequired(user.Role) && !user.TwoFactorEnabled,
+	}, nil
+}
+
+// revokeUserSessions 撤销用户的全部会话并递增令牌版本，已签发的访问令牌立即失效
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.UserSession{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+// 已轮换的旧刷新令牌再次使用时视为泄露，撤销整个会话
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	hash := utils.HashToken(req.RefreshToken)
+
+	var session models.UserSession
+	if err := config.DB.Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			utils.ServerErrorResponse(c, "数据库查询失败")
+			return
+		}
+		config.DB.Model(&models.UserSession{}).
+			Where("previous_token_hash = ? AND revoked_at IS NULL", hash).
+			Update("revoked_at", time.Now())
+		utils.UnauthorizedResponse(c, "刷新令牌无效")
+		return
+	}
+	if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		utils.UnauthorizedResponse(c, "会话已失效，请重新登录")
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, session.UserID).Error; err != nil {
+		utils.UnauthorizedResponse(c, "用户不存在")
+		return
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+
+	// 按原令牌条件更新，同一刷新令牌并发使用时只有一个请求成功
+	now := time.Now()
+	result := config.DB.Model(&models.UserSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  utils.HashToken(refreshToken),
+			"previous_token_hash": hash,
+			"expires_at":          now.Add(utils.RefreshTokenTTL),
+			"last_used_at":        now,
+			"ip":                  c.ClientIP(),
+		})
+	if result.Error != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.UnauthorizedResponse(c, "刷新令牌无效")
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role, session.ID, user.TokenVersion)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+
+	utils.SuccessResponse(c, models.LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL / time.Second),
+		User:         user,
+	})
+}
+
+// Logout 退出登录，撤销当前会话
+func Logout(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+
+	if err := config.DB.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		utils.ServerErrorResponse(c, "退出登录失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已退出登录"})
+}
+
+// LogoutAll 退出全部设备，撤销当前用户的全部会话
+func LogoutAll(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID.(uint))
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "退出登录失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已退出全部设备"})
+}
+
+// GetUserSessions 获取当前用户的有效会话
+func GetUserSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+
+	var sessions []models.UserSession
+	if err := config.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	list := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, sessionResponse{UserSession: session, Current: session.ID == sessionID})
+	}
+
+	utils.SuccessResponse(c, list)
+}
+
+// RevokeUserSession 撤销当前用户的指定会话
+func RevokeUserSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	result := config.DB.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		utils.ServerErrorResponse(c, "撤销失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.NotFoundResponse(c, "会话不存在")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "会话已撤销"})
+}
+
+// RevokeUserSessionsByAdmin 撤销指定用户的全部会话（管理员功能）
+func RevokeUserSessionsByAdmin(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用户不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "撤销失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已撤销该用户的全部会话"})
+}
+
+// GetJWKS 公开访问令牌的验证公钥(JWK Set格式)，使用HS256时为空列表
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, utils.JWKS())
+}
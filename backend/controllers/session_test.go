@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSessionRouter 注册刷新令牌和会话接口
+func newSessionRouter() *gin.Engine {
+	r := newTestRouter()
+	r.POST("/api/auth/refresh", RefreshToken)
+	protected := r.Group("/api", middlewares.AuthMiddleware(), middlewares.SessionOnly())
+	protected.GET("/auth/sessions", GetUserSessions)
+	return r
+}
+
+// refresh 使用刷新令牌换取新令牌
+func refresh(t *testing.T, r http.Handler, refreshToken string) (*testResponse, models.LoginResponse) {
+	t.Helper()
+	resp := doRequest(t, r, http.MethodPost, "/api/auth/refresh", "", gin.H{"refresh_token": refreshToken})
+	var login models.LoginResponse
+	if resp.Status == http.StatusOK {
+		resp.decode(t, &login)
+	}
+	return resp, login
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	useAccountDB(t)
+	r := newSessionRouter()
+	user := createTestUser(t, "alice", models.RoleUser, "secret-pass")
+	_, first := loginAs(t, user)
+
+	resp, rotated := refresh(t, r, first)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("refresh: %d %s", resp.Status, resp.Message)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == first {
+		t.Fatal("refresh token was not rotated")
+	}
+
+	// 轮换沿用同一个会话
+	var sessions []models.UserSession
+	config.DB.Where("user_id = ?", user.ID).Find(&sessions)
+	if len(sessions) != 1 || sessions[0].PreviousTokenHash == "" {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+
+	resp, second := refresh(t, r, rotated.RefreshToken)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("second refresh: %d %s", resp.Status, resp.Message)
+	}
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", second.Token, nil); resp.Status != http.StatusOK {
+		t.Errorf("new access token: status = %d %s", resp.Status, resp.Message)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	useAccountDB(t)
+	r := newSessionRouter()
+	user := createTestUser(t, "alice", models.RoleUser, "secret-pass")
+	_, stolen := loginAs(t, user)
+	other, otherRefresh := loginAs(t, user)
+
+	resp, rotated := refresh(t, r, stolen)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("refresh: %d %s", resp.Status, resp.Message)
+	}
+
+	// 已轮换的刷新令牌再次使用，视为泄露并撤销该会话
+	if resp, _ := refresh(t, r, stolen); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("reuse: status = %d, want 401", resp.Status)
+	}
+	if resp, _ := refresh(t, r, rotated.RefreshToken); resp.Status != http.StatusUnauthorized {
+		t.Errorf("rotated token after reuse: status = %d, want 401", resp.Status)
+	}
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", rotated.Token, nil); resp.Status != http.StatusUnauthorized {
+		t.Errorf("access token after reuse: status = %d, want 401", resp.Status)
+	}
+
+	// 同一用户的其他会话不受影响
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", other, nil); resp.Status != http.StatusOK {
+		t.Errorf("other session: status = %d %s", resp.Status, resp.Message)
+	}
+	if resp, _ := refresh(t, r, otherRefresh); resp.Status != http.StatusOK {
+		t.Errorf("other refresh: status = %d %s", resp.Status, resp.Message)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(session *models.UserSession)
+	}{
+		{"未知令牌", nil},
+		{"会话已过期", func(s *models.UserSession) {
+			config.DB.Model(s).Update("expires_at", time.Now().Add(-time.Second))
+		}},
+		{"会话已撤销", func(s *models.UserSession) {
+			config.DB.Model(s).Update("revoked_at", time.Now())
+		}},
+		{"用户已删除", func(s *models.UserSession) {
+			config.DB.Delete(&models.User{}, s.UserID)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccountDB(t)
+			r := newSessionRouter()
+			user := createTestUser(t, "alice", models.RoleUser, "secret-pass")
+			_, refreshToken := loginAs(t, user)
+
+			if tt.setup == nil {
+				refreshToken = "unknown-token"
+			} else {
+				var session models.UserSession
+				config.DB.Where("user_id = ?", user.ID).First(&session)
+				tt.setup(&session)
+			}
+			if resp, _ := refresh(t, r, refreshToken); resp.Status != http.StatusUnauthorized {
+				t.Errorf("status = %d %s, want 401", resp.Status, resp.Message)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenConcurrentUse(t *testing.T) {
+	useAccountDB(t)
+	r := newSessionRouter()
+	user := createTestUser(t, "alice", models.RoleUser, "secret-pass")
+	_, refreshToken := loginAs(t, user)
+
+	// 同一刷新令牌并发使用时只有一个请求换到新令牌
+	const workers = 5
+	var wg sync.WaitGroup
+	statuses := make(chan int, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := refresh(t, r, refreshToken)
+			statuses <- resp.Status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d, want 1", succeeded)
+	}
+}
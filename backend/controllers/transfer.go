@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// transferRequest 转移资源归属的请求，user_id 和 group_id 至少指定一个
+// 未指定的一项保持不变，group_id 为 0 时移出用户组成为个人资源
+type transferRequest struct {
+	UserID  *uint `json:"user_id"`
+	GroupID *uint `json:"group_id"`
+}
+
+// resolveTransfer 校验转移目标，返回转移后的所有者和用户组，校验失败时直接写入错误响应
+// 转移到用户组时当前用户必须是目标组的成员，用户组的资源转移给个人时目标用户必须是组成员
+func resolveTransfer(c *gin.Context, req *transferRequest, ownerID uint, groupID *uint) (uint, *uint, bool) {
+	if req.UserID == nil && req.GroupID == nil {
+		utils.ErrorResponse(c, 400, "请指定转移的目标用户或用户组")
+		return 0, nil, false
+	}
+
+	if req.GroupID != nil {
+		groupID = nil
+		if *req.GroupID != 0 {
+			if !checkGroupMember(c, *req.GroupID) {
+				return 0, nil, false
+			}
+			groupID = req.GroupID
+		}
+	}
+
+	if req.UserID != nil {
+		var count int64
+		config.DB.Model(&models.User{}).Where("id = ?", *req.UserID).Count(&count)
+		if count == 0 {
+			utils.ErrorResponse(c, 400, "目标用户不存在")
+			return 0, nil, false
+		}
+		ownerID = *req.UserID
+	}
+
+	if groupID != nil && groupMemberRole(*groupID, ownerID) == "" {
+		utils.ErrorResponse(c, 400, "目标用户不是该用户组的成员")
+		return 0, nil, false
+	}
+
+	return ownerID, groupID, true
+}
+
+// TransferFile 转移文件的所有者或归属的用户组
+// 分类属于其他用户组时同时清除文件的分类
+func TransferFile(c *gin.Context) {
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var file models.File
+	query := config.DB.Where("id = ? AND is_deleted = ?", c.Param("id"), false)
+
+	// 只能转移自己的个人文件和担任组管理员的用户组的文件，访问控制条目不能授予转移权限
+	query = scopeFiles(c, query, fileAccessOwner)
+
+	if err := query.Preload("Category").First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "文件不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+
+	ownerID, groupID, ok := resolveTransfer(c, &req, file.UserID, file.GroupID)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"user_id":  ownerID,
+		"group_id": groupID,
+	}
+	if file.Category != nil && file.Category.GroupID != nil && (groupID == nil || *file.Category.GroupID != *groupID) {
+		updates["category_id"] = nil
+	}
+
+	if err := config.DB.Model(&file).Updates(updates).Error; err != nil {
+		utils.ServerErrorResponse(c, "转移失败")
+		return
+	}
+
+	config.DB.Preload("User").Preload("Category").Preload("Group").Preload("Tags").First(&file, file.ID)
+
+	utils.SuccessResponse(c, file)
+}
+
+// TransferCategory 转移分类及其子分类归属的用户组，group_id 为 0 时成为公共分类
+// 转移到用户组需要是目标组的组管理员；上级分类不属于目标组时转移后成为根分类
+func TransferCategory(c *gin.Context) {
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.GroupID == nil {
+		utils.ErrorResponse(c, 400, "请指定转移的目标用户组")
+		return
+	}
+
+	var category models.Category
+	if err := scopeCategories(c, config.DB).First(&category, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "分类不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if !checkCategoryGroupAdmin(c, &category) {
+		return
+	}
+
+	var groupID *uint
+	if *req.GroupID != 0 {
+		if !checkGroupMember(c, *req.GroupID) {
+			return
+		}
+		if !isGroupAdmin(c, *req.GroupID) {
+			utils.ForbiddenResponse(c, "只有组管理员可以将分类转移到用户组")
+			return
+		}
+		groupID = req.GroupID
+	}
+
+	ids, err := categoryTreeIDs([]uint{category.ID})
+	if err != nil {
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Category{}).Where("id IN ?", ids).Update("group_id", groupID).Error; err != nil {
+			return err
+		}
+		if category.ParentID == nil {
+			return nil
+		}
+		var parent models.Category
+		if err := tx.First(&parent, *category.ParentID).Error; err != nil {
+			return err
+		}
+		if parent.GroupID == nil || groupID != nil && *parent.GroupID == *groupID {
+			return nil
+		}
+		return tx.Model(&category).Update("parent_id", nil).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "转移失败")
+		return
+	}
+
+	config.DB.Preload("Parent").First(&category, category.ID)
+
+	utils.SuccessResponse(c, category)
+}
+
+// TransferFormSchema 转移表单的所有者或归属的用户组，需要是表单所有者
+func TransferFormSchema(c *gin.Context) {
+	var req transferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema, ok := findAccessibleSchema(c, c.Param("id"), models.FormRoleOwner)
+	if !ok {
+		return
+	}
+
+	ownerID, groupID, ok := resolveTransfer(c, &req, schema.UserID, schema.GroupID)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(schema).Updates(map[string]interface{}{
+			"user_id":  ownerID,
+			"group_id": groupID,
+		}).Error; err != nil {
+			return err
+		}
+		// 新所有者不再需要单独的共享设置
+		return tx.Where("schema_id = ? AND user_id = ?", schema.ID, ownerID).Delete(&models.FormShare{}).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "转移失败")
+		return
+	}
+
+	var updated models.FormSchema
+	config.DB.Preload("User").Preload("Group").First(&updated, schema.ID)
+	perm, _ := loadFormPermission(&updated, schema.Permission.UserID, hasPermission(c, models.PermFormManageAny))
+	updated.Permission = perm
+
+	utils.SuccessResponse(c, visibleSchema(updated))
+}
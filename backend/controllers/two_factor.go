@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorRecoveryCodeCount = 10 // 每次生成的恢复码数量
+	twoFactorMaxAttempts       = 5  // 同一登录请求允许输错验证码的次数
+)
+
+// verifyTwoFactorCode 校验验证码或恢复码，验证码和恢复码都只能使用一次
+func verifyTwoFactorCode(userID uint, code string, allowRecovery bool) (bool, error) {
+	code = utils.NormalizeOTPCode(code)
+
+	var setting models.UserTwoFactor
+	if err := config.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&setting).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if utils.IsTOTPCode(code) {
+		step, ok := utils.ValidateTOTP(setting.Secret, code, time.Now(), setting.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		// 按时间窗口条件更新，并发请求中同一验证码只有一次有效
+		result := config.DB.Model(&models.UserTwoFactor{}).
+			Where("id = ? AND last_used_step < ?", setting.ID, step).
+			Update("last_used_step", step)
+		return result.RowsAffected > 0, result.Error
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+	result := config.DB.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// replaceRecoveryCodes 生成新的恢复码，原有恢复码全部失效
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(twoFactorRecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	records := make([]models.TwoFactorRecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, models.TwoFactorRecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeOTPCode(code)),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// deleteTwoFactor 删除用户的两步验证设置、恢复码和未完成的登录请求
+func deleteTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.UserTwoFactor{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.LoginChallenge{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).Update("two_factor_enabled", false).Error
+}
+
+// confirmAccountOwner 修改两步验证设置前确认是账号本人，失败时写入错误响应
+// 本地账号需要输入密码；外部身份账号没有本地密码，要求当前会话是最近登录的
+func confirmAccountOwner(c *gin.Context, user *models.User, password string) bool {
+	if user.AuthProvider == models.AuthProviderLocal {
+		if password == "" || !utils.CheckPasswordHash(password, user.Password) {
+			utils.ErrorResponse(c, 400, "密码错误")
+			return false
+		}
+		return true
+	}
+
+	sessionID, _ := c.Get("session_id")
+	var session models.UserSession
+	if err := config.DB.Select("id", "user_id", "created_at").First(&session, sessionID).Error; err != nil ||
+		session.UserID != user.ID || time.Since(session.CreatedAt) > config.TwoFactorReauthWindow {
+		utils.ForbiddenResponse(c, "请重新登录后再设置两步验证")
+		return false
+	}
+	return true
+}
+
+// startTwoFactorLogin 密码验证通过后生成登录请求，客户端输入验证码后换取令牌
+func startTwoFactorLogin(c *gin.Context, user *models.User) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		utils.ServerErrorResponse(c, "登录失败")
+		return
+	}
+
+	challenge := models.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		IP:        c.ClientIP(),
+		ExpiresAt: time.Now().Add(config.TwoFactorChallengeTTL),
+	}
+	if err := config.DB.Create(&challenge).Error; err != nil {
+		utils.ServerErrorResponse(c, "登录失败")
+		return
+	}
+
+	utils.SuccessResponse(c, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int64(config.TwoFactorChallengeTTL / time.Second),
+	})
+}
+
+// LoginTwoFactor 输入验证码或恢复码完成登录
+func LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var challenge models.LoginChallenge
+	if err := config.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.ChallengeToken), time.Now()).
+		First(&challenge).Error; err != nil || challenge.Attempts >= twoFactorMaxAttempts {
+		utils.ErrorResponse(c, 400, "验证已过期，请重新登录")
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, challenge.UserID).Error; err != nil {
+		utils.ErrorResponse(c, 400, "验证已过期，请重新登录")
+		return
+	}
+
+	// 验证码输错同样计入登录失败次数
+	ip := c.ClientIP()
+	guardKeys := loginGuardKeys(user.Username, &user, ip)
+	if !checkLoginAllowed(c, guardKeys) {
+		return
+	}
+
+	ok, err := verifyTwoFactorCode(user.ID, req.Code, true)
+	if err != nil {
+		utils.ServerErrorResponse(c, "验证失败")
+		return
+	}
+	if !ok {
+		config.DB.Model(&challenge).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+		recordLoginFailure(guardKeys, ip)
+		utils.ErrorResponse(c, 400, "验证码错误")
+		return
+	}
+
+	// 登录请求只能使用一次
+	result := config.DB.Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil || result.RowsAffected == 0 {
+		utils.ErrorResponse(c, 400, "验证已过期，请重新登录")
+		return
+	}
+	clearLoginFailures(user.ID)
+
+	resp, err := issueSession(c, &user)
+	if err != nil {
+		utils.ServerErrorResponse(c, "Token生成失败")
+		return
+	}
+
+	utils.SuccessResponse(c, resp)
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var setting models.UserTwoFactor
+	enabled := config.DB.Where("user_id = ? AND enabled = ?", userID, true).First(&setting).Error == nil
+
+	var remaining int64
+	config.DB.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&remaining)
+
+	utils.SuccessResponse(c, gin.H{
+		"enabled":                  enabled,
+		"enabled_at":               setting.EnabledAt,
+		"required":                 config.TwoFactorRequired(role.(string)),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor 生成新的TOTP密钥，输入验证码确认后才启用
+// 本地账号需要输入密码，外部身份账号需要最近登录过
+func SetupTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "用户不存在")
+		return
+	}
+	if !confirmAccountOwner(c, &user, req.Password) {
+		return
+	}
+	if user.TwoFactorEnabled {
+		utils.ErrorResponse(c, 400, "已启用两步验证，请先关闭后重新设置")
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成密钥失败")
+		return
+	}
+
+	// 未确认的密钥直接替换
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserTwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserTwoFactor{UserID: user.ID, Secret: secret}).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成密钥失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(config.TwoFactorIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactor 输入身份验证器中的验证码确认启用两步验证，返回恢复码
+// 恢复码只在此时返回一次
+func EnableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var setting models.UserTwoFactor
+	if err := config.DB.Where("user_id = ? AND enabled = ?", userID, false).First(&setting).Error; err != nil {
+		utils.ErrorResponse(c, 400, "请先获取两步验证密钥")
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(setting.Secret, utils.NormalizeOTPCode(req.Code), time.Now(), 0)
+	if !ok {
+		utils.ErrorResponse(c, 400, "验证码错误")
+		return
+	}
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&setting).Updates(map[string]interface{}{
+			"enabled":        true,
+			"enabled_at":     time.Now(),
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", setting.UserID).Update("two_factor_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, setting.UserID)
+		return err
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "启用两步验证失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":        "两步验证已启用，请妥善保存恢复码",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor 关闭两步验证，需要输入验证码，本地账号还需要输入密码
+func DisableTwoFactor(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if config.TwoFactorRequired(role.(string)) {
+		utils.ForbiddenResponse(c, "当前角色必须启用两步验证")
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		utils.NotFoundResponse(c, "用户不存在")
+		return
+	}
+	if !user.TwoFactorEnabled {
+		utils.ErrorResponse(c, 400, "未启用两步验证")
+		return
+	}
+	if user.AuthProvider == models.AuthProviderLocal && !utils.CheckPasswordHash(req.Password, user.Password) {
+		utils.ErrorResponse(c, 400, "密码错误")
+		return
+	}
+
+	ok, err := verifyTwoFactorCode(user.ID, req.Code, true)
+	if err != nil {
+		utils.ServerErrorResponse(c, "验证失败")
+		return
+	}
+	if !ok {
+		utils.ErrorResponse(c, 400, "验证码错误")
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteTwoFactor(tx, user.ID)
+	}); err != nil {
+		utils.ServerErrorResponse(c, "关闭两步验证失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要输入身份验证器中的验证码
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	ok, err := verifyTwoFactorCode(userID.(uint), req.Code, false)
+	if err != nil {
+		utils.ServerErrorResponse(c, "验证失败")
+		return
+	}
+	if !ok {
+		utils.ErrorResponse(c, 400, "验证码错误")
+		return
+	}
+
+	var codes []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID.(uint))
+		return err
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成恢复码失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"recovery_codes": codes})
+}
+
+// ResetTwoFactorByAdmin 重置用户的两步验证（管理员功能），用于用户丢失身份验证器的情况
+// 用户的全部会话同时失效
+func ResetTwoFactorByAdmin(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用户不存在")
+			return
+		}
+		utils.ServerErrorResponse(c, "数据库查询失败")
+		return
+	}
+	if !canManageRole(c, user.Role) {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "重置两步验证失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "已重置两步验证"})
+}
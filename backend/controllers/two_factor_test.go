@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/middlewares"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTwoFactorRouter 注册两步验证接口和一个需要先启用两步验证的接口
+func newTwoFactorRouter() *gin.Engine {
+	r := newTestRouter()
+	auth := r.Group("/api/auth", middlewares.AuthMiddleware(), middlewares.SessionOnly())
+	auth.GET("/sessions", GetUserSessions)
+	auth.GET("/2fa", GetTwoFactorStatus)
+	auth.POST("/2fa/setup", SetupTwoFactor)
+	auth.POST("/2fa/enable", EnableTwoFactor)
+	auth.POST("/2fa/disable", DisableTwoFactor)
+	return r
+}
+
+// requireTwoFactorFor 临时要求角色启用两步验证
+func requireTwoFactorFor(t *testing.T, roles string) {
+	t.Helper()
+	t.Cleanup(config.InitTwoFactor)
+	t.Setenv("TWO_FACTOR_REQUIRED_ROLES", roles)
+	config.InitTwoFactor()
+}
+
+func TestExternalUserEnrollsTwoFactor(t *testing.T) {
+	useAccountDB(t)
+	useIdentityMappings(t, map[string]string{"EXTERNAL_ROLE_MAPPING": "platform-admins=admin"})
+	requireTwoFactorFor(t, models.RoleAdmin)
+	r := newTwoFactorRouter()
+
+	user, err := createExternalUser(config.DB, &utils.ExternalIdentity{
+		Provider: models.AuthProviderOIDC,
+		Subject:  "sub-1",
+		Username: "alice",
+		Email:    "alice@example.com",
+		Groups:   []string{"platform-admins"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleAdmin || user.Password != "" {
+		t.Fatalf("user role = %s, password set = %v", user.Role, user.Password != "")
+	}
+	token, _ := loginAs(t, user)
+
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", token, nil); resp.Status != http.StatusForbidden {
+		t.Fatalf("before enrollment: status = %d, want 403", resp.Status)
+	}
+
+	// 没有本地密码，最近登录的会话可以设置
+	resp := doRequest(t, r, http.MethodPost, "/api/auth/2fa/setup", token, gin.H{})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("setup: %d %s", resp.Status, resp.Message)
+	}
+	var setup struct {
+		Secret string `json:"secret"`
+	}
+	resp.decode(t, &setup)
+
+	resp = doRequest(t, r, http.MethodPost, "/api/auth/2fa/enable", token, gin.H{"code": totpNow(t, setup.Secret)})
+	if resp.Status != http.StatusOK {
+		t.Fatalf("enable: %d %s", resp.Status, resp.Message)
+	}
+	var enabled struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	resp.decode(t, &enabled)
+	if len(enabled.RecoveryCodes) != twoFactorRecoveryCodeCount {
+		t.Errorf("recovery codes = %d, want %d", len(enabled.RecoveryCodes), twoFactorRecoveryCodeCount)
+	}
+
+	if resp := doRequest(t, r, http.MethodGet, "/api/auth/sessions", token, nil); resp.Status != http.StatusOK {
+		t.Errorf("after enrollment: status = %d %s, want 200", resp.Status, resp.Message)
+	}
+}
+
+func TestTwoFactorSetupConfirmsAccountOwner(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     string
+		password     string
+		loginAgo     time.Duration
+		wantStatus   int
+		wantDisabled bool // 随后只输入验证码能否关闭
+	}{
+		{"本地账号输入正确密码", models.AuthProviderLocal, "secret-pass", 0, http.StatusOK, false},
+		{"本地账号密码错误", models.AuthProviderLocal, "wrong", 0, http.StatusBadRequest, false},
+		{"本地账号未输入密码", models.AuthProviderLocal, "", 0, http.StatusBadRequest, false},
+		{"本地账号不受登录时间限制", models.AuthProviderLocal, "secret-pass", time.Hour, http.StatusOK, false},
+		{"外部账号最近登录", models.AuthProviderLDAP, "", time.Minute, http.StatusOK, true},
+		{"外部账号忽略密码字段", models.AuthProviderOIDC, "anything", 0, http.StatusOK, true},
+		{"外部账号登录已久", models.AuthProviderOIDC, "", time.Hour, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccountDB(t)
+			r := newTwoFactorRouter()
+
+			user := createTestUser(t, "bob", models.RoleUser, "secret-pass")
+			if tt.provider != models.AuthProviderLocal {
+				config.DB.Model(user).Updates(map[string]interface{}{"auth_provider": tt.provider, "password": ""})
+			}
+			token, _ := loginAs(t, user)
+			config.DB.Model(&models.UserSession{}).Where("user_id = ?", user.ID).
+				Update("created_at", time.Now().Add(-tt.loginAgo))
+
+			resp := doRequest(t, r, http.MethodPost, "/api/auth/2fa/setup", token, gin.H{"password": tt.password})
+			if resp.Status != tt.wantStatus {
+				t.Fatalf("setup: status = %d %s, want %d", resp.Status, resp.Message, tt.wantStatus)
+			}
+			if resp.Status != http.StatusOK {
+				return
+			}
+
+			var setup struct {
+				Secret string `json:"secret"`
+			}
+			resp.decode(t, &setup)
+			if resp := doRequest(t, r, http.MethodPost, "/api/auth/2fa/enable", token, gin.H{"code": totpNow(t, setup.Secret)}); resp.Status != http.StatusOK {
+				t.Fatalf("enable: %d %s", resp.Status, resp.Message)
+			}
+
+			// 关闭时外部账号只需要验证码，本地账号还需要密码；同一时间窗口的验证码已使用，使用恢复码
+			codes, _ := replaceRecoveryCodes(config.DB, user.ID)
+			resp = doRequest(t, r, http.MethodPost, "/api/auth/2fa/disable", token, gin.H{"code": codes[0]})
+			if disabled := resp.Status == http.StatusOK; disabled != tt.wantDisabled {
+				t.Errorf("disable without password: status = %d %s, want disabled %v", resp.Status, resp.Message, tt.wantDisabled)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"log"
 	"material-platform/config"
 	"material-platform/models"
 	"material-platform/utils"
@@ -12,6 +13,11 @@ import (
 
 // Register 用户注册
 func Register(c *gin.Context) {
+	if !config.LocalRegistrationEnabled {
+		utils.ForbiddenResponse(c, "已关闭本地注册，请使用单点登录或目录账号登录")
+		return
+	}
+
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
@@ -31,6 +37,12 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 检查密码强度
+	if err := utils.ValidatePassword(req.Password, req.Username); err != nil {
+		utils.ErrorResponse(c, 400, err.Error())
+		return
+	}
+
 	// 加密密码
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
@@ -43,7 +55,7 @@ func Register(c *gin.Context) {
 		Username: req.Username,
 		Email:    req.Email,
 		Password: hashedPassword,
-		Role:     "user",
+		Role:     models.RoleUser,
 	}
 
 	if err := config.DB.Create(&user).Error; err != nil {
@@ -51,17 +63,14 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// 生成token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
+	// 创建登录会话
+	resp, err := issueSession(c, &user)
 	if err != nil {
 		utils.ServerErrorResponse(c, "Token生成失败")
 		return
 	}
 
-	utils.SuccessResponse(c, models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	utils.SuccessResponse(c, resp)
 }
 
 // Login 用户登录
@@ -72,34 +81,72 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 查找用户
+	// 查找用户，账号不存在时同样统计失败次数，不提示账号是否存在
 	var user models.User
+	found := true
 	if err := config.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, 400, "用户名或密码错误")
+		if err != gorm.ErrRecordNotFound {
+			utils.ServerErrorResponse(c, "数据库查询失败")
 			return
 		}
-		utils.ServerErrorResponse(c, "数据库查询失败")
+		found = false
+	}
+
+	// 检查登录失败次数
+	ip := c.ClientIP()
+	var guardKeys []loginGuardKey
+	if found {
+		guardKeys = loginGuardKeys(req.Username, &user, ip)
+	} else {
+		guardKeys = loginGuardKeys(req.Username, nil, ip)
+	}
+	if !checkLoginAllowed(c, guardKeys) {
 		return
 	}
 
-	// 验证密码
-	if !utils.CheckPasswordHash(req.Password, user.Password) {
+	// 验证密码：本地账号校验本地密码，LDAP账号和本地不存在的账号(启用LDAP时)由目录服务验证，
+	// OIDC账号只能通过单点登录
+	var identity *utils.ExternalIdentity
+	passed := false
+	switch {
+	case found && user.AuthProvider == models.AuthProviderLocal:
+		passed = utils.CheckPasswordHash(req.Password, user.Password)
+	case config.LDAP != nil && (!found || user.AuthProvider == models.AuthProviderLDAP):
+		username := req.Username
+		if found {
+			username = user.Username
+		}
+		var err error
+		identity, err = config.LDAP.Authenticate(username, req.Password)
+		if err != nil && err != utils.ErrLDAPInvalidCredentials {
+			log.Printf("LDAP验证失败: %v", err)
+			utils.ErrorResponse(c, 503, "目录服务暂时不可用，请稍后重试")
+			return
+		}
+		passed = err == nil
+	default:
+		compareDummyPassword(req.Password)
+	}
+	if !passed {
+		recordLoginFailure(guardKeys, ip)
 		utils.ErrorResponse(c, 400, "用户名或密码错误")
 		return
 	}
 
-	// 生成token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
-	if err != nil {
-		utils.ServerErrorResponse(c, "Token生成失败")
-		return
+	// 目录账号每次登录时同步账号信息、角色和用户组
+	loginUser := &user
+	if identity != nil {
+		var existing *models.User
+		if found {
+			existing = &user
+		}
+		var ok bool
+		if loginUser, ok = provisionExternalUser(c, identity, existing); !ok {
+			return
+		}
 	}
 
-	utils.SuccessResponse(c, models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	completeLogin(c, loginUser)
 }
 
 // GetUserProfile 获取用户个人信息
@@ -194,6 +241,16 @@ func GetAllUsers(c *gin.Context) {
 	utils.PageResponse(c, users, total, page, pageSize)
 }
 
+// isLastAdmin 用户是否为唯一的管理员
+func isLastAdmin(user *models.User) bool {
+	if user.Role != models.RoleAdmin {
+		return false
+	}
+	var count int64
+	config.DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&count)
+	return count <= 1
+}
+
 // UpdateUserByAdmin 管理员更新用户信息
 func UpdateUserByAdmin(c *gin.Context) {
 	userID := c.Param("id")
@@ -207,6 +264,9 @@ func UpdateUserByAdmin(c *gin.Context) {
 		utils.ServerErrorResponse(c, "数据库查询失败")
 		return
 	}
+	if !canManageRole(c, user.Role) {
+		return
+	}
 
 	// 绑定更新数据
 	var updateData struct {
@@ -241,15 +301,40 @@ func UpdateUserByAdmin(c *gin.Context) {
 		user.Email = updateData.Email
 	}
 
-	if updateData.Role != "" {
+	// 角色必须存在且不能高于当前用户的权限，角色变化时撤销该用户的全部会话
+	roleChanged := false
+	if updateData.Role != "" && updateData.Role != user.Role {
+		var count int64
+		config.DB.Model(&models.Role{}).Where("name = ?", updateData.Role).Count(&count)
+		if count == 0 {
+			utils.ErrorResponse(c, 400, "角色不存在")
+			return
+		}
+		if !canManageRole(c, updateData.Role) {
+			return
+		}
+		if isLastAdmin(&user) {
+			utils.ErrorResponse(c, 400, "至少需要保留一个管理员")
+			return
+		}
 		user.Role = updateData.Role
+		roleChanged = true
 	}
 
 	if updateData.Avatar != "" {
 		user.Avatar = updateData.Avatar
 	}
 
-	if err := config.DB.Save(&user).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if roleChanged {
+			return revokeUserSessions(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "用户信息更新失败")
 		return
 	}
@@ -270,8 +355,43 @@ func DeleteUser(c *gin.Context) {
 		utils.ServerErrorResponse(c, "数据库查询失败")
 		return
 	}
+	if !canManageRole(c, user.Role) {
+		return
+	}
+	if isLastAdmin(&user) {
+		utils.ErrorResponse(c, 400, "至少需要保留一个管理员")
+		return
+	}
 
-	if err := config.DB.Delete(&user).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// 同时移除该用户的登录会话、用户组成员关系、表单共享、访问控制条目、审核指派和Webhook
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserSession{}).Error; err != nil {
+			return err
+		}
+		if err := deleteTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.FormShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.FormRecordAssignee{}).Error; err != nil {
+			return err
+		}
+		if err := deleteWebhooks(tx, "user_id", user.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
 		utils.ServerErrorResponse(c, "用户删除失败")
 		return
 	}
@@ -0,0 +1,370 @@
+package controllers
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// userGroupRequest 用户组请求参数
+type userGroupRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description"`
+}
+
+// userGroupMembersRequest 设置用户组成员的请求参数
+// admin_ids 为组管理员，会同时加入成员；为空时保留现有成员的角色
+type userGroupMembersRequest struct {
+	UserIDs  []uint `json:"user_ids"`
+	AdminIDs []uint `json:"admin_ids"`
+}
+
+// groupMemberRequest 组管理员添加成员或修改成员角色的请求参数
+type groupMemberRequest struct {
+	Role string `json:"role"` // member(默认) 或 admin
+}
+
+// findUserGroup 按路径参数查找用户组，查找失败时直接写入错误响应
+func findUserGroup(c *gin.Context) (*models.UserGroup, bool) {
+	var group models.UserGroup
+	if err := config.DB.First(&group, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "用户组不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	return &group, true
+}
+
+// GetUserGroups 获取用户组列表，用于选择共享对象；有管理用户组权限时可同时获取成员
+func GetUserGroups(c *gin.Context) {
+
+	query := config.DB.Model(&models.UserGroup{}).Order("name ASC")
+	if hasPermission(c, models.PermGroupManage) && c.Query("with_members") == "1" {
+		query = query.Preload("Members")
+	}
+
+	var groups []models.UserGroup
+	if err := query.Find(&groups).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, groups)
+}
+
+// CreateUserGroup 创建用户组（管理员）
+func CreateUserGroup(c *gin.Context) {
+	var req userGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.UserGroup{}).Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "用户组名称已存在")
+		return
+	}
+
+	group := models.UserGroup{Name: req.Name, Description: req.Description}
+	if err := config.DB.Create(&group).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建失败")
+		return
+	}
+
+	utils.SuccessResponse(c, group)
+}
+
+// UpdateUserGroup 修改用户组（管理员）
+func UpdateUserGroup(c *gin.Context) {
+	var req userGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.UserGroup{}).Where("name = ? AND id <> ?", req.Name, group.ID).Count(&count)
+	if count > 0 {
+		utils.ErrorResponse(c, 400, "用户组名称已存在")
+		return
+	}
+
+	group.Name = req.Name
+	group.Description = req.Description
+	if err := config.DB.Omit("Members").Save(group).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	utils.SuccessResponse(c, group)
+}
+
+// DeleteUserGroup 删除用户组及其成员关系、共享设置和访问控制条目（管理员），用户组仍拥有文件、分类或表单时不能删除
+func DeleteUserGroup(c *gin.Context) {
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+
+	var owned int64
+	for _, model := range []interface{}{&models.File{}, &models.Category{}, &models.FormSchema{}} {
+		var count int64
+		config.DB.Model(model).Where("group_id = ?", group.ID).Count(&count)
+		owned += count
+	}
+	if owned > 0 {
+		utils.ErrorResponse(c, 400, "用户组仍拥有文件、分类或表单，请先转移")
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.FormShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "用户组删除成功"})
+}
+
+// SetUserGroupMembers 设置用户组成员，按提交的列表整体替换（管理员）
+func SetUserGroupMembers(c *gin.Context) {
+	var req userGroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+
+	userIDs := uniqueIDs(append(req.UserIDs, req.AdminIDs...))
+	var users []models.User
+	if len(userIDs) > 0 {
+		if err := config.DB.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+		if len(users) != len(userIDs) {
+			utils.ErrorResponse(c, 400, "部分用户不存在")
+			return
+		}
+	}
+
+	// 未指定组管理员时保留现有成员的角色
+	roles := make(map[uint]string)
+	if req.AdminIDs == nil {
+		var members []models.UserGroupMember
+		config.DB.Where("group_id = ?", group.ID).Find(&members)
+		for _, member := range members {
+			roles[member.UserID] = member.Role
+		}
+	}
+	for _, id := range req.AdminIDs {
+		roles[id] = models.GroupRoleAdmin
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.UserGroupMember{}).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			role := roles[user.ID]
+			if role == "" {
+				role = models.GroupRoleMember
+			}
+			if err := tx.Create(&models.UserGroupMember{GroupID: group.ID, UserID: user.ID, Role: role}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "保存成员失败")
+		return
+	}
+
+	config.DB.Preload("Members").First(group, group.ID)
+
+	utils.SuccessResponse(c, group)
+}
+
+// GetMyUserGroups 获取当前用户所在的用户组及在组中的角色
+func GetMyUserGroups(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var members []models.UserGroupMember
+	if err := config.DB.Where("user_id = ?", userID).Order("group_id ASC").Find(&members).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	groupIDs := make([]uint, len(members))
+	for i, member := range members {
+		groupIDs[i] = member.GroupID
+	}
+	var groups []models.UserGroup
+	if len(groupIDs) > 0 {
+		if err := config.DB.Where("id IN ?", groupIDs).Order("name ASC").Find(&groups).Error; err != nil {
+			utils.ServerErrorResponse(c, "查询失败")
+			return
+		}
+	}
+
+	list := make([]gin.H, len(groups))
+	for i, group := range groups {
+		for _, member := range members {
+			if member.GroupID == group.ID {
+				list[i] = gin.H{"group": group, "role": member.Role, "joined_at": member.CreatedAt}
+			}
+		}
+	}
+
+	utils.SuccessResponse(c, list)
+}
+
+// GetUserGroupMembers 获取用户组成员及其角色，组成员和有管理用户组权限的用户可以查看
+func GetUserGroupMembers(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+	if !hasPermission(c, models.PermGroupManage) && groupMemberRole(group.ID, userID.(uint)) == "" {
+		utils.ForbiddenResponse(c, "不是该用户组的成员")
+		return
+	}
+
+	var members []models.UserGroupMember
+	if err := config.DB.Where("group_id = ?", group.ID).
+		Preload("User").
+		Order("role ASC, created_at ASC").
+		Find(&members).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, members)
+}
+
+// SaveUserGroupMember 添加用户组成员或修改成员角色（组管理员）
+func SaveUserGroupMember(c *gin.Context) {
+	var req groupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.GroupRoleMember
+	}
+	if req.Role != models.GroupRoleMember && req.Role != models.GroupRoleAdmin {
+		utils.ErrorResponse(c, 400, "不支持的成员角色")
+		return
+	}
+
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+	if !isGroupAdmin(c, group.ID) {
+		utils.ForbiddenResponse(c, "只有组管理员可以管理成员")
+		return
+	}
+
+	var user models.User
+	if err := config.DB.Select("id").First(&user, c.Param("user_id")).Error; err != nil {
+		utils.ErrorResponse(c, 400, "用户不存在")
+		return
+	}
+
+	var member models.UserGroupMember
+	err := config.DB.Where("group_id = ? AND user_id = ?", group.ID, user.ID).First(&member).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		member = models.UserGroupMember{GroupID: group.ID, UserID: user.ID, Role: req.Role}
+		err = config.DB.Create(&member).Error
+	case err == nil:
+		if member.Role == models.GroupRoleAdmin && req.Role != models.GroupRoleAdmin && !keepsGroupAdmin(c, group.ID) {
+			return
+		}
+		member.Role = req.Role
+		err = config.DB.Model(&models.UserGroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, user.ID).Update("role", req.Role).Error
+	}
+	if err != nil {
+		utils.ServerErrorResponse(c, "保存成员失败")
+		return
+	}
+
+	utils.SuccessResponse(c, member)
+}
+
+// RemoveUserGroupMember 移除用户组成员（组管理员），成员也可以退出用户组
+func RemoveUserGroupMember(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	group, ok := findUserGroup(c)
+	if !ok {
+		return
+	}
+
+	var member models.UserGroupMember
+	if err := config.DB.Where("group_id = ? AND user_id = ?", group.ID, c.Param("user_id")).First(&member).Error; err != nil {
+		utils.NotFoundResponse(c, "成员不存在")
+		return
+	}
+	if member.UserID != userID.(uint) && !isGroupAdmin(c, group.ID) {
+		utils.ForbiddenResponse(c, "只有组管理员可以管理成员")
+		return
+	}
+	if member.Role == models.GroupRoleAdmin && !keepsGroupAdmin(c, group.ID) {
+		return
+	}
+
+	if err := config.DB.Where("group_id = ? AND user_id = ?", group.ID, member.UserID).Delete(&models.UserGroupMember{}).Error; err != nil {
+		utils.ServerErrorResponse(c, "移除成员失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "成员已移除"})
+}
+
+// keepsGroupAdmin 检查移除一个组管理员后用户组仍有组管理员，有管理用户组权限时不限制
+// 检查失败时直接写入错误响应
+func keepsGroupAdmin(c *gin.Context, groupID uint) bool {
+	if hasPermission(c, models.PermGroupManage) {
+		return true
+	}
+	var count int64
+	config.DB.Model(&models.UserGroupMember{}).Where("group_id = ? AND role = ?", groupID, models.GroupRoleAdmin).Count(&count)
+	if count <= 1 {
+		utils.ErrorResponse(c, 400, "用户组至少需要保留一个组管理员")
+		return false
+	}
+	return true
+}
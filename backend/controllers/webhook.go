@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webhookEvents 可订阅的事件
+var webhookEvents = []string{
+	models.WebhookEventFileUploaded,
+	models.WebhookEventFileDeleted,
+	models.WebhookEventFileRestored,
+	models.WebhookEventRecordCreated,
+	models.WebhookEventRecordUpdated,
+	models.WebhookEventRecordDeleted,
+	models.WebhookEventRecordRestored,
+	models.WebhookEventRecordTransitioned,
+}
+
+// webhookRequest 创建、修改Webhook的请求参数
+type webhookRequest struct {
+	Name       string   `json:"name" binding:"required,max=100"`
+	URL        string   `json:"url" binding:"required,max=500"`
+	Events     []string `json:"events" binding:"required"`
+	SchemaID   *uint    `json:"schema_id"`
+	CategoryID *uint    `json:"category_id"`
+	Active     *bool    `json:"active"` // 默认启用
+}
+
+// webhookSecretResponse 包含签名密钥的响应，仅在创建和重置密钥时返回
+type webhookSecretResponse struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// findWebhook 按路径参数查找Webhook，没有管理全部Webhook的权限时只能查找自己的Webhook，查找失败时直接写入错误响应
+func findWebhook(c *gin.Context) (*models.Webhook, bool) {
+	userID, _ := c.Get("user_id")
+
+	query := config.DB.Where("id = ?", c.Param("id"))
+	if !hasPermission(c, models.PermWebhookManageAny) {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var webhook models.Webhook
+	if err := query.First(&webhook).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "Webhook不存在")
+			return nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// findWebhookDelivery 按路径参数查找投递记录，查找失败时直接写入错误响应
+func findWebhookDelivery(c *gin.Context) (*models.WebhookDelivery, *models.Webhook, bool) {
+	userID, _ := c.Get("user_id")
+
+	var delivery models.WebhookDelivery
+	if err := config.DB.First(&delivery, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.NotFoundResponse(c, "投递记录不存在")
+			return nil, nil, false
+		}
+		utils.ServerErrorResponse(c, "查询失败")
+		return nil, nil, false
+	}
+
+	var webhook models.Webhook
+	if err := config.DB.First(&webhook, delivery.WebhookID).Error; err != nil || (!hasPermission(c, models.PermWebhookManageAny) && webhook.UserID != userID.(uint)) {
+		utils.NotFoundResponse(c, "投递记录不存在")
+		return nil, nil, false
+	}
+	return &delivery, &webhook, true
+}
+
+// applyWebhookRequest 校验请求参数并写入Webhook，校验失败时直接写入错误响应
+func applyWebhookRequest(c *gin.Context, webhook *models.Webhook, req *webhookRequest) bool {
+	parsed, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		utils.ErrorResponse(c, 400, "回调地址必须是有效的http或https地址")
+		return false
+	}
+	if err := utils.CheckOutboundHost(parsed.Hostname(), config.WebhookAllowedHosts); err != nil {
+		utils.ErrorResponse(c, 400, "回调地址"+err.Error())
+		return false
+	}
+
+	if req.SchemaID != nil && req.CategoryID != nil {
+		utils.ErrorResponse(c, 400, "不能同时指定表单和分类")
+		return false
+	}
+
+	events := uniqueStrings(req.Events)
+	if len(events) == 0 {
+		utils.ErrorResponse(c, 400, "至少需要订阅一个事件")
+		return false
+	}
+	for _, event := range events {
+		if !containsString(webhookEvents, event) {
+			utils.ErrorResponse(c, 400, "不支持的事件: "+event)
+			return false
+		}
+		if req.SchemaID != nil && !strings.HasPrefix(event, "record.") {
+			utils.ErrorResponse(c, 400, "指定表单的Webhook只能订阅记录事件")
+			return false
+		}
+		if req.CategoryID != nil && !strings.HasPrefix(event, "file.") {
+			utils.ErrorResponse(c, 400, "指定分类的Webhook只能订阅文件事件")
+			return false
+		}
+	}
+
+	// 表单Webhook需要表单管理权限
+	if req.SchemaID != nil && (webhook.SchemaID == nil || *webhook.SchemaID != *req.SchemaID) {
+		if _, ok := findAccessibleSchema(c, *req.SchemaID, models.FormRoleManager); !ok {
+			return false
+		}
+	}
+	if req.CategoryID != nil {
+		var count int64
+		config.DB.Model(&models.Category{}).Where("id = ?", *req.CategoryID).Count(&count)
+		if count == 0 {
+			utils.ErrorResponse(c, 400, "分类不存在")
+			return false
+		}
+	}
+
+	eventsJSON, _ := json.Marshal(events)
+	webhook.Name = req.Name
+	webhook.URL = parsed.String()
+	webhook.Events = models.JSON(eventsJSON)
+	webhook.SchemaID = req.SchemaID
+	webhook.CategoryID = req.CategoryID
+	webhook.Active = req.Active == nil || *req.Active
+	return true
+}
+
+// uniqueStrings 去除空白和重复的字符串，保持原有顺序
+func uniqueStrings(values []string) []string {
+	result := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
+
+// deleteWebhooks 删除符合条件的Webhook及其投递记录
+func deleteWebhooks(tx *gorm.DB, column string, value uint) error {
+	ids := tx.Model(&models.Webhook{}).Select("id").Where(column+" = ?", value)
+	if err := tx.Where("webhook_id IN (?)", ids).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	return tx.Where(column+" = ?", value).Delete(&models.Webhook{}).Error
+}
+
+// GetWebhookEvents 获取可订阅的事件列表
+func GetWebhookEvents(c *gin.Context) {
+	utils.SuccessResponse(c, webhookEvents)
+}
+
+// GetWebhooks 获取Webhook列表，有管理全部Webhook权限时可通过all=1查看全部用户的Webhook
+func GetWebhooks(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	query := config.DB.Model(&models.Webhook{}).Order("id DESC")
+	if !hasPermission(c, models.PermWebhookManageAny) || c.Query("all") != "1" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if schemaID := c.Query("schema_id"); schemaID != "" {
+		query = query.Where("schema_id = ?", schemaID)
+	}
+
+	var webhooks []models.Webhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, webhooks)
+}
+
+// GetWebhook 获取Webhook详情
+func GetWebhook(c *gin.Context) {
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, webhook)
+}
+
+// CreateWebhook 创建Webhook，返回的签名密钥只显示一次
+func CreateWebhook(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	webhook := models.Webhook{UserID: userID.(uint)}
+	if !applyWebhookRequest(c, &webhook, &req) {
+		return
+	}
+
+	secret, err := utils.RandomToken(24)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成签名密钥失败")
+		return
+	}
+	webhook.Secret = secret
+
+	if err := config.DB.Create(&webhook).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建失败")
+		return
+	}
+
+	utils.SuccessResponse(c, webhookSecretResponse{Webhook: webhook, Secret: secret})
+}
+
+// UpdateWebhook 修改Webhook
+func UpdateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+	if !applyWebhookRequest(c, webhook, &req) {
+		return
+	}
+
+	if err := config.DB.Save(webhook).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	utils.SuccessResponse(c, webhook)
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func DeleteWebhook(c *gin.Context) {
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteWebhooks(tx, "id", webhook.ID)
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "删除失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{"message": "Webhook已删除"})
+}
+
+// RotateWebhookSecret 重置签名密钥，返回的新密钥只显示一次
+func RotateWebhookSecret(c *gin.Context) {
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	secret, err := utils.RandomToken(24)
+	if err != nil {
+		utils.ServerErrorResponse(c, "生成签名密钥失败")
+		return
+	}
+	if err := config.DB.Model(webhook).Update("secret", secret).Error; err != nil {
+		utils.ServerErrorResponse(c, "更新失败")
+		return
+	}
+
+	utils.SuccessResponse(c, webhookSecretResponse{Webhook: *webhook, Secret: secret})
+}
+
+// PingWebhook 发送测试事件并同步返回投递结果，失败时不重试
+func PingWebhook(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+	if !webhook.Active {
+		utils.ErrorResponse(c, 400, "Webhook已停用")
+		return
+	}
+
+	delivery, err := newWebhookDelivery(webhook.ID, models.WebhookEventPing, gin.H{
+		"webhook_id": webhook.ID,
+		"actor_id":   userID,
+	})
+	if err != nil {
+		utils.ServerErrorResponse(c, "创建投递记录失败")
+		return
+	}
+
+	attemptWebhookDelivery(delivery, false)
+	hideWebhookResponse(c, delivery)
+	utils.SuccessResponse(c, delivery)
+}
+
+// GetWebhookDeliveries 获取Webhook的投递记录，可按状态和事件筛选
+func GetWebhookDeliveries(c *gin.Context) {
+	webhook, ok := findWebhook(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := config.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	offset := (page - 1) * pageSize
+	if err := query.Omit("payload", "response_body").
+		Order("id DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&deliveries).Error; err != nil {
+		utils.ServerErrorResponse(c, "查询失败")
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"list":       deliveries,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+		"total_page": (total + int64(pageSize) - 1) / int64(pageSize),
+	})
+}
+
+// GetWebhookDelivery 获取投递记录详情，包括请求内容和响应状态，响应内容只对管理所有Webhook的用户显示
+func GetWebhookDelivery(c *gin.Context) {
+	delivery, _, ok := findWebhookDelivery(c)
+	if !ok {
+		return
+	}
+
+	hideWebhookResponse(c, delivery)
+	utils.SuccessResponse(c, delivery)
+}
+
+// RedeliverWebhookDelivery 使用原请求内容重新投递，同步返回首次尝试的结果，失败时按规则重试
+func RedeliverWebhookDelivery(c *gin.Context) {
+	original, webhook, ok := findWebhookDelivery(c)
+	if !ok {
+		return
+	}
+	if !webhook.Active {
+		utils.ErrorResponse(c, 400, "Webhook已停用")
+		return
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID:    original.WebhookID,
+		EventID:      original.EventID,
+		Event:        original.Event,
+		Payload:      original.Payload,
+		Status:       models.DeliveryStatusPending,
+		RedeliveryOf: &original.ID,
+	}
+	if err := config.DB.Create(&delivery).Error; err != nil {
+		utils.ServerErrorResponse(c, "创建投递记录失败")
+		return
+	}
+
+	attemptWebhookDelivery(&delivery, original.Event != models.WebhookEventPing)
+	hideWebhookResponse(c, &delivery)
+	utils.SuccessResponse(c, delivery)
+}
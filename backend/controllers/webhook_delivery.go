@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	webhookMaxAttempts     = 6                // 最多尝试次数(含首次投递)
+	webhookRetryBase       = 30 * time.Second // 首次重试的等待时间，之后每次翻倍
+	webhookRetryMax        = time.Hour        // 重试等待时间上限
+	webhookTimeout         = 10 * time.Second // 单次请求超时
+	webhookPollInterval    = 5 * time.Second  // 检查待投递记录的间隔
+	webhookBatchSize       = 20               // 每次并发投递的记录数
+	webhookMaxResponseBody = 2048             // 保存的响应内容长度上限
+)
+
+var (
+	webhookClient = utils.NewOutboundHTTPClient(webhookTimeout, func() *utils.HostAllowlist { return config.WebhookAllowedHosts })
+	webhookWake   = make(chan struct{}, 1)
+	webhookOnce   sync.Once
+)
+
+// webhookPayload 投递的请求内容
+type webhookPayload struct {
+	ID        string      `json:"id"` // 事件ID
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// StartWebhookWorker 启动后台投递任务，服务重启后继续投递未完成的记录
+func StartWebhookWorker() {
+	webhookOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(webhookPollInterval)
+			defer ticker.Stop()
+			for {
+				processWebhookDeliveries()
+				select {
+				case <-ticker.C:
+				case <-webhookWake:
+				}
+			}
+		}()
+	})
+}
+
+// wakeWebhookWorker 通知后台任务立即检查待投递记录
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// processWebhookDeliveries 投递所有已到期的记录
+func processWebhookDeliveries() {
+	for {
+		var deliveries []models.WebhookDelivery
+		if err := config.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryStatusPending, time.Now()).
+			Order("next_attempt_at ASC").
+			Limit(webhookBatchSize).
+			Find(&deliveries).Error; err != nil {
+			log.Printf("查询待投递的Webhook失败: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				attemptWebhookDelivery(delivery, true)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// webhookRetryDelay 第n次尝试失败后的等待时间
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase << uint(attempts-1)
+	if delay <= 0 || delay > webhookRetryMax {
+		return webhookRetryMax
+	}
+	return delay
+}
+
+// signWebhookPayload 计算签名：HMAC-SHA256(secret, timestamp + "." + body)
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hideWebhookResponse 响应内容可能来自内网服务，只有管理所有Webhook的用户可以查看
+func hideWebhookResponse(c *gin.Context, delivery *models.WebhookDelivery) {
+	if !hasPermission(c, models.PermWebhookManageAny) {
+		delivery.ResponseBody = ""
+	}
+}
+
+// attemptWebhookDelivery 执行一次投递并保存结果，retry为true时失败后按指数退避安排重试
+func attemptWebhookDelivery(delivery *models.WebhookDelivery, retry bool) {
+	var webhook models.Webhook
+	if err := config.DB.First(&webhook, delivery.WebhookID).Error; err != nil || !webhook.Active {
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = "Webhook不存在或已停用"
+		config.DB.Save(delivery)
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	start := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = 0
+	delivery.ResponseBody = ""
+	delivery.Error = ""
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "material-platform-webhook/1.0")
+		req.Header.Set("X-Webhook-Event", delivery.Event)
+		req.Header.Set("X-Webhook-ID", delivery.EventID)
+		req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", signWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+		var resp *http.Response
+		resp, err = webhookClient.Do(req)
+		if err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+			resp.Body.Close()
+			delivery.ResponseStatus = resp.StatusCode
+			delivery.ResponseBody = string(body)
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				err = fmt.Errorf("响应状态码 %d", resp.StatusCode)
+			}
+		}
+	}
+	delivery.DurationMs = time.Since(start).Milliseconds()
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryStatusSuccess
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+	case !retry || delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = models.DeliveryStatusFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = truncateString(err.Error(), 500)
+	default:
+		next := now.Add(webhookRetryDelay(delivery.Attempts))
+		delivery.Status = models.DeliveryStatusPending
+		delivery.NextAttemptAt = &next
+		delivery.Error = truncateString(err.Error(), 500)
+	}
+
+	if err := config.DB.Save(delivery).Error; err != nil {
+		log.Printf("保存Webhook投递结果失败: %v", err)
+	}
+}
+
+// truncateString 按字节截断字符串，不截断多字节字符
+func truncateString(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// webhookSubscribes 判断Webhook是否订阅了事件
+func webhookSubscribes(webhook *models.Webhook, event string) bool {
+	var events []string
+	json.Unmarshal(webhook.Events, &events)
+	return containsString(events, event)
+}
+
+// activeWebhooks 订阅了事件的已启用Webhook
+func activeWebhooks(event string) []models.Webhook {
+	var webhooks []models.Webhook
+	if err := config.DB.Where("active = ? AND events LIKE ?", true, "%\""+event+"\"%").
+		Preload("User").Find(&webhooks).Error; err != nil {
+		log.Printf("查询Webhook失败: %v", err)
+		return nil
+	}
+
+	result := webhooks[:0]
+	for i := range webhooks {
+		if webhookSubscribes(&webhooks[i], event) {
+			result = append(result, webhooks[i])
+		}
+	}
+	return result
+}
+
+// buildWebhookPayload 生成请求内容，eventID 为空时生成新的事件ID
+func buildWebhookPayload(eventID, event string, data interface{}) (string, models.JSON, error) {
+	if eventID == "" {
+		var err error
+		if eventID, err = utils.RandomToken(16); err != nil {
+			return "", nil, err
+		}
+	}
+	payload, err := json.Marshal(webhookPayload{ID: eventID, Event: event, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		return "", nil, err
+	}
+	return eventID, models.JSON(payload), nil
+}
+
+// newWebhookDelivery 创建由调用方立即投递的记录，后台任务不会处理未安排时间的记录
+func newWebhookDelivery(webhookID uint, event string, data interface{}) (*models.WebhookDelivery, error) {
+	eventID, payload, err := buildWebhookPayload("", event, data)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID: webhookID,
+		EventID:   eventID,
+		Event:     event,
+		Payload:   payload,
+		Status:    models.DeliveryStatusPending,
+	}
+	if err := config.DB.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// enqueueWebhookDeliveries 为匹配的Webhook创建投递记录并通知后台任务，data 按Webhook生成请求中的数据，同一事件的事件ID相同
+func enqueueWebhookDeliveries(webhooks []models.Webhook, event string, data func(webhook *models.Webhook) interface{}) {
+	if len(webhooks) == 0 {
+		return
+	}
+
+	var eventID string
+	now := time.Now()
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		var payload models.JSON
+		var err error
+		if eventID, payload, err = buildWebhookPayload(eventID, event, data(webhook)); err != nil {
+			log.Printf("生成Webhook内容失败: %v", err)
+			return
+		}
+
+		delivery := models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       eventID,
+			Event:         event,
+			Payload:       payload,
+			Status:        models.DeliveryStatusPending,
+			NextAttemptAt: &now,
+		}
+		if err := config.DB.Create(&delivery).Error; err != nil {
+			log.Printf("创建Webhook投递记录失败: %v", err)
+		}
+	}
+	wakeWebhookWorker()
+}
+
+// emitFileEvent 触发文件事件：分类Webhook接收该分类的文件，用户Webhook接收自己的文件(有查看全部文件权限时接收全部)
+func emitFileEvent(event string, actorID uint, fileIDs ...uint) {
+	webhooks := activeWebhooks(event)
+	if len(webhooks) == 0 || len(fileIDs) == 0 {
+		return
+	}
+
+	var files []models.File
+	if err := config.DB.Where("id IN ?", fileIDs).Preload("User").Preload("Category").Preload("Tags").
+		Find(&files).Error; err != nil {
+		log.Printf("查询Webhook事件的文件失败: %v", err)
+		return
+	}
+
+	roles := rolePermissionCache{}
+	for i := range files {
+		file := &files[i]
+		var matched []models.Webhook
+		for _, webhook := range webhooks {
+			if webhook.SchemaID != nil {
+				continue
+			}
+			if webhook.CategoryID != nil && (file.CategoryID == nil || *file.CategoryID != *webhook.CategoryID) {
+				continue
+			}
+			if !roles.has(webhook.User.Role, models.PermFileReadAny) && file.UserID != webhook.UserID {
+				continue
+			}
+			matched = append(matched, webhook)
+		}
+		data := gin.H{"file": file, "actor_id": actorID}
+		enqueueWebhookDeliveries(matched, event, func(*models.Webhook) interface{} { return data })
+	}
+}
+
+// emitRecordEvent 触发记录事件：表单Webhook接收该表单的记录，用户Webhook接收自己表单的记录(有管理全部表单权限时接收全部)
+// 投递内容按Webhook所有者当前的表单权限过滤记录范围和不可见字段，所有者已无权访问表单时停用该表单Webhook
+func emitRecordEvent(event string, actorID uint, extra gin.H, recordIDs ...uint) {
+	webhooks := activeWebhooks(event)
+	if len(webhooks) == 0 || len(recordIDs) == 0 {
+		return
+	}
+
+	var records []models.FormRecord
+	if err := config.DB.Where("id IN ?", recordIDs).Preload("Schema").Preload("User").
+		Find(&records).Error; err != nil {
+		log.Printf("查询Webhook事件的记录失败: %v", err)
+		return
+	}
+
+	responses := buildRecordResponses(records)
+	roles := rolePermissionCache{}
+	perms := make(map[[2]uint]*models.FormPermission) // 按 [所有者, 表单] 缓存有效权限
+	disabled := make(map[uint]bool)
+	for i := range records {
+		record := &records[i]
+		var matched []models.Webhook
+		for _, webhook := range webhooks {
+			if webhook.CategoryID != nil || disabled[webhook.ID] {
+				continue
+			}
+			if webhook.SchemaID != nil && *webhook.SchemaID != record.SchemaID {
+				continue
+			}
+			manageAny := roles.has(webhook.User.Role, models.PermFormManageAny)
+			if webhook.SchemaID == nil && !manageAny && record.Schema.UserID != webhook.UserID {
+				continue
+			}
+
+			key := [2]uint{webhook.UserID, record.SchemaID}
+			perm, ok := perms[key]
+			if !ok {
+				var err error
+				if perm, err = loadFormPermission(&record.Schema, webhook.UserID, manageAny); err != nil {
+					log.Printf("查询Webhook所有者的表单权限失败: %v", err)
+					continue
+				}
+				perms[key] = perm
+			}
+			if perm == nil {
+				disabled[webhook.ID] = true
+				disableWebhook(webhook.ID)
+				continue
+			}
+			if canViewRecord(perm, record) {
+				matched = append(matched, webhook)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		response := responses[i]
+		response.Schema = nil
+		enqueueWebhookDeliveries(matched, event, func(webhook *models.Webhook) interface{} {
+			perm := perms[[2]uint{webhook.UserID, record.SchemaID}]
+			data := gin.H{
+				"record":   visibleRecordResponse(perm, response),
+				"schema":   gin.H{"id": record.Schema.ID, "name": record.Schema.Name},
+				"actor_id": actorID,
+			}
+			for key, value := range extra {
+				if key == "changes" {
+					value = visibleEventChanges(perm, value)
+				}
+				data[key] = value
+			}
+			return data
+		})
+	}
+}
+
+// disableWebhook 停用所有者已无权访问表单的Webhook
+func disableWebhook(webhookID uint) {
+	if err := config.DB.Model(&models.Webhook{}).Where("id = ?", webhookID).Update("active", false).Error; err != nil {
+		log.Printf("停用Webhook失败: %v", err)
+		return
+	}
+	log.Printf("Webhook %d 的所有者已无权访问表单，已停用", webhookID)
+}
+
+// visibleRecordResponse 返回移除了不可见字段的记录响应副本
+func visibleRecordResponse(perm *models.FormPermission, response models.FormRecordResponse) models.FormRecordResponse {
+	if !hasHiddenFields(perm) {
+		return response
+	}
+	data := make(map[string]interface{}, len(response.Data))
+	for key, value := range response.Data {
+		data[key] = value
+	}
+	assets := make(map[string][]models.Asset, len(response.Assets))
+	for key, value := range response.Assets {
+		assets[key] = value
+	}
+	relations := make(map[string][]models.FormRecordResponse, len(response.Relations))
+	for key, value := range response.Relations {
+		relations[key] = value
+	}
+	response.Data, response.Assets, response.Relations = data, assets, relations
+
+	responses := []models.FormRecordResponse{response}
+	filterRecordResponses(perm, responses)
+	return responses[0]
+}
+
+// visibleEventChanges 过滤事件附加的字段差异(修订中保存的JSON或差异列表)中不可见的字段
+func visibleEventChanges(perm *models.FormPermission, value interface{}) interface{} {
+	switch changes := value.(type) {
+	case []models.FieldChange:
+		return visibleChanges(perm, changes)
+	case models.JSON:
+		var parsed []models.FieldChange
+		if json.Unmarshal(changes, &parsed) != nil {
+			return nil
+		}
+		return visibleChanges(perm, parsed)
+	}
+	return value
+}
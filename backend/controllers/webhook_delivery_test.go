@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowWebhookHosts 临时设置Webhook允许访问的内网主机，并关闭已有连接使设置在下次连接时生效
+func allowWebhookHosts(t *testing.T, value string) {
+	t.Helper()
+	previous := config.WebhookAllowedHosts
+	config.WebhookAllowedHosts, _ = utils.ParseHostAllowlist(value)
+	webhookClient.CloseIdleConnections()
+	t.Cleanup(func() { config.WebhookAllowedHosts = previous })
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"whsec", "1700000000", `{"id":"e1"}`, "sha256=7e6859a1a93752955693040d16abace18dbb53d905b914ceaf32e06b3b43bdf0"},
+		{"another-secret", "1700000000", `{"id":"e1"}`, "sha256=d584f6b4ce64f28b92c726b23bc7852a5dbbf73b4940d8b4a07cc989b20e9b6c"},
+		{"whsec", "1700000001", `{"id":"e1"}`, "sha256=03a3451418bf78fb55eed13597799e65b07d00b8deb0fc78e40119a3eef527c7"},
+		{"whsec", "1700000000", "", "sha256=ab5fdf6f7cdf5f7abf2f4d61c6b0376dc6bf75beafc17135e5fd06513ee7afd8"},
+	}
+	for _, tt := range tests {
+		if got := signWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("signWebhookPayload(%q, %q, %q) = %s, want %s", tt.secret, tt.timestamp, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour}, // 64分钟超过上限
+		{40, time.Hour},
+		{100, time.Hour}, // 移位溢出
+	}
+	for _, tt := range tests {
+		if got := webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestAttemptWebhookDelivery(t *testing.T) {
+	const secret = "test-secret"
+
+	var redirected int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&redirected, 1)
+	}))
+	defer target.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+		if r.Header.Get("X-Webhook-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("received"))
+		case "/redirect":
+			http.Redirect(w, r, target.URL, http.StatusFound)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		allow      string
+		retry      bool
+		wantStatus string
+		wantCode   int
+		wantError  string
+	}{
+		{"签名正确时投递成功", receiver.URL + "/ok", "127.0.0.1", true, models.DeliveryStatusSuccess, 200, ""},
+		{"失败后安排重试", receiver.URL + "/fail", "127.0.0.1", true, models.DeliveryStatusPending, 500, "响应状态码 500"},
+		{"不重试时直接失败", receiver.URL + "/fail", "127.0.0.1", false, models.DeliveryStatusFailed, 500, "响应状态码 500"},
+		{"不跟随重定向", receiver.URL + "/redirect", "127.0.0.1", false, models.DeliveryStatusFailed, 302, "响应状态码 302"},
+		{"拒绝未允许的内网地址", receiver.URL + "/ok", "", false, models.DeliveryStatusFailed, 0, utils.ErrPrivateAddress.Error()},
+		{"允许列表中的地址段", receiver.URL + "/ok", "127.0.0.0/8", false, models.DeliveryStatusSuccess, 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, &models.Webhook{}, &models.WebhookDelivery{})
+			allowWebhookHosts(t, tt.allow)
+
+			webhook := models.Webhook{Name: "test", URL: tt.url, Secret: secret, Events: models.JSON(`["ping"]`), Active: true, UserID: 1}
+			if err := config.DB.Create(&webhook).Error; err != nil {
+				t.Fatal(err)
+			}
+			delivery, err := newWebhookDelivery(webhook.ID, models.WebhookEventPing, map[string]interface{}{"webhook_id": webhook.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			attemptWebhookDelivery(delivery, tt.retry)
+
+			if delivery.Status != tt.wantStatus || delivery.ResponseStatus != tt.wantCode {
+				t.Fatalf("status = %s/%d, want %s/%d (error %q)", delivery.Status, delivery.ResponseStatus, tt.wantStatus, tt.wantCode, delivery.Error)
+			}
+			if !strings.Contains(delivery.Error, tt.wantError) || (tt.wantError == "") != (delivery.Error == "") {
+				t.Errorf("error = %q, want %q", delivery.Error, tt.wantError)
+			}
+			if delivery.Attempts != 1 {
+				t.Errorf("attempts = %d, want 1", delivery.Attempts)
+			}
+			if tt.wantStatus == models.DeliveryStatusPending {
+				if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(start.Add(webhookRetryBase)) {
+					t.Errorf("next attempt = %v, want at least %v later", delivery.NextAttemptAt, webhookRetryBase)
+				}
+			} else if delivery.NextAttemptAt != nil {
+				t.Errorf("next attempt = %v, want nil", delivery.NextAttemptAt)
+			}
+
+			var saved models.WebhookDelivery
+			config.DB.First(&saved, delivery.ID)
+			if saved.Status != delivery.Status {
+				t.Errorf("saved status = %s, want %s", saved.Status, delivery.Status)
+			}
+		})
+	}
+
+	if n := atomic.LoadInt32(&redirected); n != 0 {
+		t.Errorf("redirect target received %d requests, want 0", n)
+	}
+}
+
+// createTestWebhook 创建订阅记录更新事件的Webhook
+func createTestWebhook(t *testing.T, name string, userID uint, schemaID *uint) *models.Webhook {
+	t.Helper()
+	webhook := &models.Webhook{Name: name, URL: "https://hooks.example.com/" + name, Secret: "test-secret",
+		Events: models.JSON(`["record.updated"]`), SchemaID: schemaID, Active: true, UserID: userID}
+	if err := config.DB.Create(webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+func TestEmitRecordEventScopesPayload(t *testing.T) {
+	useAccountDB(t, formTables...)
+	owner := createTestUser(t, "owner", models.RoleUser, "owner-pass-1")
+	viewer := createTestUser(t, "viewer", models.RoleUser, "viewer-pass-1")
+	revoked := createTestUser(t, "revoked", models.RoleUser, "revoked-pass-1")
+
+	schema := createTestSchema(t, "人员", []models.FormField{
+		{Name: "name", Label: "姓名", Type: "string"},
+		{Name: "salary", Label: "薪资", Type: "number"},
+	})
+	config.DB.Model(schema).Update("user_id", owner.ID)
+	shareTestSchema(t, schema.ID, &viewer.ID, nil, models.FormRoleViewer, models.RowScopeOwn, map[string]string{"salary": "hidden"})
+	ownRecord := createTestRecord(t, schema.ID, map[string]interface{}{"name": "甲", "salary": 100})
+	config.DB.Model(ownRecord).Update("user_id", owner.ID)
+	viewerRecord := createTestRecord(t, schema.ID, map[string]interface{}{"name": "乙", "salary": 200})
+	config.DB.Model(viewerRecord).Update("user_id", viewer.ID)
+
+	// 表单Webhook创建后所有者的权限被降低或撤销
+	ownerHook := createTestWebhook(t, "owner", owner.ID, nil)
+	viewerHook := createTestWebhook(t, "viewer", viewer.ID, &schema.ID)
+	revokedHook := createTestWebhook(t, "revoked", revoked.ID, &schema.ID)
+
+	changes := models.JSON(`[{"field":"name","old_value":"","new_value":"乙"},{"field":"salary","old_value":0,"new_value":200}]`)
+	emitRecordEvent(models.WebhookEventRecordUpdated, owner.ID, gin.H{"changes": changes}, ownRecord.ID, viewerRecord.ID)
+
+	var deliveries []models.WebhookDelivery
+	config.DB.Order("id").Find(&deliveries)
+	type payload struct {
+		ID   string `json:"id"`
+		Data struct {
+			Record  models.FormRecordResponse `json:"record"`
+			Changes []models.FieldChange      `json:"changes"`
+		} `json:"data"`
+	}
+	received := make(map[uint][]payload)
+	eventIDs := make(map[uint]string)
+	for _, delivery := range deliveries {
+		var p payload
+		if err := json.Unmarshal(delivery.Payload, &p); err != nil {
+			t.Fatal(err)
+		}
+		received[delivery.WebhookID] = append(received[delivery.WebhookID], p)
+		if id, ok := eventIDs[p.Data.Record.ID]; ok && id != p.ID {
+			t.Errorf("record %d: event ids %s and %s differ", p.Data.Record.ID, id, p.ID)
+		}
+		eventIDs[p.Data.Record.ID] = p.ID
+	}
+
+	if got := received[ownerHook.ID]; len(got) != 2 || got[0].Data.Record.Data["salary"] == nil || len(got[0].Data.Changes) != 2 {
+		t.Errorf("owner webhook received %+v", got)
+	}
+
+	// 仅可见自己的记录，且不包含隐藏字段
+	got := received[viewerHook.ID]
+	if len(got) != 1 || got[0].Data.Record.ID != viewerRecord.ID {
+		t.Fatalf("viewer webhook received %+v", got)
+	}
+	if _, ok := got[0].Data.Record.Data["salary"]; ok || got[0].Data.Record.Data["name"] != "乙" {
+		t.Errorf("viewer record data = %v", got[0].Data.Record.Data)
+	}
+	if len(got[0].Data.Changes) != 1 || got[0].Data.Changes[0].Field != "name" {
+		t.Errorf("viewer changes = %+v", got[0].Data.Changes)
+	}
+
+	// 已无权访问表单的Webhook不再投递并被停用
+	if len(received[revokedHook.ID]) != 0 {
+		t.Errorf("revoked webhook received %+v", received[revokedHook.ID])
+	}
+	var active []uint
+	config.DB.Model(&models.Webhook{}).Where("active = ?", true).Order("id").Pluck("id", &active)
+	if len(active) != 2 || active[0] != ownerHook.ID || active[1] != viewerHook.ID {
+		t.Errorf("active webhooks = %v, want [%d %d]", active, ownerHook.ID, viewerHook.ID)
+	}
+}
@@ -3,15 +3,29 @@ package main
 import (
 	"log"
 	"material-platform/config"
+	"material-platform/controllers"
 	"material-platform/routes"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 加载数据目录、JWT签名密钥、密码策略、邮件、登录保护、两步验证、外部身份提供方和Webhook设置
+	config.InitStorage()
+	config.InitJWTKeys()
+	config.InitPasswordPolicy()
+	config.InitMailer()
+	config.InitLoginProtection()
+	config.InitTwoFactor()
+	config.InitIdentity()
+	config.InitWebhook()
+
 	// 初始化数据库
 	config.InitDB()
 
+	// 启动Webhook投递任务
+	controllers.StartWebhookWorker()
+
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"material-platform/config"
+	"material-platform/models"
+	"material-platform/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accessTokenTouchInterval 最近使用时间的更新间隔，避免每次请求都写数据库
+const accessTokenTouchInterval = time.Minute
+
+// authenticateAccessToken 验证个人访问令牌，失败时写入错误响应
+func authenticateAccessToken(c *gin.Context, tokenString string, user *models.User) bool {
+	var token models.PersonalAccessToken
+	if err := config.DB.Where("token_hash = ?", utils.HashToken(tokenString)).First(&token).Error; err != nil {
+		utils.UnauthorizedResponse(c, "无效的访问令牌")
+		return false
+	}
+	now := time.Now()
+	if token.RevokedAt != nil || token.ExpiresAt.Before(now) {
+		utils.UnauthorizedResponse(c, "访问令牌已失效")
+		return false
+	}
+
+	if err := config.DB.Select(authUserColumns).First(user, token.UserID).Error; err != nil {
+		utils.UnauthorizedResponse(c, "访问令牌已失效")
+		return false
+	}
+
+	var scopes []string
+	if err := json.Unmarshal(token.Scopes, &scopes); err != nil {
+		utils.UnauthorizedResponse(c, "访问令牌已失效")
+		return false
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval {
+		config.DB.Model(&token).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.ClientIP(),
+		})
+	}
+
+	c.Set("access_token_id", token.ID)
+	c.Set("token_scopes", scopes)
+	return true
+}
+
+// RequireScope 检查个人访问令牌是否有资源的访问权限，登录会话不受限制
+// GET、HEAD 请求需要 资源:read 或 资源:write，其他请求需要 资源:write
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("token_scopes")
+		if !exists {
+			c.Next()
+			return
+		}
+
+		required := resource + ":write"
+		readOnly := c.Request.Method == "GET" || c.Request.Method == "HEAD"
+		for _, scope := range value.([]string) {
+			if scope == required || (readOnly && scope == resource+":read") {
+				c.Next()
+				return
+			}
+		}
+
+		if readOnly {
+			required = resource + ":read"
+		}
+		utils.ForbiddenResponse(c, "访问令牌缺少权限: "+required)
+		c.Abort()
+	}
+}
+
+// SessionOnly 只允许登录会话访问，用于账号安全相关的接口，个人访问令牌不能访问
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("token_scopes"); exists {
+			utils.ForbiddenResponse(c, "该接口不支持使用访问令牌")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
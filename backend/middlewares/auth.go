@@ -1,13 +1,41 @@
 package middlewares
 
 import (
+	"material-platform/config"
+	"material-platform/models"
 	"material-platform/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware JWT身份验证中间件
+// passwordChangeAllowed 需要修改密码时仍可访问的接口，包括两步验证的设置接口，避免同时要求两者时无法完成任何一项
+var passwordChangeAllowed = map[string]bool{
+	"PUT /api/users/password":   true,
+	"GET /api/auth/2fa":         true,
+	"POST /api/auth/2fa/setup":  true,
+	"POST /api/auth/2fa/enable": true,
+	"GET /api/users/profile":    true,
+	"POST /api/auth/logout":     true,
+	"POST /api/auth/logout-all": true,
+}
+
+// twoFactorSetupAllowed 角色要求两步验证但尚未启用时仍可访问的接口，包括修改密码
+var twoFactorSetupAllowed = map[string]bool{
+	"GET /api/auth/2fa":         true,
+	"POST /api/auth/2fa/setup":  true,
+	"POST /api/auth/2fa/enable": true,
+	"PUT /api/users/password":   true,
+	"GET /api/users/profile":    true,
+	"POST /api/auth/logout":     true,
+	"POST /api/auth/logout-all": true,
+}
+
+// authUserColumns 身份验证时读取的用户字段
+var authUserColumns = []string{"id", "username", "role", "token_version", "must_change_password", "two_factor_enabled"}
+
+// AuthMiddleware 身份验证中间件，支持JWT访问令牌和个人访问令牌
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取Authorization header
@@ -32,29 +60,109 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 解析token
-		claims, err := utils.ParseToken(tokenString)
-		if err != nil {
-			utils.UnauthorizedResponse(c, "无效的token")
+		if !authenticate(c, tokenString) {
 			c.Abort()
 			return
 		}
 
-		// 将用户信息存储到上下文中
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware 可选的身份验证中间件，请求带有令牌时与 AuthMiddleware 相同，否则作为匿名请求继续
+// 令牌只能通过请求头传递，图片、下载等链接使用带签名的文件链接
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			c.Next()
+			return
+		}
+
+		if !authenticate(c, tokenString) {
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
 }
 
-// AdminMiddleware 管理员权限中间件
-func AdminMiddleware() gin.HandlerFunc {
+// authenticate 验证令牌并将用户信息存储到上下文中，失败时写入错误响应
+func authenticate(c *gin.Context, tokenString string) bool {
+	// 个人访问令牌以固定前缀开头，其余按JWT处理
+	var user models.User
+	if strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+		if !authenticateAccessToken(c, tokenString, &user) {
+			return false
+		}
+	} else if !authenticateSession(c, tokenString, &user) {
+		return false
+	}
+
+	if message := pendingAccountAction(&user, c.Request.Method+" "+c.FullPath()); message != "" {
+		utils.ForbiddenResponse(c, message)
+		return false
+	}
+
+	// 将用户信息存储到上下文中
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("permissions", config.RolePermissions(user.Role))
+	return true
+}
+
+// pendingAccountAction 用户需要先修改密码或启用两步验证时，返回访问该接口被拒绝的提示，否则返回空字符串
+func pendingAccountAction(user *models.User, route string) string {
+	// 需要修改密码的用户只能修改密码、设置两步验证、查看个人信息和退出登录
+	if user.MustChangePassword && !passwordChangeAllowed[route] {
+		return "请先修改密码"
+	}
+
+	// 角色要求两步验证的用户启用前只能设置两步验证和修改密码
+	if config.TwoFactorRequired(user.Role) && !user.TwoFactorEnabled && !twoFactorSetupAllowed[route] {
+		return "请先启用两步验证"
+	}
+	return ""
+}
+
+// authenticateSession 验证JWT访问令牌及其登录会话，失败时写入错误响应
+func authenticateSession(c *gin.Context, tokenString string, user *models.User) bool {
+	// 解析token
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil {
+		utils.UnauthorizedResponse(c, "无效的token")
+		return false
+	}
+
+	// 检查会话是否已撤销或过期
+	var session models.UserSession
+	if err := config.DB.Select("id", "user_id", "expires_at", "revoked_at").
+		First(&session, claims.SessionID).Error; err != nil ||
+		session.UserID != claims.UserID || session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		utils.UnauthorizedResponse(c, "会话已失效，请重新登录")
+		return false
+	}
+
+	// 检查用户是否存在，修改密码、角色后旧令牌失效
+	if err := config.DB.Select(authUserColumns).
+		First(user, claims.UserID).Error; err != nil || user.TokenVersion != claims.TokenVersion {
+		utils.UnauthorizedResponse(c, "登录状态已失效，请重新登录")
+		return false
+	}
+
+	c.Set("session_id", session.ID)
+	return true
+}
+
+// RequirePermission 权限检查中间件，需要在 AuthMiddleware 之后使用
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			utils.ForbiddenResponse(c, "需要管理员权限")
+		value, _ := c.Get("permissions")
+		permissions, _ := value.(models.PermissionSet)
+		if !permissions.Has(permission) {
+			utils.ForbiddenResponse(c, "没有权限执行此操作")
 			c.Abort()
 			return
 		}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"material-platform/config"
+	"material-platform/models"
+	"testing"
+)
+
+func TestPendingAccountAction(t *testing.T) {
+	// 先注册的清理函数后执行，此时环境变量已经恢复
+	t.Cleanup(config.InitTwoFactor)
+	t.Setenv("TWO_FACTOR_REQUIRED_ROLES", models.RoleAdmin)
+	config.InitTwoFactor()
+
+	both := &models.User{Role: models.RoleAdmin, MustChangePassword: true}
+	passwordOnly := &models.User{Role: models.RoleUser, MustChangePassword: true}
+	twoFactorOnly := &models.User{Role: models.RoleAdmin}
+	enabled := &models.User{Role: models.RoleAdmin, TwoFactorEnabled: true}
+
+	tests := []struct {
+		name  string
+		user  *models.User
+		route string
+		want  string
+	}{
+		{"两者都需要时可以修改密码", both, "PUT /api/users/password", ""},
+		{"两者都需要时可以查看两步验证状态", both, "GET /api/auth/2fa", ""},
+		{"两者都需要时可以生成密钥", both, "POST /api/auth/2fa/setup", ""},
+		{"两者都需要时可以启用两步验证", both, "POST /api/auth/2fa/enable", ""},
+		{"两者都需要时可以退出登录", both, "POST /api/auth/logout", ""},
+		{"两者都需要时不能访问其他接口", both, "GET /api/files", "请先修改密码"},
+		{"只需修改密码时可以设置两步验证", passwordOnly, "POST /api/auth/2fa/setup", ""},
+		{"只需修改密码时不能访问其他接口", passwordOnly, "GET /api/files", "请先修改密码"},
+		{"只需两步验证时可以修改密码", twoFactorOnly, "PUT /api/users/password", ""},
+		{"只需两步验证时不能访问其他接口", twoFactorOnly, "GET /api/files", "请先启用两步验证"},
+		{"已启用两步验证", enabled, "GET /api/files", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pendingAccountAction(tt.user, tt.route); got != tt.want {
+				t.Errorf("pendingAccountAction(%q) = %q, want %q", tt.route, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// AccessTokenPrefix 个人访问令牌的前缀，用于和JWT区分
+const AccessTokenPrefix = "mpat_"
+
+// PersonalAccessToken 个人访问令牌，用于脚本等自动化调用，只保存令牌的哈希
+// 权限范围格式为 资源:read 或 资源:write，write 包含 read
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Prefix     string     `json:"prefix" gorm:"size:20"` // 令牌开头几位，用于识别令牌
+	Scopes     JSON       `json:"scopes" gorm:"type:json;not null"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty" gorm:"size:64"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
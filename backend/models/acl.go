@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// 访问控制的对象类型
+const (
+	ACLObjectFile     = "file"     // 单个文件
+	ACLObjectCategory = "category" // 分类，对其下所有子分类中的文件生效
+)
+
+// 访问控制权限，权限依次递增
+const (
+	ACLRead   = "read"   // 查看、预览、下载
+	ACLWrite  = "write"  // 修改文件信息和内容
+	ACLManage = "manage" // 删除、恢复文件，管理访问控制条目
+)
+
+// ACLEntry 文件或分类的访问控制条目，授权给单个用户或用户组
+type ACLEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ObjectType string    `json:"object_type" gorm:"size:20;not null;index:idx_acl_object"`
+	ObjectID   uint      `json:"object_id" gorm:"not null;index:idx_acl_object"`
+	UserID     *uint     `json:"user_id" gorm:"index"`  // 授权给用户
+	GroupID    *uint     `json:"group_id" gorm:"index"` // 授权给用户组
+	Permission string    `json:"permission" gorm:"size:20;not null"`
+	CreatedBy  uint      `json:"created_by" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// 关联
+	User  *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Group *UserGroup `json:"group,omitempty" gorm:"foreignKey:GroupID"`
+}
+
+// TableName 指定表名
+func (ACLEntry) TableName() string {
+	return "acl_entries"
+}
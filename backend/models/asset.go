@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Asset 表单字段上传的资源文件
+type Asset struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	OriginalName string    `json:"original_name" gorm:"not null;size:255"`
+	FileName     string    `json:"file_name" gorm:"not null;size:255"`
+	FilePath     string    `json:"-" gorm:"not null;size:500"`
+	URL          string    `json:"url" gorm:"not null;size:500"` // 访问路径 /api/assets/:id/content，响应中替换为带签名的链接
+	FileSize     int64     `json:"file_size"`
+	FileType     string    `json:"file_type" gorm:"size:100"`
+	MimeType     string    `json:"mime_type" gorm:"size:100"`
+	SHA256Hash   string    `json:"-" gorm:"size:64;index"`
+	RefCount     int       `json:"ref_count" gorm:"default:0"` // 被表单记录引用的次数
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Asset) TableName() string {
+	return "assets"
+}
+
+// FormRecordAsset 表单记录与资源文件的引用关系
+type FormRecordAsset struct {
+	RecordID  uint      `json:"record_id" gorm:"primaryKey"`
+	FieldKey  string    `json:"field_key" gorm:"primaryKey;size:100"`
+	AssetID   uint      `json:"asset_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (FormRecordAsset) TableName() string {
+	return "form_record_assets"
+}
@@ -11,6 +11,7 @@ type Category struct {
 	Name        string         `gorm:"not null;size:100" json:"name"`
 	Description string         `gorm:"size:500" json:"description"`
 	ParentID    *uint          `gorm:"index" json:"parent_id"`
+	GroupID     *uint          `gorm:"index" json:"group_id"` // 归属的用户组，为空时所有用户可见
 	Icon        string         `gorm:"size:100" json:"icon"`
 	Color       string         `gorm:"size:20" json:"color"`
 	Sort        int            `gorm:"default:0" json:"sort"`
@@ -34,15 +34,28 @@ type File struct {
 	// 外键
 	UserID     uint  `gorm:"not null;index" json:"user_id"`
 	CategoryID *uint `gorm:"index" json:"category_id"`
+	GroupID    *uint `gorm:"index" json:"group_id"` // 归属的用户组，为空时为个人文件
 
 	// 时间戳
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	// 关联关系
-	User     User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Category *Category `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
-	Tags     []Tag     `gorm:"many2many:file_tags;" json:"tags,omitempty"`
+	User     User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Category *Category  `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Group    *UserGroup `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	Tags     []Tag      `gorm:"many2many:file_tags;" json:"tags,omitempty"`
+
+	// 带签名的预览、下载链接，不保存到数据库
+	Links *FileLinks `gorm:"-" json:"links,omitempty"`
+}
+
+// FileLinks 文件的临时访问链接，用于图片、下载等无法设置请求头的场景
+type FileLinks struct {
+	Preview   string    `json:"preview"`
+	Download  string    `json:"download"`
+	Thumbnail string    `json:"thumbnail"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // TableName 指定表名
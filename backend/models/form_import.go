@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// 导入任务状态
+const (
+	ImportStatusPending   = "pending"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// 导入模式
+const (
+	ImportModeInsert = "insert" // 仅新增
+	ImportModeUpsert = "upsert" // 按关键字段更新，不存在则新增
+)
+
+// FormImportJob 表单数据导入任务
+type FormImportJob struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	SchemaID uint   `json:"schema_id" gorm:"not null;index"`
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	FileName string `json:"file_name" gorm:"size:255"`
+	Format   string `json:"format" gorm:"size:10"` // csv, xlsx
+	Mode     string `json:"mode" gorm:"size:20"`   // insert, upsert
+	KeyField string `json:"key_field" gorm:"size:100"`
+	Mapping  JSON   `json:"mapping" gorm:"type:json"` // 列名 -> 字段名
+
+	// 进度
+	Status    string `json:"status" gorm:"size:20;index"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+	Inserted  int    `json:"inserted"`
+	Updated   int    `json:"updated"`
+	Failed    int    `json:"failed"`
+	Message   string `json:"message" gorm:"size:1000"`
+
+	// 文件路径（不对外暴露）
+	SourcePath string `json:"-" gorm:"size:500"`
+	ReportPath string `json:"-" gorm:"size:500"`
+	HasReport  bool   `json:"has_report" gorm:"default:false"`
+
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FormImportJob) TableName() string {
+	return "form_import_jobs"
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// FormPublication 表单的公开填写链接，匿名用户通过链接令牌查看表单并提交记录
+type FormPublication struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	SchemaID uint   `json:"schema_id" gorm:"not null;uniqueIndex"`
+	Token    string `json:"token" gorm:"not null;size:64;uniqueIndex"` // 公开链接中的令牌
+	Enabled  bool   `json:"enabled"`
+
+	// 开放时间，为空表示不限制
+	OpensAt  *time.Time `json:"opens_at"`
+	ClosesAt *time.Time `json:"closes_at"`
+
+	MaxSubmissions  int    `json:"max_submissions"`          // 最多提交次数，0表示不限制
+	SubmissionCount int    `json:"submission_count"`         // 已提交次数
+	RateLimit       int    `json:"rate_limit"`               // 同一IP每小时最多提交次数，0表示不限制
+	Challenge       string `json:"challenge" gorm:"size:20"` // 人机验证方式: none, math, pow
+	PoWDifficulty   int    `json:"pow_difficulty"`           // 工作量证明难度
+	AllowEdit       bool   `json:"allow_edit"`               // 是否允许提交者凭确认令牌修改提交
+
+	UserID    uint      `json:"user_id" gorm:"not null"` // 发布者，匿名提交的记录归属于发布者
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 关联
+	Schema FormSchema `json:"-" gorm:"foreignKey:SchemaID"`
+}
+
+// TableName 指定表名
+func (FormPublication) TableName() string {
+	return "form_publications"
+}
+
+// FormSubmission 通过公开链接提交的记录
+type FormSubmission struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	PublicationID  uint      `json:"publication_id" gorm:"not null;index:idx_submission_ip"`
+	RecordID       uint      `json:"record_id" gorm:"not null;index"`
+	TokenHash      string    `json:"-" gorm:"not null;size:64;uniqueIndex"` // 确认令牌的摘要
+	ChallengeNonce *string   `json:"-" gorm:"size:64;uniqueIndex"`          // 已使用的验证题目，防止重复使用
+	IP             string    `json:"ip" gorm:"size:64;index:idx_submission_ip"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index:idx_submission_ip"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FormSubmission) TableName() string {
+	return "form_submissions"
+}
+
+// ChallengeAttempt 公开表单验证题目的作答记录，每道题只能作答一次，答错的次数用于按IP限制作答频率
+type ChallengeAttempt struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	PublicationID uint      `json:"publication_id" gorm:"not null;index:idx_challenge_attempt_ip"`
+	Nonce         string    `json:"-" gorm:"not null;size:64;uniqueIndex"`
+	IP            string    `json:"ip" gorm:"size:64;index:idx_challenge_attempt_ip"`
+	Failed        bool      `json:"failed"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index:idx_challenge_attempt_ip"`
+}
+
+// TableName 指定表名
+func (ChallengeAttempt) TableName() string {
+	return "challenge_attempts"
+}
@@ -10,9 +10,14 @@ type FormRecord struct {
 	SchemaID  uint      `json:"schema_id" gorm:"not null"`
 	Data      JSON      `json:"data" gorm:"type:json;not null"`
 	UserID    uint      `json:"user_id" gorm:"not null"`
+	State     string    `json:"state,omitempty" gorm:"size:50;index"` // 工作流状态
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// 回收站
+	IsDeleted bool       `json:"is_deleted" gorm:"default:false;index"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
 	// 关联
 	Schema FormSchema `json:"schema,omitempty" gorm:"foreignKey:SchemaID"`
 	User   User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -29,7 +34,31 @@ type FormRecordResponse struct {
 	SchemaID  uint                   `json:"schema_id"`
 	Data      map[string]interface{} `json:"data"`
 	UserID    uint                   `json:"user_id"`
+	State     string                 `json:"state,omitempty"`
 	CreatedAt time.Time              `json:"created_at"`
 	UpdatedAt time.Time              `json:"updated_at"`
+	DeletedAt *time.Time             `json:"deleted_at,omitempty"`
 	Schema    *FormSchema            `json:"schema,omitempty"`
+	User      *User                  `json:"user,omitempty"`
+
+	// 文件字段引用的资源，按字段名分组
+	Assets map[string][]Asset `json:"assets,omitempty"`
+
+	// 展开的关联记录，按字段名分组
+	Relations map[string][]FormRecordResponse `json:"relations,omitempty"`
+}
+
+// FormRecordRelation 表单记录之间的关联关系(由关联字段维护)
+type FormRecordRelation struct {
+	RecordID       uint      `json:"record_id" gorm:"primaryKey"`
+	FieldKey       string    `json:"field_key" gorm:"primaryKey;size:100"`
+	TargetRecordID uint      `json:"target_record_id" gorm:"primaryKey;index"`
+	SchemaID       uint      `json:"schema_id" gorm:"not null;index"`
+	TargetSchemaID uint      `json:"target_schema_id" gorm:"not null;index"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (FormRecordRelation) TableName() string {
+	return "form_record_relations"
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// FormReport 保存的表单统计报表，定义为聚合查询条件
+type FormReport struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	SchemaID    uint      `json:"schema_id" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"not null;size:255"`
+	Description string    `json:"description"`
+	Definition  JSON      `json:"definition" gorm:"type:json;not null"` // 聚合查询条件
+	UserID      uint      `json:"user_id" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 关联
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FormReport) TableName() string {
+	return "form_reports"
+}
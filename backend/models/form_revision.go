@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// 记录修订的操作类型
+const (
+	RevisionActionCreate  = "create"  // 创建
+	RevisionActionUpdate  = "update"  // 修改
+	RevisionActionDelete  = "delete"  // 移到回收站
+	RevisionActionRecover = "recover" // 从回收站恢复
+	RevisionActionRevert  = "revert"  // 恢复到历史版本
+)
+
+// FormRecordRevision 表单记录的修订历史，每次创建、修改、删除记录时生成
+type FormRecordRevision struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	RecordID uint   `json:"record_id" gorm:"not null;uniqueIndex:idx_record_version"`
+	Version  int    `json:"version" gorm:"not null;uniqueIndex:idx_record_version"`
+	SchemaID uint   `json:"schema_id" gorm:"not null;index"`
+	Action   string `json:"action" gorm:"size:20;not null"`
+	Data     JSON   `json:"data" gorm:"type:json"`    // 操作后的记录数据(删除时为删除前的数据)
+	Changes  JSON   `json:"changes" gorm:"type:json"` // 字段级差异 []FieldChange
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+
+	// 修订对应的版本号来源(恢复到历史版本时)
+	SourceVersion *int `json:"source_version,omitempty"`
+
+	// 批量操作标识，同一次批量操作产生的修订相同
+	BatchID string `json:"batch_id,omitempty" gorm:"size:32;index"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// 关联
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// FieldChange 字段级差异
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Label    string      `json:"label,omitempty"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// TableName 指定表名
+func (FormRecordRevision) TableName() string {
+	return "form_record_revisions"
+}
@@ -11,15 +11,27 @@ type FormSchema struct {
 	Name        string    `json:"name" gorm:"not null;size:255"`
 	Description string    `json:"description"`
 	Schema      JSON      `json:"schema" gorm:"type:json;not null"`
+	StorageMode string    `json:"storage_mode" gorm:"size:20;not null;default:json"` // 记录数据存储方式: json, table
 	UserID      uint      `json:"user_id" gorm:"not null"`
+	GroupID     *uint     `json:"group_id" gorm:"index"` // 归属的用户组，组成员可以访问
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
 	// 关联
 	User    User         `json:"user" gorm:"foreignKey:UserID"`
+	Group   *UserGroup   `json:"group,omitempty" gorm:"foreignKey:GroupID"`
 	Records []FormRecord `json:"records,omitempty" gorm:"foreignKey:SchemaID"`
+
+	// 当前用户的权限，不存储
+	Permission *FormPermission `json:"permission,omitempty" gorm:"-"`
 }
 
+// 表单记录数据的存储方式
+const (
+	StorageModeJSON  = "json"  // 存储在form_records.data中
+	StorageModeTable = "table" // 存储在按表单结构生成的物理表中
+)
+
 // JSON 自定义JSON类型，用于处理JSON字段
 type JSON json.RawMessage
 
@@ -98,6 +110,30 @@ type FormField struct {
 	// 枚举类型专用
 	EnumOptions []FormFieldOption `json:"enum_options,omitempty"` // 枚举选项
 
+	// 文件类型专用(file, image)
+	Multiple bool   `json:"multiple,omitempty"`  // 是否允许多个文件
+	MaxFiles *int   `json:"max_files,omitempty"` // 最多文件数
+	Accept   string `json:"accept,omitempty"`    // 允许的类型，如 image/*,.pdf
+
+	// 关联类型专用(relation)
+	RelationSchemaID *uint  `json:"relation_schema_id,omitempty"` // 关联的表单结构
+	RelationType     string `json:"relation_type,omitempty"`      // one_to_one, many_to_one, one_to_many, many_to_many
+	OnDelete         string `json:"on_delete,omitempty"`          // 被关联记录删除时的处理: restrict, cascade, nullify
+	DisplayField     string `json:"display_field,omitempty"`      // 展示关联记录时使用的字段
+
+	// 公式类型专用(formula)，计算结果按 Precision、TimeFormat 格式化
+	Formula string `json:"formula,omitempty"` // 公式表达式，如 price * quantity、SUM(items.amount)
+
+	// 重复分组类型专用(group)，值为对象数组，每个对象按子字段填写
+	Fields   []FormField `json:"fields,omitempty"`    // 子字段
+	MinItems *int        `json:"min_items,omitempty"` // 最少条目数
+	MaxItems *int        `json:"max_items,omitempty"` // 最多条目数
+
+	// 条件逻辑：条件引用同一分组内的字段或顶层字段
+	VisibleWhen  *FieldCondition `json:"visible_when,omitempty"`  // 满足条件时显示，隐藏字段不校验且不保存
+	RequiredWhen *FieldCondition `json:"required_when,omitempty"` // 满足条件时必填
+	Section      string          `json:"section,omitempty"`       // 所属分节(步骤)ID
+
 	// 表单形式
 	InputType    string `json:"input_type,omitempty"`    // 输入方式
 	TextareaRows *int   `json:"textarea_rows,omitempty"` // 多行文本行数
@@ -108,15 +144,50 @@ type FormField struct {
 	SortOrder  int                    `json:"sort_order"`
 }
 
+// 关联字段的关联类型
+const (
+	RelationOneToOne   = "one_to_one"   // 关联一条记录，且该记录只能被关联一次
+	RelationManyToOne  = "many_to_one"  // 关联一条记录，该记录可被多条记录关联
+	RelationOneToMany  = "one_to_many"  // 关联多条记录，每条记录只能被关联一次
+	RelationManyToMany = "many_to_many" // 关联多条记录，不限制被关联次数
+)
+
+// 被关联记录删除时的处理方式
+const (
+	OnDeleteRestrict = "restrict" // 存在引用时禁止删除
+	OnDeleteCascade  = "cascade"  // 同时删除引用它的记录
+	OnDeleteNullify  = "nullify"  // 清空引用它的字段值
+)
+
 // FormFieldOption 表单字段选项（用于select、radio、checkbox等）
 type FormFieldOption struct {
 	Label string `json:"label"`
 	Value string `json:"value"`
 }
 
+// FieldCondition 字段条件，Field/Op/Value 构成单个比较，All/Any 组合多个条件
+type FieldCondition struct {
+	Field string           `json:"field,omitempty"`
+	Op    string           `json:"op,omitempty"` // eq, ne, in, not_in, gt, gte, lt, lte, contains, empty, not_empty
+	Value interface{}      `json:"value,omitempty"`
+	All   []FieldCondition `json:"all,omitempty"` // 全部满足
+	Any   []FieldCondition `json:"any,omitempty"` // 任一满足
+}
+
+// FormSection 表单分节，多步骤表单中每个分节为一步
+type FormSection struct {
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	VisibleWhen *FieldCondition `json:"visible_when,omitempty"` // 分节隐藏时其中的字段均隐藏
+	SortOrder   int             `json:"sort_order"`
+}
+
 // FormSchemaData 完整的表单结构数据
 type FormSchemaData struct {
-	Fields []FormField `json:"fields"`
+	Fields   []FormField   `json:"fields"`
+	Sections []FormSection `json:"sections,omitempty"`
+	Workflow *FormWorkflow `json:"workflow,omitempty"` // 记录状态机(审批流程)
 }
 
 // TableName 指定表名
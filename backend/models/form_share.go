@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+)
+
+// 表单协作角色，权限依次递增
+const (
+	FormRoleViewer    = "viewer"    // 查看、导出记录
+	FormRoleSubmitter = "submitter" // 提交记录，修改、删除自己提交的记录
+	FormRoleEditor    = "editor"    // 新增、修改、删除所有记录，导入数据
+	FormRoleManager   = "manager"   // 修改表单定义，管理共享、公开链接
+	FormRoleOwner     = "owner"     // 表单创建者和管理员
+)
+
+// 记录可见范围
+const (
+	RowScopeAll = "all" // 全部记录
+	RowScopeOwn = "own" // 仅自己提交的记录
+)
+
+// 字段权限
+const (
+	FieldAccessHidden = "hidden" // 不可见
+	FieldAccessRead   = "read"   // 只读
+	FieldAccessWrite  = "write"  // 可读写
+)
+
+// FormShare 表单共享设置，共享给单个用户或用户组
+type FormShare struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	SchemaID uint   `json:"schema_id" gorm:"not null;index"`
+	UserID   *uint  `json:"user_id" gorm:"index"`  // 共享给用户
+	GroupID  *uint  `json:"group_id" gorm:"index"` // 共享给用户组
+	Role     string `json:"role" gorm:"size:20;not null"`
+	RowScope string `json:"row_scope" gorm:"size:20;not null"`
+	// 字段权限，字段key到 hidden/read/write 的映射；未列出的字段查看者只读，其他角色可读写
+	FieldPermissions JSON      `json:"field_permissions" gorm:"type:json"`
+	CreatedBy        uint      `json:"created_by" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+
+	// 关联
+	User  *User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Group *UserGroup `json:"group,omitempty" gorm:"foreignKey:GroupID"`
+}
+
+// TableName 指定表名
+func (FormShare) TableName() string {
+	return "form_shares"
+}
+
+// FormPermission 当前用户对表单的有效权限，由所有适用的共享设置合并得到
+type FormPermission struct {
+	Role     string            `json:"role"`
+	RowScope string            `json:"row_scope"`
+	Fields   map[string]string `json:"fields,omitempty"` // 与角色默认权限不同的字段
+	UserID   uint              `json:"-"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// FormTemplate 用户保存的表单模板，共享的模板对所有用户可见
+// 内置模板定义在代码中，不存储在数据库
+type FormTemplate struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null;size:255"`
+	Description string    `json:"description"`
+	Category    string    `json:"category" gorm:"size:100;index"`
+	Schema      JSON      `json:"schema" gorm:"type:json;not null"` // 表单结构数据(FormSchemaData)
+	Shared      bool      `json:"shared" gorm:"index"`              // 是否共享给所有用户
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 关联
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FormTemplate) TableName() string {
+	return "form_templates"
+}
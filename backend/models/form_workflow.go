@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// 工作流转换的特殊触发者，其余取值为表单协作角色(具有该角色及以上的用户)
+const (
+	WorkflowActorCreator  = "creator"  // 记录提交者
+	WorkflowActorAssignee = "assignee" // 指派给记录的审核人
+)
+
+// FormWorkflow 表单的记录状态机
+type FormWorkflow struct {
+	InitialState string               `json:"initial_state"` // 新记录的状态，默认为第一个状态
+	States       []WorkflowState      `json:"states"`
+	Transitions  []WorkflowTransition `json:"transitions"`
+}
+
+// WorkflowState 工作流状态
+type WorkflowState struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Final bool   `json:"final,omitempty"` // 终止状态，未指定来源状态的转换不能从终止状态发起
+}
+
+// WorkflowTransition 工作流状态转换
+type WorkflowTransition struct {
+	Key            string   `json:"key"`
+	Label          string   `json:"label"`
+	From           []string `json:"from,omitempty"`            // 来源状态，为空表示任意非终止状态
+	To             string   `json:"to"`                        // 目标状态
+	Roles          []string `json:"roles,omitempty"`           // 可触发的角色，为空表示表单管理者
+	RequireComment bool     `json:"require_comment,omitempty"` // 是否必须填写意见
+}
+
+// FormRecordTransition 记录的状态转换历史
+type FormRecordTransition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	RecordID   uint      `json:"record_id" gorm:"not null;index"`
+	SchemaID   uint      `json:"schema_id" gorm:"not null;index"`
+	Transition string    `json:"transition" gorm:"size:50;not null"`
+	FromState  string    `json:"from_state" gorm:"size:50"`
+	ToState    string    `json:"to_state" gorm:"size:50;not null"`
+	Comment    string    `json:"comment" gorm:"type:text"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// 关联
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FormRecordTransition) TableName() string {
+	return "form_record_transitions"
+}
+
+// FormRecordAssignee 指派给记录的审核人，审核人可查看该记录
+type FormRecordAssignee struct {
+	RecordID   uint      `json:"record_id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"primaryKey;index"`
+	AssignedBy uint      `json:"assigned_by" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// 关联
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (FormRecordAssignee) TableName() string {
+	return "form_record_assignees"
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// 账号来源
+const (
+	AuthProviderLocal = "local" // 本地注册，使用本地密码登录
+	AuthProviderOIDC  = "oidc"  // OpenID Connect 单点登录
+	AuthProviderLDAP  = "ldap"  // LDAP目录，密码由目录服务验证
+)
+
+// OIDCLoginState 发起OIDC授权时保存的state，回调时校验并只能使用一次
+type OIDCLoginState struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	StateHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Nonce        string     `json:"-" gorm:"size:64;not null"`
+	CodeVerifier string     `json:"-" gorm:"size:128;not null"` // PKCE
+	IP           string     `json:"ip" gorm:"size:64"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// OIDCCallbackRequest OIDC回调请求结构，code 和 state 取自身份提供方重定向的参数
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// 登录失败的统计对象
+const (
+	LoginGuardUser = "user" // 按账号统计(账号不存在时按输入的用户名统计)
+	LoginGuardIP   = "ip"   // 按来源IP统计
+)
+
+// LoginFailure 连续登录失败的统计
+type LoginFailure struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	GuardKey     string     `json:"key" gorm:"size:200;not null;uniqueIndex"` // 统计对象：user:<用户ID>、name:<用户名> 或 ip:<IP>
+	Kind         string     `json:"kind" gorm:"size:10;not null"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (LoginFailure) TableName() string {
+	return "login_failures"
+}
+
+// LoginLockout 登录锁定的审计记录
+type LoginLockout struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	GuardKey    string     `json:"key" gorm:"size:200;not null;index"`
+	Kind        string     `json:"kind" gorm:"size:10;not null"`
+	Subject     string     `json:"subject" gorm:"size:150"` // 被锁定的用户名或IP
+	UserID      *uint      `json:"user_id,omitempty" gorm:"index"`
+	Failures    int        `json:"failures"`
+	IP          string     `json:"ip" gorm:"size:64"` // 触发锁定的请求来源
+	LockedUntil time.Time  `json:"locked_until"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy  *uint      `json:"unlocked_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordReset 密码重置令牌，只保存令牌哈希
+type PasswordReset struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	IP        string     `json:"ip" gorm:"size:64"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PasswordReset) TableName() string {
+	return "password_resets"
+}
@@ -31,8 +31,46 @@ type RegisterRequest struct {
 
 // LoginResponse 登录响应结构
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token                  string `json:"token"`
+	RefreshToken           string `json:"refresh_token"`
+	ExpiresIn              int64  `json:"expires_in"` // 访问令牌有效期(秒)
+	User                   User   `json:"user"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"` // 当前角色必须启用两步验证，启用前只能访问两步验证设置
+}
+
+// TwoFactorChallengeResponse 需要两步验证时的登录响应
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"` // 验证有效期(秒)
+}
+
+// TwoFactorLoginRequest 两步验证登录请求结构，code 为验证码或恢复码
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码请求结构
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest 申请重置密码请求结构
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求结构
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// RefreshRequest 刷新令牌请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // FileUploadResponse 文件上传响应
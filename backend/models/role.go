@@ -0,0 +1,112 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 内置角色
+const (
+	RoleAdmin = "admin" // 拥有全部权限
+	RoleUser  = "user"  // 注册用户的默认角色
+)
+
+// PermissionAll 表示全部权限，只用于内置管理员角色
+const PermissionAll = "*"
+
+// 权限
+const (
+	PermFileUpload        = "file.upload"         // 上传文件
+	PermFileReadAny       = "file.read.any"       // 查看所有用户的文件和资源
+	PermFileManageAny     = "file.manage.any"     // 修改、删除、恢复所有用户的文件
+	PermCategoryManage    = "category.manage"     // 管理分类
+	PermTagManage         = "tag.manage"          // 管理标签
+	PermFormCreate        = "form.create"         // 创建表单
+	PermFormManageAny     = "form.manage.any"     // 管理所有表单及其数据
+	PermTemplateManageAny = "template.manage.any" // 管理所有用户的表单模板
+	PermWebhookCreate     = "webhook.create"      // 创建和修改Webhook
+	PermWebhookManageAny  = "webhook.manage.any"  // 管理所有用户的Webhook
+	PermUserManage        = "user.manage"         // 管理用户、访问令牌和登录锁定
+	PermGroupManage       = "group.manage"        // 管理用户组
+	PermRoleManage        = "role.manage"         // 管理角色
+	PermSystemManage      = "system.manage"       // 查看系统统计、清理资源
+)
+
+// Permission 权限说明
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 全部可分配的权限
+var Permissions = []Permission{
+	{PermFileUpload, "上传文件"},
+	{PermFileReadAny, "查看所有用户的文件和资源"},
+	{PermFileManageAny, "修改、删除、恢复所有用户的文件"},
+	{PermCategoryManage, "管理分类"},
+	{PermTagManage, "管理标签"},
+	{PermFormCreate, "创建表单"},
+	{PermFormManageAny, "管理所有表单及其数据"},
+	{PermTemplateManageAny, "管理所有用户的表单模板"},
+	{PermWebhookCreate, "创建和修改Webhook"},
+	{PermWebhookManageAny, "管理所有用户的Webhook"},
+	{PermUserManage, "管理用户、访问令牌和登录锁定"},
+	{PermGroupManage, "管理用户组"},
+	{PermRoleManage, "管理角色"},
+	{PermSystemManage, "查看系统统计、清理资源"},
+}
+
+// DefaultUserPermissions 内置普通用户角色的初始权限
+var DefaultUserPermissions = []string{PermFileUpload, PermCategoryManage, PermTagManage, PermFormCreate}
+
+// Role 角色，用户的 role 字段保存角色名
+type Role struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"size:20;not null;uniqueIndex"`
+	DisplayName string    `json:"display_name" gorm:"size:100"`
+	Description string    `json:"description" gorm:"size:255"`
+	Permissions JSON      `json:"permissions" gorm:"type:json;not null"` // 权限名列表
+	IsSystem    bool      `json:"is_system" gorm:"default:false"`        // 内置角色不能删除
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	UserCount int64 `json:"user_count" gorm:"-"` // 使用该角色的用户数
+}
+
+// TableName 指定表名
+func (Role) TableName() string {
+	return "roles"
+}
+
+// PermissionSet 角色的权限集合
+func (r *Role) PermissionSet() PermissionSet {
+	var names []string
+	json.Unmarshal(r.Permissions, &names)
+
+	set := make(PermissionSet, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// PermissionSet 权限集合
+type PermissionSet map[string]bool
+
+// Has 是否拥有权限
+func (s PermissionSet) Has(permission string) bool {
+	return s[PermissionAll] || s[permission]
+}
+
+// Covers 是否拥有另一个集合中的全部权限，用于防止授予自己没有的权限
+func (s PermissionSet) Covers(other PermissionSet) bool {
+	if s[PermissionAll] {
+		return true
+	}
+	for permission := range other {
+		if !s[permission] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// UserSession 登录会话，保存刷新令牌的哈希；访问令牌携带会话ID，会话撤销后立即失效
+type UserSession struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	UserID            uint       `json:"user_id" gorm:"not null;index"`
+	RefreshTokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	PreviousTokenHash string     `json:"-" gorm:"size:64;index"` // 上一个刷新令牌，再次使用时视为令牌泄露并撤销会话
+	UserAgent         string     `json:"user_agent" gorm:"size:255"`
+	IP                string     `json:"ip" gorm:"size:64"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// UserTwoFactor 用户的TOTP两步验证设置，未确认前 Enabled 为 false
+type UserTwoFactor struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;uniqueIndex"`
+	Secret       string     `json:"-" gorm:"size:64;not null"`
+	Enabled      bool       `json:"enabled" gorm:"default:false"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-" gorm:"default:0"` // 最近一次使用的时间窗口，防止验证码重复使用
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (UserTwoFactor) TableName() string {
+	return "user_two_factors"
+}
+
+// TwoFactorRecoveryCode 两步验证恢复码，只保存哈希，每个只能使用一次
+type TwoFactorRecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;index"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (TwoFactorRecoveryCode) TableName() string {
+	return "two_factor_recovery_codes"
+}
+
+// LoginChallenge 密码验证通过后等待两步验证的登录请求
+type LoginChallenge struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	IP        string     `json:"ip" gorm:"size:64"`
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (LoginChallenge) TableName() string {
+	return "login_challenges"
+}
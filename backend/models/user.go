@@ -11,8 +11,14 @@ type User struct {
 	Username    string         `gorm:"unique;not null;size:50" json:"username"`
 	Email       string         `gorm:"unique;not null;size:100" json:"email"`
 	Password    string         `gorm:"not null;size:255" json:"-"`
-	Role        string         `gorm:"default:user;size:20" json:"role"` // admin, user
+	Role        string         `gorm:"default:user;size:20" json:"role"` // 角色名，对应 roles 表
 	Avatar      string         `gorm:"size:255" json:"avatar"`
+	TokenVersion int           `gorm:"default:0" json:"-"` // 修改密码、角色时递增，使已签发的令牌失效
+	MustChangePassword bool    `gorm:"default:false" json:"must_change_password"` // 下次登录后必须修改密码
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	TwoFactorEnabled bool      `gorm:"default:false" json:"two_factor_enabled"` // 登录时需要输入TOTP验证码
+	AuthProvider string        `gorm:"default:local;size:20" json:"auth_provider"` // 账号来源：local、oidc、ldap
+	ExternalID  string         `gorm:"index;size:255" json:"-"` // 身份提供方中的用户标识(OIDC的sub或LDAP的DN)
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// 用户组成员角色
+const (
+	GroupRoleMember = "member" // 查看、编辑组内的文件和表单
+	GroupRoleAdmin  = "admin"  // 管理组成员，删除、转移组内的资源
+)
+
+// UserGroup 用户组，表单等资源可共享给用户组，文件、分类、表单也可以归属于用户组
+type UserGroup struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null;size:100;uniqueIndex"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 关联
+	Members []User `json:"members,omitempty" gorm:"many2many:user_group_members;joinForeignKey:GroupID;joinReferences:UserID"`
+}
+
+// TableName 指定表名
+func (UserGroup) TableName() string {
+	return "user_groups"
+}
+
+// UserGroupMember 用户组成员
+type UserGroupMember struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"size:20;not null;default:member"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 关联
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (UserGroupMember) TableName() string {
+	return "user_group_members"
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+)
+
+// Webhook事件
+const (
+	WebhookEventPing               = "ping" // 测试事件，仅手动触发
+	WebhookEventFileUploaded       = "file.uploaded"
+	WebhookEventFileDeleted        = "file.deleted"
+	WebhookEventFileRestored       = "file.restored"
+	WebhookEventRecordCreated      = "record.created"
+	WebhookEventRecordUpdated      = "record.updated"
+	WebhookEventRecordDeleted      = "record.deleted"
+	WebhookEventRecordRestored     = "record.restored"
+	WebhookEventRecordTransitioned = "record.transitioned" // 工作流状态转换
+)
+
+// Webhook投递状态
+const (
+	DeliveryStatusPending = "pending" // 等待投递或等待重试
+	DeliveryStatusSuccess = "success"
+	DeliveryStatusFailed  = "failed" // 重试次数用尽
+)
+
+// Webhook 出站回调配置
+// 指定表单时只接收该表单的记录事件，指定分类时只接收该分类的文件事件，都不指定时接收自己的文件和表单的事件
+type Webhook struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name" gorm:"size:100;not null"`
+	URL        string    `json:"url" gorm:"size:500;not null"`
+	Secret     string    `json:"-" gorm:"size:64;not null"`        // 签名密钥，仅在创建和重置时返回
+	Events     JSON      `json:"events" gorm:"type:json;not null"` // 订阅的事件列表
+	SchemaID   *uint     `json:"schema_id" gorm:"index"`
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Active     bool      `json:"active" gorm:"index"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// 关联
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// WebhookDelivery Webhook投递记录，保存请求内容和最近一次尝试的结果
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"size:32;index"` // 同一事件投递到多个Webhook或重新投递时相同
+	Event          string     `json:"event" gorm:"size:50;not null"`
+	Payload        JSON       `json:"payload,omitempty" gorm:"type:json;not null"`
+	Status         string     `json:"status" gorm:"size:20;not null;index"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty" gorm:"type:text"`
+	Error          string     `json:"error,omitempty" gorm:"size:500"`
+	DurationMs     int64      `json:"duration_ms"`
+	RedeliveryOf   *uint      `json:"redelivery_of,omitempty"` // 手动重新投递时的原投递记录
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
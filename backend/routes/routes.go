@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"material-platform/config"
 	"material-platform/controllers"
 	"material-platform/middlewares"
+	"material-platform/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,9 +12,12 @@ import (
 // SetupRoutes 设置路由
 func SetupRoutes(r *gin.Engine) {
 	// 静态文件服务
-	r.Static("/uploads", "../uploads")
-	r.Static("/assets", "../assets") // 资源文件服务（表单字段上传）
-	r.Static("/static", "../static")
+	for prefix, dir := range config.StaticRoots {
+		r.Static(prefix, dir)
+	}
+
+	// 访问令牌验证公钥
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
 
 	// API路由组
 	api := r.Group("/api")
@@ -22,61 +27,142 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			auth.POST("/register", controllers.Register)
 			auth.POST("/login", controllers.Login)
+			auth.POST("/login/2fa", controllers.LoginTwoFactor)
+			auth.POST("/refresh", controllers.RefreshToken)
+			auth.GET("/jwks", controllers.GetJWKS)
+			auth.GET("/password/policy", controllers.GetPasswordPolicy)
+			auth.POST("/password/forgot", controllers.ForgotPassword)
+			auth.POST("/password/reset", controllers.ResetPassword)
+			auth.GET("/providers", controllers.GetIdentityProviders)
+			auth.GET("/oidc/authorize", controllers.OIDCAuthorize)
+			auth.POST("/oidc/callback", controllers.OIDCCallback)
+		}
+
+		// 公开表单填写（无需认证）
+		publicForms := api.Group("/public/forms")
+		{
+			publicForms.GET("/:token", controllers.GetPublicForm)
+			publicForms.GET("/:token/challenge", controllers.GetPublicFormChallenge)
+			publicForms.POST("/:token/submissions", controllers.SubmitPublicForm)
+			publicForms.GET("/:token/submissions/:submission", controllers.GetPublicSubmission)
+			publicForms.PUT("/:token/submissions/:submission", controllers.UpdatePublicSubmission)
 		}
 
-		// 文件预览和下载（无需认证）
-		api.GET("/files/:id/preview", controllers.PreviewFile)
-		api.GET("/files/:id/download", controllers.DownloadFile)
-		api.GET("/files/:id/thumbnail", controllers.GetFileThumbnail)
+		// 文件预览和下载（公开文件无需认证，其他文件按访问权限检查）
+		filePreview := api.Group("/files", middlewares.OptionalAuthMiddleware(), middlewares.RequireScope("files"))
+		{
+			filePreview.GET("/:id/preview", controllers.PreviewFile)
+			filePreview.GET("/:id/download", controllers.DownloadFile)
+			filePreview.GET("/:id/thumbnail", controllers.GetFileThumbnail)
+		}
+
+		// 表单资源文件（需要登录且可以查看该资源，或使用带签名的链接）
+		assetContent := api.Group("/assets", middlewares.OptionalAuthMiddleware(), middlewares.RequireScope("forms"))
+		{
+			assetContent.GET("/:id/content", controllers.GetAssetContent)
+		}
 
 		// 需要认证的路由
 		protected := api.Group("/")
 		protected.Use(middlewares.AuthMiddleware())
 		{
+			// 账号安全（不支持个人访问令牌）
+			account := protected.Group("/auth", middlewares.SessionOnly())
+			{
+				// 会话管理
+				account.POST("/logout", controllers.Logout)
+				account.POST("/logout-all", controllers.LogoutAll)
+				account.GET("/sessions", controllers.GetUserSessions)
+				account.DELETE("/sessions/:id", controllers.RevokeUserSession)
+
+				// 两步验证
+				account.GET("/2fa", controllers.GetTwoFactorStatus)
+				account.POST("/2fa/setup", controllers.SetupTwoFactor)
+				account.POST("/2fa/enable", controllers.EnableTwoFactor)
+				account.POST("/2fa/disable", controllers.DisableTwoFactor)
+				account.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+
+				// 个人访问令牌
+				account.GET("/tokens/scopes", controllers.GetAccessTokenScopes)
+				account.GET("/tokens", controllers.GetAccessTokens)
+				account.POST("/tokens", controllers.CreateAccessToken)
+				account.DELETE("/tokens/:id", controllers.RevokeAccessToken)
+			}
+
 			// 用户相关
-			user := protected.Group("/users")
+			user := protected.Group("/users", middlewares.RequireScope("profile"))
 			{
 				user.GET("/profile", controllers.GetUserProfile)
 				user.PUT("/profile", controllers.UpdateUserProfile)
+				user.PUT("/password", middlewares.SessionOnly(), controllers.ChangePassword)
+				user.GET("/permissions", controllers.GetMyPermissions)
+			}
+
+			// 用户组（用于选择共享对象），组管理员可以管理成员
+			protected.GET("/groups", middlewares.RequireScope("profile"), controllers.GetUserGroups)
+			groups := protected.Group("/groups", middlewares.RequireScope("profile"))
+			{
+				groups.GET("/mine", controllers.GetMyUserGroups)
+				groups.GET("/:id/members", controllers.GetUserGroupMembers)
+				groups.PUT("/:id/members/:user_id", controllers.SaveUserGroupMember)
+				groups.DELETE("/:id/members/:user_id", controllers.RemoveUserGroupMember)
 			}
 
 			// 分类管理
-			categories := protected.Group("/categories")
+			categories := protected.Group("/categories", middlewares.RequireScope("files"))
 			{
 				categories.GET("/", controllers.GetCategories)
-				categories.POST("/", controllers.CreateCategory)
-				categories.PUT("/:id", controllers.UpdateCategory)
-				categories.DELETE("/:id", controllers.DeleteCategory)
+				categories.POST("/", middlewares.RequirePermission(models.PermCategoryManage), controllers.CreateCategory)
+				categories.PUT("/:id", middlewares.RequirePermission(models.PermCategoryManage), controllers.UpdateCategory)
+				categories.DELETE("/:id", middlewares.RequirePermission(models.PermCategoryManage), controllers.DeleteCategory)
+				categories.PUT("/:id/owner", middlewares.RequirePermission(models.PermCategoryManage), controllers.TransferCategory)
+				categories.GET("/:id/acl", controllers.GetCategoryACL)
+				categories.POST("/:id/acl", controllers.CreateCategoryACL)
+				categories.GET("/:id/permissions", controllers.GetCategoryPermissions)
 			}
 
 			// 标签管理
-			tags := protected.Group("/tags")
+			tags := protected.Group("/tags", middlewares.RequireScope("files"))
 			{
 				tags.GET("/", controllers.GetTags)
-				tags.POST("/", controllers.CreateTag)
-				tags.PUT("/:id", controllers.UpdateTag)
-				tags.DELETE("/:id", controllers.DeleteTag)
+				tags.POST("/", middlewares.RequirePermission(models.PermTagManage), controllers.CreateTag)
+				tags.PUT("/:id", middlewares.RequirePermission(models.PermTagManage), controllers.UpdateTag)
+				tags.DELETE("/:id", middlewares.RequirePermission(models.PermTagManage), controllers.DeleteTag)
 			}
 
 			// 文件管理
-			files := protected.Group("/files")
+			files := protected.Group("/files", middlewares.RequireScope("files"))
 			{
 				files.GET("/", controllers.GetFiles)
-				files.POST("/upload", controllers.UploadFile)
+				files.POST("/upload", middlewares.RequirePermission(models.PermFileUpload), controllers.UploadFile)
 				files.GET("/:id", controllers.GetFile)
 				files.PUT("/:id", controllers.UpdateFile)
 				files.DELETE("/:id", controllers.DeleteFile)
 				files.POST("/:id/restore", controllers.RestoreFile)
+				files.GET("/:id/links", controllers.GetFileLinks)
 				files.GET("/:id/content", controllers.GetFileContent)
 				files.PUT("/:id/content", controllers.UpdateFileContent)
+				files.PUT("/:id/owner", controllers.TransferFile)
+
+				// 访问控制
+				files.GET("/:id/acl", controllers.GetFileACL)
+				files.POST("/:id/acl", controllers.CreateFileACL)
+				files.GET("/:id/permissions", controllers.GetFilePermissions)
 
 				// 文件批量操作
 				files.POST("/batch-delete", controllers.BatchDeleteFiles)
 				files.POST("/batch-restore", controllers.BatchRestoreFiles)
 			}
 
+			// 文件和分类的访问控制条目
+			acl := protected.Group("/acl", middlewares.RequireScope("files"))
+			{
+				acl.PUT("/:id", controllers.UpdateACLEntry)
+				acl.DELETE("/:id", controllers.DeleteACLEntry)
+			}
+
 			// 回收站
-			recycle := protected.Group("/recycle")
+			recycle := protected.Group("/recycle", middlewares.RequireScope("files"))
 			{
 				recycle.GET("/", controllers.GetDeletedFiles)
 				recycle.DELETE("/empty", controllers.EmptyRecycleBin)
@@ -85,46 +171,185 @@ func SetupRoutes(r *gin.Engine) {
 			}
 
 			// 表单结构管理
-			forms := protected.Group("/forms")
+			forms := protected.Group("/forms", middlewares.RequireScope("forms"))
 			{
 				forms.GET("/", controllers.GetFormSchemas)
-				forms.POST("/", controllers.CreateFormSchema)
+				forms.POST("/", middlewares.RequirePermission(models.PermFormCreate), controllers.CreateFormSchema)
 				forms.GET("/:id", controllers.GetFormSchema)
 				forms.PUT("/:id", controllers.UpdateFormSchema)
 				forms.DELETE("/:id", controllers.DeleteFormSchema)
+				forms.PUT("/:id/storage", controllers.ChangeFormStorage)
+				forms.PUT("/:id/owner", controllers.TransferFormSchema)
+				forms.POST("/:id/clone", middlewares.RequirePermission(models.PermFormCreate), controllers.CloneFormSchema)
+
+				// JSON Schema 导入导出
+				forms.GET("/:id/json-schema", controllers.ExportFormJSONSchema)
+				forms.PUT("/:id/json-schema", controllers.ReplaceFormJSONSchema)
+				forms.POST("/json-schema", middlewares.RequirePermission(models.PermFormCreate), controllers.ImportFormJSONSchema)
+
+				// 公开填写链接
+				forms.GET("/:id/publication", controllers.GetFormPublication)
+				forms.PUT("/:id/publication", controllers.SaveFormPublication)
+				forms.DELETE("/:id/publication", controllers.DeleteFormPublication)
+
+				// 共享设置
+				forms.GET("/:id/shares", controllers.GetFormShares)
+				forms.POST("/:id/shares", controllers.CreateFormShare)
+				forms.PUT("/shares/:id", controllers.UpdateFormShare)
+				forms.DELETE("/shares/:id", controllers.DeleteFormShare)
+			}
+
+			// 表单模板
+			formTemplates := protected.Group("/forms", middlewares.RequireScope("forms"))
+			{
+				formTemplates.GET("/templates", controllers.GetFormTemplates)
+				formTemplates.POST("/templates", controllers.CreateFormTemplate)
+				formTemplates.GET("/templates/:id", controllers.GetFormTemplate)
+				formTemplates.PUT("/templates/:id", controllers.UpdateFormTemplate)
+				formTemplates.DELETE("/templates/:id", controllers.DeleteFormTemplate)
+				formTemplates.POST("/templates/:id/use", middlewares.RequirePermission(models.PermFormCreate), controllers.UseFormTemplate)
+				formTemplates.POST("/:id/template", controllers.SaveFormSchemaAsTemplate)
 			}
 
 			// 表单数据管理
-			formRecords := protected.Group("/forms")
+			formRecords := protected.Group("/forms", middlewares.RequireScope("forms"))
 			{
 				formRecords.GET("/:id/records", controllers.GetFormRecords)
+				formRecords.GET("/:id/export", controllers.ExportFormRecords)
+				formRecords.POST("/:id/aggregate", controllers.AggregateFormRecords)
 				formRecords.POST("/records", controllers.CreateFormRecord)
 				formRecords.GET("/records/:id", controllers.GetFormRecord)
 				formRecords.PUT("/records/:id", controllers.UpdateFormRecord)
 				formRecords.DELETE("/records/:id", controllers.DeleteFormRecord)
+				formRecords.POST("/records/:id/restore", controllers.RestoreFormRecord)
+
+				// 批量操作
+				formRecords.POST("/:id/records/batch-delete", controllers.BatchDeleteFormRecords)
+				formRecords.POST("/:id/records/batch-update", controllers.BatchUpdateFormRecords)
+				formRecords.POST("/:id/records/batch-duplicate", controllers.BatchDuplicateFormRecords)
+
+				// 修订历史
+				formRecords.GET("/records/:id/revisions", controllers.GetFormRecordRevisions)
+				formRecords.GET("/records/:id/revisions/compare", controllers.CompareFormRecordRevisions)
+				formRecords.GET("/records/:id/revisions/:version", controllers.GetFormRecordRevision)
+				formRecords.POST("/records/:id/revisions/:version/restore", controllers.RestoreFormRecordRevision)
+
+				// 工作流
+				formRecords.GET("/records/:id/workflow", controllers.GetFormRecordWorkflow)
+				formRecords.POST("/records/:id/transitions", controllers.TransitionFormRecord)
+				formRecords.PUT("/records/:id/assignees", controllers.SetFormRecordAssignees)
+				formRecords.GET("/pending", controllers.GetPendingFormRecords)
+			}
+
+			// 表单统计报表
+			formReports := protected.Group("/forms", middlewares.RequireScope("forms"))
+			{
+				formReports.GET("/:id/reports", controllers.GetFormReports)
+				formReports.POST("/:id/reports", controllers.CreateFormReport)
+				formReports.GET("/reports/:id", controllers.GetFormReport)
+				formReports.PUT("/reports/:id", controllers.UpdateFormReport)
+				formReports.DELETE("/reports/:id", controllers.DeleteFormReport)
+				formReports.GET("/reports/:id/run", controllers.RunFormReport)
+			}
+
+			// 表单记录回收站
+			formRecycle := protected.Group("/forms/recycle", middlewares.RequireScope("forms"))
+			{
+				formRecycle.GET("/", controllers.GetDeletedFormRecords)
+				formRecycle.DELETE("/empty", controllers.EmptyFormRecycleBin)
+				formRecycle.DELETE("/:id", controllers.PermanentDeleteFormRecord)
+			}
+
+			// 表单数据导入
+			formImports := protected.Group("/forms", middlewares.RequireScope("forms"))
+			{
+				formImports.POST("/:id/import/preview", controllers.PreviewFormImport)
+				formImports.POST("/:id/import", controllers.CreateFormImport)
+				formImports.GET("/:id/import-jobs", controllers.GetFormImportJobs)
+				formImports.GET("/import-jobs/:id", controllers.GetFormImportJob)
+				formImports.GET("/import-jobs/:id/errors", controllers.DownloadFormImportErrors)
+			}
+
+			// Webhook
+			webhooks := protected.Group("/webhooks", middlewares.RequireScope("webhooks"))
+			{
+				webhooks.GET("/events", controllers.GetWebhookEvents)
+				webhooks.GET("/", controllers.GetWebhooks)
+				webhooks.POST("/", middlewares.RequirePermission(models.PermWebhookCreate), controllers.CreateWebhook)
+				webhooks.GET("/:id", controllers.GetWebhook)
+				webhooks.PUT("/:id", middlewares.RequirePermission(models.PermWebhookCreate), controllers.UpdateWebhook)
+				webhooks.DELETE("/:id", controllers.DeleteWebhook)
+				webhooks.POST("/:id/secret", controllers.RotateWebhookSecret)
+				webhooks.POST("/:id/ping", controllers.PingWebhook)
+				webhooks.GET("/:id/deliveries", controllers.GetWebhookDeliveries)
+				webhooks.GET("/deliveries/:id", controllers.GetWebhookDelivery)
+				webhooks.POST("/deliveries/:id/redeliver", controllers.RedeliverWebhookDelivery)
 			}
 
 			// 通用资源上传（用于表单字段）
-			assets := protected.Group("/assets")
+			assets := protected.Group("/assets", middlewares.RequireScope("forms"))
 			{
 				assets.POST("/upload", controllers.UploadAsset)
+				assets.GET("/:id", controllers.GetAsset)
 			}
 		}
 
 		// 管理员路由
 		admin := api.Group("/admin")
-		admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+		admin.Use(middlewares.AuthMiddleware(), middlewares.RequireScope("admin"))
 		{
 			// 用户管理
-			adminUsers := admin.Group("/users")
+			adminUsers := admin.Group("/users", middlewares.RequirePermission(models.PermUserManage))
 			{
 				adminUsers.GET("/", controllers.GetAllUsers)
 				adminUsers.PUT("/:id", controllers.UpdateUserByAdmin)
 				adminUsers.DELETE("/:id", controllers.DeleteUser)
+				adminUsers.POST("/:id/revoke-sessions", controllers.RevokeUserSessionsByAdmin)
+				adminUsers.PUT("/:id/password", controllers.SetUserPasswordByAdmin)
+				adminUsers.POST("/:id/unlock", controllers.UnlockUser)
+				adminUsers.DELETE("/:id/2fa", controllers.ResetTwoFactorByAdmin)
 			}
 
-			// 系统统计
-			admin.GET("/stats", controllers.GetSystemStats)
+			// 个人访问令牌管理
+			adminTokens := admin.Group("/access-tokens", middlewares.RequirePermission(models.PermUserManage))
+			{
+				adminTokens.GET("/", controllers.GetAllAccessTokens)
+				adminTokens.DELETE("/:id", controllers.RevokeAccessTokenByAdmin)
+			}
+
+			// 登录锁定记录
+			adminLockouts := admin.Group("/login-lockouts", middlewares.RequirePermission(models.PermUserManage))
+			{
+				adminLockouts.GET("/", controllers.GetLoginLockouts)
+				adminLockouts.POST("/:id/unlock", controllers.UnlockLoginLockout)
+			}
+
+			// 用户组管理
+			adminGroups := admin.Group("/groups", middlewares.RequirePermission(models.PermGroupManage))
+			{
+				adminGroups.GET("/", controllers.GetUserGroups)
+				adminGroups.POST("/", controllers.CreateUserGroup)
+				adminGroups.PUT("/:id", controllers.UpdateUserGroup)
+				adminGroups.DELETE("/:id", controllers.DeleteUserGroup)
+				adminGroups.PUT("/:id/members", controllers.SetUserGroupMembers)
+			}
+
+			// 角色管理
+			adminRoles := admin.Group("/roles", middlewares.RequirePermission(models.PermRoleManage))
+			{
+				adminRoles.GET("/permissions", controllers.GetPermissions)
+				adminRoles.GET("/", controllers.GetRoles)
+				adminRoles.POST("/", controllers.CreateRole)
+				adminRoles.PUT("/:id", controllers.UpdateRole)
+				adminRoles.DELETE("/:id", controllers.DeleteRole)
+			}
+
+			// 系统维护
+			system := admin.Group("/", middlewares.RequirePermission(models.PermSystemManage))
+			{
+				system.GET("/stats", controllers.GetSystemStats)
+				system.DELETE("/assets/orphans", controllers.CleanupOrphanAssets)
+			}
 		}
 	}
 }
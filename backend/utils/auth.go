@@ -8,14 +8,27 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// JWT密钥，实际应用中应该从环境变量读取
-var jwtSecret = []byte("material-platform-secret-key")
+// 服务端密钥，用于人机验证题目等内部签名，由配置加载
+var serverSecret []byte
+
+// SetServerSecret 设置服务端密钥
+func SetServerSecret(secret []byte) {
+	serverSecret = secret
+}
+
+// 令牌有效期
+const (
+	AccessTokenTTL  = 15 * time.Minute    // 访问令牌
+	RefreshTokenTTL = 30 * 24 * time.Hour // 刷新令牌，每次刷新后重新计算
+)
 
 // Claims JWT Claims结构
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID       uint   `json:"user_id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	SessionID    uint   `json:"sid"`
+	TokenVersion int    `json:"ver"`
 	jwt.RegisteredClaims
 }
 
@@ -31,28 +44,35 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateToken 生成JWT Token
-func GenerateToken(userID uint, username, role string) (string, error) {
+// GenerateToken 生成JWT访问令牌，令牌绑定登录会话和用户的令牌版本
+func GenerateToken(userID uint, username, role string, sessionID uint, tokenVersion int) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:       userID,
+		Username:     username,
+		Role:         role,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
 }
 
-// ParseToken 解析JWT Token
+// ParseToken 解析JWT Token，按令牌头中的kid选择验证密钥
 func ParseToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, lookupVerifyKey,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
 
 	if err != nil {
 		return nil, err
@@ -63,4 +83,4 @@ func ParseToken(tokenString string) (*Claims, error) {
 	}
 
 	return nil, errors.New("invalid token")
-}
\ No newline at end of file
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// 人机验证方式
+const (
+	ChallengeNone = "none" // 不验证
+	ChallengeMath = "math" // 算术题
+	ChallengePoW  = "pow"  // 工作量证明：客户端找出 answer 使 SHA256(challenge + ":" + answer) 前 difficulty 位为0
+)
+
+// MaxPoWDifficulty 工作量证明允许的最大难度(前导0位数)
+const MaxPoWDifficulty = 28
+
+// challengePayload 验证题目中携带的信息，由服务端签名，无需在服务端保存
+type challengePayload struct {
+	Type       string `json:"t"`
+	Nonce      string `json:"n"`
+	Scope      string `json:"s"`
+	Difficulty int    `json:"d,omitempty"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+// Challenge 下发给客户端的验证题目
+type Challenge struct {
+	Type       string    `json:"type"`
+	Token      string    `json:"token"`
+	Question   string    `json:"question,omitempty"`   // 算术题题目
+	Difficulty int       `json:"difficulty,omitempty"` // 工作量证明难度
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RandomToken 生成n字节的随机字符串(十六进制)
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashToken 计算令牌的SHA256摘要，用于保存令牌而不保存原文
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewChallenge 生成验证题目，scope用于限定题目只能在指定对象上使用
+func NewChallenge(challengeType, scope string, difficulty int, ttl time.Duration) (*Challenge, error) {
+	nonce, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := challengePayload{
+		Type:      challengeType,
+		Nonce:     nonce,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	challenge := &Challenge{Type: challengeType, ExpiresAt: time.Unix(payload.ExpiresAt, 0)}
+
+	// 算术题的答案参与签名，题目本身不包含答案
+	answer := ""
+	switch challengeType {
+	case ChallengeMath:
+		a, _ := rand.Int(rand.Reader, big.NewInt(20))
+		b, _ := rand.Int(rand.Reader, big.NewInt(20))
+		x, y := a.Int64()+1, b.Int64()+1
+		challenge.Question = fmt.Sprintf("%d + %d = ?", x, y)
+		answer = fmt.Sprint(x + y)
+	case ChallengePoW:
+		if difficulty < 1 || difficulty > MaxPoWDifficulty {
+			return nil, fmt.Errorf("工作量证明难度必须在1到%d之间", MaxPoWDifficulty)
+		}
+		payload.Difficulty = difficulty
+		challenge.Difficulty = difficulty
+	default:
+		return nil, errors.New("不支持的验证方式")
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	challenge.Token = encoded + "." + signChallenge(encoded, answer)
+	return challenge, nil
+}
+
+// ErrChallengeWrongAnswer 算术题答案错误
+var ErrChallengeWrongAnswer = errors.New("验证答案错误，请重新获取")
+
+// VerifyChallenge 校验客户端提交的验证结果，返回题目的nonce(用于防止重复使用)
+// claim 在比较答案之前调用，用于登记题目已被作答，返回错误时不再比较答案；
+// 每道题只能作答一次，答错后即失效，避免对同一道算术题逐个尝试答案
+func VerifyChallenge(token, answer, scope string, claim func(nonce string) error) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", errors.New("验证信息格式错误")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errors.New("验证信息格式错误")
+	}
+	var payload challengePayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return "", errors.New("验证信息格式错误")
+	}
+	if payload.Scope != scope {
+		return "", errors.New("验证信息无效")
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return "", errors.New("验证已过期，请重新获取")
+	}
+
+	answer = strings.TrimSpace(answer)
+	switch payload.Type {
+	case ChallengeMath:
+		if err := claim(payload.Nonce); err != nil {
+			return "", err
+		}
+		if !hmac.Equal([]byte(parts[1]), []byte(signChallenge(parts[0], answer))) {
+			return "", ErrChallengeWrongAnswer
+		}
+	case ChallengePoW:
+		if !hmac.Equal([]byte(parts[1]), []byte(signChallenge(parts[0], ""))) {
+			return "", errors.New("验证信息无效")
+		}
+		if err := claim(payload.Nonce); err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(token + ":" + answer))
+		if leadingZeroBits(sum[:]) < payload.Difficulty {
+			return "", errors.New("工作量证明校验失败")
+		}
+	default:
+		return "", errors.New("验证信息无效")
+	}
+
+	return payload.Nonce, nil
+}
+
+// signChallenge 使用服务端密钥对题目签名
+func signChallenge(payload, answer string) string {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte("challenge:" + payload + ":" + answer))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// leadingZeroBits 计算字节序列的前导0位数
+func leadingZeroBits(data []byte) int {
+	count := 0
+	for _, b := range data {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
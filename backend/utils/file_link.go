@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// SignFileLink 为文件预览、下载链接签名，链接只对指定文件和用户在过期前有效
+func SignFileLink(fileID, userID uint, expires int64) string {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte(fmt.Sprintf("file:%d:%d:%d", fileID, userID, expires)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyFileLink 校验文件链接的签名和有效期
+func VerifyFileLink(fileID, userID uint, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(SignFileLink(fileID, userID, expires)))
+}
+
+// SignAssetLink 为表单资源文件链接签名，链接在过期前对持有者有效，只在通过权限检查的响应中生成
+func SignAssetLink(assetID uint, expires int64) string {
+	mac := hmac.New(sha256.New, serverSecret)
+	mac.Write([]byte(fmt.Sprintf("asset:%d:%d", assetID, expires)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAssetLink 校验资源文件链接的签名和有效期
+func VerifyAssetLink(assetID uint, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(SignAssetLink(assetID, expires)))
+}
@@ -0,0 +1,1115 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 公式长度与嵌套深度限制，防止构造过于复杂的表达式
+const (
+	formulaMaxLength = 2000
+	formulaMaxDepth  = 64
+)
+
+// formulaTimeLayouts 公式中解析时间文本时依次尝试的布局
+var formulaTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"15:04:05",
+}
+
+// FormulaEnv 公式求值环境，提供当前记录的字段值和关联记录的字段值
+type FormulaEnv interface {
+	// FieldValue 返回当前记录中字段的值
+	FieldValue(name string) interface{}
+	// RelatedValues 返回关联字段所关联记录中目标字段的值列表
+	RelatedValues(field, target string) ([]interface{}, error)
+}
+
+// FormulaRef 公式引用的字段，Target不为空时表示引用关联记录中的字段
+type FormulaRef struct {
+	Field  string
+	Target string
+}
+
+// Formula 解析后的公式
+type Formula struct {
+	root formulaNode
+	refs []FormulaRef
+}
+
+// ParseFormula 解析公式表达式
+//
+// 支持的语法：
+//   - 数字、'文本'或"文本"、true、false、null
+//   - 字段引用：字段名 或 {字段名}；关联记录字段：关联字段.字段名
+//   - 运算符：+ - * / %、& (文本拼接)、= == != <> < <= > >=、&& || ! (AND OR NOT)
+//   - 函数：IF、AND、OR、NOT、SUM、AVG、MIN、MAX、COUNT、ROUND、FLOOR、CEIL、ABS、
+//     CONCAT、LEN、UPPER、LOWER、TRIM、TEXT、VALUE、COALESCE、
+//     NOW、TODAY、DATE、DATE_ADD、DATE_DIFF、YEAR、MONTH、DAY
+func ParseFormula(expr string) (*Formula, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, fmt.Errorf("公式不能为空")
+	}
+	if len(expr) > formulaMaxLength {
+		return nil, fmt.Errorf("公式长度不能超过%d个字符", formulaMaxLength)
+	}
+
+	tokens, err := tokenizeFormula(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &formulaParser{tokens: tokens}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("公式在 '%s' 附近有多余内容", p.peek().text)
+	}
+
+	return &Formula{root: root, refs: p.refs}, nil
+}
+
+// Refs 返回公式引用的字段
+func (f *Formula) Refs() []FormulaRef {
+	return f.refs
+}
+
+// Eval 在给定环境中计算公式的值
+// 结果类型为 float64、string、bool、time.Time、[]interface{} 或 nil，数值结果溢出或无意义(NaN、±Inf)时返回错误
+func (f *Formula) Eval(env FormulaEnv) (interface{}, error) {
+	value, err := f.root.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := value.(float64); ok && (math.IsNaN(n) || math.IsInf(n, 0)) {
+		return nil, fmt.Errorf("计算结果不是有效的数字")
+	}
+	return value, nil
+}
+
+// ---------- 词法分析 ----------
+
+type formulaTokenKind int
+
+const (
+	tokenEOF formulaTokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenField
+	tokenOp
+)
+
+type formulaToken struct {
+	kind formulaTokenKind
+	text string
+}
+
+// tokenizeFormula 将公式拆分为词法单元
+func tokenizeFormula(expr string) ([]formulaToken, error) {
+	var tokens []formulaToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, formulaToken{tokenNumber, string(runes[start:i])})
+
+		case r == '\'' || r == '"':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("公式中的文本缺少结束引号")
+			}
+			tokens = append(tokens, formulaToken{tokenString, sb.String()})
+
+		case r == '{':
+			end := i + 1
+			for end < len(runes) && runes[end] != '}' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("公式中的字段引用缺少 '}'")
+			}
+			name := strings.TrimSpace(string(runes[i+1 : end]))
+			if name == "" {
+				return nil, fmt.Errorf("公式中的字段引用不能为空")
+			}
+			tokens = append(tokens, formulaToken{tokenField, name})
+			i = end + 1
+
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, formulaToken{tokenIdent, string(runes[start:i])})
+
+		default:
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<>", "<=", ">=", "&&", "||":
+					tokens = append(tokens, formulaToken{tokenOp, two})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("+-*/%&=<>!(),.", r) {
+				tokens = append(tokens, formulaToken{tokenOp, string(r)})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("公式中包含无效字符 '%c'", r)
+		}
+	}
+
+	return append(tokens, formulaToken{kind: tokenEOF}), nil
+}
+
+// ---------- 语法分析 ----------
+
+type formulaParser struct {
+	tokens []formulaToken
+	pos    int
+	depth  int
+	refs   []FormulaRef
+}
+
+func (p *formulaParser) peek() formulaToken {
+	return p.tokens[p.pos]
+}
+
+func (p *formulaParser) next() formulaToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// isOp 判断当前词法单元是否为指定运算符或关键字(关键字不区分大小写)
+func (p *formulaParser) isOp(ops ...string) (string, bool) {
+	token := p.peek()
+	for _, op := range ops {
+		if token.kind == tokenOp && token.text == op {
+			return op, true
+		}
+		if token.kind == tokenIdent && strings.EqualFold(token.text, op) && p.tokens[p.pos+1].text != "(" {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *formulaParser) expect(op string) error {
+	if _, ok := p.isOp(op); !ok {
+		return fmt.Errorf("公式缺少 '%s'", op)
+	}
+	p.next()
+	return nil
+}
+
+// 运算符优先级，数值越大优先级越高
+var formulaBinaryLevels = [][]string{
+	{"||", "OR"},
+	{"&&", "AND"},
+	{"=", "==", "!=", "<>", "<", "<=", ">", ">="},
+	{"&"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// parseExpr 按优先级解析二元运算表达式
+func (p *formulaParser) parseExpr(level int) (formulaNode, error) {
+	if level >= len(formulaBinaryLevels) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseExpr(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.isOp(formulaBinaryLevels[level]...)
+		if !ok {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseExpr(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: normalizeFormulaOp(op), left: left, right: right}
+	}
+}
+
+// parseUnary 解析一元运算 (- ! NOT)
+func (p *formulaParser) parseUnary() (formulaNode, error) {
+	if op, ok := p.isOp("-", "!", "NOT"); ok {
+		p.next()
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > formulaMaxDepth {
+			return nil, fmt.Errorf("公式嵌套层级过深")
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: normalizeFormulaOp(op), operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary 解析字面量、字段引用、函数调用和括号表达式
+func (p *formulaParser) parsePrimary() (formulaNode, error) {
+	token := p.next()
+
+	switch token.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的数字 '%s'", token.text)
+		}
+		return &literalNode{value: n}, nil
+
+	case tokenString:
+		return &literalNode{value: token.text}, nil
+
+	case tokenField:
+		return p.parseFieldRef(token.text)
+
+	case tokenIdent:
+		switch strings.ToLower(token.text) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+
+		if _, ok := p.isOp("("); ok {
+			return p.parseCall(token.text)
+		}
+		return p.parseFieldRef(token.text)
+
+	case tokenOp:
+		if token.text == "(" {
+			node, err := p.parseSubExpr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	}
+
+	if token.kind == tokenEOF {
+		return nil, fmt.Errorf("公式不完整")
+	}
+	return nil, fmt.Errorf("公式在 '%s' 附近有语法错误", token.text)
+}
+
+// parseSubExpr 解析括号或函数参数中的表达式，并限制嵌套深度
+func (p *formulaParser) parseSubExpr() (formulaNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > formulaMaxDepth {
+		return nil, fmt.Errorf("公式嵌套层级过深")
+	}
+	return p.parseExpr(0)
+}
+
+// parseFieldRef 解析字段引用，支持 关联字段.目标字段
+func (p *formulaParser) parseFieldRef(name string) (formulaNode, error) {
+	node := &fieldNode{field: name}
+	if _, ok := p.isOp("."); ok {
+		p.next()
+		target := p.next()
+		if target.kind != tokenIdent && target.kind != tokenField {
+			return nil, fmt.Errorf("字段 '%s' 后缺少关联记录的字段名", name)
+		}
+		node.target = target.text
+	}
+	p.refs = append(p.refs, FormulaRef{Field: node.field, Target: node.target})
+	return node, nil
+}
+
+// parseCall 解析函数调用
+func (p *formulaParser) parseCall(name string) (formulaNode, error) {
+	name = strings.ToUpper(name)
+	spec, ok := formulaFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的函数 '%s'", name)
+	}
+
+	p.next() // (
+	var args []formulaNode
+	if _, ok := p.isOp(")"); !ok {
+		for {
+			arg, err := p.parseSubExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.isOp(","); !ok {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) < spec.minArgs || (spec.maxArgs >= 0 && len(args) > spec.maxArgs) {
+		return nil, fmt.Errorf("函数 %s 的参数个数不正确", name)
+	}
+	return &callNode{name: name, args: args}, nil
+}
+
+// normalizeFormulaOp 统一运算符写法
+func normalizeFormulaOp(op string) string {
+	switch strings.ToUpper(op) {
+	case "OR":
+		return "||"
+	case "AND":
+		return "&&"
+	case "NOT":
+		return "!"
+	case "==":
+		return "="
+	case "<>":
+		return "!="
+	}
+	return op
+}
+
+// ---------- 语法树与求值 ----------
+
+type formulaNode interface {
+	eval(env FormulaEnv) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env FormulaEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type fieldNode struct {
+	field  string
+	target string
+}
+
+func (n *fieldNode) eval(env FormulaEnv) (interface{}, error) {
+	if n.target == "" {
+		return normalizeFormulaValue(env.FieldValue(n.field)), nil
+	}
+	values, err := env.RelatedValues(n.field, n.target)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, len(values))
+	for i, value := range values {
+		list[i] = normalizeFormulaValue(value)
+	}
+	return list, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand formulaNode
+}
+
+func (n *unaryNode) eval(env FormulaEnv) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !formulaTruthy(value), nil
+	}
+	if value == nil {
+		return nil, nil
+	}
+	number, err := formulaNumber(value)
+	if err != nil {
+		return nil, err
+	}
+	return -number, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right formulaNode
+}
+
+func (n *binaryNode) eval(env FormulaEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逻辑运算短路求值
+	switch n.op {
+	case "&&":
+		if !formulaTruthy(left) {
+			return false, nil
+		}
+		right, err := n.right.eval(env)
+		return formulaTruthy(right), err
+	case "||":
+		if formulaTruthy(left) {
+			return true, nil
+		}
+		right, err := n.right.eval(env)
+		return formulaTruthy(right), err
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&":
+		return formulaText(left) + formulaText(right), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return formulaCompare(n.op, left, right)
+	default:
+		return formulaArithmetic(n.op, left, right)
+	}
+}
+
+type callNode struct {
+	name string
+	args []formulaNode
+}
+
+func (n *callNode) eval(env FormulaEnv) (interface{}, error) {
+	// IF 只计算被选中的分支
+	if n.name == "IF" {
+		cond, err := n.args[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if formulaTruthy(cond) {
+			return n.args[1].eval(env)
+		}
+		if len(n.args) > 2 {
+			return n.args[2].eval(env)
+		}
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return formulaFuncs[n.name].fn(args)
+}
+
+// normalizeFormulaValue 将字段值转换为公式内部使用的类型
+func normalizeFormulaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case []uint:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = float64(item)
+		}
+		return list
+	case []string:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = item
+		}
+		return list
+	}
+	return value
+}
+
+// formulaTruthy 判断值的真假
+func formulaTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// formulaNumber 将值转换为数字，空值视为0
+func formulaNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' 不是有效的数字", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("无法将 %v 转换为数字", value)
+}
+
+// formulaText 将值转换为文本
+func formulaText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formulaText(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// formulaTime 将值转换为时间
+func formulaTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		text := strings.TrimSpace(v)
+		for _, layout := range formulaTimeLayouts {
+			if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// formulaArithmetic 计算算术运算，支持 时间±天数 与 时间-时间(天数)
+func formulaArithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil && right == nil {
+		return nil, nil
+	}
+
+	if lt, ok := left.(time.Time); ok {
+		switch op {
+		case "+", "-":
+			if rt, ok := formulaTime(right); ok && op == "-" {
+				return lt.Sub(rt).Hours() / 24, nil
+			}
+			days, err := formulaNumber(right)
+			if err != nil {
+				return nil, err
+			}
+			if op == "-" {
+				days = -days
+			}
+			return lt.Add(time.Duration(days * float64(24*time.Hour))), nil
+		}
+		return nil, fmt.Errorf("时间不支持 '%s' 运算", op)
+	}
+
+	// 文本相加视为拼接
+	if op == "+" {
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			if _, err := formulaNumber(left); err != nil {
+				return formulaText(left) + formulaText(right), nil
+			}
+			if _, err := formulaNumber(right); err != nil {
+				return formulaText(left) + formulaText(right), nil
+			}
+		}
+	}
+
+	a, err := formulaNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := formulaNumber(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("除数不能为0")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("除数不能为0")
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("不支持的运算符 '%s'", op)
+}
+
+// formulaCompare 比较两个值，数字、时间按大小比较，其余按文本比较
+func formulaCompare(op string, left, right interface{}) (interface{}, error) {
+	var cmp int
+
+	switch {
+	case left == nil || right == nil:
+		if op != "=" && op != "!=" {
+			return false, nil
+		}
+		equal := (left == nil || left == "") && (right == nil || right == "")
+		return equal == (op == "="), nil
+
+	case isFormulaTime(left) || isFormulaTime(right):
+		lt, lok := formulaTime(left)
+		rt, rok := formulaTime(right)
+		if !lok || !rok {
+			return nil, fmt.Errorf("无法比较时间与非时间值")
+		}
+		cmp = lt.Compare(rt)
+
+	default:
+		a, aerr := formulaNumber(left)
+		b, berr := formulaNumber(right)
+		_, lb := left.(bool)
+		_, rb := right.(bool)
+		if aerr == nil && berr == nil && lb == rb {
+			switch {
+			case a < b:
+				cmp = -1
+			case a > b:
+				cmp = 1
+			}
+		} else {
+			cmp = strings.Compare(formulaText(left), formulaText(right))
+		}
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func isFormulaTime(value interface{}) bool {
+	_, ok := value.(time.Time)
+	return ok
+}
+
+// ---------- 内置函数 ----------
+
+type formulaFunc struct {
+	minArgs int
+	maxArgs int // -1 表示不限
+	fn      func(args []interface{}) (interface{}, error)
+}
+
+var formulaFuncs map[string]formulaFunc
+
+func init() {
+	formulaFuncs = map[string]formulaFunc{
+		"IF": {2, 3, nil}, // 在callNode中惰性求值
+		"AND": {1, -1, func(args []interface{}) (interface{}, error) {
+			for _, arg := range flattenFormulaArgs(args) {
+				if !formulaTruthy(arg) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}},
+		"OR": {1, -1, func(args []interface{}) (interface{}, error) {
+			for _, arg := range flattenFormulaArgs(args) {
+				if formulaTruthy(arg) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}},
+		"NOT": {1, 1, func(args []interface{}) (interface{}, error) {
+			return !formulaTruthy(args[0]), nil
+		}},
+
+		// 聚合函数，参数可以是关联记录的字段值列表
+		"SUM":   {1, -1, formulaAggregate("SUM")},
+		"AVG":   {1, -1, formulaAggregate("AVG")},
+		"MIN":   {1, -1, formulaAggregate("MIN")},
+		"MAX":   {1, -1, formulaAggregate("MAX")},
+		"COUNT": {1, -1, formulaAggregate("COUNT")},
+
+		// 数学函数
+		"ROUND": {1, 2, func(args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			n, err := formulaNumber(args[0])
+			if err != nil {
+				return nil, err
+			}
+			digits := 0.0
+			if len(args) > 1 {
+				if digits, err = formulaNumber(args[1]); err != nil {
+					return nil, err
+				}
+			}
+			return RoundFloat(n, int(digits)), nil
+		}},
+		"FLOOR": {1, 1, formulaMath(math.Floor)},
+		"CEIL":  {1, 1, formulaMath(math.Ceil)},
+		"ABS":   {1, 1, formulaMath(math.Abs)},
+
+		// 文本函数
+		"CONCAT": {1, -1, func(args []interface{}) (interface{}, error) {
+			var sb strings.Builder
+			for _, arg := range flattenFormulaArgs(args) {
+				sb.WriteString(formulaText(arg))
+			}
+			return sb.String(), nil
+		}},
+		"LEN": {1, 1, func(args []interface{}) (interface{}, error) {
+			if list, ok := args[0].([]interface{}); ok {
+				return float64(len(list)), nil
+			}
+			return float64(len([]rune(formulaText(args[0])))), nil
+		}},
+		"UPPER": {1, 1, formulaString(strings.ToUpper)},
+		"LOWER": {1, 1, formulaString(strings.ToLower)},
+		"TRIM":  {1, 1, formulaString(strings.TrimSpace)},
+		"TEXT": {1, 1, func(args []interface{}) (interface{}, error) {
+			return formulaText(args[0]), nil
+		}},
+		"VALUE": {1, 1, func(args []interface{}) (interface{}, error) {
+			return formulaNumber(args[0])
+		}},
+		"COALESCE": {1, -1, func(args []interface{}) (interface{}, error) {
+			for _, arg := range args {
+				if arg != nil && arg != "" {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}},
+
+		// 日期函数
+		"NOW": {0, 0, func(args []interface{}) (interface{}, error) {
+			return time.Now(), nil
+		}},
+		"TODAY": {0, 0, func(args []interface{}) (interface{}, error) {
+			now := time.Now()
+			return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), nil
+		}},
+		"DATE": {1, 3, func(args []interface{}) (interface{}, error) {
+			if len(args) == 1 {
+				if args[0] == nil {
+					return nil, nil
+				}
+				t, ok := formulaTime(args[0])
+				if !ok {
+					return nil, fmt.Errorf("'%s' 不是有效的时间", formulaText(args[0]))
+				}
+				return t, nil
+			}
+			if len(args) != 3 {
+				return nil, fmt.Errorf("函数 DATE 的参数个数不正确")
+			}
+			parts := make([]int, 3)
+			for i, arg := range args {
+				n, err := formulaNumber(arg)
+				if err != nil {
+					return nil, err
+				}
+				parts[i] = int(n)
+			}
+			return time.Date(parts[0], time.Month(parts[1]), parts[2], 0, 0, 0, 0, time.Local), nil
+		}},
+		"DATE_ADD": {3, 3, func(args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			t, ok := formulaTime(args[0])
+			if !ok {
+				return nil, fmt.Errorf("'%s' 不是有效的时间", formulaText(args[0]))
+			}
+			n, err := formulaNumber(args[1])
+			if err != nil {
+				return nil, err
+			}
+			switch strings.ToLower(formulaText(args[2])) {
+			case "year", "years":
+				return t.AddDate(int(n), 0, 0), nil
+			case "month", "months":
+				return t.AddDate(0, int(n), 0), nil
+			case "day", "days":
+				return t.AddDate(0, 0, int(n)), nil
+			case "hour", "hours":
+				return t.Add(time.Duration(n * float64(time.Hour))), nil
+			case "minute", "minutes":
+				return t.Add(time.Duration(n * float64(time.Minute))), nil
+			}
+			return nil, fmt.Errorf("不支持的时间单位 '%s'", formulaText(args[2]))
+		}},
+		"DATE_DIFF": {2, 3, func(args []interface{}) (interface{}, error) {
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			a, aok := formulaTime(args[0])
+			b, bok := formulaTime(args[1])
+			if !aok || !bok {
+				return nil, fmt.Errorf("DATE_DIFF 的参数必须是时间")
+			}
+			unit := "days"
+			if len(args) > 2 {
+				unit = strings.ToLower(formulaText(args[2]))
+			}
+			diff := a.Sub(b)
+			switch unit {
+			case "day", "days":
+				return math.Trunc(diff.Hours() / 24), nil
+			case "hour", "hours":
+				return math.Trunc(diff.Hours()), nil
+			case "minute", "minutes":
+				return math.Trunc(diff.Minutes()), nil
+			case "month", "months":
+				months := (a.Year()-b.Year())*12 + int(a.Month()) - int(b.Month())
+				return float64(months), nil
+			case "year", "years":
+				return float64(a.Year() - b.Year()), nil
+			}
+			return nil, fmt.Errorf("不支持的时间单位 '%s'", unit)
+		}},
+		"YEAR":  {1, 1, formulaDatePart(func(t time.Time) int { return t.Year() })},
+		"MONTH": {1, 1, formulaDatePart(func(t time.Time) int { return int(t.Month()) })},
+		"DAY":   {1, 1, formulaDatePart(func(t time.Time) int { return t.Day() })},
+	}
+}
+
+// flattenFormulaArgs 展开参数中的列表(关联记录的字段值)
+func flattenFormulaArgs(args []interface{}) []interface{} {
+	var values []interface{}
+	for _, arg := range args {
+		if list, ok := arg.([]interface{}); ok {
+			values = append(values, flattenFormulaArgs(list)...)
+			continue
+		}
+		values = append(values, arg)
+	}
+	return values
+}
+
+// formulaAggregate 生成聚合函数，忽略空值
+func formulaAggregate(name string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		var values []interface{}
+		for _, value := range flattenFormulaArgs(args) {
+			if value != nil && value != "" {
+				values = append(values, value)
+			}
+		}
+
+		if name == "COUNT" {
+			return float64(len(values)), nil
+		}
+		if len(values) == 0 {
+			if name == "SUM" {
+				return 0.0, nil
+			}
+			return nil, nil
+		}
+
+		// MIN/MAX 支持时间
+		if name == "MIN" || name == "MAX" {
+			if _, ok := formulaTime(values[0]); ok && !isFormulaNumeric(values[0]) {
+				best, _ := formulaTime(values[0])
+				for _, value := range values[1:] {
+					t, ok := formulaTime(value)
+					if !ok {
+						return nil, fmt.Errorf("%s 的参数类型不一致", name)
+					}
+					if (name == "MIN" && t.Before(best)) || (name == "MAX" && t.After(best)) {
+						best = t
+					}
+				}
+				return best, nil
+			}
+		}
+
+		numbers := make([]float64, len(values))
+		for i, value := range values {
+			n, err := formulaNumber(value)
+			if err != nil {
+				return nil, err
+			}
+			numbers[i] = n
+		}
+
+		result := numbers[0]
+		switch name {
+		case "SUM", "AVG":
+			for _, n := range numbers[1:] {
+				result += n
+			}
+			if name == "AVG" {
+				result /= float64(len(numbers))
+			}
+		case "MIN":
+			for _, n := range numbers[1:] {
+				result = math.Min(result, n)
+			}
+		case "MAX":
+			for _, n := range numbers[1:] {
+				result = math.Max(result, n)
+			}
+		}
+		return result, nil
+	}
+}
+
+func isFormulaNumeric(value interface{}) bool {
+	_, err := formulaNumber(value)
+	return err == nil
+}
+
+// formulaMath 生成单参数数学函数
+func formulaMath(fn func(float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		n, err := formulaNumber(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(n), nil
+	}
+}
+
+// formulaString 生成单参数文本函数
+func formulaString(fn func(string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(formulaText(args[0])), nil
+	}
+}
+
+// formulaDatePart 生成提取日期部分的函数
+func formulaDatePart(fn func(time.Time) int) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		t, ok := formulaTime(args[0])
+		if !ok {
+			return nil, fmt.Errorf("'%s' 不是有效的时间", formulaText(args[0]))
+		}
+		return float64(fn(t)), nil
+	}
+}
+
+// RoundFloat 按指定小数位数四舍五入，位数限制在0到15之间
+func RoundFloat(value float64, digits int) float64 {
+	if digits < 0 {
+		digits = 0
+	} else if digits > 15 {
+		digits = 15
+	}
+	pow := math.Pow(10, float64(digits))
+	rounded := math.Round(value*pow) / pow
+	// 数值过大时乘积溢出，此时已没有可舍入的小数部分
+	if math.IsNaN(rounded) || math.IsInf(rounded, 0) {
+		return value
+	}
+	return rounded
+}
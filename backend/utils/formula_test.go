@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// formulaTestEnv 测试用的公式求值环境，related 的键为 "关联字段.目标字段"
+type formulaTestEnv struct {
+	values  map[string]interface{}
+	related map[string][]interface{}
+	err     error
+}
+
+func (e formulaTestEnv) FieldValue(name string) interface{} {
+	return e.values[name]
+}
+
+func (e formulaTestEnv) RelatedValues(field, target string) ([]interface{}, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.related[field+"."+target], nil
+}
+
+// evalFormula 解析并计算公式
+func evalFormula(expr string, env FormulaEnv) (interface{}, error) {
+	formula, err := ParseFormula(expr)
+	if err != nil {
+		return nil, err
+	}
+	return formula.Eval(env)
+}
+
+func TestFormulaPrecedence(t *testing.T) {
+	env := formulaTestEnv{values: map[string]interface{}{"price": 2.5, "quantity": 4, "name": "螺丝"}}
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"2 + 3 * 4", 14.0},
+		{"(2 + 3) * 4", 20.0},
+		{"10 - 4 - 3", 3.0},
+		{"24 / 4 / 2", 3.0},
+		{"2 * 7 % 4", 2.0},
+		{"-2 * 3", -6.0},
+		{"- -2", 2.0},
+		{"price * quantity + 1", 11.0},
+		{"{price} * ({quantity} - 1)", 7.5},
+		{"1 + 2 & 3", "33"},
+		{"name & '-' & quantity * 2", "螺丝-8"},
+		{"1 + 1 = 2", true},
+		{"2 * 3 > 5 && 1 < 0", false},
+		{"1 = 2 || 3 = 3 && 4 = 4", true},
+		{"1 = 1 OR 1 = 2 AND 1 = 2", true},
+		{"(1 = 1 OR 1 = 2) AND 1 = 2", false},
+		{"NOT 0 && 0", false},
+		{"!(1 > 2)", true},
+		{"3 <> 3", false},
+		{"3 == 3", true},
+		{"IF(quantity > 3, 'many', 'few')", "many"},
+		{"ROUND(10 / 3, 2) * 3", 9.99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFormula(tt.expr, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormulaDivisionByZero(t *testing.T) {
+	env := formulaTestEnv{values: map[string]interface{}{"zero": 0, "empty": "", "n": 6}}
+	tests := []struct {
+		expr    string
+		want    interface{}
+		wantErr bool
+	}{
+		{"1 / 0", nil, true},
+		{"5 % 0", nil, true},
+		{"n / zero", nil, true},
+		{"n / empty", nil, true},
+		{"n / missing", nil, true},
+		{"n / (3 - 3)", nil, true},
+		{"IF(zero = 0, 0, n / zero)", 0.0, false},
+		{"zero = 0 || n / zero > 1", true, false},
+		{"n / 4", 1.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFormula(tt.expr, env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormulaNullOperands(t *testing.T) {
+	env := formulaTestEnv{values: map[string]interface{}{"a": nil, "empty": "", "text": "abc", "n": 2}}
+	tests := []struct {
+		expr    string
+		want    interface{}
+		wantErr bool
+	}{
+		{"a + missing", nil, false},
+		{"a + 1", 1.0, false},
+		{"a * n", 0.0, false},
+		{"-a", nil, false},
+		{"empty + n", 2.0, false},
+		{"a & 'x'", "x", false},
+		{"a = ''", true, false},
+		{"a = null", true, false},
+		{"empty = null", true, false},
+		{"a != 0", true, false},
+		{"a > 0", false, false},
+		{"a < 0", false, false},
+		{"!a", true, false},
+		{"a && true", false, false},
+		{"ROUND(a)", nil, false},
+		{"ABS(a)", nil, false},
+		{"UPPER(a)", nil, false},
+		{"LEN(a)", 0.0, false},
+		{"COALESCE(a, empty, 'fallback')", "fallback", false},
+		{"IF(a, 1)", nil, false},
+		{"DATE(a)", nil, false},
+		{"text + n", "abc2", false},
+		{"text * n", nil, true},
+		{"VALUE(text)", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFormula(tt.expr, env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantMsg string
+	}{
+		{"空公式", "  ", "不能为空"},
+		{"未知函数", "FOO(1)", "不支持的函数 'FOO'"},
+		{"未知函数不区分大小写", "sum(1) + median(2)", "不支持的函数 'MEDIAN'"},
+		{"参数过少", "ROUND()", "参数个数不正确"},
+		{"参数过多", "IF(1, 2, 3, 4)", "参数个数不正确"},
+		{"无参函数传入参数", "NOW(1)", "参数个数不正确"},
+		{"表达式不完整", "1 +", "不完整"},
+		{"缺少右括号", "(1 + 2", "缺少 ')'"},
+		{"多余内容", "1 2", "多余内容"},
+		{"文本缺少引号", "'abc", "缺少结束引号"},
+		{"空字段引用", "{ }", "不能为空"},
+		{"字段引用缺少右括号", "{price", "缺少 '}'"},
+		{"关联字段缺少目标字段", "items.", "缺少关联记录的字段名"},
+		{"无效字符", "1 # 2", "无效字符"},
+		{"嵌套过深", strings.Repeat("(", formulaMaxDepth+1) + "1" + strings.Repeat(")", formulaMaxDepth+1), "嵌套层级过深"},
+		{"超出长度", strings.Repeat("1+", formulaMaxLength) + "1", "长度不能超过"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFormula(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("ParseFormula(%q) err = %v, want %q", tt.expr, err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestFormulaRefs(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []FormulaRef
+	}{
+		{"1 + 2", nil},
+		{"price * {数量}", []FormulaRef{{Field: "price"}, {Field: "数量"}}},
+		{"SUM(items.amount) + {items}.{单价}", []FormulaRef{{Field: "items", Target: "amount"}, {Field: "items", Target: "单价"}}},
+		{"IF(true, unknown_field, null)", []FormulaRef{{Field: "unknown_field"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			formula, err := ParseFormula(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formula.Refs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Refs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormulaUnknownField(t *testing.T) {
+	// 引用的字段是否存在由表单结构校验，求值时不存在的字段视为空值
+	env := formulaTestEnv{values: map[string]interface{}{"price": 3}}
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"unknown", nil},
+		{"price + unknown", 3.0},
+		{"unknown & 'x'", "x"},
+		{"COUNT(unknown.amount)", 0.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFormula(tt.expr, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormulaRelatedAggregates(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.Local) }
+	env := formulaTestEnv{
+		values: map[string]interface{}{"discount": 5},
+		related: map[string][]interface{}{
+			"items.amount": {10, "5", nil, "", 7.5},
+			"items.name":   {"A", "B", nil},
+			"items.due":    {"2024-01-03", day(1), "2024-01-02 08:00"},
+			"items.code":   {"x1", "y2"},
+			"empty.amount": {},
+		},
+	}
+	tests := []struct {
+		expr    string
+		want    interface{}
+		wantErr bool
+	}{
+		{"SUM(items.amount)", 22.5, false},
+		{"SUM(items.amount) - discount", 17.5, false},
+		{"AVG(items.amount)", 7.5, false},
+		{"MIN(items.amount)", 5.0, false},
+		{"MAX(items.amount)", 10.0, false},
+		{"COUNT(items.amount)", 3.0, false},
+		{"COUNT(items.name)", 2.0, false},
+		{"SUM(items.amount, 2.5, discount)", 30.0, false},
+		{"LEN(items.amount)", 5.0, false},
+		{"CONCAT(items.name)", "AB", false},
+		{"items.name & ''", "A, B, ", false},
+		{"MIN(items.due)", day(1), false},
+		{"MAX(items.due)", day(3), false},
+		{"SUM(empty.amount)", 0.0, false},
+		{"AVG(empty.amount)", nil, false},
+		{"MAX(empty.amount)", nil, false},
+		{"COUNT(empty.amount)", 0.0, false},
+		{"AND(items.code)", true, false},
+		{"OR(empty.amount)", false, false},
+		{"SUM(items.code)", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := evalFormula(tt.expr, env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("= %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("读取关联记录出错", func(t *testing.T) {
+		failing := formulaTestEnv{err: errors.New("database is locked")}
+		if _, err := evalFormula("SUM(items.amount)", failing); err == nil {
+			t.Error("Eval() succeeded, want error")
+		}
+		// 未选中的分支不读取关联记录
+		if got, err := evalFormula("IF(false, SUM(items.amount), 1)", failing); err != nil || got != 1.0 {
+			t.Errorf("= %v, %v, want 1", got, err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minHMACSecretLength HMAC密钥的最小长度(字节)
+const minHMACSecretLength = 32
+
+// JWTKey JWT签名或验证密钥，仅有公钥的密钥只能用于验证
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	signKey   interface{} // []byte、*rsa.PrivateKey 或 ed25519.PrivateKey
+	verifyKey interface{} // []byte、*rsa.PublicKey 或 ed25519.PublicKey
+}
+
+// CanSign 是否可用于签名
+func (k *JWTKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+var (
+	jwtKeysMu  sync.RWMutex
+	signingKey *JWTKey
+	verifyKeys = make(map[string]*JWTKey)
+)
+
+// NewHMACKey 创建HS256密钥，id为空时根据密钥内容生成
+func NewHMACKey(id string, secret []byte) (*JWTKey, error) {
+	if len(secret) < minHMACSecretLength {
+		return nil, fmt.Errorf("HMAC密钥长度不能少于 %d 字节", minHMACSecretLength)
+	}
+	if id == "" {
+		id = keyFingerprint(secret)
+	}
+	return &JWTKey{ID: id, Algorithm: AlgHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// ParsePEMKey 解析PEM格式的RSA或Ed25519私钥/公钥，id为空时根据公钥生成
+func ParsePEMKey(id string, data []byte) (*JWTKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是有效的PEM文件")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("不支持的PEM类型: %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &JWTKey{ID: id}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.signKey, key.verifyKey = AlgRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Algorithm, key.verifyKey = AlgRS256, k
+	case ed25519.PrivateKey:
+		key.Algorithm, key.signKey, key.verifyKey = AlgEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Algorithm, key.verifyKey = AlgEdDSA, k
+	default:
+		return nil, errors.New("仅支持RSA和Ed25519密钥")
+	}
+	if pub, ok := key.verifyKey.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, errors.New("RSA密钥长度不能少于2048位")
+	}
+
+	if key.ID == "" {
+		der, err := x509.MarshalPKIXPublicKey(key.verifyKey)
+		if err != nil {
+			return nil, err
+		}
+		key.ID = keyFingerprint(der)
+	}
+	return key, nil
+}
+
+// keyFingerprint 根据密钥内容生成密钥ID
+func keyFingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SetJWTKeys 设置签名密钥和其余仅用于验证的密钥(轮换前的旧密钥)
+func SetJWTKeys(active *JWTKey, others []*JWTKey) error {
+	if active == nil || !active.CanSign() {
+		return errors.New("签名密钥必须包含私钥")
+	}
+
+	keys := map[string]*JWTKey{active.ID: active}
+	for _, key := range others {
+		if _, exists := keys[key.ID]; exists {
+			return fmt.Errorf("密钥ID重复: %s", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	jwtKeysMu.Lock()
+	defer jwtKeysMu.Unlock()
+	signingKey = active
+	verifyKeys = keys
+	return nil
+}
+
+// currentSigningKey 当前签名密钥
+func currentSigningKey() (*JWTKey, error) {
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+	if signingKey == nil {
+		return nil, errors.New("未配置JWT签名密钥")
+	}
+	return signingKey, nil
+}
+
+// signingMethod 密钥对应的JWT签名方法
+func signingMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// lookupVerifyKey 按令牌头中的kid查找验证密钥，并检查算法是否与密钥一致
+func lookupVerifyKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	jwtKeysMu.RLock()
+	key, exists := verifyKeys[kid]
+	jwtKeysMu.RUnlock()
+
+	if !exists {
+		return nil, errors.New("unknown key id")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.verifyKey, nil
+}
+
+// JWKS 返回非对称验证密钥的JWK Set，HMAC密钥不公开
+func JWKS() map[string]interface{} {
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+
+	ids := make([]string, 0, len(verifyKeys))
+	for id := range verifyKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	keys := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		key := verifyKeys[id]
+		jwk := map[string]string{"kid": key.ID, "alg": key.Algorithm, "use": "sig"}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
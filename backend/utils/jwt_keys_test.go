@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pemKey 将私钥或公钥编码为PEM
+func pemKey(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	return pem.EncodeToMemory(block)
+}
+
+// useJWTKeys 临时设置JWT密钥，测试结束后恢复
+func useJWTKeys(t *testing.T, active *JWTKey, others ...*JWTKey) {
+	t.Helper()
+	jwtKeysMu.RLock()
+	previousSigning, previousVerify := signingKey, verifyKeys
+	jwtKeysMu.RUnlock()
+	t.Cleanup(func() {
+		jwtKeysMu.Lock()
+		signingKey, verifyKeys = previousSigning, previousVerify
+		jwtKeysMu.Unlock()
+	})
+	if err := SetJWTKeys(active, others); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signTestToken 使用指定算法、kid和密钥签发令牌
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseTokenKeySelection(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := pemKey(t, &rsaPrivate.PublicKey)
+
+	active, err := ParsePEMKey("rsa", pemKey(t, rsaPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edVerify, err := ParsePEMKey("ed", pemKey(t, edPublic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldHMAC, err := NewHMACKey("old", []byte("previous-hmac-secret-0123456789ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	useJWTKeys(t, active, edVerify, oldHMAC)
+
+	valid := Claims{UserID: 7, Username: "alice", SessionID: 3, RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	issued, err := GenerateToken(7, "alice", "user", 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := issued[:len(issued)-4] + strings.Repeat("A", 4)
+	if tampered == issued {
+		tampered = issued[:len(issued)-4] + strings.Repeat("B", 4)
+	}
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name   string
+		token  string
+		wantOK bool
+	}{
+		{"当前密钥签发", issued, true},
+		{"轮换前的HMAC密钥", signTestToken(t, jwt.SigningMethodHS256, "old", []byte("previous-hmac-secret-0123456789ab"), valid), true},
+		{"仅用于验证的Ed25519公钥", signTestToken(t, jwt.SigningMethodEdDSA, "ed", edPrivate, valid), true},
+		{"用RSA公钥作为HMAC密钥伪造", signTestToken(t, jwt.SigningMethodHS256, "rsa", rsaPEM, valid), false},
+		{"用RSA公钥DER作为HMAC密钥伪造", signTestToken(t, jwt.SigningMethodHS256, "rsa", x509.MarshalPKCS1PublicKey(&rsaPrivate.PublicKey), valid), false},
+		{"kid指向Ed25519密钥但使用RS256", signTestToken(t, jwt.SigningMethodRS256, "ed", rsaPrivate, valid), false},
+		{"kid指向HMAC密钥但使用RS256", signTestToken(t, jwt.SigningMethodRS256, "old", rsaPrivate, valid), false},
+		{"kid指向RSA密钥但使用EdDSA", signTestToken(t, jwt.SigningMethodEdDSA, "rsa", edPrivate, valid), false},
+		{"未知kid", signTestToken(t, jwt.SigningMethodRS256, "unknown", rsaPrivate, valid), false},
+		{"缺少kid", signTestToken(t, jwt.SigningMethodRS256, "", rsaPrivate, valid), false},
+		{"不支持的RS512", signTestToken(t, jwt.SigningMethodRS512, "rsa", rsaPrivate, valid), false},
+		{"alg为none", unsigned, false},
+		{"签名被篡改", tampered, false},
+		{"已过期", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, expired), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("ParseToken() err = %v, want ok %v", err, tt.wantOK)
+			}
+			if tt.wantOK && (claims.UserID != 7 || claims.SessionID != 3) {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+
+	t.Run("移除旧密钥后不再接受", func(t *testing.T) {
+		useJWTKeys(t, active)
+		if _, err := ParseToken(signTestToken(t, jwt.SigningMethodHS256, "old", []byte("previous-hmac-secret-0123456789ab"), valid)); err == nil {
+			t.Error("token signed by removed key accepted")
+		}
+	})
+}
+
+func TestJWTKeyValidation(t *testing.T) {
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHMACKey("", []byte("too-short")); err == nil {
+		t.Error("short HMAC secret accepted")
+	}
+	if _, err := ParsePEMKey("", pemKey(t, weakRSA)); err == nil {
+		t.Error("1024-bit RSA key accepted")
+	}
+	if _, err := ParsePEMKey("", []byte("not a pem")); err == nil {
+		t.Error("invalid PEM accepted")
+	}
+
+	verifyOnly, err := ParsePEMKey("", pemKey(t, edPublic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifyOnly.CanSign() || verifyOnly.ID == "" {
+		t.Errorf("public key = %+v", verifyOnly)
+	}
+	if err := SetJWTKeys(verifyOnly, nil); err == nil {
+		t.Error("public key accepted as signing key")
+	}
+
+	a, _ := NewHMACKey("dup", []byte("first-hmac-secret-0123456789abcdef"))
+	b, _ := NewHMACKey("dup", []byte("second-hmac-secret-0123456789abcde"))
+	if err := SetJWTKeys(a, []*JWTKey{b}); err == nil {
+		t.Error("duplicate key id accepted")
+	}
+}
+
+func TestJWKSHidesHMACKeys(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, _ := ParsePEMKey("rsa", pemKey(t, rsaPrivate))
+	hmacKey, _ := NewHMACKey("hmac", []byte("hmac-secret-0123456789abcdefghijk"))
+	useJWTKeys(t, hmacKey, rsaKey)
+
+	keys := JWKS()["keys"].([]map[string]string)
+	if len(keys) != 1 || keys[0]["kid"] != "rsa" || keys[0]["alg"] != AlgRS256 || keys[0]["kty"] != "RSA" {
+		t.Errorf("JWKS = %v", keys)
+	}
+}
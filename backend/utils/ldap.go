@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPInvalidCredentials 用户不存在或密码错误
+var ErrLDAPInvalidCredentials = errors.New("用户名或密码错误")
+
+// ldapDial 连接目录服务，测试中替换为模拟的目录
+var ldapDial = func(a *LDAPAuthenticator) (ldap.Client, error) {
+	return a.dial()
+}
+
+// LDAPAuthenticator 通过LDAP目录验证用户密码：先查找用户的DN，再以该DN和密码绑定
+type LDAPAuthenticator struct {
+	URL                string // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string // 查找用户使用的账号，为空时匿名查找
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // 查找用户的过滤条件，%s 替换为转义后的用户名，如 (uid=%s)
+	UsernameAttribute  string
+	EmailAttribute     string
+	GroupAttribute     string // 用户所属组的属性，如 memberOf
+	MatchGroupRDN      bool   // 组映射是否也匹配组DN第一个RDN的值，不同OU下的同名组会被视为同一个组
+	Timeout            time.Duration
+}
+
+// Authenticate 验证用户名和密码，返回目录中的用户信息
+// 组按属性的原值(通常为完整DN)返回；启用 MatchGroupRDN 时同时返回DN第一个RDN的值(如 cn=editors,ou=groups,... 还返回 editors)
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*ExternalIdentity, error) {
+	// 空密码会被目录服务视为匿名绑定而成功
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := ldapDial(a)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP服务账号绑定失败: %w", err)
+		}
+	}
+
+	attributes := []string{a.UsernameAttribute, a.EmailAttribute}
+	if a.GroupAttribute != "" {
+		attributes = append(attributes, a.GroupAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.timeout()/time.Second), false,
+		strings.ReplaceAll(a.UserFilter, "%s", ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP查找用户失败: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP用户绑定失败: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider: "ldap",
+		Subject:  entry.DN,
+		Username: entry.GetAttributeValue(a.UsernameAttribute),
+		Email:    entry.GetAttributeValue(a.EmailAttribute),
+		// 目录中的邮箱由管理员维护
+		EmailVerified: true,
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	if a.GroupAttribute != "" {
+		for _, value := range entry.GetAttributeValues(a.GroupAttribute) {
+			identity.Groups = append(identity.Groups, value)
+			if !a.MatchGroupRDN {
+				continue
+			}
+			if dn, err := ldap.ParseDN(value); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+				identity.Groups = append(identity.Groups, dn.RDNs[0].Attributes[0].Value)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// dial 连接目录服务，按设置启用StartTLS
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.InsecureSkipVerify}
+	if u, err := url.Parse(a.URL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+	conn, err := ldap.DialURL(a.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.timeout()}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接LDAP服务失败: %w", err)
+	}
+	conn.SetTimeout(a.timeout())
+
+	if a.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// timeout 单次请求的超时时间，默认10秒
+func (a *LDAPAuthenticator) timeout() time.Duration {
+	if a.Timeout > 0 {
+		return a.Timeout
+	}
+	return 10 * time.Second
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeEntry 模拟目录中的条目
+type fakeEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeDirectory 模拟的目录服务连接，只实现验证用户需要的操作
+type fakeDirectory struct {
+	ldap.Client
+	entries []fakeEntry
+	binds   []string // 成功绑定的DN
+}
+
+// Bind 与目录服务一致，空密码视为匿名绑定并成功
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if password == "" {
+		d.binds = append(d.binds, "")
+		return nil
+	}
+	for _, entry := range d.entries {
+		if entry.dn == dn && entry.password == password {
+			d.binds = append(d.binds, dn)
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+// Search 只支持 (uid=...) 形式的过滤条件
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		for _, uid := range entry.attributes["uid"] {
+			if req.Filter == "(uid="+ldap.EscapeFilter(uid)+")" {
+				attributes := make(map[string][]string)
+				for _, name := range req.Attributes {
+					if values, ok := entry.attributes[name]; ok {
+						attributes[name] = values
+					}
+				}
+				result.Entries = append(result.Entries, ldap.NewEntry(entry.dn, attributes))
+			}
+		}
+	}
+	if req.SizeLimit > 0 && len(result.Entries) > req.SizeLimit {
+		return result, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error { return nil }
+
+// useFakeDirectory 使用模拟的目录服务，返回连接次数
+func useFakeDirectory(t *testing.T, directory *fakeDirectory) *int {
+	t.Helper()
+	dials := 0
+	previous := ldapDial
+	ldapDial = func(*LDAPAuthenticator) (ldap.Client, error) {
+		dials++
+		directory.binds = nil
+		return directory, nil
+	}
+	t.Cleanup(func() { ldapDial = previous })
+	return &dials
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	const serviceDN = "cn=reader,dc=example,dc=com"
+	directory := &fakeDirectory{entries: []fakeEntry{
+		{dn: serviceDN, password: "service-pass"},
+		{dn: "uid=alice,ou=people,dc=example,dc=com", password: "alice-pass", attributes: map[string][]string{
+			"uid":      {"alice"},
+			"mail":     {"alice@example.com"},
+			"memberOf": {"cn=editors,ou=groups,dc=example,dc=com", "cn=staff,ou=other,dc=example,dc=com"},
+		}},
+		{dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-pass", attributes: map[string][]string{"uid": {"bob"}}},
+		{dn: "uid=bob,ou=contractors,dc=example,dc=com", password: "bob-pass", attributes: map[string][]string{"uid": {"bob"}}},
+	}}
+	dials := useFakeDirectory(t, directory)
+	authenticator := func(configure func(a *LDAPAuthenticator)) *LDAPAuthenticator {
+		a := &LDAPAuthenticator{BindDN: serviceDN, BindPassword: "service-pass", BaseDN: "dc=example,dc=com",
+			UserFilter: "(uid=%s)", UsernameAttribute: "uid", EmailAttribute: "mail", GroupAttribute: "memberOf"}
+		if configure != nil {
+			configure(a)
+		}
+		return a
+	}
+
+	t.Run("验证成功", func(t *testing.T) {
+		identity, err := authenticator(nil).Authenticate("alice", "alice-pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Subject != "uid=alice,ou=people,dc=example,dc=com" || identity.Username != "alice" || identity.Email != "alice@example.com" {
+			t.Errorf("identity = %+v", identity)
+		}
+		wantGroups := []string{"cn=editors,ou=groups,dc=example,dc=com", "cn=staff,ou=other,dc=example,dc=com"}
+		if !reflect.DeepEqual(identity.Groups, wantGroups) {
+			t.Errorf("groups = %v, want %v", identity.Groups, wantGroups)
+		}
+		if want := []string{serviceDN, identity.Subject}; !reflect.DeepEqual(directory.binds, want) {
+			t.Errorf("binds = %v, want %v", directory.binds, want)
+		}
+	})
+
+	t.Run("同时匹配组DN的第一个RDN", func(t *testing.T) {
+		identity, err := authenticator(func(a *LDAPAuthenticator) { a.MatchGroupRDN = true }).Authenticate("alice", "alice-pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"cn=editors,ou=groups,dc=example,dc=com", "editors", "cn=staff,ou=other,dc=example,dc=com", "staff"}
+		if !reflect.DeepEqual(identity.Groups, want) {
+			t.Errorf("groups = %v, want %v", identity.Groups, want)
+		}
+	})
+
+	tests := []struct {
+		name      string
+		configure func(a *LDAPAuthenticator)
+		username  string
+		password  string
+		wantDial  bool
+	}{
+		{"空密码不连接目录", nil, "alice", "", false},
+		{"空用户名不连接目录", nil, "", "alice-pass", false},
+		{"密码错误", nil, "alice", "wrong-pass", true},
+		{"用户不存在", nil, "nobody", "alice-pass", true},
+		{"用户名中的过滤字符被转义", nil, "*", "alice-pass", true},
+		{"匹配到多个用户", nil, "bob", "bob-pass", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *dials
+			_, err := authenticator(tt.configure).Authenticate(tt.username, tt.password)
+			if err != ErrLDAPInvalidCredentials {
+				t.Errorf("err = %v, want ErrLDAPInvalidCredentials", err)
+			}
+			if dialed := *dials > before; dialed != tt.wantDial {
+				t.Errorf("dialed = %v, want %v", dialed, tt.wantDial)
+			}
+		})
+	}
+
+	t.Run("服务账号绑定失败", func(t *testing.T) {
+		_, err := authenticator(func(a *LDAPAuthenticator) { a.BindPassword = "wrong" }).Authenticate("alice", "alice-pass")
+		if err == nil || err == ErrLDAPInvalidCredentials || !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			t.Errorf("err = %v, want service bind error", err)
+		}
+		if len(directory.binds) != 0 {
+			t.Errorf("binds = %v", directory.binds)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage 邮件内容
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string // 纯文本
+}
+
+// Mailer 邮件发送驱动
+type Mailer interface {
+	Send(msg MailMessage) error
+}
+
+var (
+	mailerMu sync.RWMutex
+	mailer   Mailer = LogMailer{}
+)
+
+// SetMailer 设置邮件发送驱动
+func SetMailer(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = m
+}
+
+// SendMail 使用当前驱动发送邮件
+func SendMail(msg MailMessage) error {
+	mailerMu.RLock()
+	m := mailer
+	mailerMu.RUnlock()
+	return m.Send(msg)
+}
+
+// LogMailer 只把邮件写入日志，用于开发环境
+type LogMailer struct{}
+
+// Send 实现Mailer接口
+func (LogMailer) Send(msg MailMessage) error {
+	log.Printf("邮件(未发送) 收件人: %s 主题: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTP连接加密方式
+const (
+	SMTPSecurityNone     = "none"     // 不加密
+	SMTPSecurityStartTLS = "starttls" // 升级为TLS，服务器不支持时不发送
+	SMTPSecurityTLS      = "tls"      // 直接使用TLS连接(通常为465端口)
+)
+
+// SMTPMailer 通过SMTP服务器发送邮件
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string // 为空时不认证
+	Password string
+	From     string
+	Security string
+	Timeout  time.Duration
+
+	// TLSConfig 为空时按 Host 校验服务器证书，使用内部CA时可指定 RootCAs
+	TLSConfig *tls.Config
+}
+
+// Send 实现Mailer接口
+func (m *SMTPMailer) Send(msg MailMessage) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(m.From, "\r\n") {
+		return errors.New("邮件地址无效")
+	}
+
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	if m.TLSConfig != nil {
+		tlsConfig = m.TLSConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = m.Host
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if m.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	// 服务器未声明STARTTLS时不降级为明文，避免中间人去掉该扩展后窃取认证信息和邮件内容
+	if m.Security == SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP服务器不支持STARTTLS，如需明文发送请将 SMTP_SECURITY 设置为 none")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMailData(m.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMailData 生成邮件原文，主题和正文按UTF-8编码
+func buildMailData(from string, msg MailMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMail 测试SMTP服务收到的邮件
+type fakeMail struct {
+	From string
+	To   string
+	Data string
+	TLS  bool
+}
+
+// fakeSMTPServer 本地SMTP服务，支持STARTTLS、直接TLS和AUTH PLAIN
+type fakeSMTPServer struct {
+	Addr string
+
+	ln                net.Listener
+	tlsConfig         *tls.Config
+	advertiseStartTLS bool // 是否声明STARTTLS
+
+	mu    sync.Mutex
+	mails []fakeMail
+	auths []string // 收到的认证信息，解码后的 "\x00用户名\x00密码"
+}
+
+// newFakeSMTPServer 启动测试SMTP服务，implicitTLS 为 true 时连接建立后直接TLS握手
+func newFakeSMTPServer(t *testing.T, implicitTLS, advertiseStartTLS bool) (*fakeSMTPServer, *x509.CertPool) {
+	t.Helper()
+	// 借用 httptest 的自签名证书，证书对 127.0.0.1 有效
+	certServer := httptest.NewTLSServer(nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(certServer.Certificate())
+	tlsConfig := &tls.Config{Certificates: certServer.TLS.Certificates}
+	certServer.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	s := &fakeSMTPServer{Addr: ln.Addr().String(), ln: ln, tlsConfig: tlsConfig, advertiseStartTLS: advertiseStartTLS}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, implicitTLS)
+		}
+	}()
+	return s, pool
+}
+
+// serve 处理一个SMTP会话
+func (s *fakeSMTPServer) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	var current fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.advertiseStartTLS && !secure {
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250-STARTTLS")
+			} else {
+				tp.PrintfLine("250-fake")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			if !s.advertiseStartTLS || secure {
+				tp.PrintfLine("502 not supported")
+				continue
+			}
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, secure = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			s.mu.Lock()
+			s.auths = append(s.auths, string(decoded))
+			s.mu.Unlock()
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			current = fakeMail{From: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), TLS: secure}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			current.To = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, current)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+// received 返回收到的邮件和认证信息
+func (s *fakeSMTPServer) received() ([]fakeMail, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeMail(nil), s.mails...), append([]string(nil), s.auths...)
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	tests := []struct {
+		name              string
+		security          string
+		implicitTLS       bool
+		advertiseStartTLS bool
+		wantErr           bool
+		wantTLS           bool
+	}{
+		{"STARTTLS", SMTPSecurityStartTLS, false, true, false, true},
+		{"服务器不支持STARTTLS时拒绝明文发送", SMTPSecurityStartTLS, false, false, true, false},
+		{"直接TLS连接", SMTPSecurityTLS, true, false, false, true},
+		{"明确设置为明文", SMTPSecurityNone, false, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, pool := newFakeSMTPServer(t, tt.implicitTLS, tt.advertiseStartTLS)
+			host, port, _ := net.SplitHostPort(server.Addr)
+			portNumber, _ := net.LookupPort("tcp", port)
+			mailer := &SMTPMailer{
+				Host:      host,
+				Port:      portNumber,
+				Username:  "mailer",
+				Password:  "smtp-pass",
+				From:      "noreply@example.com",
+				Security:  tt.security,
+				Timeout:   5 * time.Second,
+				TLSConfig: &tls.Config{RootCAs: pool},
+			}
+
+			err := mailer.Send(MailMessage{To: "alice@example.com", Subject: "重置密码", Body: "reset token"})
+			mails, auths := server.received()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Send() succeeded, want error")
+				}
+				if len(mails) != 0 || len(auths) != 0 {
+					t.Errorf("server received %d mails and %d auths in plaintext", len(mails), len(auths))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mails) != 1 {
+				t.Fatalf("server received %d mails, want 1", len(mails))
+			}
+			got := mails[0]
+			if got.From != "noreply@example.com" || got.To != "alice@example.com" || got.TLS != tt.wantTLS {
+				t.Errorf("mail = %+v", got)
+			}
+			if len(auths) != 1 || auths[0] != "\x00mailer\x00smtp-pass" {
+				t.Errorf("auth = %q", auths)
+			}
+			if !strings.Contains(got.Data, base64.StdEncoding.EncodeToString([]byte("reset token"))) {
+				t.Errorf("data = %q", got.Data)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	server, _ := newFakeSMTPServer(t, false, false)
+	host, port, _ := net.SplitHostPort(server.Addr)
+	portNumber, _ := net.LookupPort("tcp", port)
+	mailer := &SMTPMailer{Host: host, Port: portNumber, From: "noreply@example.com", Security: SMTPSecurityNone}
+
+	if err := mailer.Send(MailMessage{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "s", Body: "b"}); err == nil {
+		t.Error("Send() accepted a recipient with CRLF")
+	}
+	if mails, _ := server.received(); len(mails) != 0 {
+		t.Errorf("server received %d mails, want 0", len(mails))
+	}
+}
+
+func TestBuildMailData(t *testing.T) {
+	body := strings.Repeat("密码重置链接 https://example.com/reset?token=abc ", 10)
+	data := buildMailData("noreply@example.com", MailMessage{To: "alice@example.com", Subject: "重置密码 - Material", Body: body})
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line longer than 78: %q", line)
+		}
+	}
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("From"); got != "noreply@example.com" {
+		t.Errorf("From = %q", got)
+	}
+	if got := msg.Header.Get("To"); got != "alice@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "重置密码 - Material" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if _, err := mail.ParseDate(msg.Header.Get("Date")); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != body {
+		t.Errorf("body = %q, want %q", decoded, body)
+	}
+}
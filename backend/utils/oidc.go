@@ -0,0 +1,384 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcKeysRefreshInterval 遇到未知kid时重新获取JWKS的最小间隔，避免被伪造的令牌频繁触发
+const oidcKeysRefreshInterval = time.Minute
+
+// ExternalIdentity 身份提供方返回的用户信息
+type ExternalIdentity struct {
+	Provider string // oidc 或 ldap
+	Subject  string // 身份提供方中的唯一标识
+	Username string
+	Email    string
+	Groups   []string // 身份提供方中的组
+	// EmailVerified 邮箱是否经过身份提供方验证，只有验证过的邮箱才能用于关联本地账号
+	EmailVerified bool
+}
+
+// OIDCProvider OpenID Connect 身份提供方，使用授权码模式(PKCE)登录
+type OIDCProvider struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string // 用户名对应的声明，如 preferred_username
+	EmailClaim    string
+	GroupsClaim   string
+	HTTPClient    *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// oidcDiscovery 身份提供方的 /.well-known/openid-configuration
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// PKCEChallenge 计算PKCE的S256 code_challenge
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange 使用授权码换取令牌并校验ID令牌，返回其中的用户信息
+func (p *OIDCProvider) Exchange(code, codeVerifier, nonce string) (*ExternalIdentity, error) {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || token.IDToken == "" {
+		if token.Error != "" {
+			return nil, fmt.Errorf("换取令牌失败: %s %s", token.Error, token.ErrorDescription)
+		}
+		return nil, fmt.Errorf("换取令牌失败: HTTP %d", status)
+	}
+
+	claims, err := p.verifyIDToken(token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &ExternalIdentity{
+		Provider: "oidc",
+		Subject:  claimString(claims, "sub"),
+		Username: claimString(claims, p.UsernameClaim),
+		Email:    claimString(claims, p.EmailClaim),
+		Groups:   claimStrings(claims, p.GroupsClaim),
+	}
+	// email_verified 只对应标准的 email 声明，使用其他邮箱声明时视为未验证
+	identity.EmailVerified = p.EmailClaim == "email" && claimBool(claims, "email_verified")
+	if identity.Subject == "" {
+		return nil, errors.New("ID令牌缺少sub")
+	}
+	return identity, nil
+}
+
+// verifyIDToken 校验ID令牌的签名、签发者、受众、有效期和nonce
+func (p *OIDCProvider) verifyIDToken(raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, p.lookupKey,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID令牌无效: %w", err)
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("ID令牌的nonce不匹配")
+	}
+	// 有多个受众时 azp 必须是本应用
+	if aud, _ := claims.GetAudience(); len(aud) > 1 && claimString(claims, "azp") != p.ClientID {
+		return nil, errors.New("ID令牌的azp不匹配")
+	}
+	return claims, nil
+}
+
+// lookupKey 按kid查找身份提供方的验证密钥，未知kid时重新获取JWKS
+func (p *OIDCProvider) lookupKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	key, exists := p.keys[kid]
+	stale := time.Since(p.keysFetchedAt) > oidcKeysRefreshInterval
+	p.mu.Unlock()
+
+	if !exists && stale {
+		if err := p.refreshKeys(); err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		key, exists = p.keys[kid]
+		p.mu.Unlock()
+	}
+	if !exists {
+		return nil, errors.New("unknown key id")
+	}
+	return key, nil
+}
+
+// refreshKeys 获取身份提供方的JWKS
+func (p *OIDCProvider) refreshKeys() error {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("获取JWKS失败: HTTP %d", status)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// getDiscovery 获取并缓存身份提供方的配置
+func (p *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	d = &oidcDiscovery{}
+	status, err := p.doJSON(req, d)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("获取OIDC配置失败: HTTP %d", status)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("OIDC配置的issuer %q 与设置的 %q 不一致", d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OIDC配置不完整")
+	}
+
+	p.mu.Lock()
+	p.discovery = d
+	p.mu.Unlock()
+	return d, nil
+}
+
+// doJSON 发送请求并解析JSON响应，返回HTTP状态码
+func (p *OIDCProvider) doJSON(req *http.Request, v interface{}) (int, error) {
+	client := p.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("身份提供方返回的内容无法解析: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// jsonWebKey JWK Set 中的公钥
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey 解析RSA、EC或Ed25519公钥
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("不支持的曲线")
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("不支持的OKP密钥")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("不支持的密钥类型")
+}
+
+// claimString 读取字符串声明
+func claimString(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimBool 读取布尔声明，部分身份提供方以字符串 "true" 返回
+func claimBool(claims jwt.MapClaims, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// claimStrings 读取字符串或字符串数组声明
+func claimStrings(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
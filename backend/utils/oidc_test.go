@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP 测试用的身份提供方，令牌接口返回以 claims 签发的ID令牌
+type testIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := &OIDCProvider{
+		Issuer:        idp.URL,
+		ClientID:      "material",
+		RedirectURL:   "http://localhost/callback",
+		UsernameClaim: "preferred_username",
+		EmailClaim:    "email",
+		GroupsClaim:   "groups",
+	}
+
+	tests := []struct {
+		name              string
+		extra             jwt.MapClaims
+		emailClaim        string
+		wantGroups        []string
+		wantEmailVerified bool
+	}{
+		{"组数组和已验证邮箱", jwt.MapClaims{"groups": []string{"editors", "cn=design,ou=groups,dc=example,dc=com"}, "email_verified": true},
+			"email", []string{"editors", "cn=design,ou=groups,dc=example,dc=com"}, true},
+		{"单个组和字符串形式的验证标记", jwt.MapClaims{"groups": "editors", "email_verified": "true"}, "email", []string{"editors"}, true},
+		{"未验证的邮箱", jwt.MapClaims{"email_verified": false}, "email", nil, false},
+		{"缺少验证标记", jwt.MapClaims{}, "email", nil, false},
+		{"其他字符串视为未验证", jwt.MapClaims{"email_verified": "yes"}, "email", nil, false},
+		{"使用非标准邮箱声明", jwt.MapClaims{"email_verified": true, "mail": "alice@example.com"}, "mail", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = jwt.MapClaims{
+				"iss":                idp.URL,
+				"aud":                "material",
+				"sub":                "u-1",
+				"exp":                time.Now().Add(time.Minute).Unix(),
+				"nonce":              "n-1",
+				"preferred_username": "alice",
+				"email":              "alice@example.com",
+			}
+			for k, v := range tt.extra {
+				idp.claims[k] = v
+			}
+			provider.EmailClaim = tt.emailClaim
+
+			identity, err := provider.Exchange("good-code", "verifier", "n-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Subject != "u-1" || identity.Username != "alice" || identity.Email != "alice@example.com" {
+				t.Errorf("identity = %+v", identity)
+			}
+			if !reflect.DeepEqual(identity.Groups, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", identity.Groups, tt.wantGroups)
+			}
+			if identity.EmailVerified != tt.wantEmailVerified {
+				t.Errorf("email verified = %v, want %v", identity.EmailVerified, tt.wantEmailVerified)
+			}
+		})
+	}
+
+	t.Run("nonce不匹配", func(t *testing.T) {
+		if _, err := provider.Exchange("good-code", "verifier", "n-2"); err == nil {
+			t.Error("exchange succeeded with wrong nonce")
+		}
+	})
+	t.Run("授权码无效", func(t *testing.T) {
+		if _, err := provider.Exchange("bad-code", "verifier", "n-1"); err == nil {
+			t.Error("exchange succeeded with invalid code")
+		}
+	})
+}
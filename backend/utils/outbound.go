@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress 目标是本机、内网或链路本地地址
+var ErrPrivateAddress = errors.New("不允许访问本机或内网地址")
+
+// nonPublicPrefixes 除标准库已识别的私有、回环和链路本地地址外，其他不可从公网访问的地址段
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64，可映射到内网IPv4地址
+}
+
+// HostAllowlist 管理员允许访问的主机，可以是主机名、IP或CIDR，允许的主机不受内网地址限制
+type HostAllowlist struct {
+	hosts    map[string]bool
+	prefixes []netip.Prefix
+}
+
+// ParseHostAllowlist 解析逗号分隔的主机名、IP或CIDR，返回无法解析的项
+func ParseHostAllowlist(value string) (*HostAllowlist, []string) {
+	list := &HostAllowlist{hosts: map[string]bool{}}
+	var invalid []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				invalid = append(invalid, item)
+				continue
+			}
+			list.prefixes = append(list.prefixes, prefix.Masked())
+			continue
+		}
+		if ip, err := netip.ParseAddr(item); err == nil {
+			list.prefixes = append(list.prefixes, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		list.hosts[strings.TrimSuffix(item, ".")] = true
+	}
+	return list, invalid
+}
+
+// AllowsHost 主机名是否在允许列表中
+func (l *HostAllowlist) AllowsHost(host string) bool {
+	if l == nil {
+		return false
+	}
+	return l.hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+}
+
+// AllowsIP IP是否在允许的地址段中
+func (l *HostAllowlist) AllowsIP(ip netip.Addr) bool {
+	if l == nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublicIP 是否为可从公网访问的单播地址
+func IsPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckOutboundHost 保存回调地址时提前拒绝明显指向本机或内网的主机，实际连接时仍会按解析后的IP检查
+func CheckOutboundHost(host string, allowlist *HostAllowlist) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if allowlist.AllowsHost(host) {
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if IsPublicIP(ip) || allowlist.AllowsIP(ip) {
+			return nil
+		}
+		return ErrPrivateAddress
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// NewOutboundHTTPClient 访问用户提供地址的HTTP客户端：
+// 连接时检查解析后的IP，拒绝本机、内网和链路本地地址(允许列表中的主机和地址段除外)，不使用代理，不跟随重定向
+// allowlist 在每次连接时调用，管理员修改设置后立即生效
+func NewOutboundHTTPClient(timeout time.Duration, allowlist func() *HostAllowlist) *http.Client {
+	transport := &http.Transport{
+		Proxy:                 nil,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			list := allowlist()
+			dialer := &net.Dialer{Timeout: timeout}
+			if !list.AllowsHost(host) {
+				dialer.Control = func(network, address string, _ syscall.RawConn) error {
+					addrPort, err := netip.ParseAddrPort(address)
+					if err != nil {
+						return err
+					}
+					if ip := addrPort.Addr(); !IsPublicIP(ip) && !list.AllowsIP(ip) {
+						return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+					}
+					return nil
+				}
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
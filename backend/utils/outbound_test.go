@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOutboundHost(t *testing.T) {
+	allowlist, invalid := ParseHostAllowlist("hooks.internal, 10.0.5.0/24, 192.168.1.10, not/a/cidr")
+	if len(invalid) != 1 || invalid[0] != "not/a/cidr" {
+		t.Fatalf("invalid = %v, want [not/a/cidr]", invalid)
+	}
+
+	tests := []struct {
+		host      string
+		allowlist *HostAllowlist
+		wantErr   bool
+	}{
+		{"example.com", nil, false},
+		{"93.184.216.34", nil, false},
+		{"localhost", nil, true},
+		{"api.localhost", nil, true},
+		{"127.0.0.1", nil, true},
+		{"169.254.169.254", nil, true},
+		{"::1", nil, true},
+		{"10.0.5.7", nil, true},
+		{"10.0.5.7", allowlist, false},
+		{"10.0.6.7", allowlist, true},
+		{"192.168.1.10", allowlist, false},
+		{"HOOKS.internal.", allowlist, false},
+	}
+	for _, tt := range tests {
+		err := CheckOutboundHost(tt.host, tt.allowlist)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckOutboundHost(%q) error = %v, want error %v", tt.host, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOutboundHTTPClient(t *testing.T) {
+	var redirected bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// 同一服务按主机名访问，用于测试按主机名允许
+	byName := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name       string
+		allow      string
+		url        string
+		wantStatus int
+		wantErr    error
+	}{
+		{"未允许时拒绝连接回环地址", "", server.URL, 0, ErrPrivateAddress},
+		{"解析后的地址同样检查", "", byName, 0, ErrPrivateAddress},
+		{"允许的IP", "127.0.0.1", server.URL, http.StatusNoContent, nil},
+		{"允许的地址段", "127.0.0.0/8", server.URL, http.StatusNoContent, nil},
+		{"允许的主机名", "localhost", byName, http.StatusNoContent, nil},
+		{"允许的主机名不影响按IP访问", "localhost", server.URL, 0, ErrPrivateAddress},
+		{"不跟随重定向", "127.0.0.1", server.URL + "/redirect", http.StatusFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist, _ := ParseHostAllowlist(tt.allow)
+			client := NewOutboundHTTPClient(5*time.Second, func() *HostAllowlist { return allowlist })
+			resp, err := client.Get(tt.url)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	if redirected {
+		t.Error("redirect was followed")
+	}
+}
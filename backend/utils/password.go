@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes bcrypt只使用密码的前72个字节
+const maxPasswordBytes = 72
+
+// PasswordPolicy 密码强度策略
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`
+	RequireUpper  bool `json:"require_upper"`
+	RequireLower  bool `json:"require_lower"`
+	RequireDigit  bool `json:"require_digit"`
+	RequireSymbol bool `json:"require_symbol"`
+}
+
+// passwordPolicy 当前密码策略，由配置加载
+var passwordPolicy = PasswordPolicy{MinLength: 8, RequireDigit: true}
+
+// commonPasswords 常见弱密码，无论策略如何都不允许使用
+var commonPasswords = map[string]bool{
+	"12345678": true, "123456789": true, "1234567890": true, "password": true, "password1": true,
+	"password123": true, "qwerty123": true, "11111111": true, "88888888": true, "abc12345": true,
+	"admin123": true, "admin1234": true, "iloveyou": true, "welcome1": true, "a1234567": true,
+}
+
+// SetPasswordPolicy 设置密码策略
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// GetPasswordPolicy 获取当前密码策略
+func GetPasswordPolicy() PasswordPolicy {
+	return passwordPolicy
+}
+
+// ValidatePassword 按密码策略校验密码强度，密码不能包含用户名
+func ValidatePassword(password, username string) error {
+	policy := passwordPolicy
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return fmt.Errorf("密码长度不能少于 %d 个字符", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("密码长度不能超过 %d 个字节", maxPasswordBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		return errors.New("密码必须包含大写字母")
+	}
+	if policy.RequireLower && !lower {
+		return errors.New("密码必须包含小写字母")
+	}
+	if policy.RequireDigit && !digit {
+		return errors.New("密码必须包含数字")
+	}
+	if policy.RequireSymbol && !symbol {
+		return errors.New("密码必须包含特殊字符")
+	}
+
+	lowered := strings.ToLower(password)
+	if commonPasswords[lowered] {
+		return errors.New("密码过于简单，请更换")
+	}
+	if username != "" && len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+		return errors.New("密码不能包含用户名")
+	}
+	return nil
+}
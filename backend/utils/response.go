@@ -74,4 +74,12 @@ func PageResponse(c *gin.Context, list interface{}, total int64, page, pageSize
 			Pages:    pages,
 		},
 	})
-}
\ No newline at end of file
+}
+
+// TooManyRequestsResponse 请求过于频繁响应
+func TooManyRequestsResponse(c *gin.Context, message string) {
+	c.JSON(http.StatusTooManyRequests, models.ApiResponse{
+		Code:    429,
+		Message: message,
+	})
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP参数(RFC 6238)，与常见的身份验证器应用默认值一致
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 // 秒
+	totpSkew   = 1  // 允许前后各一个时间窗口的时钟误差
+)
+
+// totpEncoding 密钥使用不带填充的Base32编码
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成160位的TOTP密钥(Base32)
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPProvisioningURI 生成身份验证器应用扫码使用的 otpauth:// 地址
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(TOTPPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpCode 计算指定时间窗口的验证码
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000)
+}
+
+// ValidateTOTP 校验验证码，返回匹配的时间窗口
+// 不大于 lastStep 的时间窗口视为已使用，同一验证码不能重复使用
+func ValidateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / TOTPPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes 生成n个恢复码，格式为 xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		token, err := RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, token[:5]+"-"+token[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeOTPCode 去除用户输入的验证码或恢复码中的空格和连字符
+func NormalizeOTPCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// IsTOTPCode 判断输入是否为身份验证器生成的数字验证码
+func IsTOTPCode(code string) bool {
+	if len(code) != TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录B的SHA1测试密钥 "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 测试向量取后6位，1111111109 位于第 37037036 个时间窗口
+	const (
+		at   = 1111111109
+		code = "081804"
+		step = int64(at / TOTPPeriod)
+	)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"RFC向量 59", rfc6238Secret, "287082", 59, 0, 1, true},
+		{"RFC向量 1234567890", rfc6238Secret, "005924", 1234567890, 0, 1234567890 / TOTPPeriod, true},
+		{"RFC向量 2000000000", rfc6238Secret, "279037", 2000000000, 0, 2000000000 / TOTPPeriod, true},
+		{"当前窗口", rfc6238Secret, code, at, 0, step, true},
+		{"小写密钥", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code, at, 0, step, true},
+		{"慢一个窗口", rfc6238Secret, code, at + TOTPPeriod, 0, step, true},
+		{"快一个窗口", rfc6238Secret, code, at - TOTPPeriod, 0, step, true},
+		{"慢两个窗口", rfc6238Secret, code, at + 2*TOTPPeriod, 0, 0, false},
+		{"快两个窗口", rfc6238Secret, code, at - 2*TOTPPeriod, 0, 0, false},
+		{"重复使用同一窗口", rfc6238Secret, code, at, step, 0, false},
+		{"已使用更晚的窗口", rfc6238Secret, code, at, step + 1, 0, false},
+		{"上次使用前一窗口", rfc6238Secret, code, at, step - 1, step, true},
+		{"错误的验证码", rfc6238Secret, "081805", at, 0, 0, false},
+		{"长度不对", rfc6238Secret, "81804", at, 0, 0, false},
+		{"8位验证码", rfc6238Secret, "07081804", at, 0, 0, false},
+		{"无效密钥", "not-base32!", code, at, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.now, 0), tt.lastStep)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = %d, %v, want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	// 按登录流程保存每次匹配的窗口，同一验证码在有效期内只能使用一次
+	now := time.Unix(1111111109, 0)
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	current := now.Unix() / TOTPPeriod
+
+	var lastStep int64
+	step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current), now, lastStep)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	lastStep = step
+
+	// 时钟误差范围内再次提交，或提交更早窗口的验证码
+	for _, offset := range []time.Duration{0, 10 * time.Second, TOTPPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current), now.Add(offset), lastStep); ok {
+			t.Errorf("replay after %v accepted", offset)
+		}
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current-1), now, lastStep); ok {
+		t.Error("earlier window accepted after later one was used")
+	}
+
+	// 下一个窗口的验证码仍可使用
+	if step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+1), now, lastStep); !ok || step != current+1 {
+		t.Errorf("next window = %d, %v, want %d, true", step, ok, current+1)
+	}
+}
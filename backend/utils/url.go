@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBaseURL 根据请求获取服务访问的基础URL（协议+主机）
+func GetBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+
+	host := c.Request.Host
+	if forwardedHost := c.GetHeader("X-Forwarded-Host"); forwardedHost != "" {
+		host = strings.TrimSpace(strings.Split(forwardedHost, ",")[0])
+	}
+
+	return scheme + "://" + host
+}
+
+// ToAbsoluteURL 将相对路径转换为绝对URL，已是绝对URL的直接返回
+func ToAbsoluteURL(baseURL, path string) string {
+	if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return strings.TrimSuffix(baseURL, "/") + path
+}
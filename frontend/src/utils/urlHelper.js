@@ -22,4 +22,4 @@ export function toAbsoluteUrl(url) {
     // 不以/开头的路径，添加基础URL和/
     return baseUrl + '/' + url
   }
-}
\ No newline at end of file
+}